@@ -41,11 +41,14 @@ func Start(ctx context.Context, cfg *config.SnapshotterConfig) error {
 		ListeningSocketUID:  cfg.UID,
 		ListeningSocketGID:  cfg.GID,
 		EnableCRIKeychain:   cfg.RemoteConfig.AuthConfig.EnableCRIKeychain,
+		RecordPullNamespaces: cfg.RemoteConfig.AuthConfig.EnableKubeconfigKeychain &&
+			len(cfg.RemoteConfig.AuthConfig.KubeSecretNamespaces) > 0,
 		ImageServiceAddress: cfg.RemoteConfig.AuthConfig.ImageServiceAddress,
 	}
 
 	if cfg.RemoteConfig.AuthConfig.EnableKubeconfigKeychain {
-		if err := auth.InitKubeSecretListener(ctx, cfg.RemoteConfig.AuthConfig.KubeconfigPath); err != nil {
+		if err := auth.InitKubeSecretListener(ctx, cfg.RemoteConfig.AuthConfig.KubeconfigPath,
+			cfg.RemoteConfig.AuthConfig.KubeSecretNamespaces); err != nil {
 			return err
 		}
 	}
@@ -59,6 +62,41 @@ func Start(ctx context.Context, cfg *config.SnapshotterConfig) error {
 		}
 	}
 
+	if f := cfg.RemoteConfig.AuthConfig.LabelEncryptionKeyFile; f != "" {
+		if err := auth.InitLabelEncryption(f, cfg.RemoteConfig.AuthConfig.RequireEncryptedLabels); err != nil {
+			return errors.Wrap(err, "failed to initialize label encryption")
+		}
+	}
+
+	if f := cfg.RemoteConfig.AuthConfig.AuthFile; f != "" {
+		if err := auth.InitAuthFileProvider(f); err != nil {
+			return errors.Wrap(err, "failed to initialize auth file provider")
+		}
+	}
+
+	if helpers := cfg.RemoteConfig.AuthConfig.CredentialHelpers; len(helpers) > 0 {
+		auth.InitCredentialHelperProvider(helpers, cfg.RemoteConfig.AuthConfig.StoreRenewedCredentials)
+	}
+
+	if cfg.RemoteConfig.AuthConfig.EnableGCPWorkloadIdentity {
+		auth.InitGCPProvider()
+	}
+
+	if cfg.RemoteConfig.AuthConfig.EnableAzureManagedIdentity {
+		auth.InitAzureProvider(cfg.RemoteConfig.AuthConfig.AzureClientID)
+	}
+
+	if ttl := cfg.RemoteConfig.AuthConfig.KeyChainCacheTTL; ttl > 0 {
+		auth.InitKeyChainCache(ttl)
+	}
+
+	if cfg.RemoteConfig.AuthConfig.CredentialServiceAddress != "" {
+		if err := auth.InitGRPCProvider(cfg.RemoteConfig.AuthConfig.CredentialServiceAddress,
+			cfg.RemoteConfig.AuthConfig.CredentialServiceTimeout); err != nil {
+			return errors.Wrap(err, "failed to initialize gRPC credential provider")
+		}
+	}
+
 	return Serve(ctx, rs, opt, stopSignal)
 }
 
@@ -67,7 +105,9 @@ type ServeOptions struct {
 	ListeningSocketUID  int
 	ListeningSocketGID  int
 	EnableCRIKeychain   bool
-	ImageServiceAddress string
+	// Serve the CRI image proxy only to record the pod namespace of pulls.
+	RecordPullNamespaces bool
+	ImageServiceAddress  string
 }
 
 func Serve(ctx context.Context, sn snapshots.Snapshotter, options ServeOptions, stop <-chan struct{}) error {
@@ -91,6 +131,8 @@ func Serve(ctx context.Context, sn snapshots.Snapshotter, options ServeOptions,
 
 	if options.EnableCRIKeychain {
 		auth.AddImageProxy(ctx, rpc, options.ImageServiceAddress)
+	} else if options.RecordPullNamespaces {
+		auth.AddPullNamespaceProxy(ctx, rpc, options.ImageServiceAddress)
 	}
 
 	go func() {
@@ -8,7 +8,11 @@
 package config
 
 import (
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"dario.cat/mergo"
@@ -155,6 +159,11 @@ type DaemonConfig struct {
 	ThreadsNumber    int    `toml:"threads_number"`
 	LogRotationSize  int    `toml:"log_rotation_size"`
 	FailoverPolicy   string `toml:"failover_policy"`
+	// Default the cache work dir of the nydusd configuration template to <root>/cache
+	// when it's unset, so that all the state lives under the snapshotter root.
+	DefaultWorkDirFromRoot bool `toml:"default_work_dir_from_root"`
+	// Watch the nydusd configuration template and push changes to running daemons.
+	ReloadConfigOnChange bool `toml:"reload_config_on_change"`
 }
 
 type LoggingConfig struct {
@@ -201,6 +210,10 @@ type AuthConfig struct {
 	// based on kubeconfig or ServiceAccount
 	EnableKubeconfigKeychain bool   `toml:"enable_kubeconfig_keychain"`
 	KubeconfigPath           string `toml:"kubeconfig_path"`
+	// Namespaces whose dockerconfigjson secrets are watched, all if empty. If set, the CRI
+	// image proxy records the pod namespace of pulls, and images only use the secrets of
+	// their pod's namespace.
+	KubeSecretNamespaces []string `toml:"kube_secret_namespaces"`
 	// CRI proxy mode
 	EnableCRIKeychain   bool   `toml:"enable_cri_keychain"`
 	ImageServiceAddress string `toml:"image_service_address"`
@@ -208,22 +221,288 @@ type AuthConfig struct {
 	EnableKubeletCredentialProviders bool   `toml:"enable_kubelet_credential_providers"`
 	CredentialProviderConfig         string `toml:"credential_provider_config"`
 	CredentialProviderBinDir         string `toml:"credential_provider_bin_dir"`
+	// Docker credential helpers by registry host, which may contain wildcards like
+	// "*.dkr.ecr.*.amazonaws.com". "docker-credential-<helper>" is run from $PATH.
+	CredentialHelpers map[string]string `toml:"credential_helpers"`
+	// Store credentials renewed from other providers in the credential helper of their
+	// registry host with its "store" command, e.g. to share them with other clients of it.
+	StoreRenewedCredentials bool `toml:"store_renewed_credentials"`
+	// Address of a local gRPC credential service, e.g. "/run/credential.sock". Disabled if empty.
+	CredentialServiceAddress string `toml:"credential_service_address"`
+	// How long to wait for the credential service per request, 5s if 0.
+	CredentialServiceTimeout time.Duration `toml:"credential_service_timeout"`
 	// Periodic credential renewal interval. When set to a positive duration,
 	// the snapshotter caches credentials from configured renewable providers and
 	// refreshes them at this interval. Set to 0 (default) to disable.
 	CredentialRenewalInterval time.Duration `toml:"credential_renewal_interval"`
+	// Renew credentials which tell their expiry, like ECR tokens, before they expire,
+	// also in between or without periodic renewal.
+	RefreshExpiringCredentials bool `toml:"refresh_expiring_credentials"`
+	// Reuse resolved credentials of an image for this long rather than asking the providers
+	// on every layer. 0 (default) disables caching. Cached credentials can be dropped through
+	// the system controller when secrets are rotated.
+	KeyChainCacheTTL time.Duration `toml:"keychain_cache_ttl"`
+	// Use access tokens of the GCE service account or GKE workload identity, fetched from
+	// the metadata server, for Artifact Registry and Container Registry. They are renewed
+	// before they expire.
+	EnableGCPWorkloadIdentity bool `toml:"enable_gcp_workload_identity"`
+	// Exchange the token of the managed identity of the node for ACR refresh tokens. The
+	// client ID selects a user-assigned identity, e.g. the kubelet identity of AKS.
+	EnableAzureManagedIdentity bool   `toml:"enable_azure_managed_identity"`
+	AzureClientID              string `toml:"azure_client_id"`
+	// Client certificates by registry host, e.g. "registry.internal:5000", presented to
+	// registries authenticating clients by certificate, alongside or instead of credentials.
+	ClientCerts map[string]ClientCertConfig `toml:"client_certs"`
+	// Bearer token files by registry host, or by repository path prefix like
+	// "registry.example.com/team", e.g. a service account token projected by kubelet.
+	// The token is passed to nydusd as registry token, and again whenever the file changes.
+	TokenFiles map[string]string `toml:"token_files"`
+	// File listing credentials and client certificates by registry host, reloaded when it
+	// changes. Disabled if empty.
+	AuthFile string `toml:"auth_file"`
+	// File with the 32 bytes AES key, raw or base64 encoded, the pull secret label is
+	// encrypted with. Plain labels are still accepted with a warning.
+	LabelEncryptionKeyFile string `toml:"label_encryption_key_file"`
+	// Refuse plain pull secret labels, once all clients encrypt them.
+	RequireEncryptedLabels bool `toml:"require_encrypted_labels"`
+}
+
+// ClientCertConfig names the PEM encoded client certificate and its key.
+type ClientCertConfig struct {
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
 }
 
 // Configure remote storage like container registry
 type RemoteConfig struct {
-	AuthConfig         AuthConfig    `toml:"auth"`
-	ConvertVpcRegistry bool          `toml:"convert_vpc_registry"`
-	SkipSSLVerify      bool          `toml:"skip_ssl_verify"`
-	MirrorsConfig      MirrorsConfig `toml:"mirrors_config"`
+	AuthConfig         AuthConfig     `toml:"auth"`
+	ConvertVpcRegistry bool           `toml:"convert_vpc_registry"`
+	SkipSSLVerify      bool           `toml:"skip_ssl_verify"`
+	MirrorsConfig      MirrorsConfig  `toml:"mirrors_config"`
+	ThrottleConfig     ThrottleConfig `toml:"throttle"`
+	ProxyConfig        ProxyConfig    `toml:"proxy"`
+	// External request signers by name, referred to by the signer of backends
+	Signers        map[string]SignerConfig `toml:"signers"`
+	PrefetchConfig PrefetchConfig          `toml:"prefetch"`
+	// Let nydusd serve cached data only, rather than fail reads, once all backends of an
+	// image are unreachable, see BackendConfig.CacheOnlyOnOutage
+	CacheOnlyOnOutage bool `toml:"cache_only_on_outage"`
+
+	MetadataCacheConfig MetadataCacheConfig `toml:"metadata_cache"`
+	VaultConfig         VaultConfig         `toml:"vault"`
+	SpiffeConfig        SpiffeConfig        `toml:"spiffe"`
+	// Fetch images by another name, e.g. through the proxy cache projects of Harbor. The first
+	// matching rule applies.
+	Rewrites []RewriteRule `toml:"rewrites"`
+}
+
+// Images named From are fetched as To. Both are a registry host followed by a repository,
+// and may end in "/*" to match, and keep, everything below, e.g. "docker.io/library/*" and
+// "harbor.internal/proxy/library/*".
+type RewriteRule struct {
+	From string `toml:"from"`
+	To   string `toml:"to"`
+}
+
+// Node-wide limits of lazy-loading traffic, applied to backends without their own.
+// Zero means unlimited.
+type ThrottleConfig struct {
+	MaxBandwidthBytesPerSec int `toml:"max_bandwidth_bytes_per_sec"`
+	// Bytes allowed above the rate in a burst, defaults to one second worth of traffic
+	MaxBandwidthBurstBytes int `toml:"max_bandwidth_burst_bytes"`
+	// Concurrent requests nydusd issues for a single blob
+	MaxConcurrencyPerBlob int `toml:"max_concurrency_per_blob"`
+}
+
+// Node-wide HTTP proxy of lazy-loading traffic, used by backends without their own.
+type ProxyConfig struct {
+	URL string `toml:"url"`
+	// Hosts reached without the proxy, in the format of the NO_PROXY environment variable
+	NoProxy []string `toml:"no_proxy"`
+}
+
+// Caching proxy shared by all nydusd daemons of the node for the HEAD, manifest and token
+// requests to registries, so identical requests are only sent upstream once.
+type MetadataCacheConfig struct {
+	// Loopback address the proxy listens on, e.g. "127.0.0.1:8765". Disabled if empty.
+	Address string `toml:"address"`
+	// How long successful responses are served from the cache, defaults to 30s.
+	// Tokens are never served past their expiry.
+	TTL time.Duration `toml:"ttl"`
+	// Maximum number of cached responses, defaults to 1024
+	MaxEntries int `toml:"max_entries"`
+}
+
+// Prefetch and read-ahead settings replacing the ones of the nydusd configuration template.
+type PrefetchPolicy struct {
+	Enable        bool `toml:"enable"`
+	PrefetchAll   bool `toml:"prefetch_all"`
+	ThreadsCount  int  `toml:"threads_count"`
+	MergingSize   int  `toml:"merging_size"`
+	BandwidthRate int  `toml:"bandwidth_rate"`
+	// How long blobs are read ahead of the requested ranges after mount, 0 disables it
+	ReadAheadSec int `toml:"readahead_sec"`
+}
+
+type PrefetchConfig struct {
+	// Policies by name, images select one with the label.NydusPrefetchPolicy label
+	Policies map[string]PrefetchPolicy `toml:"policies"`
+	// Policy names by backend type, e.g. `registry = "lazy"`, for images without the label
+	Defaults map[string]string `toml:"defaults"`
+}
+
+// HashiCorp Vault providing the credentials of backends configured with `"signer": "vault"`,
+// see daemonconfig.VaultSigner. Disabled if the address is empty.
+type VaultConfig struct {
+	Address   string `toml:"address"`
+	Namespace string `toml:"namespace"`
+	// CA bundle trusted in addition to the system roots
+	CAFile string `toml:"ca_file"`
+	// "approle" with role_id and secret_id_file, or "kubernetes" with role and jwt_file
+	AuthMethod string `toml:"auth_method"`
+	// Path the auth method is mounted at, defaults to the name of the method
+	AuthMount    string `toml:"auth_mount"`
+	RoleID       string `toml:"role_id"`
+	SecretIDFile string `toml:"secret_id_file"`
+	Role         string `toml:"role"`
+	// Defaults to the service account token of the pod
+	JWTFile string `toml:"jwt_file"`
+	// Path of the secret of a backend, e.g. "secret/data/nydus/{host}". "{backend_type}",
+	// "{host}", "{repo}" and "{bucket}" are replaced with those of the backend.
+	SecretPath string `toml:"secret_path"`
+	// How long secrets without a lease, like those of the KV engine, are used before they
+	// are read again. Defaults to 1h.
+	RefreshInterval time.Duration `toml:"refresh_interval"`
+}
+
+// X.509 SVID of the SPIFFE Workload API of a SPIRE agent, presented by nydusd as client
+// certificate to blob services authenticating workloads by mTLS.
+type SpiffeConfig struct {
+	// Socket of the Workload API, e.g. "/run/spire/sockets/agent.sock". Disabled if empty.
+	WorkloadAPISocket string `toml:"workload_api_socket"`
+	// SPIFFE ID of the SVID to use if the snapshotter is issued several, the first one if empty
+	SpiffeID string `toml:"spiffe_id"`
+	// Registry hosts, e.g. "blobs.internal:8443", getting the SVID, and trusting the bundle
+	// of its trust domain
+	Hosts []string `toml:"hosts"`
+}
+
+// Program providing the material to sign backend requests with, see daemonconfig.ExecSigner.
+type SignerConfig struct {
+	Path string   `toml:"path"`
+	Args []string `toml:"args"`
+	// How long a single run may take, unlimited if zero
+	Timeout time.Duration `toml:"timeout"`
 }
 
 type MirrorsConfig struct {
 	Dir string `toml:"dir"`
+	// Probe mirrors without a ping_url too, by requesting their registry API root,
+	// and skip those that are unreachable. Mirrors with a ping_url are always checked.
+	ProbeMirrors bool `toml:"probe_mirrors"`
+	// Timeout of a single mirror probe, defaults to 3s.
+	ProbeTimeout time.Duration           `toml:"probe_timeout"`
+	Dragonfly    DragonflyConfig         `toml:"dragonfly"`
+	Spegel       SpegelConfig            `toml:"spegel"`
+	Discovery    MirrorDiscoveryConfig   `toml:"discovery"`
+	Kubernetes   KubernetesMirrorsConfig `toml:"kubernetes"`
+	// How often the latency of mirrors is measured in the background to order mirrors of the
+	// same weight by it. Set to 0 (the default) to keep their order.
+	LatencyProbeInterval time.Duration `toml:"latency_probe_interval"`
+	// Honor mirrors given per image in the "containerd.io/snapshot/nydus-mirrors" label. Those
+	// mirrors receive the registry credential of the image, so only allow it if the workloads
+	// setting the label are trusted.
+	AllowLabelMirrors bool                 `toml:"allow_label_mirrors"`
+	FanOut            FanOutConfig         `toml:"fan_out"`
+	Failback          MirrorFailbackConfig `toml:"failback"`
+}
+
+// Point running instances back at a mirror they fell back from, to the next mirror or the
+// origin registry, once the mirror is healthy again.
+type MirrorFailbackConfig struct {
+	Enable bool `toml:"enable"`
+	// How often the mirrors fallen back from are probed, defaults to 30s.
+	Interval time.Duration `toml:"interval"`
+	// Successful probes in a row after which a mirror is failed back to, defaults to 3.
+	HealthyProbes int `toml:"healthy_probes"`
+	// How long a mirror must not have failed before it is failed back to, defaults to 1m.
+	Cooldown time.Duration `toml:"cooldown"`
+}
+
+const (
+	FanOutModeDragonfly = "dragonfly"
+	FanOutModeGossip    = "gossip"
+)
+
+// Hand the blobs prefetched on this node on to the other nodes, so that they pull them from
+// peers instead of the registry.
+type FanOutConfig struct {
+	Enable bool `toml:"enable"`
+	// FanOutModeDragonfly seeds the blobs in the local dfdaemon, FanOutModeGossip serves them
+	// from this node and announces them to the peers.
+	Mode string `toml:"mode"`
+	// Address the blobs and announcements of peers are served on in gossip mode, e.g. ":8091"
+	ListenAddress string `toml:"listen_address"`
+	// URL peers reach ListenAddress by, e.g. "https://10.0.0.1:8091"
+	AdvertiseAddress string `toml:"advertise_address"`
+	// URLs of the other nodes in gossip mode. Announcements are only accepted from them.
+	Peers []string `toml:"peers"`
+	// How long announcements of peers are honored unless renewed, defaults to 10m.
+	AnnounceTTL time.Duration `toml:"announce_ttl"`
+	// Peers authenticate each other by mutual TLS in gossip mode: the CA verifying the
+	// certificates of peers, and the certificate and key of this node, for serving as well as
+	// for announcing and fetching blobs.
+	CAFile   string `toml:"ca_file"`
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+}
+
+// Spegel node-to-node mirror on the node, used for the blobs of every registry while it is
+// healthy. Spegel resolves content by digest only, so manifests and tokens still come from
+// the registry.
+type SpegelConfig struct {
+	Enable bool `toml:"enable"`
+	// Registry of Spegel, defaults to "http://127.0.0.1:30020"
+	Address string `toml:"address"`
+	// Health endpoint of Spegel, defaults to "<address>/healthz"
+	PingURL string `toml:"ping_url"`
+	// Registry hosts mirrored by Spegel, all if empty
+	Registries []string `toml:"registries"`
+}
+
+// Render the NydusMirrorConfig resources selecting this node into the mirrors directory,
+// next to the hosts.toml files written by hand.
+type KubernetesMirrorsConfig struct {
+	Enable bool `toml:"enable"`
+	// Kubeconfig to watch the resources with, the in-cluster configuration if empty
+	KubeconfigPath string `toml:"kubeconfig_path"`
+	// Name of this node, defaults to $NODE_NAME or the hostname
+	NodeName string `toml:"node_name"`
+}
+
+// Mirrors discovered from DNS SRV records, tried after the ones of hosts.toml.
+type MirrorDiscoveryConfig struct {
+	SRV []SRVMirrorConfig `toml:"srv"`
+	// How often the records are looked up again, defaults to 30s.
+	RefreshInterval time.Duration `toml:"refresh_interval"`
+}
+
+type SRVMirrorConfig struct {
+	// Name of the SRV record, e.g. "_nydus-mirror._tcp.cluster.local"
+	Name string `toml:"name"`
+	// "http" or "https", defaults to "https"
+	Scheme string `toml:"scheme"`
+	// Registry hosts the mirrors serve, all if empty
+	Registries []string `toml:"registries"`
+}
+
+// Dragonfly dfdaemon on the node, used as first mirror of every registry while it is healthy.
+type DragonflyConfig struct {
+	Enable bool `toml:"enable"`
+	// Proxy of dfdaemon, defaults to "http://127.0.0.1:4001"
+	ProxyAddress string `toml:"proxy_address"`
+	// Health endpoint of dfdaemon, defaults to "http://127.0.0.1:4003/healthy"
+	PingURL string `toml:"ping_url"`
 }
 
 type MetricsConfig struct {
@@ -348,6 +627,206 @@ func ValidateConfig(c *SnapshotterConfig) error {
 			"\"enable_cri_keychain\" and \"enable_kubeconfig_keychain\" can't be set at the same time")
 	}
 
+	if t := c.RemoteConfig.ThrottleConfig; t.MaxBandwidthBytesPerSec < 0 || t.MaxBandwidthBurstBytes < 0 || t.MaxConcurrencyPerBlob < 0 {
+		return errors.New("throttle limits must not be negative")
+	} else if t.MaxBandwidthBurstBytes > 0 && t.MaxBandwidthBytesPerSec == 0 {
+		return errors.New("\"max_bandwidth_burst_bytes\" requires \"max_bandwidth_bytes_per_sec\"")
+	}
+
+	if p := c.RemoteConfig.ProxyConfig.URL; p != "" {
+		if u, err := url.Parse(p); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("invalid proxy url %q, must be an http(s) URL", p)
+		}
+	}
+
+	for host, helper := range c.RemoteConfig.AuthConfig.CredentialHelpers {
+		if helper == "" || strings.ContainsAny(helper, "/\\ ") {
+			return errors.Errorf("invalid credential helper %q of %s", helper, host)
+		}
+	}
+	if c.RemoteConfig.AuthConfig.KeyChainCacheTTL < 0 {
+		return errors.New("\"keychain_cache_ttl\" must not be negative")
+	}
+	if c.RemoteConfig.AuthConfig.CredentialServiceTimeout < 0 {
+		return errors.New("\"credential_service_timeout\" must not be negative")
+	}
+	for host, cert := range c.RemoteConfig.AuthConfig.ClientCerts {
+		if !filepath.IsAbs(cert.CertFile) || !filepath.IsAbs(cert.KeyFile) {
+			return errors.Errorf("\"cert_file\" and \"key_file\" of client cert of %s must be absolute paths", host)
+		}
+	}
+	for host, path := range c.RemoteConfig.AuthConfig.TokenFiles {
+		if !filepath.IsAbs(path) {
+			return errors.Errorf("token file of %s must be an absolute path", host)
+		}
+	}
+	if f := c.RemoteConfig.AuthConfig.AuthFile; f != "" && !filepath.IsAbs(f) {
+		return errors.New("\"auth_file\" must be an absolute path")
+	}
+	if f := c.RemoteConfig.AuthConfig.LabelEncryptionKeyFile; f != "" && !filepath.IsAbs(f) {
+		return errors.New("\"label_encryption_key_file\" must be an absolute path")
+	}
+	if a := c.RemoteConfig.AuthConfig; a.RequireEncryptedLabels && a.LabelEncryptionKeyFile == "" {
+		return errors.New("\"require_encrypted_labels\" needs \"label_encryption_key_file\"")
+	}
+
+	if m := c.RemoteConfig.MetadataCacheConfig; m.Address != "" {
+		host, _, err := net.SplitHostPort(m.Address)
+		if err != nil {
+			return errors.Wrapf(err, "invalid metadata cache address %q", m.Address)
+		}
+		// The cache forwards requests with the credentials of nydusd, so it is only for the node.
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return errors.Errorf("metadata cache address %q must be a loopback address", m.Address)
+		}
+		if m.TTL < 0 || m.MaxEntries < 0 {
+			return errors.New("\"ttl\" and \"max_entries\" of metadata cache must not be negative")
+		}
+	}
+
+	prefetch := c.RemoteConfig.PrefetchConfig
+	for name, p := range prefetch.Policies {
+		if p.ThreadsCount < 0 || p.MergingSize < 0 || p.BandwidthRate < 0 || p.ReadAheadSec < 0 {
+			return errors.Errorf("settings of prefetch policy %q must not be negative", name)
+		}
+	}
+	for backendType, name := range prefetch.Defaults {
+		if _, ok := prefetch.Policies[name]; !ok {
+			return errors.Errorf("unknown prefetch policy %q for backend type %s", name, backendType)
+		}
+	}
+
+	for name, s := range c.RemoteConfig.Signers {
+		if !filepath.IsAbs(s.Path) {
+			return errors.Errorf("path of signer %q must be absolute", name)
+		}
+		if s.Timeout < 0 {
+			return errors.Errorf("timeout of signer %q must not be negative", name)
+		}
+	}
+
+	if d := c.RemoteConfig.MirrorsConfig.Dragonfly; d.Enable {
+		for _, u := range []string{d.ProxyAddress, d.PingURL} {
+			if u == "" {
+				continue
+			}
+			if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return errors.Errorf("invalid dragonfly address %q, must be an http(s) URL", u)
+			}
+		}
+	}
+	if s := c.RemoteConfig.MirrorsConfig.Spegel; s.Enable {
+		for _, u := range []string{s.Address, s.PingURL} {
+			if u == "" {
+				continue
+			}
+			if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return errors.Errorf("invalid spegel address %q, must be an http(s) URL", u)
+			}
+		}
+	}
+
+	for _, r := range c.RemoteConfig.Rewrites {
+		for _, name := range []string{r.From, r.To} {
+			// Everything of a registry is matched by its host alone.
+			prefix, wildcard := strings.CutSuffix(name, "/*")
+			host, repo, _ := strings.Cut(prefix, "/")
+			if host == "" || (repo == "" && !wildcard) || strings.Contains(prefix, "*") {
+				return errors.Errorf("invalid rewrite rule %q, names must be a host and repository, optionally ending in \"/*\"", name)
+			}
+		}
+		if strings.HasSuffix(r.From, "/*") != strings.HasSuffix(r.To, "/*") {
+			return errors.Errorf("rewrite rule from %q to %q must end in \"/*\" on both sides or neither", r.From, r.To)
+		}
+	}
+
+	if f := c.RemoteConfig.MirrorsConfig.FanOut; f.Enable {
+		switch f.Mode {
+		case FanOutModeDragonfly:
+			if !c.RemoteConfig.MirrorsConfig.Dragonfly.Enable {
+				return errors.New("fan-out through dragonfly needs dragonfly to be enabled")
+			}
+		case FanOutModeGossip:
+			if _, _, err := net.SplitHostPort(f.ListenAddress); err != nil {
+				return errors.Wrapf(err, "invalid fan-out listen address %q", f.ListenAddress)
+			}
+			for _, u := range append([]string{f.AdvertiseAddress}, f.Peers...) {
+				if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+					return errors.Errorf("invalid fan-out address %q, must be an https URL", u)
+				}
+			}
+			if f.CAFile == "" || f.CertFile == "" || f.KeyFile == "" {
+				return errors.New("fan-out through gossip needs ca_file, cert_file and key_file to authenticate peers")
+			}
+		default:
+			return errors.Errorf("invalid fan-out mode %q, must be %q or %q", f.Mode, FanOutModeDragonfly, FanOutModeGossip)
+		}
+		if f.AnnounceTTL < 0 {
+			return errors.Errorf("invalid fan-out announce TTL %v", f.AnnounceTTL)
+		}
+	}
+
+	if f := c.RemoteConfig.MirrorsConfig.Failback; f.Interval < 0 || f.HealthyProbes < 0 || f.Cooldown < 0 {
+		return errors.Errorf("invalid mirror failback interval %v, healthy probes %d or cooldown %v",
+			f.Interval, f.HealthyProbes, f.Cooldown)
+	}
+
+	if c.RemoteConfig.MirrorsConfig.Kubernetes.Enable && c.RemoteConfig.MirrorsConfig.Dir == "" {
+		return errors.New("mirrors from kubernetes need a mirrors directory")
+	}
+
+	if c.RemoteConfig.MirrorsConfig.LatencyProbeInterval < 0 {
+		return errors.Errorf("invalid mirror latency probe interval %v", c.RemoteConfig.MirrorsConfig.LatencyProbeInterval)
+	}
+	discovery := c.RemoteConfig.MirrorsConfig.Discovery
+	if discovery.RefreshInterval < 0 {
+		return errors.Errorf("invalid mirror discovery refresh interval %v", discovery.RefreshInterval)
+	}
+	for _, r := range discovery.SRV {
+		if r.Name == "" {
+			return errors.New("mirror discovery SRV record without name")
+		}
+		if r.Scheme != "" && r.Scheme != "http" && r.Scheme != "https" {
+			return errors.Errorf("invalid scheme %q of SRV record %s, must be http or https", r.Scheme, r.Name)
+		}
+	}
+
+	if s := c.RemoteConfig.SpiffeConfig; s.WorkloadAPISocket != "" {
+		if len(s.Hosts) == 0 {
+			return errors.New("spiffe requires \"hosts\" to present the SVID to")
+		}
+		if s.SpiffeID != "" && !strings.HasPrefix(s.SpiffeID, "spiffe://") {
+			return errors.Errorf("invalid SPIFFE ID %q", s.SpiffeID)
+		}
+	}
+
+	if v := c.RemoteConfig.VaultConfig; v.Address != "" {
+		if u, err := url.Parse(v.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("invalid vault address %q, must be an http(s) URL", v.Address)
+		}
+		switch v.AuthMethod {
+		case "approle":
+			if v.RoleID == "" || v.SecretIDFile == "" {
+				return errors.New("vault auth method \"approle\" requires \"role_id\" and \"secret_id_file\"")
+			}
+		case "kubernetes":
+			if v.Role == "" {
+				return errors.New("vault auth method \"kubernetes\" requires \"role\"")
+			}
+		default:
+			return errors.Errorf("invalid vault auth method %q, must be \"approle\" or \"kubernetes\"", v.AuthMethod)
+		}
+		if v.SecretPath == "" {
+			return errors.New("vault requires \"secret_path\"")
+		}
+		if v.RefreshInterval < 0 {
+			return errors.New("\"refresh_interval\" of vault must not be negative")
+		}
+		if _, ok := c.RemoteConfig.Signers["vault"]; ok {
+			return errors.New("signer name \"vault\" is reserved when vault is configured")
+		}
+	}
+
 	if c.RemoteConfig.MirrorsConfig.Dir != "" {
 		dirExisted, err := file.IsDirExisted(c.RemoteConfig.MirrorsConfig.Dir)
 		if err != nil {
@@ -282,4 +282,118 @@ func TestProcessConfigurations(t *testing.T) {
 	A.NoError(err)
 	err = ValidateConfig(&snapshotterConfig4)
 	A.Error(err)
+
+	var snapshotterConfig5 SnapshotterConfig
+	snapshotterConfig5.RemoteConfig.AuthConfig.ClientCerts = map[string]ClientCertConfig{
+		"registry.internal": {CertFile: "/etc/nydus/client.crt"},
+	}
+
+	err = MergeConfig(&snapshotterConfig5, &defaultSnapshotterConfig)
+	A.NoError(err)
+	err = ValidateConfig(&snapshotterConfig5)
+	A.ErrorContains(err, "client cert")
+
+	var snapshotterConfig6 SnapshotterConfig
+	snapshotterConfig6.RemoteConfig.SpiffeConfig.WorkloadAPISocket = "/run/spire/sockets/agent.sock"
+
+	err = MergeConfig(&snapshotterConfig6, &defaultSnapshotterConfig)
+	A.NoError(err)
+	err = ValidateConfig(&snapshotterConfig6)
+	A.ErrorContains(err, "hosts")
+	snapshotterConfig6.RemoteConfig.SpiffeConfig.Hosts = []string{"blobs.internal:8443"}
+	A.NoError(ValidateConfig(&snapshotterConfig6))
+
+	var snapshotterConfig7 SnapshotterConfig
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Dragonfly.Enable = true
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Dragonfly.ProxyAddress = "127.0.0.1:4001"
+
+	err = MergeConfig(&snapshotterConfig7, &defaultSnapshotterConfig)
+	A.NoError(err)
+	err = ValidateConfig(&snapshotterConfig7)
+	A.ErrorContains(err, "dragonfly")
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Dragonfly.ProxyAddress = "http://127.0.0.1:4001"
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Discovery.SRV = []SRVMirrorConfig{{Name: "_nydus-mirror._tcp.cluster.local", Scheme: "ftp"}}
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "scheme")
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Discovery.SRV[0].Scheme = "http"
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Spegel = SpegelConfig{Enable: true, Address: "127.0.0.1:30020"}
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "spegel")
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Spegel.Address = "http://127.0.0.1:30020"
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Kubernetes.Enable = true
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "kubernetes")
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Dir = t.TempDir()
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.FanOut = FanOutConfig{Enable: true, Mode: "multicast"}
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "fan-out mode")
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.FanOut = FanOutConfig{
+		Enable:           true,
+		Mode:             FanOutModeGossip,
+		ListenAddress:    ":8091",
+		AdvertiseAddress: "https://10.0.0.1:8091",
+		Peers:            []string{"http://10.0.0.2:8091"},
+	}
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "fan-out address")
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.FanOut.Peers = []string{"https://10.0.0.2:8091"}
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "authenticate peers")
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.FanOut.CAFile = "/etc/nydus/fanout/ca.pem"
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.FanOut.CertFile = "/etc/nydus/fanout/node.pem"
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.FanOut.KeyFile = "/etc/nydus/fanout/node-key.pem"
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+
+	snapshotterConfig7.RemoteConfig.Rewrites = []RewriteRule{{From: "docker.io/library/*", To: "harbor.internal/proxy"}}
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "on both sides")
+	snapshotterConfig7.RemoteConfig.Rewrites[0].To = "harbor.internal/proxy/*/library/*"
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "invalid rewrite rule")
+	snapshotterConfig7.RemoteConfig.Rewrites[0].To = "harbor.internal"
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "invalid rewrite rule")
+	// Registries are matched by their host alone.
+	snapshotterConfig7.RemoteConfig.Rewrites[0] = RewriteRule{From: "docker.io/*", To: "harbor.internal/dockerhub/*"}
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+	snapshotterConfig7.RemoteConfig.Rewrites[0].To = "harbor.internal/proxy/library/*"
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Failback = MirrorFailbackConfig{Enable: true, HealthyProbes: -1}
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "mirror failback")
+	snapshotterConfig7.RemoteConfig.MirrorsConfig.Failback.HealthyProbes = 3
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+
+	snapshotterConfig7.RemoteConfig.MetadataCacheConfig.Address = "0.0.0.0:8765"
+	A.ErrorContains(ValidateConfig(&snapshotterConfig7), "loopback")
+	snapshotterConfig7.RemoteConfig.MetadataCacheConfig.Address = "[::1]:8765"
+	A.NoError(ValidateConfig(&snapshotterConfig7))
+}
+
+func TestRewriteImage(t *testing.T) {
+	A := assert.New(t)
+	globalConfig.Rewrites = []RewriteRule{
+		{From: "docker.io/library/nginx", To: "harbor.internal/web/nginx"},
+		{From: "docker.io/library/*", To: "harbor.internal/proxy/library/*"},
+		{From: "ghcr.io/*", To: "harbor.internal/ghcr/*"},
+		{From: "quay.io/*", To: "harbor.internal/*"},
+	}
+	defer func() { globalConfig.Rewrites = nil }()
+
+	for _, tc := range []struct {
+		host, repo         string
+		wantHost, wantRepo string
+		rewritten          bool
+	}{
+		{"docker.io", "library/nginx", "harbor.internal", "web/nginx", true},
+		{"docker.io", "library/busybox", "harbor.internal", "proxy/library/busybox", true},
+		{"docker.io", "bitnami/redis", "docker.io", "bitnami/redis", false},
+		{"ghcr.io", "org/team/app", "harbor.internal", "ghcr/org/team/app", true},
+		{"ghcr.io.evil", "org/app", "ghcr.io.evil", "org/app", false},
+		{"quay.io", "org/app", "harbor.internal", "org/app", true},
+	} {
+		host, repo, ok := RewriteImage(tc.host, tc.repo)
+		A.Equal(tc.rewritten, ok, tc.repo)
+		A.Equal(tc.wantHost, host)
+		A.Equal(tc.wantRepo, repo)
+	}
 }
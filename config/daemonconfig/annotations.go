@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"strconv"
+
+	"github.com/containerd/log"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+// Annotations describing the effective configuration of a snapshot, for diagnostics.
+const (
+	AnnotationBackend = "nydus.backend"
+	AnnotationHost    = "nydus.host"
+	AnnotationMirrors = "nydus.mirrors"
+)
+
+// asAnnotations summarizes c without any secret: the backend type, the registry host or
+// object storage endpoint, and the number of mirrors configured for the registry host.
+func asAnnotations(c DaemonConfig) map[string]string {
+	backendType, bc := c.StorageBackend()
+	annotations := map[string]string{AnnotationBackend: backendType.String()}
+
+	switch backendType {
+	case backendTypeRegistry:
+		if bc.Host == "" {
+			break
+		}
+		annotations[AnnotationHost] = bc.Host
+		mirrors, _, err := LoadMirrorsConfig(config.GetMirrorsConfigDir(), bc.Host)
+		if err != nil {
+			log.L.Warnf("Failed to load mirrors config for %s: %v", bc.Host, err)
+		}
+		annotations[AnnotationMirrors] = strconv.Itoa(len(mirrors))
+	case backendTypeOss, backendTypeS3:
+		if bc.EndPoint != "" {
+			annotations[AnnotationHost] = bc.EndPoint
+		}
+	}
+
+	return annotations
+}
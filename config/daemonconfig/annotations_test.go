@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestAsAnnotations(t *testing.T) {
+	mirrorsDir := t.TempDir()
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."http://mirror1:5000"]
+[host."http://mirror2:5000"]
+`)
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{MirrorsConfig: config.MirrorsConfig{Dir: mirrorsDir}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.Backend.Config.Host = testRegistryHost
+	cfg.Device.Backend.Config.Auth = "dXNlcjpwYXNz"
+	cfg.Device.Backend.Config.RegistryToken = "token"
+	require.Equal(t, map[string]string{
+		AnnotationBackend: "registry",
+		AnnotationHost:    testRegistryHost,
+		AnnotationMirrors: "2",
+	}, cfg.AsAnnotations())
+
+	fscacheCfg := &FscacheDaemonConfig{}
+	require.NoError(t, json.Unmarshal([]byte(`{"config": {"backend_type": "s3", "backend_config":
+		{"endpoint": "s3.amazonaws.com", "access_key_id": "ak", "access_key_secret": "sk"}}}`), fscacheCfg))
+	annotations := fscacheCfg.AsAnnotations()
+	require.Equal(t, map[string]string{
+		AnnotationBackend: "s3",
+		AnnotationHost:    "s3.amazonaws.com",
+	}, annotations)
+
+	for _, c := range []DaemonConfig{cfg, fscacheCfg} {
+		for _, v := range c.AsAnnotations() {
+			require.NotContains(t, []string{"dXNlcjpwYXNz", "token", "ak", "sk"}, v)
+		}
+	}
+}
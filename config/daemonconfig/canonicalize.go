@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2020. Ant Group. All rights reserved.
+ * Copyright (c) 2022. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// canonicalize lowercases schemes and trims trailing slashes from hosts and URLs, and sorts
+// lists whose order doesn't matter. Endpoints are tried in order, so they are kept in theirs,
+// and object prefixes are kept as is since a trailing slash is part of the object key.
+// Mirrors are sorted by host, nydusd picks among them by health rather than by order.
+func (c *BackendConfig) canonicalize() {
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.BlobURLScheme = strings.ToLower(c.BlobURLScheme)
+	c.Host = strings.TrimRight(c.Host, "/")
+	c.BlobRedirectedHost = strings.TrimRight(c.BlobRedirectedHost, "/")
+	c.EndPoint = canonicalURL(c.EndPoint)
+	for i, e := range c.Endpoints {
+		c.Endpoints[i] = canonicalURL(e)
+	}
+	c.Proxy.URL = canonicalURL(c.Proxy.URL)
+	// Copies are sorted, the lists may be shared with other configurations.
+	for _, list := range []*[]string{&c.CACertFiles, &c.MetadataCACertFiles, &c.Proxy.NoProxy} {
+		if len(*list) > 0 {
+			*list = slices.Sorted(slices.Values(*list))
+		}
+	}
+	if len(c.Mirrors) > 0 {
+		mirrors := slices.Clone(c.Mirrors)
+		for i := range mirrors {
+			mirrors[i].Host = canonicalURL(mirrors[i].Host)
+		}
+		slices.SortStableFunc(mirrors, func(a, b RegistryMirrorConfig) int {
+			return strings.Compare(a.Host, b.Host)
+		})
+		c.Mirrors = mirrors
+	}
+}
+
+// canonicalURL lowercases the scheme of u, if any, and trims its trailing slashes.
+func canonicalURL(u string) string {
+	u = strings.TrimRight(u, "/")
+	if scheme, rest, ok := strings.Cut(u, "://"); ok {
+		return strings.ToLower(scheme) + "://" + rest
+	}
+	return u
+}
+
+// configHash digests the canonicalized, secret-filtered configuration. Keys are sorted by
+// the JSON encoding of maps, and c itself is left untouched.
+func configHash(c DaemonConfig) (string, error) {
+	clone := c.Clone()
+	clone.Canonicalize()
+
+	b, err := json.Marshal(serializeWithSecretFilter(clone))
+	if err != nil {
+		return "", errors.Wrap(err, "marshal config")
+	}
+	return digest.FromBytes(b).String(), nil
+}
+
+// withoutMirrors returns a copy of c for which no mirror is selected when supplementing and
+// nydusd falls back to the origin registry if the proxy fails. As the mirror replaces the
+// registry host, it has to be called before supplementing.
+func withoutMirrors(c DaemonConfig) DaemonConfig {
+	clone := c.Clone()
+	_, bc := clone.StorageBackend()
+	bc.DisableMirrors = true
+	bc.Mirrors = nil
+	bc.Proxy.Fallback = true
+	for _, b := range clone.BackendChain()[1:] {
+		b.Config.DisableMirrors = true
+		b.Config.Mirrors = nil
+		b.Config.Proxy.Fallback = true
+	}
+	return clone
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// ComposeConfig returns the effective configuration of an image from three layers, in order
+// of precedence: the per-image information, the user template and the system defaults in base.
+// A template field overrides base when it is set to a non-zero value, so e.g. a template can't
+// turn off a flag enabled by base. Neither base nor template is modified.
+func ComposeConfig(base, template DaemonConfig, info SupplementInfoInterface) (DaemonConfig, error) {
+	if reflect.TypeOf(base) != reflect.TypeOf(template) {
+		return nil, errors.Errorf("can't compose %T with %T", base, template)
+	}
+
+	c := base.Clone()
+	mergeNonZero(reflect.ValueOf(c).Elem(), reflect.ValueOf(template.Clone()).Elem())
+
+	if err := SupplementDaemonConfig(c, info.GetImageID(), info.GetSnapshotID(), info.IsVPCRegistry(),
+		info.GetLabels(), info.GetParams()); err != nil {
+		return nil, errors.Wrap(err, "supplement composed configuration")
+	}
+	return c, nil
+}
+
+// mergeNonZero recursively overwrites dst with the non-zero values of src.
+func mergeNonZero(dst, src reflect.Value) {
+	//nolint:exhaustive
+	switch src.Kind() {
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			mergeNonZero(dst.Field(i), src.Field(i))
+		}
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() || src.Elem().Kind() != reflect.Struct {
+			dst.Set(src)
+			return
+		}
+		mergeNonZero(dst.Elem(), src.Elem())
+	default:
+		if !src.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComposeConfig(t *testing.T) {
+	base := &FuseDaemonConfig{Device: &DeviceConfig{}, Mode: "direct", EnableXattr: true}
+	base.Device.Backend.BackendType = backendTypeRegistry
+	base.Device.Backend.Config.Timeout = 10
+	base.Device.Backend.Config.RetryLimit = 3
+	base.Device.Backend.Config.Host = "base.example.com"
+	base.Device.Cache.Config.WorkDir = "/var/cache/base"
+
+	template := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	template.Device.Backend.BackendType = backendTypeRegistry
+	template.Device.Backend.Config.Timeout = 30
+	template.Device.Backend.Config.Host = "template.example.com"
+	template.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeOss}
+
+	c, err := ComposeConfig(base, template, &SupplementInfo{ImageID: "registry.example.com/team/app:v1", SnapshotID: "1"})
+	require.NoError(t, err)
+	composed := c.(*FuseDaemonConfig)
+
+	// image > template > base
+	require.Equal(t, "registry.example.com", composed.Device.Backend.Config.Host)
+	require.Equal(t, "team/app", composed.Device.Backend.Config.Repo)
+	require.Equal(t, 30, composed.Device.Backend.Config.Timeout)
+	require.Equal(t, 3, composed.Device.Backend.Config.RetryLimit)
+	require.Equal(t, "/var/cache/base", composed.Device.Cache.Config.WorkDir)
+	require.Equal(t, "direct", composed.Mode)
+	require.True(t, composed.EnableXattr)
+	require.NotNil(t, composed.Device.FallbackBackend)
+
+	// The layers are left untouched.
+	require.Equal(t, 10, base.Device.Backend.Config.Timeout)
+	require.Equal(t, "template.example.com", template.Device.Backend.Config.Host)
+	require.Nil(t, base.Device.FallbackBackend)
+
+	fscacheCfg, err := LoadFscacheConfig("../../misc/snapshotter/nydusd-config.fscache.json")
+	require.NoError(t, err)
+	_, err = ComposeConfig(base, fscacheCfg, &SupplementInfo{ImageID: "busybox:latest"})
+	require.Error(t, err)
+}
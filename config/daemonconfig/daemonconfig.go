@@ -8,54 +8,160 @@
 package daemonconfig
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
-	"net/http"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
-	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/containerd/log"
+	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpproxy"
 
 	"github.com/containerd/nydus-snapshotter/config"
 	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/metacache"
+	"github.com/containerd/nydus-snapshotter/pkg/spiffe"
 	"github.com/containerd/nydus-snapshotter/pkg/utils/registry"
 )
 
-type StorageBackendType = string
+// StorageBackendType identifies where nydusd fetches blobs from.
+type StorageBackendType string
 
 const (
 	backendTypeLocalfs  StorageBackendType = "localfs"
 	backendTypeOss      StorageBackendType = "oss"
 	backendTypeRegistry StorageBackendType = "registry"
 	backendTypeS3       StorageBackendType = "s3"
+	backendTypeAzblob   StorageBackendType = "azblob"
+	backendTypeGCS      StorageBackendType = "gcs"
+	// Plain HTTP(S) file server, e.g. nginx or WebDAV, serving blobs by ID under a base URL.
+	backendTypeHTTP StorageBackendType = "http"
+	// Blobs fetched by CID through an IPFS gateway or a local IPFS daemon.
+	backendTypeIPFS StorageBackendType = "ipfs"
+	// No remote backend, nydusd only serves blobs already in the cache.
+	backendTypeNone StorageBackendType = "none"
 )
 
+// ParseStorageBackendType parses a backend type case-insensitively and rejects unknown ones.
+func ParseStorageBackendType(s string) (StorageBackendType, error) {
+	t := StorageBackendType(strings.ToLower(strings.TrimSpace(s)))
+	if !t.IsValid() {
+		return "", errors.Errorf("unknown backend type %q", s)
+	}
+	return t, nil
+}
+
+func (t StorageBackendType) String() string {
+	return string(t)
+}
+
+// IsValid reports whether t is a backend type supported by nydusd.
+func (t StorageBackendType) IsValid() bool {
+	switch t {
+	case backendTypeLocalfs, backendTypeOss, backendTypeRegistry, backendTypeS3,
+		backendTypeAzblob, backendTypeGCS, backendTypeHTTP, backendTypeIPFS, backendTypeNone:
+		return true
+	default:
+		return false
+	}
+}
+
+const sseTypeKMS = "aws:kms"
+
+const (
+	authSchemeBasic  = "basic"
+	authSchemeBearer = "bearer"
+)
+
+// Longest lifetime of a SigV4 presigned URL accepted by S3 and compatible stores, 7 days.
+const maxPresignExpirySec = 7 * 24 * 60 * 60
+
 type DaemonConfig interface {
 	// Provide stuffs relevant to accessing registry apart from auth
 	Supplement(host, repo, snapshotID string, params map[string]string)
 	// Provide auth
 	FillAuth(kc *auth.PassKeyChain)
 	StorageBackend() (StorageBackendType, *BackendConfig)
+	// Secondary backend used when the primary one is unavailable, or ("", nil) if not configured
+	FallbackStorageBackend() (StorageBackendType, *BackendConfig)
+	// Backends in the order nydusd tries them, starting with the primary one
+	BackendChain() []ChainedBackend
 	DumpString() (string, error)
+	// Stream the content of DumpString to w, without secrets
+	DumpTo(w io.Writer) error
 	DumpFile(path string) error
+	// Report all problems found in the configuration, empty if it is healthy
+	HealthCheck() []error
+	// Normalize equivalent values so that equal configurations dump identically
+	Canonicalize()
+	// Digest of the canonicalized configuration without secrets, to detect configuration drift
+	ConfigHash() (string, error)
+	// Deep copy sharing no slice, map or pointer with the original
+	Clone() DaemonConfig
+	// Deep copy pulling from the origin registry only, skipping mirrors when supplemented
+	WithoutMirrors() DaemonConfig
+	// Secret-free summary of the effective backend, attachable as snapshot annotations
+	AsAnnotations() map[string]string
+}
+
+// DefaultMaxConfigBytes is the size limit of a configuration file unless WithMaxConfigBytes is given.
+const DefaultMaxConfigBytes int64 = 1 << 20
+
+type loadOptions struct {
+	disallowUnknownFields bool
+	allowComments         bool
+	maxConfigBytes        int64
+}
+
+// LoadOpt tunes how a daemon configuration file is loaded.
+type LoadOpt func(o *loadOptions)
+
+// WithDisallowUnknownFields rejects configuration files containing keys that
+// don't map to any configuration field, e.g. a misspelled "timout".
+func WithDisallowUnknownFields() LoadOpt {
+	return func(o *loadOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// WithComments accepts `//` line and `/* */` block comments in the configuration file,
+// so that templates can be annotated. Strict JSON is expected by default.
+func WithComments() LoadOpt {
+	return func(o *loadOptions) {
+		o.allowComments = true
+	}
+}
+
+// WithMaxConfigBytes limits the size of the configuration file, so that a huge file is
+// rejected before being read into memory. Non-positive values keep the default.
+func WithMaxConfigBytes(n int64) LoadOpt {
+	return func(o *loadOptions) {
+		if n > 0 {
+			o.maxConfigBytes = n
+		}
+	}
 }
 
 // Daemon configurations factory
-func NewDaemonConfig(fsDriver, path string) (DaemonConfig, error) {
+func NewDaemonConfig(fsDriver, path string, opts ...LoadOpt) (DaemonConfig, error) {
 	switch fsDriver {
 	case config.FsDriverFscache:
-		cfg, err := LoadFscacheConfig(path)
+		cfg, err := LoadFscacheConfig(path, opts...)
 		if err != nil {
 			return nil, err
 		}
 		return cfg, nil
 	case config.FsDriverFusedev:
-		cfg, err := LoadFuseConfig(path)
+		cfg, err := LoadFuseConfig(path, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -65,12 +171,66 @@ func NewDaemonConfig(fsDriver, path string) (DaemonConfig, error) {
 	}
 }
 
+// NewDaemonConfigStrict is like NewDaemonConfig but fails on unknown configuration keys.
+func NewDaemonConfigStrict(fsDriver, path string) (DaemonConfig, error) {
+	return NewDaemonConfig(fsDriver, path, WithDisallowUnknownFields())
+}
+
+// loadConfigFile reads the configuration file p and decodes it into cfg.
+func loadConfigFile(p string, cfg interface{}, opts []LoadOpt) error {
+	o := loadOptions{maxConfigBytes: DefaultMaxConfigBytes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return errors.Wrapf(err, "read configuration file %s", p)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, o.maxConfigBytes+1))
+	if err != nil {
+		return errors.Wrapf(err, "read configuration file %s", p)
+	}
+	if int64(len(b)) > o.maxConfigBytes {
+		return errors.Errorf("configuration file %s exceeds the limit of %d bytes", p, o.maxConfigBytes)
+	}
+
+	if o.allowComments {
+		b = stripJSONComments(b)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	if o.disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(cfg); err != nil {
+		return errors.Wrapf(err, "unmarshal %s", p)
+	}
+	if decoder.More() {
+		return errors.Errorf("unmarshal %s: unexpected data after configuration", p)
+	}
+
+	return nil
+}
+
+// BackendConfig is the backend configuration of nydusd. Fields tagged `nydusd:"-"` are only
+// consumed by the snapshotter, they are read from configuration files but neither handed to
+// nydusd nor hashed.
 type BackendConfig struct {
 	// Localfs backend configs
-	BlobFile     string `json:"blob_file,omitempty"`
-	Dir          string `json:"dir,omitempty"`
-	ReadAhead    bool   `json:"readahead"`
-	ReadAheadSec int    `json:"readahead_sec,omitempty"`
+	BlobFile string `json:"blob_file,omitempty"`
+	Dir      string `json:"dir,omitempty"`
+	// Read blobs ahead of the requested ranges for ReadAheadSec seconds after mount.
+	// Supported by all backends, it may be set per image by a prefetch policy.
+	ReadAhead    bool `json:"readahead"`
+	ReadAheadSec int  `json:"readahead_sec,omitempty"`
+	// Let the snapshotter download the blobs of images from their registry into Dir when
+	// preparing their layers, so that nydusd needs no network access.
+	PopulateFromRegistry bool `json:"populate_from_registry,omitempty" nydusd:"-"`
+	// Blobs downloaded at the same time when populating Dir, defaults to 4
+	PopulateConcurrency int `json:"populate_concurrency,omitempty" nydusd:"-"`
 
 	// Registry backend configs
 	Host               string `json:"host,omitempty"`
@@ -79,21 +239,112 @@ type BackendConfig struct {
 	RegistryToken      string `json:"registry_token,omitempty" secret:"true"`
 	BlobURLScheme      string `json:"blob_url_scheme,omitempty"`
 	BlobRedirectedHost string `json:"blob_redirected_host,omitempty"`
+	// Force how credentials are passed to the registry, "basic" or "bearer". Empty guesses
+	// from the credential, a password without username being taken as a bearer token.
+	AuthScheme string `json:"auth_scheme,omitempty"`
+	// Token service used instead of the one announced by WWW-Authenticate, for registries
+	// behind gateways hiding it, and the scope requested from it. The scope may contain the
+	// {host} and {repo} placeholders, e.g. "repository:{repo}:pull".
+	TokenURL   string `json:"token_url,omitempty"`
+	TokenScope string `json:"token_scope,omitempty"`
+	// Caching proxy the HEAD, manifest and token requests are sent to, with the original
+	// URL as path, i.e. "<metadata_proxy>/<scheme>/<host>/<path>". The snapshotter points
+	// registry backends to its own one if enabled.
+	MetadataProxy string `json:"metadata_proxy,omitempty"`
+	// Registry the HEAD, manifest and token requests are sent to instead of Host, as
+	// "<scheme>://<host>", e.g. the origin when Host is a mirror only serving blobs.
+	// nydusd versions without split metadata fetching ignore it and send every request to
+	// Host, see the "Mirror scope" section of docs/configure_nydus.md.
+	MetadataURL string `json:"metadata_url,omitempty"`
+	// TLS settings of the requests to MetadataURL, which are the ones of the registry while
+	// the skip_verify, ca_cert_files, cert_file and key_file of the backend are the mirror's.
+	MetadataSkipVerify  bool     `json:"metadata_skip_verify,omitempty"`
+	MetadataCACertFiles []string `json:"metadata_ca_cert_files,omitempty"`
+	MetadataCertFile    string   `json:"metadata_cert_file,omitempty"`
+	MetadataKeyFile     string   `json:"metadata_key_file,omitempty"`
 
 	// Shared by oss and s3 backend configs
-	EndPoint        string `json:"endpoint,omitempty"`
-	AccessKeyID     string `json:"access_key_id,omitempty" secret:"true"`
-	AccessKeySecret string `json:"access_key_secret,omitempty" secret:"true"`
-	BucketName      string `json:"bucket_name,omitempty"`
-	ObjectPrefix    string `json:"object_prefix,omitempty"`
+	EndPoint string `json:"endpoint,omitempty"`
+	// Endpoints tried in order, e.g. a primary and a secondary region for disaster recovery.
+	// It takes precedence over EndPoint, which is kept set to its first element.
+	Endpoints       []string `json:"endpoints,omitempty"`
+	AccessKeyID     string   `json:"access_key_id,omitempty" secret:"true"`
+	AccessKeySecret string   `json:"access_key_secret,omitempty" secret:"true"`
+	BucketName      string   `json:"bucket_name,omitempty"`
+	ObjectPrefix    string   `json:"object_prefix,omitempty"`
+	// Server-side encryption requested on reads, e.g. "AES256" or "aws:kms".
+	SSEType string `json:"sse_type,omitempty"`
+	// KMS key ID required by "aws:kms". It only identifies the key and is not a secret.
+	SSEKMSKeyID string `json:"sse_kms_key_id,omitempty"`
+	// Lifetime of presigned blob URLs. Zero keeps nydusd's default.
+	PresignExpirySec int `json:"presign_expiry_sec,omitempty"`
+	// Address buckets as "<endpoint>/<bucket>" instead of "<bucket>.<endpoint>", as required
+	// by MinIO and most on-premises stores. It is turned on when supplementing for endpoints
+	// that can't be prefixed with a bucket name, e.g. "10.0.0.1:9000" or "minio:9000".
+	PathStyle bool `json:"path_style,omitempty"`
 
 	// S3-specific config
 	Region string `json:"region,omitempty"`
+	// Region used to sign requests, for S3-compatible stores behind a global endpoint
+	// whose signing region differs from the bucket region. Defaults to Region.
+	SigningRegion string `json:"signing_region,omitempty"`
+	// Session token of temporary credentials, e.g. issued by AWS STS
+	SessionToken string `json:"session_token,omitempty" secret:"true"`
+
+	// OSS-specific config
+	// RAM role assumed through STS. The access keys are then only used to request temporary
+	// credentials, which replace them in the configuration handed to nydusd.
+	RoleARN         string `json:"role_arn,omitempty" nydusd:"-"`
+	RoleSessionName string `json:"role_session_name,omitempty" nydusd:"-"`
+	// STS endpoint, defaults to sts.aliyuncs.com
+	STSEndpoint string `json:"sts_endpoint,omitempty" nydusd:"-"`
+	// Lifetime of the temporary credentials. Zero keeps the default of STS, an hour.
+	RoleDurationSec int `json:"role_duration_sec,omitempty" nydusd:"-"`
+
+	// Azure blob backend configs, ObjectPrefix applies as well
+	AccountName   string `json:"account_name,omitempty"`
+	ContainerName string `json:"container_name,omitempty"`
+	SASToken      string `json:"sas_token,omitempty" secret:"true"`
+	// Authenticate with the managed identity of the node instead of a SAS token
+	ManagedIdentity bool `json:"managed_identity,omitempty"`
+	// Client ID of a user-assigned managed identity, empty selects the system-assigned one
+	ManagedIdentityClientID string `json:"managed_identity_client_id,omitempty"`
+
+	// GCS backend configs, BucketName and ObjectPrefix apply as well
+	// Service account key file, empty uses the workload identity or the default credentials of the node
+	CredentialsFile  string `json:"credentials_file,omitempty"`
+	WorkloadIdentity bool   `json:"workload_identity,omitempty"`
+	// Append "<host>/<repo>/" of the image to ObjectPrefix, for buckets storing the blobs
+	// of each image under its own prefix
+	ObjectPrefixFromImage bool `json:"object_prefix_from_image,omitempty" nydusd:"-"`
+
+	// HTTP backend configs
+	BaseURL  string `json:"base_url,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty" secret:"true"`
+	// Extra headers sent with every request
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// IPFS backend configs
+	GatewayURL string `json:"gateway_url,omitempty"`
+	// API socket of a local IPFS daemon, used instead of the gateway
+	APISocket string `json:"api_socket,omitempty"`
+	// CIDs of the blobs keyed by blob ID, filled from the label.NydusIPFSBlobCIDs image label
+	BlobCIDs map[string]string `json:"blob_cids,omitempty"`
 
 	// Shared by registry, oss, and s3
 	Scheme      string   `json:"scheme,omitempty"`
 	SkipVerify  bool     `json:"skip_verify,omitempty"`
 	CACertFiles []string `json:"ca_cert_files,omitempty"`
+	// CA bundle trusted in addition to the system roots, and the client certificate and
+	// key presented to the registry, for private registries using an internal CA.
+	CAFile   string `json:"ca_file,omitempty"`
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// Access public-read storage without signing requests. Unlike empty credentials, which
+	// may be filled later or make nydusd fall back to an instance role, no credential is
+	// ever filled in then.
+	Anonymous bool `json:"anonymous,omitempty"`
 
 	// Below configs are common configs shared by all backends
 	Proxy struct {
@@ -102,34 +353,307 @@ type BackendConfig struct {
 		PingURL       string `json:"ping_url,omitempty"`
 		CheckInterval int    `json:"check_interval,omitempty"`
 		UseHTTP       bool   `json:"use_http,omitempty"`
+		// Credential of the proxy, looked up by proxy host when not set in the template
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty" secret:"true"`
+		// Hosts reached without the proxy, in the format of the NO_PROXY environment variable.
+		// The snapshotter drops the proxy from the configuration if the backend host matches.
+		NoProxy []string `json:"no_proxy,omitempty"`
 	} `json:"proxy,omitempty"`
+	// Once the backend and all fallback backends are unreachable, serve reads of cached data
+	// and report the backend as degraded instead of failing all reads. Only honored on the
+	// primary backend, the snapshotter sets it for all images if so configured.
+	CacheOnlyOnOutage bool `json:"cache_only_on_outage,omitempty"`
+	// Request signer, registered with RegisterRequestSigner, providing the material to sign
+	// requests with, e.g. the headers of an internal HMAC scheme
+	Signer string `json:"signer,omitempty" nydusd:"-"`
+
 	Timeout        int `json:"timeout,omitempty"`
 	ConnectTimeout int `json:"connect_timeout,omitempty"`
 	RetryLimit     int `json:"retry_limit,omitempty"`
+	// How long nydusd keeps probing an idle connection before reusing it, and how long
+	// an idle connection may stay in the pool. Zero leaves nydusd's defaults untouched.
+	KeepAliveSec   int `json:"keep_alive_sec,omitempty"`
+	IdleTimeoutSec int `json:"idle_timeout_sec,omitempty"`
+	// Cap of blob fetch bandwidth so nydusd does not starve other traffic on shared
+	// nodes. Zero means unlimited.
+	MaxBandwidthBytesPerSec int `json:"max_bandwidth_bytes_per_sec,omitempty"`
+	// Bytes allowed above the bandwidth cap in a burst. Zero keeps nydusd's default of
+	// one second worth of traffic.
+	MaxBandwidthBurstBytes int `json:"max_bandwidth_burst_bytes,omitempty"`
+	// Concurrent requests nydusd issues for a single blob. Zero means unlimited.
+	MaxConcurrencyPerBlob int `json:"max_concurrency_per_blob,omitempty"`
+
+	// Mirrors nydusd fails over to by itself, tried in order of health. Unlike the mirrors
+	// of hosts.toml, which the snapshotter resolves into Host, they are passed on as is.
+	Mirrors []RegistryMirrorConfig `json:"mirrors,omitempty"`
+
+	// Skip mirror selection when supplementing, only set by WithoutMirrors
+	DisableMirrors bool `json:"-"`
+}
+
+// RegistryMirrorConfig is a mirror of the registry backend in the format of nydusd.
+type RegistryMirrorConfig struct {
+	Host                string            `json:"host"`
+	Headers             map[string]string `json:"headers,omitempty"`
+	HealthCheckInterval int               `json:"health_check_interval,omitempty"`
+	FailureLimit        uint8             `json:"failure_limit,omitempty"`
+	PingURL             string            `json:"ping_url,omitempty"`
+}
+
+// endpoints returns the object storage endpoints in the order they are tried.
+func (c *BackendConfig) endpoints() []string {
+	if len(c.Endpoints) > 0 {
+		return c.Endpoints
+	}
+	if c.EndPoint != "" {
+		return []string{c.EndPoint}
+	}
+	return nil
+}
+
+// applyEndpoints makes the endpoint list win over the singular endpoint.
+func (c *BackendConfig) applyEndpoints() {
+	if len(c.Endpoints) > 0 {
+		c.EndPoint = c.Endpoints[0]
+	}
+}
+
+// applyPathStyle turns path-style addressing on if the bucket name can't be prepended to
+// the host of an endpoint.
+func (c *BackendConfig) applyPathStyle() {
+	for _, e := range c.endpoints() {
+		if !c.PathStyle && !virtualHostable(e) {
+			log.L.Infof("Using path-style addressing for endpoint %s", e)
+			c.PathStyle = true
+		}
+	}
+}
+
+// virtualHostable tells whether the host of the endpoint e can have a bucket subdomain.
+// IP addresses and single-label names such as "localhost" or a service name can't.
+func virtualHostable(e string) bool {
+	if !strings.Contains(e, "://") {
+		e = "https://" + e
+	}
+	u, err := url.Parse(e)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return net.ParseIP(host) == nil && strings.Contains(host, ".")
+}
+
+// BlobFiles returns the blobs served by the localfs backend, either the single blob_file or
+// the regular files found in dir. nydusd looks up each blob by its ID in dir, so the blobs
+// don't need to be listed in the configuration.
+func (c *BackendConfig) BlobFiles() ([]string, error) {
+	if c.BlobFile != "" {
+		return []string{c.BlobFile}, nil
+	}
+	if c.Dir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read localfs dir")
+	}
+	var blobs []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			blobs = append(blobs, filepath.Join(c.Dir, entry.Name()))
+		}
+	}
+	return blobs, nil
+}
+
+var tokenScopePlaceholders = strings.NewReplacer("{host}", "", "{repo}", "")
+
+// expandTokenScope substitutes the registry host and repository into the token scope.
+func (c *BackendConfig) expandTokenScope() {
+	c.TokenScope = strings.NewReplacer("{host}", c.Host, "{repo}", c.Repo).Replace(c.TokenScope)
+}
+
+// fillAuth sets the registry credential as basic auth or bearer token according to AuthScheme.
+func (c *BackendConfig) fillAuth(kc *auth.PassKeyChain) {
+	if kc == nil || c.Anonymous {
+		return
+	}
+
+	bearer := kc.TokenBase()
+	switch c.AuthScheme {
+	case authSchemeBasic:
+		bearer = false
+	case authSchemeBearer:
+		bearer = true
+	}
+
+	if bearer {
+		c.RegistryToken = kc.Password
+	} else {
+		c.Auth = kc.ToBase64()
+	}
+}
+
+// ChainedBackend is an entry of the backend chain of a configuration.
+type ChainedBackend struct {
+	Type   StorageBackendType
+	Config *BackendConfig
+}
+
+// backendChain lists the primary backend followed by the fallback ones.
+func backendChain(backendType StorageBackendType, bc *BackendConfig, fallback *FallbackBackend,
+	fallbacks []FallbackBackend) []ChainedBackend {
+	chain := []ChainedBackend{{Type: backendType, Config: bc}}
+	if fallback != nil {
+		chain = append(chain, ChainedBackend{Type: fallback.BackendType, Config: &fallback.Config})
+	}
+	for i := range fallbacks {
+		chain = append(chain, ChainedBackend{Type: fallbacks[i].BackendType, Config: &fallbacks[i].Config})
+	}
+	return chain
+}
+
+// FallbackBackend is a secondary backend nydusd tries when the primary backend is unavailable,
+// e.g. a registry behind an OSS bucket.
+type FallbackBackend struct {
+	BackendType StorageBackendType `json:"type"`
+	Config      BackendConfig      `json:"config"`
 }
 
 type DeviceConfig struct {
 	ID      string `json:"id,omitempty"`
 	Backend struct {
-		BackendType string        `json:"type"`
-		Config      BackendConfig `json:"config"`
+		BackendType StorageBackendType `json:"type"`
+		Config      BackendConfig      `json:"config"`
 	} `json:"backend"`
-	Cache struct {
+	FallbackBackend *FallbackBackend `json:"fallback_backend,omitempty"`
+	// More backends tried in order after FallbackBackend
+	FallbackBackends []FallbackBackend `json:"fallback_backends,omitempty"`
+	Cache            struct {
 		CacheType  string `json:"type"`
 		Compressed bool   `json:"compressed,omitempty"`
-		Config     struct {
+		// See FscacheDaemonConfig for the tradeoff of verifying chunk digests.
+		VerifyDigest *bool `json:"validate,omitempty"`
+		Config       struct {
 			WorkDir           string `json:"work_dir"`
 			DisableIndexedMap bool   `json:"disable_indexed_map"`
 		} `json:"config"`
 	} `json:"cache"`
 }
 
+// stripJSONComments blanks out `//` and `/* */` comments outside of JSON strings, so that
+// e.g. "http://mirror" is kept intact. Newlines are kept to preserve error line numbers.
+func stripJSONComments(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	inString, escaped := false, false
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if inString {
+			out = append(out, c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(b) && b[i+1] == '/':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+			if i < len(b) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(b) && b[i+1] == '*':
+			for i += 2; i < len(b) && (b[i] != '*' || i+1 >= len(b) || b[i+1] != '/'); i++ {
+				if b[i] == '\n' {
+					out = append(out, '\n')
+				}
+			}
+			// Skip the closing "*/"
+			i++
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// applyBackendLabel replaces the primary backend of c with the one given in the
+// label.NydusBackend label, which has the same format as the backend of the template.
+func applyBackendLabel(c DaemonConfig, value string) error {
+	var b struct {
+		BackendType StorageBackendType `json:"type"`
+		Config      BackendConfig      `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(value), &b); err != nil {
+		return errors.Wrapf(err, "parse label %s", label.NydusBackend)
+	}
+	backendType, err := ParseStorageBackendType(b.BackendType.String())
+	if err != nil {
+		return errors.Wrapf(err, "invalid backend in label %s", label.NydusBackend)
+	}
+	if backendType == backendTypeNone {
+		return errors.Errorf("invalid backend type %q in label %s", backendType, label.NydusBackend)
+	}
+	if err := b.Config.Validate(); err != nil {
+		return errors.Wrapf(err, "validate backend config in label %s", label.NydusBackend)
+	}
+	b.Config.applyEndpoints()
+
+	switch cfg := c.(type) {
+	case *FuseDaemonConfig:
+		cfg.Device.Backend.BackendType = backendType
+		cfg.Device.Backend.Config = b.Config
+	case *FscacheDaemonConfig:
+		cfg.Config.BackendType = backendType
+		cfg.Config.BackendConfig = b.Config
+	}
+	return nil
+}
+
+// PopulatedLocalfs returns the localfs backend of c if the snapshotter is to download
+// the blobs into its directory, nil otherwise.
+func PopulatedLocalfs(c DaemonConfig) *BackendConfig {
+	backendType, bc := c.StorageBackend()
+	if backendType != backendTypeLocalfs || !bc.PopulateFromRegistry {
+		return nil
+	}
+	return bc
+}
+
+// DefaultWorkDir sets the cache work dir of c to <root>/cache unless it's already set.
+func DefaultWorkDir(c DaemonConfig, root string) {
+	workDir := filepath.Join(root, "cache")
+	switch cfg := c.(type) {
+	case *FuseDaemonConfig:
+		if cfg.Device.Cache.Config.WorkDir == "" {
+			cfg.Device.Cache.Config.WorkDir = workDir
+		}
+	case *FscacheDaemonConfig:
+		if cfg.Config.CacheConfig.WorkDir == "" {
+			cfg.Config.CacheConfig.WorkDir = workDir
+		}
+	}
+}
+
 // For nydusd as FUSE daemon. Serialize Daemon info and persist to a json file
 // We don't have to persist configuration file for fscache since its configuration
 // is passed through HTTP API.
 func DumpConfigFile(c interface{}, path string) error {
 	if config.IsBackendSourceEnabled() {
 		c = serializeWithSecretFilter(c)
+	} else {
+		c = nydusdConfig(c)
 	}
 	b, err := json.Marshal(c)
 	if err != nil {
@@ -168,174 +692,727 @@ func atomicWriteFile(path string, data []byte) (err error) {
 	return nil
 }
 
+// DumpConfigString dumps the configuration for nydusd, so tagged secrets are kept.
+// Fields registered with RegisterSecretFieldPath are left out.
 func DumpConfigString(c interface{}) (string, error) {
-	b, err := json.Marshal(c)
-	return string(b), err
+	v := nydusdConfig(c)
+	if hasRegisteredSecretFields() {
+		v = serializeWithoutRegisteredSecrets(c)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal config")
+	}
+	return string(b), nil
+}
+
+// DumpConfigTo streams the secret-filtered configuration to w, e.g. to be shown or compared.
+func DumpConfigTo(c interface{}, w io.Writer) error {
+	return json.NewEncoder(w).Encode(serializeWithSecretFilter(c))
+}
+
+// SupplementDaemonConfigResult describes what a daemon configuration was supplemented with.
+type SupplementDaemonConfigResult struct {
+	// Registry host the configuration points to, after docker.io/VPC normalization
+	// and mirror selection. Empty for non-registry backends.
+	Host    string
+	Backend StorageBackendType
+	// Whether credentials were found and filled into the configuration.
+	AuthFilled bool
+	// Scheme of the registry itself, regardless of mirror selection. Empty for non-registry
+	// backends.
+	Scheme string
 }
 
 // Achieve a daemon configuration from template or snapshotter's configuration
 func SupplementDaemonConfig(c DaemonConfig, imageID, snapshotID string,
 	vpcRegistry bool, labels map[string]string, params map[string]string) error {
+	_, err := SupplementDaemonConfigWithResult(c, imageID, snapshotID, vpcRegistry, labels, params)
+	return err
+}
+
+// SupplementInfoInterface provides the per-image information a configuration is supplemented with.
+type SupplementInfoInterface interface {
+	GetImageID() string
+	GetSnapshotID() string
+	IsVPCRegistry() bool
+	GetLabels() map[string]string
+	GetParams() map[string]string
+}
+
+// SupplementInfo is a plain SupplementInfoInterface implementation.
+type SupplementInfo struct {
+	ImageID     string
+	SnapshotID  string
+	VPCRegistry bool
+	Labels      map[string]string
+	Params      map[string]string
+}
 
+func (i *SupplementInfo) GetImageID() string           { return i.ImageID }
+func (i *SupplementInfo) GetSnapshotID() string        { return i.SnapshotID }
+func (i *SupplementInfo) IsVPCRegistry() bool          { return i.VPCRegistry }
+func (i *SupplementInfo) GetLabels() map[string]string { return i.Labels }
+func (i *SupplementInfo) GetParams() map[string]string { return i.Params }
+
+const minimalFscacheConfig = `{"type": "bootstrap", "config": {"backend_type": "registry", "cache_type": "fscache"}}`
+
+// MinimalConfigForImage builds the smallest configuration pulling the image from its registry,
+// without template. Credentials are filled as usual, e.g. from labels.
+func MinimalConfigForImage(fsDriver string, info SupplementInfoInterface) (DaemonConfig, error) {
+	var c DaemonConfig
+	switch fsDriver {
+	case config.FsDriverFscache:
+		cfg := &FscacheDaemonConfig{}
+		if err := json.Unmarshal([]byte(minimalFscacheConfig), cfg); err != nil {
+			return nil, errors.Wrap(err, "build fscache configuration")
+		}
+		c = cfg
+	case config.FsDriverFusedev:
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}, Mode: "direct"}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		c = cfg
+	default:
+		return nil, errors.Errorf("unsupported, fs driver %q", fsDriver)
+	}
+
+	if err := SupplementDaemonConfig(c, info.GetImageID(), info.GetSnapshotID(), info.IsVPCRegistry(),
+		info.GetLabels(), info.GetParams()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SupplementDaemonConfigWithResult is like SupplementDaemonConfig but also reports the values
+// computed while supplementing, e.g. for logging and metrics.
+func SupplementDaemonConfigWithResult(c DaemonConfig, imageID, snapshotID string,
+	vpcRegistry bool, labels map[string]string, params map[string]string) (*SupplementDaemonConfigResult, error) {
+	start := time.Now()
+	result, err := supplementDaemonConfig(c, imageID, snapshotID, vpcRegistry, labels, params)
+	backendType, _ := c.StorageBackend()
+	getSupplementObserver().ObserveSupplement(backendType, time.Since(start), err)
+	return result, err
+}
+
+// RefreshCredentials supplements a copy of template for the image and replaces the
+// credentials of the backends of c, a configuration supplemented from it earlier, with the
+// fresh ones. The mirror selected for c and everything else is kept, and no mirror is
+// probed. Credentials that can't be found anymore, like the ones of a deleted pull secret,
+// stay in place.
+func RefreshCredentials(c, template DaemonConfig, imageID, snapshotID string,
+	labels map[string]string, params map[string]string) error {
+	fresh := withoutMirrors(template)
+	if _, err := SupplementDaemonConfigWithResult(fresh, imageID, snapshotID, false, labels, params); err != nil {
+		return err
+	}
+
+	chain, freshChain := c.BackendChain(), fresh.BackendChain()
+	if len(chain) != len(freshChain) {
+		return errors.Errorf("backend chain of %s changed, reload the configuration instead", snapshotID)
+	}
+	for i, b := range chain {
+		b.Config.copyCredentials(freshChain[i].Config)
+	}
+	return nil
+}
+
+// ReselectMirror selects the mirror of the registry backends of c, a configuration
+// supplemented from template earlier, again, e.g. after the mirrors configuration changed.
+// Only the host and the settings of the selected mirror are replaced, the credentials and
+// everything else are kept. It returns whether the selection changed.
+func ReselectMirror(c, template DaemonConfig, imageID, snapshotID string,
+	labels map[string]string, params map[string]string) (bool, error) {
+	fresh := template.Clone()
+	if _, err := SupplementDaemonConfigWithResult(fresh, imageID, snapshotID, false, labels, params); err != nil {
+		return false, err
+	}
+
+	chain, freshChain := c.BackendChain(), fresh.BackendChain()
+	if len(chain) != len(freshChain) {
+		return false, errors.Errorf("backend chain of %s changed, reload the configuration instead", snapshotID)
+	}
+	changed := false
+	for i, b := range chain {
+		if b.Type == backendTypeRegistry && b.Config.copyMirror(freshChain[i].Config) {
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// copyMirror takes the mirror selected for from, and its settings, if it differs from
+// the one of c.
+func (c *BackendConfig) copyMirror(from *BackendConfig) bool {
+	if c.Host == from.Host && c.Scheme == from.Scheme && c.MetadataURL == from.MetadataURL {
+		return false
+	}
+	c.Host, c.Scheme = from.Host, from.Scheme
+	c.SkipVerify, c.CACertFiles = from.SkipVerify, from.CACertFiles
+	c.CertFile, c.KeyFile = from.CertFile, from.KeyFile
+	c.ConnectTimeout, c.Timeout = from.ConnectTimeout, from.Timeout
+	c.Headers = from.Headers
+	c.MetadataURL = from.MetadataURL
+	c.MetadataSkipVerify, c.MetadataCACertFiles = from.MetadataSkipVerify, from.MetadataCACertFiles
+	c.MetadataCertFile, c.MetadataKeyFile = from.MetadataCertFile, from.MetadataKeyFile
+	return true
+}
+
+// copyCredentials takes the credentials filled into from. Client certificates are only
+// taken if both point to the same host, as a selected mirror has its own.
+func (c *BackendConfig) copyCredentials(from *BackendConfig) {
+	for _, f := range []struct {
+		field *string
+		value string
+	}{
+		{&c.Auth, from.Auth},
+		{&c.RegistryToken, from.RegistryToken},
+		{&c.AccessKeyID, from.AccessKeyID},
+		{&c.AccessKeySecret, from.AccessKeySecret},
+		{&c.SessionToken, from.SessionToken},
+	} {
+		if f.value != "" {
+			*f.field = f.value
+		}
+	}
+	if len(from.Headers) > 0 {
+		headers := make(map[string]string, len(c.Headers)+len(from.Headers))
+		for name, value := range c.Headers {
+			headers[name] = value
+		}
+		for name, value := range from.Headers {
+			headers[name] = value
+		}
+		c.Headers = headers
+	}
+	if c.Host == from.Host && from.CertFile != "" {
+		c.CertFile, c.KeyFile = from.CertFile, from.KeyFile
+	}
+}
+
+// SupplementObserver is told how long each supplement took and whether it failed,
+// e.g. to feed a latency histogram. Most of the time is spent resolving credentials.
+type SupplementObserver interface {
+	ObserveSupplement(backend StorageBackendType, duration time.Duration, err error)
+}
+
+type noopSupplementObserver struct{}
+
+func (noopSupplementObserver) ObserveSupplement(StorageBackendType, time.Duration, error) {}
+
+var (
+	supplementObserverLock sync.RWMutex
+	supplementObserver     SupplementObserver = noopSupplementObserver{}
+)
+
+// SetSupplementObserver replaces the observer of SupplementDaemonConfig, nil restores the default no-op one.
+func SetSupplementObserver(o SupplementObserver) {
+	supplementObserverLock.Lock()
+	defer supplementObserverLock.Unlock()
+	if o == nil {
+		o = noopSupplementObserver{}
+	}
+	supplementObserver = o
+}
+
+func getSupplementObserver() SupplementObserver {
+	supplementObserverLock.RLock()
+	defer supplementObserverLock.RUnlock()
+	return supplementObserver
+}
+
+func supplementDaemonConfig(c DaemonConfig, imageID, snapshotID string,
+	vpcRegistry bool, labels map[string]string, params map[string]string) (*SupplementDaemonConfigResult, error) {
 	image, err := registry.ParseImage(imageID)
 	if err != nil {
-		return errors.Wrapf(err, "parse image %s", imageID)
+		return nil, errors.Wrapf(err, "parse image %s", imageID)
 	}
 
-	backendType, _ := c.StorageBackend()
+	if value, ok := labels[label.NydusBackend]; ok {
+		if err := applyBackendLabel(c, value); err != nil {
+			return nil, err
+		}
+	}
+
+	rawBackendType, _ := c.StorageBackend()
+	backendType, err := ParseStorageBackendType(rawBackendType.String())
+	if err != nil {
+		return nil, err
+	}
+	result := &SupplementDaemonConfigResult{Backend: backendType}
 
 	switch backendType {
 	case backendTypeRegistry:
-		registryHost := image.Host
-		if vpcRegistry {
-			registryHost = registry.ConvertToVPCHost(registryHost)
-		} else if registryHost == "docker.io" {
-			// For docker.io images, we should use index.docker.io
-			registryHost = "index.docker.io"
-		}
-
-		effectiveScheme, effectiveHost, caCerts := selectMirrorHost(config.GetMirrorsConfigDir(), registryHost)
-		// No mirror configured use the original registry host
-		if effectiveHost == "" {
-			effectiveHost = registryHost
-		}
-		// If no auth is provided, don't touch auth from provided nydusd configuration file.
-		// We don't validate the original nydusd auth from configuration file since it can be empty
-		// when repository is public.
-		keyChain := auth.GetRegistryKeyChain(imageID, labels)
-		c.Supplement(effectiveHost, image.Repo, snapshotID, params)
-		c.FillAuth(keyChain)
+		c.Supplement("", "", snapshotID, params)
 		_, bc := c.StorageBackend()
-		if len(caCerts) > 0 {
-			bc.CACertFiles = caCerts
-		}
-		if effectiveScheme != "" {
-			bc.Scheme = effectiveScheme
+		result.Scheme = bc.originScheme()
+		host, authFilled, err := supplementRegistryBackend(bc, image, imageID, vpcRegistry, labels)
+		if err != nil {
+			return nil, err
 		}
+		result.Host = host
+		result.AuthFilled = authFilled
+
+	// Cache-only configurations are used as is.
+	case backendTypeNone:
 
-	// For Localfs, OSS, and S3 backends, only the WorkDir needs to be supplemented.
-	case backendTypeLocalfs, backendTypeOss, backendTypeS3:
+	// For Localfs and HTTP backends, only the WorkDir needs to be supplemented.
+	case backendTypeLocalfs, backendTypeHTTP:
 		c.Supplement("", "", snapshotID, params)
-	default:
-		return errors.Errorf("unknown backend type %s", backendType)
+	case backendTypeOss, backendTypeS3:
+		c.Supplement("", "", snapshotID, params)
+		_, bc := c.StorageBackend()
+		if bc.SigningRegion == "" {
+			bc.SigningRegion = bc.Region
+		}
+		if err := applyBackendLabels(backendType, bc, labels); err != nil {
+			return nil, err
+		}
+		bc.applyPathStyle()
+		if bc.RoleARN != "" {
+			if err := bc.applySTSCredential(); err != nil {
+				return nil, err
+			}
+		}
+	case backendTypeIPFS:
+		c.Supplement("", "", snapshotID, params)
+		_, bc := c.StorageBackend()
+		if err := applyBlobCIDsLabel(bc, labels); err != nil {
+			return nil, err
+		}
+	case backendTypeAzblob, backendTypeGCS:
+		c.Supplement("", "", snapshotID, params)
+		_, bc := c.StorageBackend()
+		if bc.ObjectPrefixFromImage {
+			bc.ObjectPrefix += image.Host + "/" + image.Repo + "/"
+		}
+		if err := applyBackendLabels(backendType, bc, labels); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	if err := applyPrefetchPolicy(c, backendType, labels); err != nil {
+		return nil, err
+	}
+
+	if backendType != backendTypeNone {
+		_, bc := c.StorageBackend()
+		bc.applyProxy(config.GetProxyConfig())
+		bc.fillProxyAuth()
+		if config.GetCacheOnlyOnOutage() {
+			bc.CacheOnlyOnOutage = true
+		}
+		if backendType == backendTypeRegistry {
+			bc.applyMetadataCache(config.GetMetadataCacheConfig())
+		}
+	}
+
+	if backendType != backendTypeNone {
+		throttle := config.GetThrottleConfig()
+		for _, b := range c.BackendChain() {
+			b.Config.applyThrottle(throttle)
+		}
+	}
+
+	for _, b := range c.BackendChain()[1:] {
+		if err := supplementFallbackBackend(b, image, imageID, vpcRegistry, labels); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, b := range c.BackendChain() {
+		if b.Config.Signer == "" {
+			continue
+		}
+		authFilled, err := b.Config.applySigner(b.Type)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && authFilled {
+			result.AuthFilled = true
+		}
+	}
+
+	if err := postProcessConfig(c); err != nil {
+		return nil, err
+	}
+
+	return result, nil
 }
 
-// selectMirrorHost loads mirror configs for the given registry host and returns the host and
-// scheme of the first reachable mirror. If a mirror has no PingURL it is used unconditionally.
-// Falls back to (registryHost, "") when no mirror is configured or reachable.
-func selectMirrorHost(mirrorsConfigDir, registryHost string) (scheme string, host string, caCerts []string) {
-	mirrors, caCerts, err := LoadMirrorsConfig(mirrorsConfigDir, registryHost)
-	if err != nil {
-		log.L.Warnf("Failed to load mirrors config for %s: %v, falling back to origin", registryHost, err)
-		return "", registryHost, nil
+// registryClientCert returns the client certificate configured for the registry host.
+func registryClientCert(host string) (string, string, bool) {
+	if cert, ok := config.GetClientCert(host); ok {
+		return cert.CertFile, cert.KeyFile, true
 	}
+	return auth.GetAuthFileClientCert(host)
+}
 
-	client := &http.Client{Timeout: 3 * time.Second}
-	for _, mirror := range mirrors {
-		scheme, host, err = splitMirrorURL(mirror.Host)
+// supplementRegistryBackend points bc to the registry of the image, or to its first
+// available mirror, and fills the credential of the image, or the token of the token file
+// configured for its registry. It returns the selected host and whether a credential was filled.
+func supplementRegistryBackend(bc *BackendConfig, image registry.Image, imageID string,
+	vpcRegistry bool, labels map[string]string) (string, bool, error) {
+	// Rewritten images are fetched, and their credentials looked up, by the new name. The
+	// credentials of labels are meant for the registry the image is named by, so they are left.
+	ref, authLabels := imageID, labels
+	if rewritten, ok := config.RewriteImageRef(imageID); ok {
+		parsed, err := registry.ParseImage(rewritten)
 		if err != nil {
-			log.L.Warnf("Skipping due to Failing to split mirror host %s: %v", mirror.Host, err)
-			continue
+			return "", false, errors.Wrapf(err, "parse rewritten image %s", rewritten)
 		}
-		if mirror.PingURL == "" {
-			return scheme, host, caCerts
+		log.L.Debugf("Fetching image %s as %s", imageID, rewritten)
+		ref, authLabels, image = rewritten, nil, parsed
+	}
+	registryHost := image.Host
+	if vpcRegistry {
+		registryHost = registry.ConvertToVPCHost(registryHost)
+	} else if registryHost == "docker.io" {
+		// For docker.io images, we should use index.docker.io
+		registryHost = "index.docker.io"
+	}
+
+	// If no auth is provided, don't touch auth from provided nydusd configuration file.
+	// We don't validate the original nydusd auth from configuration file since it can be empty
+	// when repository is public.
+	var (
+		keyChain *auth.PassKeyChain
+		token    string
+	)
+	if bc.Anonymous {
+		auth.RecordCredentialUse(imageID, auth.SourceAnonymous)
+	} else if path, ok := config.GetTokenFile(image.Host, image.Repo); ok {
+		var err error
+		if token, err = readTokenFile(path); err != nil {
+			return "", false, errors.Wrapf(err, "token of %s", image.Host)
 		}
-		resp, pingErr := client.Get(mirror.PingURL)
-		if pingErr == nil {
-			resp.Body.Close()
-			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-				return scheme, host, caCerts
-			}
+		auth.RecordCredentialUse(imageID, auth.SourceTokenFile)
+	} else {
+		keyChain = auth.GetRegistryKeyChain(ref, authLabels)
+	}
+	if keyChain != nil && !keyChain.InScope(image.Repo) {
+		return "", false, errors.Errorf("credential for %s is restricted to repository scope %q, can't access %q",
+			registryHost, keyChain.Scope, image.Repo)
+	}
+	// nydusd can't exchange identity tokens itself, so it gets an access token.
+	if keyChain != nil && keyChain.IdentityToken != "" {
+		var err error
+		if keyChain, err = auth.ExchangeIdentityToken(bc.Scheme, registryHost, image.Repo, keyChain); err != nil {
+			return "", false, err
 		}
+	}
 
-		if resp != nil {
-			pingBody, _ := io.ReadAll(resp.Body)
-			log.L.Warnf("Mirror %s ping URL %s check failed with error %v, statusCode %d, response '%s', trying next mirror",
-				mirror.Host,
-				mirror.PingURL,
-				err,
-				resp.StatusCode,
-				string(pingBody),
-			)
-		} else {
-			log.L.Warnf("Mirror %s ping URL %s check failed with error %v, trying next mirror",
-				mirror.Host,
-				mirror.PingURL,
-				err,
-			)
+	var (
+		effectiveScheme, effectiveHost string
+		mirror                         *MirrorConfig
+	)
+	originScheme := bc.originScheme()
+	if !bc.DisableMirrors {
+		mirrorsConfig := config.GetMirrorsConfig()
+		mirrors, err := imageMirrors(mirrorsConfig, originScheme, registryHost, labels)
+		if err != nil {
+			return "", false, err
+		}
+		// Peers having the blobs of the image are closer than any mirror. They are not
+		// trusted with credentials, and don't serve the images fetched with them anyway.
+		if keyChain == nil && token == "" {
+			mirrors = append(peerMirrors(mirrorsConfig.FanOut, ref), mirrors...)
+		}
+		effectiveScheme, effectiveHost, mirror = pickMirror(mirrorsConfig, mirrors, registryHost)
+	}
+	// No mirror configured use the original registry host
+	if effectiveHost == "" {
+		effectiveHost = registryHost
+	}
+	bc.Host = effectiveHost
+	bc.Repo = image.Repo
+	bc.fillAuth(keyChain)
+	if token != "" {
+		bc.RegistryToken = token
+	}
+	if effectiveScheme != "" {
+		bc.Scheme = effectiveScheme
+	}
+	if err := applyBackendLabels(backendTypeRegistry, bc, labels); err != nil {
+		return "", false, err
+	}
+	if mirror != nil {
+		mirror.applyTimeouts(bc)
+		mirror.applyHeaders(bc)
+		if mirror.Scope == MirrorScopeBlobs {
+			// The registry is still verified, and authenticated to, as without the mirror.
+			bc.MetadataURL = originScheme + "://" + registryHost
+			bc.MetadataSkipVerify = bc.SkipVerify
+			bc.MetadataCACertFiles = bc.CACertFiles
+			bc.MetadataCertFile, bc.MetadataKeyFile, _ = registryClientCert(image.Host)
+		}
+		mirror.applyTLS(bc)
+	} else if certFile, keyFile, ok := registryClientCert(image.Host); ok {
+		// The certificate of the registry is never presented to its mirrors.
+		bc.CertFile = certFile
+		bc.KeyFile = keyFile
+	}
+	if bc.CertFile == "" && config.IsSpiffeHost(effectiveHost) {
+		svid, ok := spiffe.GetX509SVID()
+		if !ok {
+			return "", false, errors.Errorf("no X.509 SVID from the SPIFFE Workload API for %s yet", effectiveHost)
 		}
+		bc.CertFile = svid.CertFile
+		bc.KeyFile = svid.KeyFile
+		bc.CACertFiles = append(bc.CACertFiles, svid.BundleFile)
 	}
+	bc.expandTokenScope()
 
-	return "", registryHost, nil
+	return effectiveHost, keyChain != nil || token != "", nil
 }
 
-// splitMirrorURL splits a mirror host URL (e.g. "http://mirror:5000") into scheme and bare host.
-// Scheme is forced to be https if not present.
-func splitMirrorURL(mirrorHost string) (scheme, host string, err error) {
-	// url.Parse requires a scheme to properly works even if it doesn't returns an error
-	if !strings.HasPrefix(mirrorHost, "http://") && !strings.HasPrefix(mirrorHost, "https://") {
-		mirrorHost = "https://" + mirrorHost
+// supplementFallbackBackend prepares a fallback backend for the image. Only remote backends
+// are touched, and registry backends only when the template does not name a registry host.
+func supplementFallbackBackend(b ChainedBackend, image registry.Image, imageID string,
+	vpcRegistry bool, labels map[string]string) error {
+	//nolint:exhaustive
+	switch b.Type {
+	case backendTypeRegistry:
+		if b.Config.Host == "" {
+			if _, _, err := supplementRegistryBackend(b.Config, image, imageID, vpcRegistry, labels); err != nil {
+				return errors.Wrap(err, "supplement fallback backend")
+			}
+		} else {
+			b.Config.expandTokenScope()
+		}
+	case backendTypeOss, backendTypeS3:
+		if b.Config.SigningRegion == "" {
+			b.Config.SigningRegion = b.Config.Region
+		}
+		b.Config.applyPathStyle()
+		if b.Config.RoleARN != "" {
+			if err := b.Config.applySTSCredential(); err != nil {
+				return errors.Wrap(err, "supplement fallback backend")
+			}
+		}
 	}
-	value, err := url.Parse(mirrorHost)
-	if err != nil {
-		return "", "", err
+	b.Config.applyProxy(config.GetProxyConfig())
+	b.Config.fillProxyAuth()
+	if b.Type == backendTypeRegistry {
+		b.Config.applyMetadataCache(config.GetMetadataCacheConfig())
 	}
-	return value.Scheme, value.Host, nil
+	return nil
 }
 
-func serializeWithSecretFilter(obj interface{}) map[string]interface{} {
-	result := make(map[string]interface{})
-	value := reflect.ValueOf(obj)
-	typeOfObj := reflect.TypeOf(obj)
+// ConfigPostProcessor tweaks a supplemented configuration before it is handed to nydusd.
+type ConfigPostProcessor func(DaemonConfig) error
 
-	if value.Kind() == reflect.Ptr {
-		value = value.Elem()
-		typeOfObj = typeOfObj.Elem()
-	}
+var (
+	configPostProcessorsLock sync.RWMutex
+	configPostProcessors     []ConfigPostProcessor
+)
 
-	for i := 0; i < value.NumField(); i++ {
-		field := value.Field(i)
-		fieldType := typeOfObj.Field(i)
-		secretTag := fieldType.Tag.Get("secret")
-		jsonTags := strings.Split(fieldType.Tag.Get("json"), ",")
-		omitemptyTag := false
+// RegisterConfigPostProcessor adds a site specific processor run at the end of
+// SupplementDaemonConfig, after the processors registered before it. An error
+// fails the supplement.
+func RegisterConfigPostProcessor(p ConfigPostProcessor) {
+	configPostProcessorsLock.Lock()
+	defer configPostProcessorsLock.Unlock()
+	configPostProcessors = append(configPostProcessors, p)
+}
 
-		for _, tag := range jsonTags {
-			if tag == "omitempty" {
-				omitemptyTag = true
-				break
-			}
+func postProcessConfig(c DaemonConfig) error {
+	configPostProcessorsLock.RLock()
+	defer configPostProcessorsLock.RUnlock()
+	for _, p := range configPostProcessors {
+		if err := p(c); err != nil {
+			return errors.Wrap(err, "post-process config")
 		}
+	}
+	return nil
+}
 
-		if secretTag == "true" {
-			continue
+// getProxyKeyChain looks up the credential of a proxy host.
+// It is a variable so tests can substitute a different source.
+var getProxyKeyChain = auth.GetProxyKeyChain
+
+// applyThrottle fills the traffic limits of the backend not set by the template from
+// the node-wide ones. The burst goes along with the rate it belongs to.
+func (c *BackendConfig) applyThrottle(t config.ThrottleConfig) {
+	if c.MaxBandwidthBytesPerSec == 0 {
+		c.MaxBandwidthBytesPerSec = t.MaxBandwidthBytesPerSec
+		c.MaxBandwidthBurstBytes = t.MaxBandwidthBurstBytes
+	}
+	if c.MaxConcurrencyPerBlob == 0 {
+		c.MaxConcurrencyPerBlob = t.MaxConcurrencyPerBlob
+	}
+}
+
+// applyProxy points the backend to the node-wide proxy unless the template sets its own,
+// and drops the proxy if the backend host matches no_proxy.
+func (c *BackendConfig) applyProxy(p config.ProxyConfig) {
+	if c.Proxy.URL == "" && p.URL != "" {
+		c.Proxy.URL = p.URL
+		if len(c.Proxy.NoProxy) == 0 {
+			c.Proxy.NoProxy = p.NoProxy
 		}
+	}
+	if c.Proxy.URL == "" || len(c.Proxy.NoProxy) == 0 {
+		return
+	}
 
-		if field.Kind() == reflect.Ptr && field.IsNil() {
-			continue
+	target := c.remoteURL()
+	if target == nil {
+		return
+	}
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  c.Proxy.URL,
+		HTTPSProxy: c.Proxy.URL,
+		NoProxy:    strings.Join(c.Proxy.NoProxy, ","),
+	}).ProxyFunc()
+	if proxy, err := proxyFunc(target); err == nil && proxy == nil {
+		log.L.Debugf("Bypassing proxy %s for %s", c.Proxy.URL, target.Host)
+		c.Proxy.URL = ""
+		c.Proxy.PingURL = ""
+		c.Proxy.Username = ""
+		c.Proxy.Password = ""
+	}
+}
+
+// applyMetadataCache points the registry backend to the metadata cache of the snapshotter
+// unless the template sets a metadata proxy of its own.
+func (c *BackendConfig) applyMetadataCache(m config.MetadataCacheConfig) {
+	if c.MetadataProxy != "" || m.Address == "" {
+		return
+	}
+	c.MetadataProxy = "http://" + m.Address
+	c.allowMetadataCacheHosts()
+}
+
+// allowMetadataCacheHosts lets the metadata cache forward the requests of the backend to its
+// registry or mirror.
+func (c *BackendConfig) allowMetadataCacheHosts() {
+	if u := c.remoteURL(); u != nil {
+		metacache.AllowHost(u)
+	}
+	if u, err := url.Parse(c.MetadataURL); err == nil && u.Host != "" {
+		metacache.AllowHost(u)
+	}
+}
+
+// AllowMetadataCacheHosts lets the metadata cache forward the requests of the running daemon
+// with the configuration c, e.g. after a restart of the snapshotter.
+func AllowMetadataCacheHosts(c DaemonConfig) {
+	for _, b := range c.BackendChain() {
+		if b.Type == backendTypeRegistry && b.Config.MetadataProxy != "" {
+			b.Config.allowMetadataCacheHosts()
 		}
+	}
+}
 
-		if omitemptyTag && reflect.DeepEqual(reflect.Zero(field.Type()).Interface(), field.Interface()) {
-			continue
+// remoteURL returns the URL of the service the backend talks to, nil if unknown.
+func (c *BackendConfig) remoteURL() *url.URL {
+	var target string
+	switch {
+	case c.Host != "":
+		target = c.Host
+	case c.EndPoint != "":
+		target = c.EndPoint
+	case c.BaseURL != "":
+		target = c.BaseURL
+	case c.GatewayURL != "":
+		target = c.GatewayURL
+	default:
+		return nil
+	}
+	if !strings.Contains(target, "://") {
+		scheme := c.Scheme
+		if scheme == "" {
+			scheme = "https"
 		}
+		target = scheme + "://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	return u
+}
+
+// fillProxyAuth sets the proxy credential unless the template already provides one.
+func (c *BackendConfig) fillProxyAuth() {
+	if c.Proxy.URL == "" || c.Proxy.Username != "" || c.Proxy.Password != "" {
+		return
+	}
+	u, err := url.Parse(c.Proxy.URL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	if kc := getProxyKeyChain(u.Host); kc != nil {
+		c.Proxy.Username = kc.Username
+		c.Proxy.Password = kc.Password
+	}
+}
 
-		//nolint:exhaustive
-		switch fieldType.Type.Kind() {
-		case reflect.Struct:
-			result[jsonTags[0]] = serializeWithSecretFilter(field.Interface())
-		case reflect.Ptr:
-			if fieldType.Type.Elem().Kind() == reflect.Struct {
-				result[jsonTags[0]] = serializeWithSecretFilter(field.Elem().Interface())
-			} else {
-				result[jsonTags[0]] = field.Elem().Interface()
+// originScheme returns the scheme of the registry the backend is configured for.
+func (c *BackendConfig) originScheme() string {
+	if c.Scheme == "" {
+		return "https"
+	}
+	return c.Scheme
+}
+
+// bucketNamePattern matches bucket names valid for both S3 and OSS.
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// applyBackendLabels overrides backend parameters with the per-image values of the
+// label.NydusBackend* labels. Labels not applicable to the backend type are ignored.
+func applyBackendLabels(backendType StorageBackendType, bc *BackendConfig, labels map[string]string) error {
+	switch backendType {
+	case backendTypeOss, backendTypeS3, backendTypeAzblob, backendTypeGCS:
+		if prefix, ok := labels[label.NydusBackendObjectPrefix]; ok {
+			if strings.HasPrefix(prefix, "/") || strings.Contains(prefix, "..") {
+				return errors.Errorf("invalid object prefix %q in label %s", prefix, label.NydusBackendObjectPrefix)
 			}
-		default:
-			result[jsonTags[0]] = field.Interface()
+			bc.ObjectPrefix = prefix
 		}
+		if backendType == backendTypeAzblob {
+			break
+		}
+		if bucket, ok := labels[label.NydusBackendBucket]; ok {
+			if !bucketNamePattern.MatchString(bucket) {
+				return errors.Errorf("invalid bucket name %q in label %s", bucket, label.NydusBackendBucket)
+			}
+			bc.BucketName = bucket
+		}
+	case backendTypeRegistry:
+		if host, ok := labels[label.NydusBackendRedirectedHost]; ok {
+			if u, err := url.Parse("//" + host); err != nil || host == "" || u.Host != host {
+				return errors.Errorf("invalid host %q in label %s", host, label.NydusBackendRedirectedHost)
+			}
+			bc.BlobRedirectedHost = host
+		}
+	}
+	return nil
+}
+
+// cidPattern loosely matches CIDv0 (base58) and CIDv1 (multibase) strings.
+var cidPattern = regexp.MustCompile(`^[a-zA-Z0-9]{46,}$`)
+
+// applyBlobCIDsLabel adds the blob CIDs listed in the label.NydusIPFSBlobCIDs label, e.g.
+// "sha256:<hex>=<cid>,sha256:<hex>=<cid>", to the ones of the template.
+func applyBlobCIDsLabel(bc *BackendConfig, labels map[string]string) error {
+	value, ok := labels[label.NydusIPFSBlobCIDs]
+	if !ok {
+		return nil
 	}
 
-	return result
+	cids := make(map[string]string, len(bc.BlobCIDs))
+	for id, cid := range bc.BlobCIDs {
+		cids[id] = cid
+	}
+	for _, pair := range strings.Split(value, ",") {
+		d, cid, found := strings.Cut(strings.TrimSpace(pair), "=")
+		blobDigest, err := digest.Parse(d)
+		if !found || err != nil || !cidPattern.MatchString(cid) {
+			return errors.Errorf("invalid blob CID %q in label %s", pair, label.NydusIPFSBlobCIDs)
+		}
+		cids[blobDigest.Encoded()] = cid
+	}
+	bc.BlobCIDs = cids
+	return nil
 }
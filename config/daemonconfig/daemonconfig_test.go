@@ -7,10 +7,23 @@
 package daemonconfig
 
 import (
+	"bytes"
 	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -157,4 +170,1987 @@ func TestSerializeWithSecretFilter(t *testing.T) {
 	require.NotEqual(t, newCfg.Device.Backend.Config.Auth, cfg.Device.Backend.Config.Auth)
 	require.NotNil(t, newCfg.AmplifyIo)
 	require.Equal(t, *newCfg.AmplifyIo, *cfg.AmplifyIo)
+
+	// Fields not encoded by encoding/json are not filtered into the output either.
+	withoutMirrors := cfg.WithoutMirrors()
+	jsonData, err = json.Marshal(serializeWithSecretFilter(withoutMirrors))
+	require.NoError(t, err)
+	require.NotContains(t, string(jsonData), `"-"`)
+	hash, err := cfg.ConfigHash()
+	require.NoError(t, err)
+	disabled := cfg.Clone()
+	_, bc := disabled.StorageBackend()
+	bc.DisableMirrors = true
+	disabledHash, err := disabled.ConfigHash()
+	require.NoError(t, err)
+	require.Equal(t, hash, disabledHash)
+}
+
+func TestBackendKeepAlive(t *testing.T) {
+	buf := []byte(`{
+  "device": {
+    "backend": {
+      "type": "oss",
+      "config": {
+        "endpoint": "oss-cn-hangzhou.aliyuncs.com",
+        "keep_alive_sec": 30,
+        "idle_timeout_sec": 90
+      }
+    }
+  }
+}`)
+	var cfg FuseDaemonConfig
+	require.NoError(t, json.Unmarshal(buf, &cfg))
+	bc := &cfg.Device.Backend.Config
+	require.Equal(t, 30, bc.KeepAliveSec)
+	require.Equal(t, 90, bc.IdleTimeoutSec)
+	require.NoError(t, bc.Validate())
+	require.Empty(t, bc.warnings())
+
+	output, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	require.Contains(t, string(output), `"keep_alive_sec":30`)
+	require.Contains(t, string(output), `"idle_timeout_sec":90`)
+
+	// Unset knobs are not serialized so nydusd keeps its defaults.
+	output, err = json.Marshal(BackendConfig{})
+	require.NoError(t, err)
+	require.NotContains(t, string(output), "keep_alive_sec")
+	require.NotContains(t, string(output), "idle_timeout_sec")
+
+	bc.IdleTimeoutSec = 10
+	require.NoError(t, bc.Validate())
+	require.Len(t, bc.warnings(), 1)
+
+	bc.IdleTimeoutSec = -1
+	require.Error(t, bc.Validate())
+	bc.IdleTimeoutSec = 0
+	bc.KeepAliveSec = -1
+	require.Error(t, bc.Validate())
+}
+
+func TestSigningRegion(t *testing.T) {
+	newConfig := func(signingRegion string) *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeS3
+		cfg.Device.Backend.Config.Region = "us-east-1"
+		cfg.Device.Backend.Config.SigningRegion = signingRegion
+		return cfg
+	}
+
+	// Default to the bucket region.
+	cfg := newConfig("")
+	err := SupplementDaemonConfig(cfg, "docker.io/library/busybox:latest", "1", false, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "us-east-1", cfg.Device.Backend.Config.SigningRegion)
+
+	// Keep an explicit override, serialized separately from region.
+	cfg = newConfig("auto")
+	err = SupplementDaemonConfig(cfg, "docker.io/library/busybox:latest", "1", false, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "auto", cfg.Device.Backend.Config.SigningRegion)
+
+	filtered, err := json.Marshal(serializeWithSecretFilter(cfg))
+	require.NoError(t, err)
+	require.Contains(t, string(filtered), `"region":"us-east-1"`)
+	require.Contains(t, string(filtered), `"signing_region":"auto"`)
+}
+
+func TestPathStyle(t *testing.T) {
+	for endpoint, pathStyle := range map[string]bool{
+		"oss-cn-hangzhou.aliyuncs.com": false,
+		"https://s3.example.com:9000":  false,
+		"minio:9000":                   true,
+		"http://10.0.0.1:9000":         true,
+		"[fd00::1]:9000":               true,
+	} {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeS3
+		cfg.Device.Backend.Config.EndPoint = endpoint
+		require.NoError(t, cfg.Device.Backend.Config.Validate(), endpoint)
+		require.NoError(t, SupplementDaemonConfig(cfg, "docker.io/library/busybox:latest", "1", false, nil, nil))
+		require.Equal(t, pathStyle, cfg.Device.Backend.Config.PathStyle, endpoint)
+	}
+
+	// Configured path-style addressing is kept for any endpoint.
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeOss
+	cfg.Device.Backend.Config.EndPoint = "oss.example.com"
+	cfg.Device.Backend.Config.PathStyle = true
+	require.NoError(t, SupplementDaemonConfig(cfg, "docker.io/library/busybox:latest", "1", false, nil, nil))
+	require.True(t, cfg.Device.Backend.Config.PathStyle)
+
+	for _, endpoint := range []string{"minio:0", "minio:65536", "https://:9000"} {
+		require.Error(t, (&BackendConfig{EndPoint: endpoint}).Validate(), endpoint)
+	}
+}
+
+func TestDumpTo(t *testing.T) {
+	fuseCfg := &FuseDaemonConfig{Device: &DeviceConfig{}, Mode: "direct"}
+	fuseCfg.Device.Backend.BackendType = backendTypeRegistry
+	fuseCfg.Device.Backend.Config.Host = "registry.example.com"
+	fuseCfg.Device.Backend.Config.Auth = "token_token"
+
+	fscacheCfg, err := LoadFscacheConfig("../../misc/snapshotter/nydusd-config.fscache.json")
+	require.NoError(t, err)
+	fscacheCfg.Config.BackendConfig.Auth = "token_token"
+
+	for _, cfg := range []DaemonConfig{fuseCfg, fscacheCfg} {
+		var buf bytes.Buffer
+		require.NoError(t, cfg.DumpTo(&buf))
+		require.NotContains(t, buf.String(), "token_token")
+
+		// The stream is DumpString without the secrets.
+		str, err := cfg.DumpString()
+		require.NoError(t, err)
+		require.Contains(t, str, "token_token")
+		filtered, err := json.Marshal(serializeWithSecretFilter(cfg))
+		require.NoError(t, err)
+		var streamed, dumped map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &streamed))
+		require.NoError(t, json.Unmarshal(filtered, &dumped))
+		require.Equal(t, dumped, streamed)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, fuseCfg.DumpTo(&buf))
+	require.Contains(t, buf.String(), `"host":"registry.example.com"`)
+}
+
+func TestSnapshotterOnlyFields(t *testing.T) {
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	load := func() *FuseDaemonConfig {
+		cfg, err := LoadFuseConfig("../../misc/snapshotter/nydusd-config.fusedev.json")
+		require.NoError(t, err)
+		return cfg
+	}
+	plain := load()
+	cfg := load()
+	cfg.Device.Backend.Config.Signer = "hmac"
+	cfg.Device.Backend.Config.ObjectPrefixFromImage = true
+	cfg.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeS3}
+	cfg.Device.FallbackBackend.Config.RoleARN = "arn:aws:iam::123456789012:role/nydus"
+
+	// They are neither handed to nydusd nor hashed.
+	str, err := cfg.DumpString()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, cfg.DumpTo(&buf))
+	file := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, cfg.DumpFile(file))
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	for _, dumped := range []string{str, buf.String(), string(b)} {
+		require.NotContains(t, dumped, "signer")
+		require.NotContains(t, dumped, "object_prefix_from_image")
+		require.NotContains(t, dumped, "role_arn")
+		require.Contains(t, dumped, `"type":"s3"`)
+	}
+	plain.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeS3}
+	plainHash, err := plain.ConfigHash()
+	require.NoError(t, err)
+	hash, err := cfg.ConfigHash()
+	require.NoError(t, err)
+	require.Equal(t, plainHash, hash)
+
+	// The configuration itself keeps them.
+	require.Equal(t, "hmac", cfg.Device.Backend.Config.Signer)
+	require.NotEmpty(t, cfg.Device.FallbackBackend.Config.RoleARN)
+}
+
+func TestRegisterSecretFieldPath(t *testing.T) {
+	t.Cleanup(func() {
+		secretFieldPathsLock.Lock()
+		secretFieldPaths = map[string]struct{}{}
+		secretFieldPathsLock.Unlock()
+	})
+
+	fuseCfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	fuseCfg.Device.Backend.Config.Host = "registry.example.com"
+	fuseCfg.Device.Backend.Config.Repo = "library/busybox"
+	fuseCfg.Device.Backend.Config.Auth = "token_token"
+	fscacheCfg := &FscacheDaemonConfig{}
+	require.NoError(t, json.Unmarshal([]byte(`{"config":{"backend_config":{"host":"registry.example.com"}}}`), fscacheCfg))
+
+	dump := func(c interface{}) string {
+		b, err := json.Marshal(serializeWithSecretFilter(c))
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	// Only tagged fields are filtered by default.
+	require.Contains(t, dump(fuseCfg), "registry.example.com")
+
+	RegisterSecretFieldPath("backend.config.host")
+	require.NotContains(t, dump(fuseCfg), "registry.example.com")
+	require.Contains(t, dump(fuseCfg), "library/busybox")
+	// DumpString is handed to nydusd, so it keeps the tagged secrets but omits registered ones.
+	str, err := fuseCfg.DumpString()
+	require.NoError(t, err)
+	require.NotContains(t, str, "registry.example.com")
+	require.Contains(t, str, "library/busybox")
+	require.Contains(t, str, "token_token")
+	// The fscache layout nests the backend under a different path.
+	require.Contains(t, dump(fscacheCfg), "registry.example.com")
+
+	RegisterSecretFieldPath("config.backend_config.host")
+	require.NotContains(t, dump(fscacheCfg), "registry.example.com")
+}
+
+func TestSupplementDaemonConfigWithResult(t *testing.T) {
+	newConfig := func() *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		return cfg
+	}
+
+	cfg := newConfig()
+	result, err := SupplementDaemonConfigWithResult(cfg, "busybox:latest", "1", false, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "index.docker.io", result.Host)
+	require.Equal(t, backendTypeRegistry, result.Backend)
+	require.Equal(t, "index.docker.io", cfg.Device.Backend.Config.Host)
+	require.Equal(t, "library/busybox", cfg.Device.Backend.Config.Repo)
+
+	cfg = newConfig()
+	labels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "pass",
+	}
+	result, err = SupplementDaemonConfigWithResult(cfg, "registry.cn-hangzhou.aliyuncs.com/test/app:latest", "1", true, labels, nil)
+	require.NoError(t, err)
+	require.Equal(t, "registry-vpc.cn-hangzhou.aliyuncs.com", result.Host)
+	require.Equal(t, result.Host, cfg.Device.Backend.Config.Host)
+	require.True(t, result.AuthFilled)
+
+	cfg = newConfig()
+	cfg.Device.Backend.BackendType = backendTypeOss
+	result, err = SupplementDaemonConfigWithResult(cfg, "busybox:latest", "1", false, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, result.Host)
+	require.Equal(t, backendTypeOss, result.Backend)
+}
+
+func TestRefreshCredentials(t *testing.T) {
+	template := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	template.Device.Backend.BackendType = backendTypeRegistry
+	template.Device.Backend.Config.Timeout = 5
+
+	// A mirror selected earlier and a template edited since are both kept.
+	cfg := template.Clone().(*FuseDaemonConfig)
+	cfg.Device.Backend.Config.Host = "mirror.local"
+	cfg.Device.Backend.Config.Auth = "old"
+	cfg.Device.Backend.Config.Headers = map[string]string{"X-Mirror": "1"}
+	template.Device.Backend.Config.Timeout = 10
+
+	labels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "pass",
+	}
+	require.NoError(t, RefreshCredentials(cfg, template, "registry.example.com/app:latest", "1", labels, nil))
+	bc := cfg.Device.Backend.Config
+	require.Equal(t, "mirror.local", bc.Host)
+	require.Equal(t, 5, bc.Timeout)
+	require.Equal(t, "1", bc.Headers["X-Mirror"])
+	require.NotEqual(t, "old", bc.Auth)
+	require.NotEmpty(t, bc.Auth)
+
+	// Credentials that are gone stay in place.
+	auth := bc.Auth
+	require.NoError(t, RefreshCredentials(cfg, template, "registry.example.com/app:latest", "1", nil, nil))
+	require.Equal(t, auth, cfg.Device.Backend.Config.Auth)
+}
+
+func TestBackendBandwidthLimit(t *testing.T) {
+	var cfg FscacheDaemonConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"config":{"backend_type":"registry","backend_config":{"max_bandwidth_bytes_per_sec":10485760}}}`), &cfg))
+	bc := &cfg.Config.BackendConfig
+	require.Equal(t, 10485760, bc.MaxBandwidthBytesPerSec)
+	require.NoError(t, bc.Validate())
+
+	output, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, output, `"max_bandwidth_bytes_per_sec":10485760`)
+
+	// Zero means unlimited and is left out so nydusd does not throttle.
+	bc.MaxBandwidthBytesPerSec = 0
+	require.NoError(t, bc.Validate())
+	output, err = cfg.DumpString()
+	require.NoError(t, err)
+	require.NotContains(t, output, "max_bandwidth_bytes_per_sec")
+
+	bc.MaxBandwidthBytesPerSec = -1
+	require.Error(t, bc.Validate())
+}
+
+func TestNewDaemonConfigStrict(t *testing.T) {
+	tmpDir := t.TempDir()
+	fusePath := filepath.Join(tmpDir, "fuse.json")
+	require.NoError(t, os.WriteFile(fusePath, []byte(`{"device":{"backend":{"type":"registry","config":{"timout":5}}}}`), 0600))
+	fscachePath := filepath.Join(tmpDir, "fscache.json")
+	require.NoError(t, os.WriteFile(fscachePath, []byte(`{"config":{"backend_type":"registry","backend_config":{"timout":5}}}`), 0600))
+
+	for driver, path := range map[string]string{config.FsDriverFusedev: fusePath, config.FsDriverFscache: fscachePath} {
+		cfg, err := NewDaemonConfig(driver, path)
+		require.NoError(t, err, driver)
+		_, bc := cfg.StorageBackend()
+		require.Equal(t, 0, bc.Timeout)
+
+		_, err = NewDaemonConfigStrict(driver, path)
+		require.Error(t, err, driver)
+		require.Contains(t, err.Error(), `unknown field "timout"`)
+	}
+
+	_, err := NewDaemonConfigStrict(config.FsDriverFusedev, "../../misc/snapshotter/nydusd-config.fusedev.json")
+	require.NoError(t, err)
+	_, err = NewDaemonConfigStrict(config.FsDriverFscache, "../../misc/snapshotter/nydusd-config.fscache.json")
+	require.NoError(t, err)
+}
+
+func TestSupplementScopedCredential(t *testing.T) {
+	labels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "pass",
+		label.NydusImagePullScope:    "team-a",
+	}
+
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	err := SupplementDaemonConfig(cfg, "registry.example.com/team-a/app:latest", "1", false, labels, nil)
+	require.NoError(t, err)
+	require.Equal(t, "dXNlcjpwYXNz", cfg.Device.Backend.Config.Auth)
+
+	cfg = &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	err = SupplementDaemonConfig(cfg, "registry.example.com/team-b/app:latest", "1", false, labels, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `scope "team-a"`)
+	require.Empty(t, cfg.Device.Backend.Config.Auth)
+}
+
+func TestBackendServerSideEncryption(t *testing.T) {
+	bc := BackendConfig{SSEType: "aws:kms", SSEKMSKeyID: "arn:aws:kms:us-east-1:123456789012:key/abcd"}
+	require.NoError(t, bc.Validate())
+	output, err := json.Marshal(serializeWithSecretFilter(&bc))
+	require.NoError(t, err)
+	require.Contains(t, string(output), `"sse_type":"aws:kms"`)
+	require.Contains(t, string(output), `"sse_kms_key_id":"arn:aws:kms:us-east-1:123456789012:key/abcd"`)
+
+	bc.SSEKMSKeyID = ""
+	require.Error(t, bc.Validate())
+
+	bc.SSEType = "AES256"
+	require.NoError(t, bc.Validate())
+
+	// SSE disabled
+	bc = BackendConfig{}
+	require.NoError(t, bc.Validate())
+	output, err = json.Marshal(bc)
+	require.NoError(t, err)
+	require.NotContains(t, string(output), "sse_")
+}
+
+func TestParseStorageBackendType(t *testing.T) {
+	for _, s := range []string{"localfs", "oss", "registry", "s3"} {
+		bt, err := ParseStorageBackendType(s)
+		require.NoError(t, err)
+		require.True(t, bt.IsValid())
+		require.Equal(t, s, bt.String())
+	}
+
+	bt, err := ParseStorageBackendType("Registry")
+	require.NoError(t, err)
+	require.Equal(t, backendTypeRegistry, bt)
+
+	_, err = ParseStorageBackendType("ftp")
+	require.Error(t, err)
+	require.False(t, StorageBackendType("ftp").IsValid())
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"device":{"backend":{"type":"OSS"}}}`), 0600))
+	cfg, err := NewDaemonConfig(config.FsDriverFusedev, path)
+	require.NoError(t, err)
+	bt, _ = cfg.StorageBackend()
+	require.Equal(t, backendTypeOss, bt)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"device":{"backend":{"type":"ftp"}}}`), 0600))
+	_, err = NewDaemonConfig(config.FsDriverFusedev, path)
+	require.ErrorContains(t, err, `unknown backend type "ftp"`)
+
+	fuseCfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	fuseCfg.Device.Backend.BackendType = "ftp"
+	err = SupplementDaemonConfig(fuseCfg, "busybox:latest", "1", false, nil, nil)
+	require.ErrorContains(t, err, `unknown backend type "ftp"`)
+}
+
+func TestFallbackBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+	fusePath := filepath.Join(tmpDir, "fuse.json")
+	require.NoError(t, os.WriteFile(fusePath, []byte(`{
+  "device": {
+    "backend": {"type": "oss", "config": {"endpoint": "oss-cn-hangzhou.aliyuncs.com", "bucket_name": "blobs"}},
+    "fallback_backend": {"type": "registry", "config": {"host": "registry.example.com", "repo": "app"}}
+  }
+}`), 0600))
+	fscachePath := filepath.Join(tmpDir, "fscache.json")
+	require.NoError(t, os.WriteFile(fscachePath, []byte(`{
+  "type": "bootstrap",
+  "config": {
+    "backend_type": "oss",
+    "backend_config": {"endpoint": "oss-cn-hangzhou.aliyuncs.com", "bucket_name": "blobs"},
+    "fallback_backend": {"type": "registry", "config": {"host": "registry.example.com", "repo": "app"}}
+  }
+}`), 0600))
+
+	for driver, path := range map[string]string{config.FsDriverFusedev: fusePath, config.FsDriverFscache: fscachePath} {
+		cfg, err := NewDaemonConfig(driver, path)
+		require.NoError(t, err, driver)
+
+		bt, bc := cfg.StorageBackend()
+		require.Equal(t, backendTypeOss, bt)
+		require.Equal(t, "blobs", bc.BucketName)
+
+		bt, bc = cfg.FallbackStorageBackend()
+		require.Equal(t, backendTypeRegistry, bt)
+		require.Equal(t, "registry.example.com", bc.Host)
+
+		output, err := cfg.DumpString()
+		require.NoError(t, err)
+		require.Contains(t, output, `"fallback_backend":{"type":"registry","config":{`)
+		require.Contains(t, output, `"host":"registry.example.com","repo":"app"`)
+	}
+
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	bt, bc := cfg.FallbackStorageBackend()
+	require.Empty(t, bt)
+	require.Nil(t, bc)
+	output, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.NotContains(t, output, "fallback_backend")
+
+	require.NoError(t, os.WriteFile(fusePath, []byte(`{"device":{"backend":{"type":"oss"},"fallback_backend":{"type":"ftp"}}}`), 0600))
+	_, err = NewDaemonConfig(config.FsDriverFusedev, fusePath)
+	require.ErrorContains(t, err, "invalid fallback backend")
+}
+
+func TestDefaultWorkDir(t *testing.T) {
+	root := t.TempDir()
+
+	fuseCfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	DefaultWorkDir(fuseCfg, root)
+	require.Equal(t, filepath.Join(root, "cache"), fuseCfg.Device.Cache.Config.WorkDir)
+
+	fuseCfg.Device.Cache.Config.WorkDir = "/var/cache/nydus"
+	DefaultWorkDir(fuseCfg, root)
+	require.Equal(t, "/var/cache/nydus", fuseCfg.Device.Cache.Config.WorkDir)
+
+	// Supplement keeps the work dir unless the caller provides one.
+	fuseCfg.Supplement("", "", "1", nil)
+	require.Equal(t, "/var/cache/nydus", fuseCfg.Device.Cache.Config.WorkDir)
+	fuseCfg.Supplement("", "", "1", map[string]string{CacheDir: "/cache"})
+	require.Equal(t, "/cache", fuseCfg.Device.Cache.Config.WorkDir)
+
+	fscacheCfg, err := LoadFscacheConfig("../../misc/snapshotter/nydusd-config.fscache.json")
+	require.NoError(t, err)
+	DefaultWorkDir(fscacheCfg, root)
+	require.Equal(t, filepath.Join(root, "cache"), fscacheCfg.Config.CacheConfig.WorkDir)
+
+	fscacheCfg.Config.CacheConfig.WorkDir = "/var/cache/nydus"
+	DefaultWorkDir(fscacheCfg, root)
+	require.Equal(t, "/var/cache/nydus", fscacheCfg.Config.CacheConfig.WorkDir)
+}
+
+func TestLoadConfigWithComments(t *testing.T) {
+	content := `{
+  // The registry backend
+  "device": {
+    "backend": {
+      "type": "registry", /* inline */
+      "config": {
+        "host": "http://mirror.example.com//path",
+        "repo": "library/a\"//b"
+      }
+    }
+  },
+  /*
+   * Direct mode.
+   */
+  "mode": "direct"
+}
+`
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+
+	_, err := LoadFuseConfig(p)
+	require.Error(t, err)
+
+	cfg, err := LoadFuseConfig(p, WithComments())
+	require.NoError(t, err)
+	require.Equal(t, "http://mirror.example.com//path", cfg.Device.Backend.Config.Host)
+	require.Equal(t, `library/a"//b`, cfg.Device.Backend.Config.Repo)
+	require.Equal(t, "direct", cfg.Mode)
+
+	_, err = NewDaemonConfig(config.FsDriverFusedev, p, WithComments(), WithDisallowUnknownFields())
+	require.NoError(t, err)
+}
+
+func TestCanonicalize(t *testing.T) {
+	load := func() *FuseDaemonConfig {
+		cfg, err := LoadFuseConfig("../../misc/snapshotter/nydusd-config.fusedev.json")
+		require.NoError(t, err)
+		return cfg
+	}
+
+	a := load()
+	_, bc := a.StorageBackend()
+	bc.Scheme = "https"
+	bc.Host = "registry.example.com"
+	bc.Proxy.URL = "http://proxy:8080"
+	bc.Proxy.NoProxy = []string{"10.0.0.0/8", "internal.example.com"}
+	bc.CACertFiles = []string{"/etc/nydus/a.pem", "/etc/nydus/b.pem"}
+	a.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeS3}
+	a.Device.FallbackBackend.Config.EndPoint = "https://s3.example.com"
+	a.Device.FallbackBackend.Config.ObjectPrefix = "nydus/"
+
+	b := load()
+	_, bc = b.StorageBackend()
+	bc.Scheme = "HTTPS"
+	bc.Host = "registry.example.com/"
+	bc.Proxy.URL = "HTTP://proxy:8080/"
+	bc.Proxy.NoProxy = []string{"internal.example.com", "10.0.0.0/8"}
+	caCertFiles := []string{"/etc/nydus/b.pem", "/etc/nydus/a.pem"}
+	bc.CACertFiles = caCertFiles
+	b.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeS3}
+	b.Device.FallbackBackend.Config.EndPoint = "HTTPS://s3.example.com//"
+	b.Device.FallbackBackend.Config.ObjectPrefix = "nydus/"
+
+	dumpA, err := a.DumpString()
+	require.NoError(t, err)
+	dumpB, err := b.DumpString()
+	require.NoError(t, err)
+	require.NotEqual(t, dumpA, dumpB)
+
+	a.Canonicalize()
+	b.Canonicalize()
+	dumpA, err = a.DumpString()
+	require.NoError(t, err)
+	dumpB, err = b.DumpString()
+	require.NoError(t, err)
+	require.Equal(t, dumpA, dumpB)
+	require.Equal(t, "nydus/", b.Device.FallbackBackend.Config.ObjectPrefix)
+	// Lists are sorted as copies.
+	require.Equal(t, []string{"/etc/nydus/b.pem", "/etc/nydus/a.pem"}, caCertFiles)
+}
+
+func TestCanonicalize_Mirrors(t *testing.T) {
+	load := func(mirrors ...RegistryMirrorConfig) *FuseDaemonConfig {
+		cfg, err := LoadFuseConfig("../../misc/snapshotter/nydusd-config.fusedev.json")
+		require.NoError(t, err)
+		cfg.Device.Backend.Config.Mirrors = mirrors
+		return cfg
+	}
+	m1 := RegistryMirrorConfig{Host: "https://mirror1.example.com", PingURL: "https://mirror1.example.com/v2"}
+	m2 := RegistryMirrorConfig{Host: "https://mirror2.example.com", FailureLimit: 5}
+	m2Alt := RegistryMirrorConfig{Host: "HTTPS://mirror2.example.com/", FailureLimit: 3}
+
+	a, b := load(m1, m2, m2Alt), load(m2, m1, m2Alt)
+	dumpA, err := a.DumpString()
+	require.NoError(t, err)
+	dumpB, err := b.DumpString()
+	require.NoError(t, err)
+	require.NotEqual(t, dumpA, dumpB)
+
+	hashA, err := a.ConfigHash()
+	require.NoError(t, err)
+	hashB, err := b.ConfigHash()
+	require.NoError(t, err)
+	require.Equal(t, hashA, hashB)
+	// Mirrors of the same host keep their order.
+	hashC, err := load(m1, m2Alt, m2).ConfigHash()
+	require.NoError(t, err)
+	require.NotEqual(t, hashA, hashC)
+
+	shared := b.Device.Backend.Config.Mirrors
+	b.Canonicalize()
+	require.Equal(t, []string{"https://mirror1.example.com", "https://mirror2.example.com", "https://mirror2.example.com"},
+		[]string{b.Device.Backend.Config.Mirrors[0].Host, b.Device.Backend.Config.Mirrors[1].Host, b.Device.Backend.Config.Mirrors[2].Host})
+	require.Equal(t, uint8(5), b.Device.Backend.Config.Mirrors[1].FailureLimit)
+	// The mirrors are sorted as a copy.
+	require.Equal(t, []RegistryMirrorConfig{m2, m1, m2Alt}, shared)
+}
+
+func TestMaxConfigBytes(t *testing.T) {
+	content, err := os.ReadFile("../../misc/snapshotter/nydusd-config.fusedev.json")
+	require.NoError(t, err)
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, content, 0600))
+
+	_, err = LoadFuseConfig(p, WithMaxConfigBytes(int64(len(content))))
+	require.NoError(t, err)
+	_, err = LoadFuseConfig(p, WithMaxConfigBytes(int64(len(content)-1)))
+	require.ErrorContains(t, err, "exceeds the limit")
+
+	// Trailing whitespace is still accounted for by the default limit.
+	padded := append(content, bytes.Repeat([]byte(" "), int(DefaultMaxConfigBytes)-len(content))...)
+	require.NoError(t, os.WriteFile(p, padded, 0600))
+	_, err = LoadFuseConfig(p)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(p, append(padded, ' '), 0600))
+	_, err = NewDaemonConfig(config.FsDriverFusedev, p)
+	require.ErrorContains(t, err, "exceeds the limit")
+}
+
+func TestConfigHash(t *testing.T) {
+	load := func() *FuseDaemonConfig {
+		cfg, err := LoadFuseConfig("../../misc/snapshotter/nydusd-config.fusedev.json")
+		require.NoError(t, err)
+		cfg.Device.Backend.Config.Host = "mirror.example.com"
+		cfg.Device.Backend.Config.Scheme = "https"
+		return cfg
+	}
+
+	a, b := load(), load()
+	hashA, err := a.ConfigHash()
+	require.NoError(t, err)
+	hashB, err := b.ConfigHash()
+	require.NoError(t, err)
+	require.Equal(t, hashA, hashB)
+	require.Contains(t, hashA, "sha256:")
+
+	// Secrets and equivalent spellings do not change the hash.
+	b.FillAuth(&auth.PassKeyChain{Username: "user", Password: "rotated"})
+	b.Device.Backend.Config.Scheme = "HTTPS"
+	hashB, err = b.ConfigHash()
+	require.NoError(t, err)
+	require.Equal(t, hashA, hashB)
+	require.Equal(t, "HTTPS", b.Device.Backend.Config.Scheme)
+
+	b.Device.Backend.Config.Host = "other-mirror.example.com"
+	hashB, err = b.ConfigHash()
+	require.NoError(t, err)
+	require.NotEqual(t, hashA, hashB)
+}
+
+func TestFscacheWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+		return p
+	}
+	fscacheTemplate := `{"type": "bootstrap", "config": {"backend_type": "registry", "backend_config": {},
+		"cache_type": "fscache", "cache_config": {"work_dir": %q}}}`
+
+	workDir := filepath.Join(dir, "fscache", "work")
+	cfg, err := LoadFscacheConfig(write("fscache.json", fmt.Sprintf(fscacheTemplate, workDir)))
+	require.NoError(t, err)
+	require.Equal(t, workDir, cfg.FscacheWorkDir())
+	// Loading doesn't create it, starting a daemon does.
+	require.NoDirExists(t, workDir)
+	require.NoError(t, EnsureFscacheWorkDir(cfg))
+	info, err := os.Stat(workDir)
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+	require.Zero(t, info.Mode().Perm()&^FscacheWorkDirMode)
+
+	_, err = LoadFscacheConfig(write("fscache.json", fmt.Sprintf(fscacheTemplate, "relative/work")))
+	require.ErrorContains(t, err, "must be an absolute path")
+
+	notDir := write("file", "")
+	cfg, err = LoadFscacheConfig(write("fscache.json", fmt.Sprintf(fscacheTemplate, notDir)))
+	require.NoError(t, err)
+	require.Error(t, EnsureFscacheWorkDir(cfg))
+
+	// The fusedev loader does not apply the fscache requirements.
+	fuseCfg, err := LoadFuseConfig(write("fuse.json",
+		`{"device": {"backend": {"type": "registry", "config": {}}, "cache": {"config": {"work_dir": "relative/work"}}}}`))
+	require.NoError(t, err)
+	require.Equal(t, "relative/work", fuseCfg.Device.Cache.Config.WorkDir)
+}
+
+func TestVerifyDigest(t *testing.T) {
+	fuseCfg, err := LoadFuseConfig("../../misc/snapshotter/nydusd-config.fusedev.json")
+	require.NoError(t, err)
+	fscacheCfg, err := LoadFscacheConfig("../../misc/snapshotter/nydusd-config.fscache.json")
+	require.NoError(t, err)
+
+	for _, c := range []DaemonConfig{fuseCfg, fscacheCfg} {
+		dumped, err := c.DumpString()
+		require.NoError(t, err)
+		require.NotContains(t, dumped, `"validate"`)
+	}
+
+	verify := true
+	fuseCfg.Device.Cache.VerifyDigest = &verify
+	fscacheCfg.Config.CacheConfig.VerifyDigest = &verify
+
+	dumped, err := fuseCfg.DumpString()
+	require.NoError(t, err)
+	var fuseOut map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(dumped), &fuseOut))
+	require.Equal(t, true, fuseOut["device"].(map[string]interface{})["cache"].(map[string]interface{})["validate"])
+
+	dumped, err = fscacheCfg.DumpString()
+	require.NoError(t, err)
+	var fscacheOut map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(dumped), &fscacheOut))
+	cacheConfig := fscacheOut["config"].(map[string]interface{})["cache_config"].(map[string]interface{})
+	require.Equal(t, true, cacheConfig["validate"])
+}
+
+func TestBackendPresignExpiry(t *testing.T) {
+	bc := BackendConfig{BucketName: "nydus", PresignExpirySec: 3600}
+	require.NoError(t, bc.Validate())
+	require.Empty(t, bc.warnings())
+	dumped, err := DumpConfigString(&bc)
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"presign_expiry_sec":3600`)
+
+	bc.PresignExpirySec = maxPresignExpirySec + 1
+	require.NoError(t, bc.Validate())
+	require.Len(t, bc.warnings(), 1)
+	require.Contains(t, bc.warnings()[0], "presign_expiry_sec")
+
+	bc.PresignExpirySec = -1
+	require.ErrorContains(t, bc.Validate(), "presign_expiry_sec")
+
+	bc.PresignExpirySec = 0
+	dumped, err = DumpConfigString(&bc)
+	require.NoError(t, err)
+	require.NotContains(t, dumped, "presign_expiry_sec")
+}
+
+func TestClone(t *testing.T) {
+	cfg, err := LoadFuseConfig("../../misc/snapshotter/nydusd-config.fusedev.json")
+	require.NoError(t, err)
+	verify := true
+	cfg.Device.Cache.VerifyDigest = &verify
+	cfg.Device.Backend.Config.CACertFiles = []string{"/etc/ca.pem"}
+	cfg.Device.Backend.Config.Proxy.URL = "http://proxy:8080"
+	cfg.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeOss}
+	want, err := cfg.DumpString()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clone := cfg.Clone().(*FuseDaemonConfig)
+			clone.Device.Cache.VerifyDigest = nil
+			clone.Device.Backend.Config.CACertFiles[0] = "/tmp/other.pem"
+			clone.Device.Backend.Config.Proxy.URL = ""
+			clone.Device.FallbackBackend.Config.Host = "mirror.example.com"
+			clone.Supplement("registry.example.com", "library/nginx", "1", nil)
+			if _, err := cfg.DumpString(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	fscacheCfg, err := LoadFscacheConfig("../../misc/snapshotter/nydusd-config.fscache.json")
+	require.NoError(t, err)
+	clone := fscacheCfg.Clone().(*FscacheDaemonConfig)
+	clone.Config.BackendConfig.Host = "registry.example.com"
+	require.Empty(t, fscacheCfg.Config.BackendConfig.Host)
+}
+
+func TestFillAuthScheme(t *testing.T) {
+	cases := []struct {
+		scheme    string
+		kc        auth.PassKeyChain
+		wantAuth  string
+		wantToken string
+	}{
+		{"", auth.PassKeyChain{Username: "user", Password: "pass"}, "dXNlcjpwYXNz", ""},
+		{"", auth.PassKeyChain{Password: "token"}, "", "token"},
+		{authSchemeBasic, auth.PassKeyChain{Username: "user", Password: "pass"}, "dXNlcjpwYXNz", ""},
+		{authSchemeBasic, auth.PassKeyChain{Password: "token"}, "OnRva2Vu", ""},
+		{authSchemeBearer, auth.PassKeyChain{Username: "user", Password: "pass"}, "", "pass"},
+		{authSchemeBearer, auth.PassKeyChain{Password: "token"}, "", "token"},
+	}
+	for _, tc := range cases {
+		fuseCfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		fuseCfg.Device.Backend.Config.AuthScheme = tc.scheme
+		fuseCfg.FillAuth(&tc.kc)
+		require.Equal(t, tc.wantAuth, fuseCfg.Device.Backend.Config.Auth)
+		require.Equal(t, tc.wantToken, fuseCfg.Device.Backend.Config.RegistryToken)
+
+		fscacheCfg, err := LoadFscacheConfig("../../misc/snapshotter/nydusd-config.fscache.json")
+		require.NoError(t, err)
+		fscacheCfg.Config.BackendConfig.AuthScheme = tc.scheme
+		fscacheCfg.FillAuth(&tc.kc)
+		require.Equal(t, tc.wantAuth, fscacheCfg.Config.BackendConfig.Auth)
+		require.Equal(t, tc.wantToken, fscacheCfg.Config.BackendConfig.RegistryToken)
+	}
+
+	bc := BackendConfig{AuthScheme: "digest"}
+	require.ErrorContains(t, bc.Validate(), "invalid auth_scheme")
+}
+
+func TestNoneBackend(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+		return p
+	}
+
+	_, err := LoadFuseConfig(write("no-cache.json", `{"device": {"backend": {"type": "none", "config": {}}}}`))
+	require.ErrorContains(t, err, "cache work_dir is required")
+
+	workDir := filepath.Join(dir, "cache")
+	p := write("cache-only.json", fmt.Sprintf(
+		`{"device": {"backend": {"type": "None", "config": {}}, "cache": {"type": "blobcache", "config": {"work_dir": %q}}}}`, workDir))
+	cfg, err := NewDaemonConfig(config.FsDriverFusedev, p)
+	require.NoError(t, err)
+	backendType, _ := cfg.StorageBackend()
+	require.Equal(t, backendTypeNone, backendType)
+	require.Empty(t, cfg.HealthCheck())
+
+	before, err := cfg.DumpString()
+	require.NoError(t, err)
+	result, err := SupplementDaemonConfigWithResult(cfg, "docker.io/library/nginx:latest", "1", false, nil,
+		map[string]string{CacheDir: "/other"})
+	require.NoError(t, err)
+	require.Equal(t, backendTypeNone, result.Backend)
+	require.Empty(t, result.Host)
+	after, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+
+	_, err = LoadFscacheConfig(write("fscache.json",
+		`{"type": "bootstrap", "config": {"backend_type": "none", "backend_config": {}, "cache_type": "fscache"}}`))
+	require.ErrorContains(t, err, "cache work_dir is required")
+
+	_, err = LoadFuseConfig(write("fallback.json", fmt.Sprintf(
+		`{"device": {"backend": {"type": "registry", "config": {}}, "fallback_backend": {"type": "none", "config": {}},
+		"cache": {"config": {"work_dir": %q}}}}`, workDir)))
+	require.ErrorContains(t, err, "invalid fallback backend")
+}
+
+func TestSupplementBackendLabels(t *testing.T) {
+	newConfig := func(backendType StorageBackendType) *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendType
+		cfg.Device.Backend.Config.BucketName = "template-bucket"
+		cfg.Device.Backend.Config.ObjectPrefix = "template/"
+		return cfg
+	}
+
+	cfg := newConfig(backendTypeS3)
+	_, err := SupplementDaemonConfigWithResult(cfg, "busybox:latest", "1", false, map[string]string{
+		label.NydusBackendObjectPrefix: "images/busybox/",
+		label.NydusBackendBucket:       "team-a.blobs",
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "images/busybox/", cfg.Device.Backend.Config.ObjectPrefix)
+	require.Equal(t, "team-a.blobs", cfg.Device.Backend.Config.BucketName)
+
+	// Template defaults are kept without labels.
+	cfg = newConfig(backendTypeOss)
+	_, err = SupplementDaemonConfigWithResult(cfg, "busybox:latest", "1", false, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "template/", cfg.Device.Backend.Config.ObjectPrefix)
+	require.Equal(t, "template-bucket", cfg.Device.Backend.Config.BucketName)
+
+	for _, labels := range []map[string]string{
+		{label.NydusBackendBucket: "Invalid_Bucket"},
+		{label.NydusBackendObjectPrefix: "../escape/"},
+	} {
+		_, err = SupplementDaemonConfigWithResult(newConfig(backendTypeOss), "busybox:latest", "1", false, labels, nil)
+		require.Error(t, err)
+	}
+
+	cfg = newConfig(backendTypeRegistry)
+	_, err = SupplementDaemonConfigWithResult(cfg, "busybox:latest", "1", false, map[string]string{
+		label.NydusBackendRedirectedHost: "blobs.example.com:8443",
+		label.NydusBackendBucket:         "ignored",
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "blobs.example.com:8443", cfg.Device.Backend.Config.BlobRedirectedHost)
+	require.Equal(t, "template-bucket", cfg.Device.Backend.Config.BucketName)
+
+	_, err = SupplementDaemonConfigWithResult(newConfig(backendTypeRegistry), "busybox:latest", "1", false,
+		map[string]string{label.NydusBackendRedirectedHost: "http://blobs.example.com/path"}, nil)
+	require.Error(t, err)
+}
+
+func TestProxyAuth(t *testing.T) {
+	defer func(f func(string) *auth.PassKeyChain) { getProxyKeyChain = f }(getProxyKeyChain)
+	getProxyKeyChain = func(host string) *auth.PassKeyChain {
+		if host == "proxy.example.com:3128" {
+			return &auth.PassKeyChain{Username: "proxy-user", Password: "proxy-pass"}
+		}
+		return nil
+	}
+
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.Backend.Config.Proxy.URL = "http://proxy.example.com:3128"
+	_, err := SupplementDaemonConfigWithResult(cfg, "busybox:latest", "1", false, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "proxy-user", cfg.Device.Backend.Config.Proxy.Username)
+	require.Equal(t, "proxy-pass", cfg.Device.Backend.Config.Proxy.Password)
+
+	// nydusd gets the password, the filtered dump does not.
+	dumped, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, dumped, "proxy-pass")
+	filtered, err := json.Marshal(serializeWithSecretFilter(cfg))
+	require.NoError(t, err)
+	require.Contains(t, string(filtered), "proxy-user")
+	require.NotContains(t, string(filtered), "proxy-pass")
+
+	// Credentials of the template are kept.
+	cfg = &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeOss
+	cfg.Device.Backend.Config.Proxy.URL = "http://proxy.example.com:3128"
+	cfg.Device.Backend.Config.Proxy.Username = "template-user"
+	_, err = SupplementDaemonConfigWithResult(cfg, "busybox:latest", "1", false, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "template-user", cfg.Device.Backend.Config.Proxy.Username)
+	require.Empty(t, cfg.Device.Backend.Config.Proxy.Password)
+}
+
+func TestNodeProxy(t *testing.T) {
+	defer func(f func(string) *auth.PassKeyChain) { getProxyKeyChain = f }(getProxyKeyChain)
+	getProxyKeyChain = func(string) *auth.PassKeyChain { return nil }
+
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:       t.TempDir(),
+		DaemonMode: string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{ProxyConfig: config.ProxyConfig{
+			URL: "http://proxy.example.com:3128", NoProxy: []string{".internal.example.com", "10.0.0.0/8"},
+		}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	supplement := func(backendType StorageBackendType, bc BackendConfig) BackendConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendType
+		cfg.Device.Backend.Config = bc
+		require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+		return cfg.Device.Backend.Config
+	}
+
+	// Backends without a proxy use the node-wide one.
+	bc := supplement(backendTypeRegistry, BackendConfig{})
+	require.Equal(t, "http://proxy.example.com:3128", bc.Proxy.URL)
+
+	// Hosts matching no_proxy are reached directly.
+	bc = supplement(backendTypeS3, BackendConfig{EndPoint: "s3.internal.example.com"})
+	require.Empty(t, bc.Proxy.URL)
+	bc = supplement(backendTypeS3, BackendConfig{EndPoint: "http://10.1.2.3:9000"})
+	require.Empty(t, bc.Proxy.URL)
+
+	// The proxy of the template, along with its own no_proxy list, overrides the node-wide one.
+	template := BackendConfig{EndPoint: "s3.internal.example.com"}
+	template.Proxy.URL = "http://other-proxy:8080"
+	template.Proxy.NoProxy = []string{"s3.example.com"}
+	bc = supplement(backendTypeS3, template)
+	require.Equal(t, "http://other-proxy:8080", bc.Proxy.URL)
+
+	template.Proxy.NoProxy = []string{"bad entry"}
+	require.Error(t, template.Validate())
+}
+
+func TestMetadataCache(t *testing.T) {
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:       t.TempDir(),
+		DaemonMode: string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{
+			MetadataCacheConfig: config.MetadataCacheConfig{Address: "127.0.0.1:8765"},
+		},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	supplement := func(backendType StorageBackendType, bc BackendConfig) BackendConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendType
+		cfg.Device.Backend.Config = bc
+		require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+		return cfg.Device.Backend.Config
+	}
+
+	bc := supplement(backendTypeRegistry, BackendConfig{})
+	require.Equal(t, "http://127.0.0.1:8765", bc.MetadataProxy)
+
+	bc = supplement(backendTypeRegistry, BackendConfig{MetadataProxy: "http://cache.example.com"})
+	require.Equal(t, "http://cache.example.com", bc.MetadataProxy)
+
+	bc = supplement(backendTypeS3, BackendConfig{EndPoint: "s3.example.com"})
+	require.Empty(t, bc.MetadataProxy)
+
+	require.Error(t, (&BackendConfig{MetadataProxy: "127.0.0.1:8765"}).Validate())
+}
+
+func TestClientCert(t *testing.T) {
+	cert := config.ClientCertConfig{CertFile: "/etc/nydus/client.crt", KeyFile: "/etc/nydus/client.key"}
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:       t.TempDir(),
+		DaemonMode: string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{
+			AuthConfig: config.AuthConfig{ClientCerts: map[string]config.ClientCertConfig{"registry.internal:5000": cert}},
+		},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	supplement := func(ref string, labels map[string]string) BackendConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		require.NoError(t, SupplementDaemonConfig(cfg, ref, "1", false, labels, nil))
+		return cfg.Device.Backend.Config
+	}
+
+	bc := supplement("registry.internal:5000/app:latest", nil)
+	require.Equal(t, cert.CertFile, bc.CertFile)
+	require.Equal(t, cert.KeyFile, bc.KeyFile)
+	require.Empty(t, bc.Auth)
+	require.NoError(t, bc.Validate())
+
+	// Presented alongside basic auth.
+	bc = supplement("registry.internal:5000/app:latest", map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "pass",
+	})
+	require.Equal(t, cert.CertFile, bc.CertFile)
+	require.Equal(t, "dXNlcjpwYXNz", bc.Auth)
+
+	bc = supplement("registry.example.com/app:latest", nil)
+	require.Empty(t, bc.CertFile)
+	require.Empty(t, bc.KeyFile)
+}
+
+func TestTokenFile(t *testing.T) {
+	defer func() { fileTokens = map[string]fileToken{} }()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token-1\n"), 0600))
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:       t.TempDir(),
+		DaemonMode: string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{
+			AuthConfig: config.AuthConfig{TokenFiles: map[string]string{
+				"registry.internal:5000":      tokenFile,
+				"registry.example.com/team-a": tokenFile,
+			}},
+		},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	supplement := func(ref string) BackendConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		require.NoError(t, SupplementDaemonConfig(cfg, ref, "1", false, nil, nil))
+		return cfg.Device.Backend.Config
+	}
+
+	bc := supplement("registry.internal:5000/app:latest")
+	require.Equal(t, "token-1", bc.RegistryToken)
+	require.Empty(t, bc.Auth)
+	_, changed := NextTokenFileRefresh()
+	require.False(t, changed)
+
+	// Rotated tokens are picked up and trigger a refresh.
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token-2"), 0600))
+	modTime := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(tokenFile, modTime, modTime))
+	next, changed := NextTokenFileRefresh()
+	require.True(t, changed)
+	require.True(t, next.Equal(modTime))
+	bc = supplement("registry.internal:5000/app:latest")
+	require.Equal(t, "token-2", bc.RegistryToken)
+	_, changed = NextTokenFileRefresh()
+	require.False(t, changed)
+
+	bc = supplement("registry.example.com/app:latest")
+	require.Empty(t, bc.RegistryToken)
+	bc = supplement("registry.example.com/team-a/app:latest")
+	require.Equal(t, "token-2", bc.RegistryToken)
+
+	require.NoError(t, os.Remove(tokenFile))
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	require.ErrorContains(t, SupplementDaemonConfig(cfg, "registry.internal:5000/app:latest", "1", false, nil, nil), "token file")
+}
+
+func TestRewriteImage(t *testing.T) {
+	defer func() { fileTokens = map[string]fileToken{} }()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("harbor-token"), 0600))
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:       t.TempDir(),
+		DaemonMode: string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{
+			AuthConfig: config.AuthConfig{TokenFiles: map[string]string{"harbor.internal": tokenFile}},
+			Rewrites: []config.RewriteRule{
+				{From: "docker.io/library/*", To: "harbor.internal/proxy/library/*"},
+				{From: "quay.io/*", To: "harbor.internal:8443/quay/*"},
+			},
+		},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	ref, ok := config.RewriteImageRef("nginx@sha256:" + strings.Repeat("a", 64))
+	require.True(t, ok)
+	require.Equal(t, "harbor.internal/proxy/library/nginx@sha256:"+strings.Repeat("a", 64), ref)
+	_, ok = config.RewriteImageRef("ghcr.io/org/app:v1")
+	require.False(t, ok)
+
+	labels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "docker-hub-secret",
+	}
+	supplement := func(ref string) BackendConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		require.NoError(t, SupplementDaemonConfig(cfg, ref, "1", false, labels, nil))
+		return cfg.Device.Backend.Config
+	}
+
+	// Credentials are looked up for Harbor.
+	bc := supplement("docker.io/library/nginx:1.27")
+	require.Equal(t, "harbor.internal", bc.Host)
+	require.Equal(t, "proxy/library/nginx", bc.Repo)
+	require.Equal(t, "harbor-token", bc.RegistryToken)
+
+	// The credential of the labels is meant for the original registry.
+	bc = supplement("quay.io/org/app:v1")
+	require.Equal(t, "harbor.internal:8443", bc.Host)
+	require.Equal(t, "quay/org/app", bc.Repo)
+	require.Empty(t, bc.Auth)
+
+	bc = supplement("ghcr.io/org/app:v1")
+	require.Equal(t, "ghcr.io", bc.Host)
+	require.Equal(t, "org/app", bc.Repo)
+	require.NotEmpty(t, bc.Auth)
+}
+
+func TestMinimalConfigForImage(t *testing.T) {
+	c, err := MinimalConfigForImage(config.FsDriverFusedev, &SupplementInfo{ImageID: "busybox:latest", SnapshotID: "1"})
+	require.NoError(t, err)
+	backendType, bc := c.StorageBackend()
+	require.Equal(t, backendTypeRegistry, backendType)
+	require.Equal(t, "index.docker.io", bc.Host)
+	require.Equal(t, "library/busybox", bc.Repo)
+	require.Equal(t, "/1", c.(*FuseDaemonConfig).Device.ID)
+
+	c, err = MinimalConfigForImage(config.FsDriverFscache, &SupplementInfo{
+		ImageID:    "registry.example.com:5000/team/app:v1",
+		SnapshotID: "2",
+		Labels: map[string]string{
+			label.NydusImagePullUsername: "user",
+			label.NydusImagePullSecret:   "pass",
+		},
+	})
+	require.NoError(t, err)
+	backendType, bc = c.StorageBackend()
+	require.Equal(t, backendTypeRegistry, backendType)
+	require.Equal(t, "registry.example.com:5000", bc.Host)
+	require.Equal(t, "team/app", bc.Repo)
+	require.Equal(t, "dXNlcjpwYXNz", bc.Auth)
+
+	filtered, err := json.Marshal(serializeWithSecretFilter(c))
+	require.NoError(t, err)
+	require.NotContains(t, string(filtered), "dXNlcjpwYXNz")
+
+	_, err = MinimalConfigForImage(config.FsDriverBlockdev, &SupplementInfo{ImageID: "busybox:latest"})
+	require.Error(t, err)
+}
+
+func TestPrefetchFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+		return p
+	}
+
+	cfg, err := LoadFuseConfig(write("inline.json",
+		`{"device": {"backend": {"type": "registry", "config": {}}}, "fs_prefetch": {"enable": true, "prefetch_files": ["/usr/bin/app", "/etc/app"]}}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"/usr/bin/app", "/etc/app"}, cfg.PrefetchFiles)
+	dumped, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"prefetch_files":["/usr/bin/app","/etc/app"]`)
+
+	write("hot-files", "# hot files\n/usr/lib/libapp.so\n\n  /var/lib/app/data  \n")
+	cfg, err = LoadFuseConfig(write("from-file.json",
+		`{"device": {"backend": {"type": "registry", "config": {}}}, "fs_prefetch": {"enable": true,
+		"prefetch_files": ["/usr/bin/app"], "prefetch_files_from": "hot-files"}}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"/usr/bin/app", "/usr/lib/libapp.so", "/var/lib/app/data"}, cfg.PrefetchFiles)
+	dumped, err = cfg.DumpString()
+	require.NoError(t, err)
+	require.NotContains(t, dumped, "prefetch_files_from")
+
+	for _, f := range []string{"usr/bin/app", "/usr/../../etc/shadow"} {
+		_, err = LoadFuseConfig(write("invalid.json", fmt.Sprintf(
+			`{"device": {"backend": {"type": "registry", "config": {}}}, "fs_prefetch": {"prefetch_files": [%q]}}`, f)))
+		require.ErrorContains(t, err, "invalid prefetch file")
+	}
+
+	_, err = LoadFuseConfig(write("missing.json",
+		`{"device": {"backend": {"type": "registry", "config": {}}}, "fs_prefetch": {"prefetch_files_from": "missing"}}`))
+	require.Error(t, err)
+}
+
+func TestLocalfsBlobs(t *testing.T) {
+	dir := t.TempDir()
+
+	// A single blob file is used as is, even with a dir.
+	bc := BackendConfig{BlobFile: filepath.Join(dir, "blob"), Dir: dir}
+	require.NoError(t, bc.Validate())
+	blobs, err := bc.BlobFiles()
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "blob")}, blobs)
+	dumped, err := DumpConfigString(&bc)
+	require.NoError(t, err)
+	require.Contains(t, dumped, fmt.Sprintf(`"blob_file":%q`, bc.BlobFile))
+
+	// Otherwise the blobs are enumerated from the dir, which the health check expects not to be
+	// empty. Loading the configuration doesn't, so it works before the blobs are in place.
+	bc = BackendConfig{Dir: dir}
+	require.NoError(t, bc.Validate())
+	require.ErrorContains(t, stderrors.Join(checkBackend("backend", backendTypeLocalfs, &bc)...), "no blob found")
+
+	for _, name := range []string{"b1", "a0", ".lock"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0700))
+	require.NoError(t, bc.Validate())
+	blobs, err = bc.BlobFiles()
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "a0"), filepath.Join(dir, "b1")}, blobs)
+	dumped, err = DumpConfigString(&bc)
+	require.NoError(t, err)
+	require.Contains(t, dumped, fmt.Sprintf(`"dir":%q`, dir))
+	require.NotContains(t, dumped, "blob_file")
+
+	require.Empty(t, checkBackend("backend", backendTypeLocalfs, &bc))
+
+	bc.Dir = filepath.Join(dir, "missing")
+	require.NoError(t, bc.Validate())
+	require.ErrorContains(t, stderrors.Join(checkBackend("backend", backendTypeLocalfs, &bc)...), "read localfs dir")
+	// Other backends don't look at the dir.
+	require.Empty(t, checkBackend("backend", backendTypeRegistry, &bc))
+
+	// The shipped configuration loads on a node without cached blobs.
+	_, err = LoadFuseConfig("../../misc/snapshotter/nydusd-config-localfs.json")
+	require.NoError(t, err)
+}
+
+func TestConfigPostProcessor(t *testing.T) {
+	defer func(processors []ConfigPostProcessor) { configPostProcessors = processors }(configPostProcessors)
+	configPostProcessors = nil
+
+	var calls []string
+	RegisterConfigPostProcessor(func(c DaemonConfig) error {
+		calls = append(calls, "rewrite")
+		_, bc := c.StorageBackend()
+		bc.Host = strings.Replace(bc.Host, "registry.example.com", "registry.internal", 1)
+		return nil
+	})
+	RegisterConfigPostProcessor(func(c DaemonConfig) error {
+		calls = append(calls, "check")
+		if _, bc := c.StorageBackend(); bc.Host != "registry.internal" {
+			return errors.Errorf("unexpected host %s", bc.Host)
+		}
+		return nil
+	})
+
+	newConfig := func() *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		return cfg
+	}
+
+	cfg := newConfig()
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+	require.Equal(t, []string{"rewrite", "check"}, calls)
+	require.Equal(t, "registry.internal", cfg.Device.Backend.Config.Host)
+
+	calls = nil
+	RegisterConfigPostProcessor(func(DaemonConfig) error {
+		calls = append(calls, "reject")
+		return errors.New("rejected")
+	})
+	RegisterConfigPostProcessor(func(DaemonConfig) error {
+		calls = append(calls, "unreachable")
+		return nil
+	})
+	err := SupplementDaemonConfig(newConfig(), "registry.example.com/app:latest", "1", false, nil, nil)
+	require.ErrorContains(t, err, "rejected")
+	require.Equal(t, []string{"rewrite", "check", "reject"}, calls)
+}
+
+func TestAnonymousBackend(t *testing.T) {
+	bc := BackendConfig{BucketName: "public", Anonymous: true}
+	require.NoError(t, bc.Validate())
+	dumped, err := DumpConfigString(&bc)
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"anonymous":true`)
+
+	bc.AccessKeyID = "ak"
+	require.ErrorContains(t, bc.Validate(), "anonymous")
+
+	labels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "pass",
+	}
+	newConfig := func(anonymous bool) *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		cfg.Device.Backend.Config.Anonymous = anonymous
+		return cfg
+	}
+
+	cfg := newConfig(false)
+	result, err := SupplementDaemonConfigWithResult(cfg, "registry.example.com/app:latest", "1", false, labels, nil)
+	require.NoError(t, err)
+	require.True(t, result.AuthFilled)
+	require.Equal(t, "dXNlcjpwYXNz", cfg.Device.Backend.Config.Auth)
+
+	cfg = newConfig(true)
+	result, err = SupplementDaemonConfigWithResult(cfg, "registry.example.com/app:latest", "1", false, labels, nil)
+	require.NoError(t, err)
+	require.False(t, result.AuthFilled)
+	require.Empty(t, cfg.Device.Backend.Config.Auth)
+
+	cfg.FillAuth(&auth.PassKeyChain{Username: "user", Password: "pass"})
+	require.Empty(t, cfg.Device.Backend.Config.Auth)
+}
+
+type fakeSupplementObserver struct {
+	backends  []StorageBackendType
+	durations []time.Duration
+	errs      []error
+}
+
+func (o *fakeSupplementObserver) ObserveSupplement(backend StorageBackendType, duration time.Duration, err error) {
+	o.backends = append(o.backends, backend)
+	o.durations = append(o.durations, duration)
+	o.errs = append(o.errs, err)
+}
+
+func TestSupplementObserver(t *testing.T) {
+	observer := &fakeSupplementObserver{}
+	SetSupplementObserver(observer)
+	defer SetSupplementObserver(nil)
+
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+
+	cfg = &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeOss
+	require.Error(t, SupplementDaemonConfig(cfg, "Invalid Reference", "1", false, nil, nil))
+
+	require.Equal(t, []StorageBackendType{backendTypeRegistry, backendTypeOss}, observer.backends)
+	require.NoError(t, observer.errs[0])
+	require.Error(t, observer.errs[1])
+	for _, d := range observer.durations {
+		require.Positive(t, d)
+	}
+}
+
+func TestBackendEndpoints(t *testing.T) {
+	load := func(backend string) (*FuseDaemonConfig, error) {
+		p := filepath.Join(t.TempDir(), "config.json")
+		content := fmt.Sprintf(`{"device": {"backend": {"type": "oss", "config": %s}}}`, backend)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+		return LoadFuseConfig(p)
+	}
+
+	cfg, err := load(`{"bucket_name": "nydus", "endpoint": "oss-cn-hangzhou.aliyuncs.com"}`)
+	require.NoError(t, err)
+	require.Equal(t, "oss-cn-hangzhou.aliyuncs.com", cfg.Device.Backend.Config.EndPoint)
+	require.Empty(t, cfg.Device.Backend.Config.Endpoints)
+
+	cfg, err = load(`{"bucket_name": "nydus", "endpoints": ["https://oss-cn-hangzhou.aliyuncs.com", "oss-cn-beijing.aliyuncs.com"]}`)
+	require.NoError(t, err)
+	require.Equal(t, "https://oss-cn-hangzhou.aliyuncs.com", cfg.Device.Backend.Config.EndPoint)
+	require.Empty(t, cfg.HealthCheck())
+
+	cfg, err = load(`{"bucket_name": "nydus", "endpoint": "oss-cn-shanghai.aliyuncs.com",
+		"endpoints": ["oss-cn-hangzhou.aliyuncs.com", "oss-cn-beijing.aliyuncs.com"]}`)
+	require.NoError(t, err)
+	require.Equal(t, "oss-cn-hangzhou.aliyuncs.com", cfg.Device.Backend.Config.EndPoint)
+	dumped, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"endpoint":"oss-cn-hangzhou.aliyuncs.com","endpoints":["oss-cn-hangzhou.aliyuncs.com","oss-cn-beijing.aliyuncs.com"]`)
+
+	for _, e := range []string{"ftp://oss.example.com", "https://", "oss.example.com/bucket", "https://oss.example.com?x=1"} {
+		_, err = load(fmt.Sprintf(`{"bucket_name": "nydus", "endpoints": ["oss.example.com", %q]}`, e))
+		require.ErrorContains(t, err, "invalid endpoint", e)
+	}
+}
+
+func TestS3TemporaryCredentials(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(`{"device": {"backend": {"type": "s3", "config": {
+		"bucket_name": "nydus", "region": "eu-west-1", "endpoint": "minio.example.com:9000", "path_style": true,
+		"access_key_id": "ak", "access_key_secret": "sk", "session_token": "st"}}}}`), 0600))
+	cfg, err := LoadFuseConfig(p)
+	require.NoError(t, err)
+	require.Equal(t, backendTypeS3, cfg.Device.Backend.BackendType)
+
+	dumped, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"session_token":"st"`)
+	require.Contains(t, dumped, `"path_style":true`)
+	filtered, err := json.Marshal(serializeWithSecretFilter(cfg))
+	require.NoError(t, err)
+	require.NotContains(t, string(filtered), "session_token")
+
+	bc := cfg.Device.Backend.Config
+	bc.AccessKeySecret = ""
+	var missing *MissingFieldError
+	require.ErrorAs(t, bc.Validate(), &missing)
+	require.Equal(t, "session_token", missing.RequiredBy)
+}
+
+func TestAzblobBackend(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(`{"device": {"backend": {"type": "azblob", "config": {
+		"account_name": "nydus", "container_name": "blobs", "sas_token": "sv=2022-11-02&sig=secret"}}}}`), 0600))
+	cfg, err := LoadFuseConfig(p)
+	require.NoError(t, err)
+	require.Equal(t, backendTypeAzblob, cfg.Device.Backend.BackendType)
+	require.Empty(t, cfg.HealthCheck())
+
+	filtered, err := json.Marshal(serializeWithSecretFilter(cfg))
+	require.NoError(t, err)
+	require.Contains(t, string(filtered), `"container_name":"blobs"`)
+	require.NotContains(t, string(filtered), "sas_token")
+
+	labels := map[string]string{label.NydusBackendObjectPrefix: "team-a/", label.NydusBackendBucket: "ignored"}
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, labels, nil))
+	require.Equal(t, "team-a/", cfg.Device.Backend.Config.ObjectPrefix)
+
+	bc := cfg.Device.Backend.Config
+	bc.ManagedIdentity = true
+	require.ErrorContains(t, bc.Validate(), "sas_token conflicts with managed_identity")
+	bc.SASToken = ""
+	bc.ManagedIdentityClientID = "client-id"
+	require.NoError(t, bc.Validate())
+	bc.ManagedIdentity = false
+	require.Error(t, bc.Validate())
+
+	errs := checkBackend("backend", backendTypeAzblob, &BackendConfig{})
+	require.Len(t, errs, 2)
+}
+
+func TestGCSBackend(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(`{"device": {"backend": {"type": "gcs", "config": {
+		"bucket_name": "nydus", "object_prefix": "blobs/", "object_prefix_from_image": true, "workload_identity": true}}}}`), 0600))
+	cfg, err := LoadFuseConfig(p)
+	require.NoError(t, err)
+	require.Equal(t, backendTypeGCS, cfg.Device.Backend.BackendType)
+	require.Empty(t, cfg.HealthCheck())
+
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/team-a/app:latest", "1", false, nil, nil))
+	require.Equal(t, "blobs/registry.example.com/team-a/app/", cfg.Device.Backend.Config.ObjectPrefix)
+
+	// An explicit per-image label wins over the derived prefix.
+	cfg, err = LoadFuseConfig(p)
+	require.NoError(t, err)
+	labels := map[string]string{label.NydusBackendObjectPrefix: "pinned/", label.NydusBackendBucket: "other-bucket"}
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/team-a/app:latest", "1", false, labels, nil))
+	require.Equal(t, "pinned/", cfg.Device.Backend.Config.ObjectPrefix)
+	require.Equal(t, "other-bucket", cfg.Device.Backend.Config.BucketName)
+
+	bc := cfg.Device.Backend.Config
+	bc.CredentialsFile = "/etc/nydus/gcs.json"
+	require.ErrorContains(t, bc.Validate(), "credentials_file conflicts with workload_identity")
+
+	errs := checkBackend("backend", backendTypeGCS, &BackendConfig{})
+	require.Len(t, errs, 1)
+}
+
+func TestHTTPBackend(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(`{"device": {"backend": {"type": "http", "config": {
+		"base_url": "https://blobs.lab.internal/nydus/", "username": "lab", "password": "secret",
+		"headers": {"X-Lab": "1"}}}, "cache": {"config": {"work_dir": "/cache"}}}}`), 0600))
+	cfg, err := LoadFuseConfig(p)
+	require.NoError(t, err)
+	require.Equal(t, backendTypeHTTP, cfg.Device.Backend.BackendType)
+	require.Empty(t, cfg.HealthCheck())
+
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil,
+		map[string]string{CacheDir: "/other"}))
+	require.Equal(t, "/other", cfg.Device.Cache.Config.WorkDir)
+	require.Empty(t, cfg.Device.Backend.Config.Host)
+
+	filtered, err := json.Marshal(serializeWithSecretFilter(cfg))
+	require.NoError(t, err)
+	require.Contains(t, string(filtered), `"headers":{"X-Lab":"1"}`)
+	require.NotContains(t, string(filtered), "secret")
+
+	for _, bc := range []BackendConfig{
+		{BaseURL: "ftp://blobs.lab.internal"},
+		{BaseURL: "https://blobs.lab.internal", Password: "secret"},
+		{BaseURL: "https://blobs.lab.internal", Headers: map[string]string{"X Lab": "1"}},
+	} {
+		require.Error(t, bc.Validate())
+	}
+	require.Len(t, checkBackend("backend", backendTypeHTTP, &BackendConfig{}), 1)
+}
+
+func TestIPFSBackend(t *testing.T) {
+	const (
+		blobID = "b1d3a0d4b5b2e0b7c8c4a8d7b6f5e4d3c2b1a0f9e8d7c6b5a4f3e2d1c0b9a8f7"
+		cid    = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	)
+
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(`{"device": {"backend": {"type": "ipfs", "config": {
+		"gateway_url": "http://127.0.0.1:8080", "blob_cids": {"0000": "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"}}}}}`), 0600))
+	cfg, err := LoadFuseConfig(p)
+	require.NoError(t, err)
+	require.Equal(t, backendTypeIPFS, cfg.Device.Backend.BackendType)
+	require.Empty(t, cfg.HealthCheck())
+
+	labels := map[string]string{label.NydusIPFSBlobCIDs: "sha256:" + blobID + "=" + cid}
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, labels, nil))
+	require.Equal(t, map[string]string{
+		"0000": "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+		blobID: cid,
+	}, cfg.Device.Backend.Config.BlobCIDs)
+
+	for _, v := range []string{"sha256:" + blobID, blobID + "=" + cid, "sha256:" + blobID + "=not-a-cid"} {
+		err := SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false,
+			map[string]string{label.NydusIPFSBlobCIDs: v}, nil)
+		require.ErrorContains(t, err, "invalid blob CID")
+	}
+
+	require.Error(t, (&BackendConfig{GatewayURL: "ipfs://gateway"}).Validate())
+	require.Error(t, (&BackendConfig{APISocket: "ipfs.sock"}).Validate())
+	require.Len(t, checkBackend("backend", backendTypeIPFS, &BackendConfig{}), 1)
+	require.Empty(t, checkBackend("backend", backendTypeIPFS, &BackendConfig{APISocket: "/run/ipfs/api.sock"}))
+}
+
+func TestFallbackBackendChain(t *testing.T) {
+	blobDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(blobDir, "blob"), nil, 0600))
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(fmt.Sprintf(`{"device": {
+		"backend": {"type": "localfs", "config": {"dir": %q}},
+		"fallback_backends": [
+			{"type": "registry", "config": {}},
+			{"type": "registry", "config": {"host": "backup.example.com", "repo": "backup/app"}}
+		]}}`, blobDir)), 0600))
+	cfg, err := LoadFuseConfig(p)
+	require.NoError(t, err)
+
+	chain := cfg.BackendChain()
+	require.Len(t, chain, 3)
+	require.Equal(t, []StorageBackendType{backendTypeLocalfs, backendTypeRegistry, backendTypeRegistry},
+		[]StorageBackendType{chain[0].Type, chain[1].Type, chain[2].Type})
+
+	labels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "pass",
+	}
+	result, err := SupplementDaemonConfigWithResult(cfg, "registry.example.com/app:latest", "1", false, labels, nil)
+	require.NoError(t, err)
+	require.Empty(t, result.Host)
+	require.False(t, result.AuthFilled)
+
+	// Only the remote backend without registry host is pointed to the image.
+	require.Equal(t, BackendConfig{Dir: blobDir}, cfg.Device.Backend.Config)
+	remote := cfg.Device.FallbackBackends[0].Config
+	require.Equal(t, "registry.example.com", remote.Host)
+	require.Equal(t, "app", remote.Repo)
+	require.Equal(t, "dXNlcjpwYXNz", remote.Auth)
+	backup := cfg.Device.FallbackBackends[1].Config
+	require.Equal(t, "backup.example.com", backup.Host)
+	require.Empty(t, backup.Auth)
+
+	cfg.Device.FallbackBackends[1].Config.Timeout = -1
+	errs := cfg.HealthCheck()
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "fallback backend 2")
+
+	require.NoError(t, os.WriteFile(p, []byte(`{"device": {"backend": {"type": "registry", "config": {}},
+		"fallback_backends": [{"type": "none", "config": {}}]}}`), 0600))
+	_, err = LoadFuseConfig(p)
+	require.ErrorContains(t, err, "fallback_backends[0]")
+}
+
+func TestBackendLabel(t *testing.T) {
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.Backend.Config.Timeout = 5
+
+	labels := map[string]string{
+		label.NydusBackend: `{"type": "oss", "config": {"endpoints": ["https://oss.example.com"],
+			"bucket_name": "images", "region": "cn-hangzhou"}}`,
+		label.NydusBackendObjectPrefix: "app/",
+	}
+	result, err := SupplementDaemonConfigWithResult(cfg, "registry.example.com/app:latest", "1", false, labels, nil)
+	require.NoError(t, err)
+	require.Equal(t, backendTypeOss, result.Backend)
+
+	backendType, bc := cfg.StorageBackend()
+	require.Equal(t, backendTypeOss, backendType)
+	require.Equal(t, "https://oss.example.com", bc.EndPoint)
+	require.Equal(t, "images", bc.BucketName)
+	require.Equal(t, "app/", bc.ObjectPrefix)
+	require.Equal(t, "cn-hangzhou", bc.SigningRegion)
+	require.Zero(t, bc.Timeout)
+
+	fscache := &FscacheDaemonConfig{}
+	require.NoError(t, json.Unmarshal([]byte(`{"config": {"backend_type": "oss", "backend_config": {}}}`), fscache))
+	result, err = SupplementDaemonConfigWithResult(fscache, "registry.example.com/app:latest", "1", false,
+		map[string]string{label.NydusBackend: `{"type": "registry", "config": {}}`}, nil)
+	require.NoError(t, err)
+	require.Equal(t, backendTypeRegistry, result.Backend)
+	require.Equal(t, "registry.example.com", fscache.Config.BackendConfig.Host)
+
+	for value, msg := range map[string]string{
+		`oss`:                            "parse label",
+		`{"type": "ftp", "config": {}}`:  "invalid backend",
+		`{"type": "none", "config": {}}`: "invalid backend type",
+		`{"type": "oss", "config": {"endpoints": ["ftp://oss.example.com"]}}`: "validate backend config",
+	} {
+		err := SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false,
+			map[string]string{label.NydusBackend: value}, nil)
+		require.ErrorContains(t, err, msg, value)
+	}
+}
+
+func TestBackendThrottle(t *testing.T) {
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:       t.TempDir(),
+		DaemonMode: string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{ThrottleConfig: config.ThrottleConfig{
+			MaxBandwidthBytesPerSec: 10 << 20, MaxBandwidthBurstBytes: 20 << 20, MaxConcurrencyPerBlob: 4,
+		}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeOss, Config: BackendConfig{
+		EndPoint: "oss.example.com", MaxBandwidthBytesPerSec: 1 << 20, MaxConcurrencyPerBlob: 2,
+	}}
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+
+	primary := cfg.Device.Backend.Config
+	require.Equal(t, 10<<20, primary.MaxBandwidthBytesPerSec)
+	require.Equal(t, 20<<20, primary.MaxBandwidthBurstBytes)
+	require.Equal(t, 4, primary.MaxConcurrencyPerBlob)
+
+	// Limits of the template win, the node-wide burst does not apply to another rate.
+	fallback := cfg.Device.FallbackBackend.Config
+	require.Equal(t, 1<<20, fallback.MaxBandwidthBytesPerSec)
+	require.Zero(t, fallback.MaxBandwidthBurstBytes)
+	require.Equal(t, 2, fallback.MaxConcurrencyPerBlob)
+
+	require.Error(t, (&BackendConfig{MaxBandwidthBurstBytes: 1 << 20}).Validate())
+	require.Error(t, (&BackendConfig{MaxBandwidthBytesPerSec: 1 << 20, MaxBandwidthBurstBytes: -1}).Validate())
+	require.Error(t, (&BackendConfig{MaxConcurrencyPerBlob: -1}).Validate())
+}
+
+func TestPopulatedLocalfs(t *testing.T) {
+	// The directory is filled on demand, so it may be empty.
+	bc := BackendConfig{Dir: t.TempDir(), PopulateFromRegistry: true}
+	require.NoError(t, bc.Validate())
+	require.Error(t, (&BackendConfig{PopulateFromRegistry: true}).Validate())
+	require.Error(t, (&BackendConfig{Dir: bc.Dir, BlobFile: "blob", PopulateFromRegistry: true}).Validate())
+	require.Error(t, (&BackendConfig{Dir: bc.Dir, PopulateFromRegistry: true, PopulateConcurrency: -1}).Validate())
+
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeLocalfs
+	cfg.Device.Backend.Config = bc
+	require.Equal(t, &cfg.Device.Backend.Config, PopulatedLocalfs(cfg))
+	cfg.Device.Backend.Config.PopulateFromRegistry = false
+	require.Nil(t, PopulatedLocalfs(cfg))
+}
+
+func TestRegistryTLSFiles(t *testing.T) {
+	mirrorsDir := t.TempDir()
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."https://mirror.example.com"]
+  ca_file = "/etc/mirror-ca.pem"
+  cert_file = "/etc/mirror.crt"
+  key_file = "/etc/mirror.key"
+`)
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{MirrorsConfig: config.MirrorsConfig{Dir: mirrorsDir}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	newConfig := func() *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		cfg.Device.Backend.Config.CAFile = "/etc/internal-ca.pem"
+		cfg.Device.Backend.Config.CertFile = "/etc/client.crt"
+		cfg.Device.Backend.Config.KeyFile = "/etc/client.key"
+		return cfg
+	}
+
+	// The TLS files of the template are kept for the origin registry.
+	cfg := newConfig()
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+	output, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	require.Contains(t, string(output), `"ca_file":"/etc/internal-ca.pem"`)
+	require.Contains(t, string(output), `"cert_file":"/etc/client.crt"`)
+	require.Contains(t, string(output), `"key_file":"/etc/client.key"`)
+
+	// The client cert of a selected mirror replaces the one of the template.
+	cfg = newConfig()
+	require.NoError(t, SupplementDaemonConfig(cfg, testRegistryHost+"/app:latest", "1", false, nil, nil))
+	bc := cfg.Device.Backend.Config
+	require.Equal(t, "mirror.example.com", bc.Host)
+	require.Equal(t, []string{"/etc/mirror-ca.pem"}, bc.CACertFiles)
+	require.Equal(t, "/etc/internal-ca.pem", bc.CAFile)
+	require.Equal(t, "/etc/mirror.crt", bc.CertFile)
+	require.Equal(t, "/etc/mirror.key", bc.KeyFile)
+
+	require.Error(t, (&BackendConfig{CAFile: "ca.pem"}).Validate())
+	require.Error(t, (&BackendConfig{CertFile: "/etc/client.crt"}).Validate())
+	require.Error(t, (&BackendConfig{KeyFile: "/etc/client.key"}).Validate())
+	require.Len(t, (&BackendConfig{CAFile: "/etc/ca.pem", SkipVerify: true}).warnings(), 1)
+}
+
+func TestMirrorTLSSettings(t *testing.T) {
+	mirrorsDir := t.TempDir()
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."http://127.0.0.1:1"]
+  ca = "/etc/unreachable-ca.pem"
+  ping_url = "http://127.0.0.1:1/v2/"
+[host."https://mirror.internal"]
+  ca = "/etc/mirror-ca.pem"
+`)
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{MirrorsConfig: config.MirrorsConfig{Dir: mirrorsDir}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	newConfig := func() *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		cfg.Device.Backend.Config.SkipVerify = true
+		cfg.Device.Backend.Config.CertFile = "/etc/client.crt"
+		cfg.Device.Backend.Config.KeyFile = "/etc/client.key"
+		return cfg
+	}
+
+	// The selected mirror is verified against its own CA only, and gets no client certificate
+	// of the registry.
+	cfg := newConfig()
+	require.NoError(t, SupplementDaemonConfig(cfg, testRegistryHost+"/app:latest", "1", false, nil, nil))
+	bc := cfg.Device.Backend.Config
+	require.Equal(t, "mirror.internal", bc.Host)
+	require.False(t, bc.SkipVerify)
+	require.Equal(t, []string{"/etc/mirror-ca.pem"}, bc.CACertFiles)
+	require.Empty(t, bc.CertFile)
+	require.Empty(t, bc.KeyFile)
+
+	cfg = newConfig()
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+	bc = cfg.Device.Backend.Config
+	require.Equal(t, "registry.example.com", bc.Host)
+	require.True(t, bc.SkipVerify)
+	require.Equal(t, "/etc/client.crt", bc.CertFile)
+}
+
+func TestMirrorScope(t *testing.T) {
+	mirrorsDir := t.TempDir()
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."http://p2p.local:65001"]
+  scope = "blobs"
+`)
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{MirrorsConfig: config.MirrorsConfig{Dir: mirrorsDir}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	// Blobs are fetched from the mirror, everything else from the registry.
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	require.NoError(t, SupplementDaemonConfig(cfg, testRegistryHost+"/app:latest", "1", false, nil, nil))
+	bc := cfg.Device.Backend.Config
+	require.Equal(t, "p2p.local:65001", bc.Host)
+	require.Equal(t, "http", bc.Scheme)
+	require.Equal(t, "https://"+testRegistryHost, bc.MetadataURL)
+	require.NoError(t, bc.Validate())
+
+	// The registry keeps its TLS settings, the mirror gets its own.
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."https://p2p.local:65001"]
+  scope = "blobs"
+  ca = "/etc/p2p-ca.pem"
+  skip_verify = false
+`)
+	cfg = &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.Backend.Config.SkipVerify = true
+	cfg.Device.Backend.Config.CACertFiles = []string{"/etc/registry-ca.pem"}
+	require.NoError(t, SupplementDaemonConfig(cfg, testRegistryHost+"/app:latest", "1", false, nil, nil))
+	bc = cfg.Device.Backend.Config
+	require.False(t, bc.SkipVerify)
+	require.Equal(t, []string{"/etc/p2p-ca.pem"}, bc.CACertFiles)
+	require.True(t, bc.MetadataSkipVerify)
+	require.Equal(t, []string{"/etc/registry-ca.pem"}, bc.MetadataCACertFiles)
+	require.Error(t, (&BackendConfig{MetadataCertFile: "/etc/client.crt"}).Validate())
+
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."http://p2p.local:65001"]
+[host."http://stale.local:65001"]
+  scope = "manifests"
+`)
+	mirrors, _, err := LoadMirrorsConfig(mirrorsDir, testRegistryHost)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 1)
+	require.Equal(t, MirrorScopeAll, mirrors[0].Scope)
+
+	cfg = &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	require.NoError(t, SupplementDaemonConfig(cfg, testRegistryHost+"/app:latest", "1", false, nil, nil))
+	require.Empty(t, cfg.Device.Backend.Config.MetadataURL)
+
+	require.Error(t, (&BackendConfig{MetadataURL: "registry.example.com"}).Validate())
+}
+
+func TestReselectMirror(t *testing.T) {
+	mirrorsDir := t.TempDir()
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."http://p2p.local:65001"]
+`)
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{MirrorsConfig: config.MirrorsConfig{Dir: mirrorsDir}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	template := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	template.Device.Backend.BackendType = backendTypeRegistry
+	cfg := template.Clone()
+	require.NoError(t, SupplementDaemonConfig(cfg, testRegistryHost+"/app:latest", "1", false, nil, nil))
+	cfg.(*FuseDaemonConfig).Device.Backend.Config.Auth = "kept"
+
+	changed, err := ReselectMirror(cfg, template, testRegistryHost+"/app:latest", "1", nil, nil)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."https://mirror.local"]
+  scope = "blobs"
+`)
+	changed, err = ReselectMirror(cfg, template, testRegistryHost+"/app:latest", "1", nil, nil)
+	require.NoError(t, err)
+	require.True(t, changed)
+	bc := cfg.(*FuseDaemonConfig).Device.Backend.Config
+	require.Equal(t, "mirror.local", bc.Host)
+	require.Equal(t, "https", bc.Scheme)
+	require.Equal(t, "https://"+testRegistryHost, bc.MetadataURL)
+	require.Equal(t, "kept", bc.Auth)
+}
+
+func TestActiveMirror(t *testing.T) {
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.Backend.Config.Host = "mirror.local:5000"
+	mirror, ok := ActiveMirror(cfg, testRegistryHost+"/app:latest")
+	require.True(t, ok)
+	require.Equal(t, "https://mirror.local:5000", mirror)
+	cfg.Device.Backend.Config.Scheme = "http"
+	mirror, _ = ActiveMirror(cfg, testRegistryHost+"/app:latest")
+	require.Equal(t, "http://mirror.local:5000", mirror)
+
+	cfg.Device.Backend.Config.Host = testRegistryHost
+	_, ok = ActiveMirror(cfg, testRegistryHost+"/app:latest")
+	require.False(t, ok)
+	cfg.Device.Backend.Config.Host = "index.docker.io"
+	_, ok = ActiveMirror(cfg, "docker.io/library/busybox:latest")
+	require.False(t, ok)
+}
+
+func TestTokenEndpoint(t *testing.T) {
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.Backend.Config.TokenURL = "https://gateway.example.com/auth/token"
+	cfg.Device.Backend.Config.TokenScope = "repository:{repo}:pull registry:{host}:catalog"
+	require.NoError(t, cfg.Device.Backend.Config.Validate())
+	cfg.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeRegistry, Config: BackendConfig{
+		Host: "backup.example.com", Repo: "mirror/app", TokenScope: "repository:{repo}:pull",
+	}}
+
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/team/app:latest", "1", false, nil, nil))
+	dumped, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"token_url":"https://gateway.example.com/auth/token"`)
+	require.Contains(t, dumped, `"token_scope":"repository:team/app:pull registry:registry.example.com:catalog"`)
+	require.Equal(t, "repository:mirror/app:pull", cfg.Device.FallbackBackend.Config.TokenScope)
+
+	require.Error(t, (&BackendConfig{TokenURL: "gateway.example.com/token"}).Validate())
+	require.Error(t, (&BackendConfig{TokenScope: "repository:{name}:pull"}).Validate())
+}
+
+func TestCacheOnlyOnOutage(t *testing.T) {
+	newConfig := func() *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		return cfg
+	}
+
+	cfg := newConfig()
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+	dumped, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.NotContains(t, dumped, "cache_only_on_outage")
+
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{CacheOnlyOnOutage: true},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	cfg = newConfig()
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "2", false, nil, nil))
+	dumped, err = cfg.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"cache_only_on_outage":true`)
 }
@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import "fmt"
+
+// MissingFieldError reports a backend configuration field which is required but not set.
+type MissingFieldError struct {
+	Backend StorageBackendType
+	Field   string
+	// Set when the field is required by another setting rather than by the backend type.
+	RequiredBy string
+}
+
+func (e *MissingFieldError) Error() string {
+	requiredBy := e.RequiredBy
+	if requiredBy == "" {
+		requiredBy = e.Backend.String()
+	}
+	return fmt.Sprintf("%s is required by %s", e.Field, requiredBy)
+}
+
+// InvalidSchemeError reports a scheme other than http and https.
+type InvalidSchemeError struct {
+	Field string
+	Value string
+}
+
+func (e *InvalidSchemeError) Error() string {
+	return fmt.Sprintf("invalid %s %q, must be http or https", e.Field, e.Value)
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExecSigner is a RequestSigner running an external program for each request. The program
+// reads the SignRequest as JSON from stdin and writes the SigningMaterial as JSON to stdout.
+type ExecSigner struct {
+	Path string
+	Args []string
+	// Zero waits as long as the caller does
+	Timeout time.Duration
+}
+
+func (s *ExecSigner) Sign(ctx context.Context, req SignRequest) (*SigningMaterial, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal sign request")
+	}
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, s.Path, s.Args...)
+	cmd.Stdin = bytes.NewReader(in)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, errors.Wrapf(err, "run %s: %s", s.Path, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, errors.Wrapf(err, "run %s", s.Path)
+	}
+
+	var m SigningMaterial
+	if err := json.Unmarshal(out, &m); err != nil {
+		return nil, errors.Wrapf(err, "decode output of %s", s.Path)
+	}
+	return &m, nil
+}
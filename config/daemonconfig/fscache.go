@@ -7,14 +7,16 @@
 package daemonconfig
 
 import (
-	"encoding/json"
+	"io"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/containerd/log"
 	"github.com/containerd/nydus-snapshotter/pkg/auth"
 	"github.com/containerd/nydus-snapshotter/pkg/utils/erofs"
 
+	"github.com/mohae/deepcopy"
 	"github.com/pkg/errors"
 )
 
@@ -23,6 +25,9 @@ const (
 	Bootstrap string = "bootstrap"
 )
 
+// FscacheWorkDirMode is the mode fscache work directories are created with.
+const FscacheWorkDirMode os.FileMode = 0755
+
 type BlobPrefetchConfig struct {
 	Enable        bool `json:"enable"`
 	ThreadsCount  int  `json:"threads_count"`
@@ -38,13 +43,21 @@ type FscacheDaemonConfig struct {
 	ID       string `json:"id"`
 	DomainID string `json:"domain_id"`
 	Config   *struct {
-		ID            string        `json:"id"`
-		BackendType   string        `json:"backend_type"`
-		BackendConfig BackendConfig `json:"backend_config"`
-		CacheType     string        `json:"cache_type"`
+		ID            string             `json:"id"`
+		BackendType   StorageBackendType `json:"backend_type"`
+		BackendConfig BackendConfig      `json:"backend_config"`
+		// Secondary backend used when the primary one is unavailable
+		FallbackBackend *FallbackBackend `json:"fallback_backend,omitempty"`
+		// More backends tried in order after FallbackBackend
+		FallbackBackends []FallbackBackend `json:"fallback_backends,omitempty"`
+		CacheType        string            `json:"cache_type"`
 		// Snapshotter fills
 		CacheConfig struct {
 			WorkDir string `json:"work_dir"`
+			// Verify the digest of every chunk fetched into the cache. It protects against
+			// corrupted or tampered blobs at the cost of hashing all data on the read path,
+			// which noticeably slows down cold starts. Nil keeps nydusd's default.
+			VerifyDigest *bool `json:"validate,omitempty"`
 		} `json:"cache_config"`
 		BlobPrefetchConfig BlobPrefetchConfig `json:"prefetch_config"`
 		MetadataPath       string             `json:"metadata_path"`
@@ -52,27 +65,77 @@ type FscacheDaemonConfig struct {
 }
 
 // Load Fscache configuration template file
-func LoadFscacheConfig(p string) (*FscacheDaemonConfig, error) {
+func LoadFscacheConfig(p string, opts ...LoadOpt) (*FscacheDaemonConfig, error) {
 	var cfg FscacheDaemonConfig
-	b, err := os.ReadFile(p)
-	if err != nil {
-		return nil, errors.Wrapf(err, "read fscache configuration file %s", p)
-	}
-	if err = json.Unmarshal(b, &cfg); err != nil {
-		return nil, errors.Wrapf(err, "unmarshal")
+	if err := loadConfigFile(p, &cfg, opts); err != nil {
+		return nil, errors.Wrap(err, "load fscache configuration")
 	}
 
 	if cfg.Config == nil {
 		return nil, errors.New("invalid fscache configuration")
 	}
 
+	backendType, err := ParseStorageBackendType(cfg.Config.BackendType.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid backend in %s", p)
+	}
+	cfg.Config.BackendType = backendType
+
+	if err := cfg.Config.BackendConfig.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "validate backend config in %s", p)
+	}
+	cfg.Config.BackendConfig.applyEndpoints()
+	if err := validateCacheOnly(backendType, cfg.FscacheWorkDir()); err != nil {
+		return nil, errors.Wrapf(err, "in %s", p)
+	}
+	if err := validateFallbacks(cfg.Config.FallbackBackend, cfg.Config.FallbackBackends); err != nil {
+		return nil, errors.Wrapf(err, "in %s", p)
+	}
+
+	// It is handed over to nydusd and the cachefiles kernel module.
+	if workDir := cfg.FscacheWorkDir(); workDir != "" && !filepath.IsAbs(workDir) {
+		return nil, errors.Errorf("fscache work dir %q in %s must be an absolute path", workDir, p)
+	}
+
 	return &cfg, nil
 }
 
-func (c *FscacheDaemonConfig) StorageBackend() (string, *BackendConfig) {
+// EnsureFscacheWorkDir creates the fscache work directory of the configuration, if any,
+// before a daemon is started with it.
+func EnsureFscacheWorkDir(c *FscacheDaemonConfig) error {
+	dir := c.FscacheWorkDir()
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, FscacheWorkDirMode); err != nil {
+		return errors.Wrapf(err, "create fscache work dir %s", dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.Wrapf(err, "stat fscache work dir %s", dir)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("fscache work dir %s is not a directory", dir)
+	}
+	return nil
+}
+
+// FscacheWorkDir returns the directory fscache keeps blob cache data in.
+func (c *FscacheDaemonConfig) FscacheWorkDir() string {
+	return c.Config.CacheConfig.WorkDir
+}
+
+func (c *FscacheDaemonConfig) StorageBackend() (StorageBackendType, *BackendConfig) {
 	return c.Config.BackendType, &c.Config.BackendConfig
 }
 
+func (c *FscacheDaemonConfig) FallbackStorageBackend() (StorageBackendType, *BackendConfig) {
+	if c.Config.FallbackBackend == nil {
+		return "", nil
+	}
+	return c.Config.FallbackBackend.BackendType, &c.Config.FallbackBackend.Config
+}
+
 // Each fscache/erofs has a configuration with different fscache ID built from snapshot ID.
 func (c *FscacheDaemonConfig) Supplement(host, repo, snapshotID string, params map[string]string) {
 	if host != "" {
@@ -103,19 +166,48 @@ func (c *FscacheDaemonConfig) Supplement(host, repo, snapshotID string, params m
 }
 
 func (c *FscacheDaemonConfig) FillAuth(kc *auth.PassKeyChain) {
-	if kc != nil {
-		if kc.TokenBase() {
-			c.Config.BackendConfig.RegistryToken = kc.Password
-		} else {
-			c.Config.BackendConfig.Auth = kc.ToBase64()
-		}
+	c.Config.BackendConfig.fillAuth(kc)
+}
+
+func (c *FscacheDaemonConfig) BackendChain() []ChainedBackend {
+	return backendChain(c.Config.BackendType, &c.Config.BackendConfig, c.Config.FallbackBackend, c.Config.FallbackBackends)
+}
+
+func (c *FscacheDaemonConfig) HealthCheck() []error {
+	return healthCheck(c)
+}
+
+func (c *FscacheDaemonConfig) Canonicalize() {
+	c.Config.BackendConfig.canonicalize()
+	for _, b := range c.BackendChain()[1:] {
+		b.Config.canonicalize()
 	}
 }
 
+func (c *FscacheDaemonConfig) ConfigHash() (string, error) {
+	return configHash(c)
+}
+
+func (c *FscacheDaemonConfig) Clone() DaemonConfig {
+	return deepcopy.Copy(c).(*FscacheDaemonConfig)
+}
+
+func (c *FscacheDaemonConfig) WithoutMirrors() DaemonConfig {
+	return withoutMirrors(c)
+}
+
+func (c *FscacheDaemonConfig) AsAnnotations() map[string]string {
+	return asAnnotations(c)
+}
+
 func (c *FscacheDaemonConfig) DumpString() (string, error) {
 	return DumpConfigString(c)
 }
 
+func (c *FscacheDaemonConfig) DumpTo(w io.Writer) error {
+	return DumpConfigTo(c, w)
+}
+
 func (c *FscacheDaemonConfig) DumpFile(f string) error {
 	if err := os.MkdirAll(path.Dir(f), 0755); err != nil {
 		return err
@@ -7,10 +7,13 @@
 package daemonconfig
 
 import (
-	"encoding/json"
+	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 
+	"github.com/mohae/deepcopy"
 	"github.com/pkg/errors"
 
 	"github.com/containerd/nydus-snapshotter/pkg/auth"
@@ -41,23 +44,72 @@ type FSPrefetch struct {
 	MergingSize    int  `json:"merging_size,omitempty"`
 	BandwidthRate  int  `json:"bandwidth_rate,omitempty"`
 	StreamPrefetch bool `json:"stream_prefetch,omitempty"`
+	// Absolute in-image paths of hot files to prefetch on mount
+	PrefetchFiles []string `json:"prefetch_files,omitempty"`
+	// File listing more paths to prefetch, one per line, relative to the configuration file
+	// if not absolute. It is merged into PrefetchFiles on load.
+	PrefetchFilesFrom string `json:"prefetch_files_from,omitempty"`
 }
 
-// Load fuse daemon configuration from template file
-func LoadFuseConfig(p string) (*FuseDaemonConfig, error) {
-	b, err := os.ReadFile(p)
-	if err != nil {
-		return nil, errors.Wrapf(err, "read FUSE configuration file %s", p)
+// loadPrefetchFiles merges the paths listed in PrefetchFilesFrom into PrefetchFiles and
+// validates all of them.
+func (p *FSPrefetch) loadPrefetchFiles(configDir string) error {
+	if p.PrefetchFilesFrom != "" {
+		listFile := p.PrefetchFilesFrom
+		if !filepath.IsAbs(listFile) {
+			listFile = filepath.Join(configDir, listFile)
+		}
+		b, err := os.ReadFile(listFile)
+		if err != nil {
+			return errors.Wrap(err, "read prefetch files list")
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				p.PrefetchFiles = append(p.PrefetchFiles, line)
+			}
+		}
+		p.PrefetchFilesFrom = ""
 	}
+
+	for _, f := range p.PrefetchFiles {
+		if !path.IsAbs(f) || path.Clean(f) != f {
+			return errors.Errorf("invalid prefetch file %q, must be an absolute and clean path in the image", f)
+		}
+	}
+	return nil
+}
+
+// Load fuse daemon configuration from template file
+func LoadFuseConfig(p string, opts ...LoadOpt) (*FuseDaemonConfig, error) {
 	var cfg FuseDaemonConfig
-	if err := json.Unmarshal(b, &cfg); err != nil {
-		return nil, errors.Wrapf(err, "unmarshal %s", p)
+	if err := loadConfigFile(p, &cfg, opts); err != nil {
+		return nil, errors.Wrap(err, "load FUSE configuration")
 	}
 
 	if cfg.Device == nil {
 		return nil, errors.New("invalid fuse daemon configuration")
 	}
 
+	backendType, err := ParseStorageBackendType(cfg.Device.Backend.BackendType.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid backend in %s", p)
+	}
+	cfg.Device.Backend.BackendType = backendType
+
+	if err := cfg.Device.Backend.Config.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "validate backend config in %s", p)
+	}
+	cfg.Device.Backend.Config.applyEndpoints()
+	if err := validateCacheOnly(backendType, cfg.Device.Cache.Config.WorkDir); err != nil {
+		return nil, errors.Wrapf(err, "in %s", p)
+	}
+	if err := validateFallbacks(cfg.Device.FallbackBackend, cfg.Device.FallbackBackends); err != nil {
+		return nil, errors.Wrapf(err, "in %s", p)
+	}
+	if err := cfg.FSPrefetch.loadPrefetchFiles(filepath.Dir(p)); err != nil {
+		return nil, errors.Wrapf(err, "in %s", p)
+	}
+
 	return &cfg, nil
 }
 
@@ -72,27 +124,65 @@ func (c *FuseDaemonConfig) Supplement(host, repo, snapshotID string, params map[
 	if snapshotID != "" {
 		c.Device.ID = "/" + snapshotID
 	}
-	c.Device.Cache.Config.WorkDir = params[CacheDir]
+	if cacheDir := params[CacheDir]; cacheDir != "" {
+		c.Device.Cache.Config.WorkDir = cacheDir
+	}
 }
 
 func (c *FuseDaemonConfig) FillAuth(kc *auth.PassKeyChain) {
-	if kc != nil {
-		if kc.TokenBase() {
-			c.Device.Backend.Config.RegistryToken = kc.Password
-		} else {
-			c.Device.Backend.Config.Auth = kc.ToBase64()
-		}
-	}
+	c.Device.Backend.Config.fillAuth(kc)
 }
 
-func (c *FuseDaemonConfig) StorageBackend() (string, *BackendConfig) {
+func (c *FuseDaemonConfig) StorageBackend() (StorageBackendType, *BackendConfig) {
 	return c.Device.Backend.BackendType, &c.Device.Backend.Config
 }
 
+func (c *FuseDaemonConfig) FallbackStorageBackend() (StorageBackendType, *BackendConfig) {
+	if c.Device.FallbackBackend == nil {
+		return "", nil
+	}
+	return c.Device.FallbackBackend.BackendType, &c.Device.FallbackBackend.Config
+}
+
+func (c *FuseDaemonConfig) BackendChain() []ChainedBackend {
+	return backendChain(c.Device.Backend.BackendType, &c.Device.Backend.Config, c.Device.FallbackBackend, c.Device.FallbackBackends)
+}
+
+func (c *FuseDaemonConfig) HealthCheck() []error {
+	return healthCheck(c)
+}
+
+func (c *FuseDaemonConfig) Canonicalize() {
+	c.Device.Backend.Config.canonicalize()
+	for _, b := range c.BackendChain()[1:] {
+		b.Config.canonicalize()
+	}
+}
+
+func (c *FuseDaemonConfig) ConfigHash() (string, error) {
+	return configHash(c)
+}
+
+func (c *FuseDaemonConfig) Clone() DaemonConfig {
+	return deepcopy.Copy(c).(*FuseDaemonConfig)
+}
+
+func (c *FuseDaemonConfig) WithoutMirrors() DaemonConfig {
+	return withoutMirrors(c)
+}
+
+func (c *FuseDaemonConfig) AsAnnotations() map[string]string {
+	return asAnnotations(c)
+}
+
 func (c *FuseDaemonConfig) DumpString() (string, error) {
 	return DumpConfigString(c)
 }
 
+func (c *FuseDaemonConfig) DumpTo(w io.Writer) error {
+	return DumpConfigTo(c, w)
+}
+
 func (c *FuseDaemonConfig) DumpFile(f string) error {
 	if err := os.MkdirAll(path.Dir(f), 0755); err != nil {
 		return err
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func healthCheck(c DaemonConfig) []error {
+	return checkConfig(c, config.GetMirrorsConfigDir())
+}
+
+// checkConfig validates the whole configuration and the mirrors configuration directory,
+// collecting every problem instead of stopping at the first one.
+func checkConfig(c DaemonConfig, mirrorsConfigDir string) []error {
+	backendType, backendConfig := c.StorageBackend()
+	errs := checkBackend("backend", backendType, backendConfig)
+
+	for i, b := range c.BackendChain()[1:] {
+		name := "fallback backend"
+		if i > 0 {
+			name = fmt.Sprintf("fallback backend %d", i+1)
+		}
+		errs = append(errs, checkBackend(name, b.Type, b.Config)...)
+	}
+
+	return append(errs, checkMirrorsConfigDir(mirrorsConfigDir)...)
+}
+
+func checkBackend(name string, backendType StorageBackendType, c *BackendConfig) []error {
+	var errs []error
+	if c == nil {
+		return []error{errors.Errorf("%s: missing configuration", name)}
+	}
+
+	if !backendType.IsValid() {
+		errs = append(errs, errors.Errorf("%s: unknown backend type %q", name, backendType))
+	}
+
+	switch backendType {
+	case backendTypeLocalfs:
+		if c.Dir == "" && c.BlobFile == "" {
+			errs = append(errs, errors.Wrap(&MissingFieldError{Backend: backendType, Field: "dir or blob_file"}, name))
+		}
+		// The blobs of a dir populated from the registry only arrive with the images.
+		if c.Dir != "" && c.BlobFile == "" && !c.PopulateFromRegistry {
+			if blobs, err := c.BlobFiles(); err != nil {
+				errs = append(errs, errors.Wrap(err, name))
+			} else if len(blobs) == 0 {
+				errs = append(errs, errors.Errorf("%s: no blob found in localfs dir %s", name, c.Dir))
+			}
+		}
+	case backendTypeHTTP:
+		if c.BaseURL == "" {
+			errs = append(errs, errors.Wrap(&MissingFieldError{Backend: backendType, Field: "base_url"}, name))
+		}
+	case backendTypeIPFS:
+		if c.GatewayURL == "" && c.APISocket == "" {
+			errs = append(errs, errors.Wrap(&MissingFieldError{Backend: backendType, Field: "gateway_url or api_socket"}, name))
+		}
+	case backendTypeAzblob:
+		if c.AccountName == "" {
+			errs = append(errs, errors.Wrap(&MissingFieldError{Backend: backendType, Field: "account_name"}, name))
+		}
+		if c.ContainerName == "" {
+			errs = append(errs, errors.Wrap(&MissingFieldError{Backend: backendType, Field: "container_name"}, name))
+		}
+	case backendTypeOss, backendTypeS3, backendTypeGCS:
+		if c.BucketName == "" {
+			errs = append(errs, errors.Wrap(&MissingFieldError{Backend: backendType, Field: "bucket_name"}, name))
+		}
+		if backendType == backendTypeOss && len(c.endpoints()) == 0 {
+			errs = append(errs, errors.Wrap(&MissingFieldError{Backend: backendType, Field: "endpoint"}, name))
+		}
+	}
+	// Registry host and repo are supplemented per image, so they are not required here.
+
+	for _, f := range []struct{ name, scheme string }{
+		{"scheme", c.Scheme},
+		{"blob_url_scheme", c.BlobURLScheme},
+	} {
+		if f.scheme != "" && f.scheme != "http" && f.scheme != "https" {
+			errs = append(errs, errors.Wrap(&InvalidSchemeError{Field: f.name, Value: f.scheme}, name))
+		}
+	}
+	if c.Proxy.URL != "" {
+		if u, err := url.Parse(c.Proxy.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, errors.Errorf("%s: invalid proxy url %q", name, c.Proxy.URL))
+		}
+	}
+
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"timeout", c.Timeout},
+		{"connect_timeout", c.ConnectTimeout},
+		{"retry_limit", c.RetryLimit},
+		{"proxy.check_interval", c.Proxy.CheckInterval},
+	} {
+		if f.value < 0 {
+			errs = append(errs, errors.Errorf("%s: invalid %s %d, must not be negative", name, f.name, f.value))
+		}
+	}
+	if c.Timeout > 0 && c.ConnectTimeout > c.Timeout {
+		errs = append(errs, errors.Errorf("%s: connect_timeout %d exceeds timeout %d", name, c.ConnectTimeout, c.Timeout))
+	}
+
+	for _, err := range c.validationErrors() {
+		var missing *MissingFieldError
+		if errors.As(err, &missing) && missing.Backend == "" {
+			missing.Backend = backendType
+		}
+		errs = append(errs, errors.Wrap(err, name))
+	}
+
+	return errs
+}
+
+// checkMirrorsConfigDir parses the hosts.toml of every registry host in the mirrors
+// configuration directory.
+func checkMirrorsConfigDir(dir string) []error {
+	if dir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return []error{errors.Wrapf(err, "read mirrors config dir %s", dir)}
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := loadHostDir(filepath.Join(dir, entry.Name())); err != nil {
+			errs = append(errs, errors.Wrapf(err, "mirrors config of %s", entry.Name()))
+		}
+	}
+	return errs
+}
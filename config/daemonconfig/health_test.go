@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheck(t *testing.T) {
+	cfg, err := LoadFuseConfig("../../misc/snapshotter/nydusd-config.fusedev.json")
+	require.NoError(t, err)
+	require.Empty(t, cfg.HealthCheck())
+
+	backendType, backend := cfg.StorageBackend()
+	require.Equal(t, backendTypeRegistry, backendType)
+	backend.Scheme = "ftp"
+	backend.Timeout = 5
+	backend.ConnectTimeout = 10
+	backend.RetryLimit = -1
+	backend.Proxy.URL = "not-a-url"
+	backend.KeepAliveSec = -1
+	backend.SSEType = sseTypeKMS
+	cfg.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeOss}
+
+	mirrorsDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(mirrorsDir, "docker.io"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mirrorsDir, "docker.io", "hosts.toml"), []byte("[host"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(mirrorsDir, "ghcr.io"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mirrorsDir, "ghcr.io", "hosts.toml"),
+		[]byte("[host.\"http://127.0.0.1:5000\"]\n"), 0644))
+
+	errs := checkConfig(cfg, mirrorsDir)
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	require.Equal(t, []string{
+		`backend: invalid scheme "ftp", must be http or https`,
+		`backend: invalid proxy url "not-a-url"`,
+		`backend: invalid retry_limit -1, must not be negative`,
+		`backend: connect_timeout 10 exceeds timeout 5`,
+		`backend: invalid keep_alive_sec -1, must not be negative`,
+		`backend: sse_kms_key_id is required by sse_type "aws:kms"`,
+		`fallback backend: bucket_name is required by oss`,
+		`fallback backend: endpoint is required by oss`,
+	}, msgs[:len(msgs)-1])
+	require.Contains(t, msgs[len(msgs)-1], "mirrors config of docker.io")
+
+	fscacheCfg, err := LoadFscacheConfig("../../misc/snapshotter/nydusd-config.fscache.json")
+	require.NoError(t, err)
+	require.Empty(t, fscacheCfg.HealthCheck())
+	fscacheCfg.Config.BackendType = "ftp"
+	require.Len(t, fscacheCfg.HealthCheck(), 1)
+}
+
+func TestHealthCheckTypedErrors(t *testing.T) {
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeOss
+	cfg.Device.Backend.Config.BlobURLScheme = "ftp"
+	cfg.Device.Backend.Config.SSEType = sseTypeKMS
+	cfg.Device.FallbackBackend = &FallbackBackend{BackendType: backendTypeLocalfs}
+
+	type missing struct {
+		backend StorageBackendType
+		field   string
+	}
+	var (
+		gotMissing []missing
+		gotScheme  []InvalidSchemeError
+	)
+	for _, err := range checkConfig(cfg, "") {
+		var missingErr *MissingFieldError
+		var schemeErr *InvalidSchemeError
+		switch {
+		case errors.As(err, &missingErr):
+			gotMissing = append(gotMissing, missing{missingErr.Backend, missingErr.Field})
+		case errors.As(err, &schemeErr):
+			gotScheme = append(gotScheme, *schemeErr)
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	require.Equal(t, []missing{
+		{backendTypeOss, "bucket_name"},
+		{backendTypeOss, "endpoint"},
+		{backendTypeOss, "sse_kms_key_id"},
+		{backendTypeLocalfs, "dir or blob_file"},
+	}, gotMissing)
+	require.Equal(t, []InvalidSchemeError{{Field: "blob_url_scheme", Value: "ftp"}}, gotScheme)
+
+	var missingErr *MissingFieldError
+	err := cfg.Device.Backend.Config.Validate()
+	require.True(t, errors.As(err, &missingErr))
+	require.Equal(t, "sse_kms_key_id", missingErr.Field)
+	require.Equal(t, `sse_kms_key_id is required by sse_type "aws:kms"`, err.Error())
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+// ConfigSummary describes a nydusd configuration file found by InspectConfigDir.
+type ConfigSummary struct {
+	Path    string
+	Driver  string
+	Backend StorageBackendType
+	// Number of mirrors configured for the registry host of the backend
+	MirrorCount int
+	// Whether credentials are stored in the file
+	HasSecrets bool
+	// Why the file could not be loaded, only Path and Driver are set then
+	Err error
+}
+
+// InspectConfigDir loads every nydusd configuration file with the ".json" extension in dir,
+// whichever driver it is written for. Files which are not nydusd configurations are skipped,
+// and invalid ones are summarized with the error they failed to load with.
+func InspectConfigDir(dir string) ([]ConfigSummary, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read config dir %s", dir)
+	}
+
+	var summaries []ConfigSummary
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		p := filepath.Join(dir, entry.Name())
+		driver := detectFsDriver(p)
+		if driver == "" {
+			log.L.Debugf("Skipping %s, not a nydusd configuration", p)
+			continue
+		}
+
+		c, err := NewDaemonConfig(driver, p)
+		if err != nil {
+			summaries = append(summaries, ConfigSummary{Path: p, Driver: driver, Err: err})
+			continue
+		}
+
+		backendType, backendConfig := c.StorageBackend()
+		summary := ConfigSummary{
+			Path:       p,
+			Driver:     driver,
+			Backend:    backendType,
+			HasSecrets: hasSecrets(reflect.ValueOf(c)),
+		}
+		if backendType == backendTypeRegistry && backendConfig.Host != "" {
+			mirrors, _, err := LoadMirrorsConfig(config.GetMirrorsConfigDir(), backendConfig.Host)
+			if err != nil {
+				log.L.Warnf("Failed to load mirrors config for %s: %v", backendConfig.Host, err)
+			}
+			summary.MirrorCount = len(mirrors)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// detectFsDriver tells the driver of a configuration file from its top level keys, or from
+// its name if the content is ambiguous. It returns "" for files which are not nydusd configurations.
+func detectFsDriver(p string) string {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return ""
+	}
+
+	_, isFuse := keys["device"]
+	_, isFscache := keys["config"]
+	switch {
+	case isFuse && !isFscache:
+		return config.FsDriverFusedev
+	case isFscache && !isFuse:
+		return config.FsDriverFscache
+	case isFuse && isFscache:
+		name := filepath.Base(p)
+		if strings.Contains(name, config.FsDriverFscache) {
+			return config.FsDriverFscache
+		}
+		if strings.Contains(name, config.FsDriverFusedev) {
+			return config.FsDriverFusedev
+		}
+	}
+	return ""
+}
+
+// hasSecrets reports whether any field tagged as secret is set in v.
+func hasSecrets(v reflect.Value) bool {
+	//nolint:exhaustive
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return !v.IsNil() && hasSecrets(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).Tag.Get("secret") == "true" {
+				if !v.Field(i).IsZero() {
+					return true
+				}
+				continue
+			}
+			if hasSecrets(v.Field(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestInspectConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	write("a.json", `{"device": {"backend": {"type": "registry",
+		"config": {"host": "registry.example.com", "auth": "dXNlcjpwYXNz"}}}, "mode": "direct"}`)
+	write("b.json", `{"type": "bootstrap", "config": {"backend_type": "oss",
+		"backend_config": {"endpoint": "oss.example.com", "bucket_name": "nydus"}, "cache_type": "fscache"}}`)
+	write("c.json", `{"device": {"backend": {"type": "registry", "config": {"host": 5}}}}`)
+	write("d.json", `{"device": {"backend": {"type": "localfs", "config": {"dir": "/var/lib/nydus/blobs"}}}}`)
+	write("junk.json", `not json at all`)
+	write("other.json", `{"hello": "world"}`)
+	write("README", `{"device": {}}`)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub.json"), 0755))
+
+	summaries, err := InspectConfigDir(dir)
+	require.NoError(t, err)
+	// Invalid files don't keep the others from being inspected.
+	require.Len(t, summaries, 4)
+	require.Equal(t, filepath.Join(dir, "c.json"), summaries[2].Path)
+	require.Equal(t, config.FsDriverFusedev, summaries[2].Driver)
+	require.Error(t, summaries[2].Err)
+	require.Equal(t, ConfigSummary{
+		Path:    filepath.Join(dir, "d.json"),
+		Driver:  config.FsDriverFusedev,
+		Backend: backendTypeLocalfs,
+	}, summaries[3])
+	require.Equal(t, []ConfigSummary{
+		{
+			Path:       filepath.Join(dir, "a.json"),
+			Driver:     config.FsDriverFusedev,
+			Backend:    backendTypeRegistry,
+			HasSecrets: true,
+		},
+		{
+			Path:    filepath.Join(dir, "b.json"),
+			Driver:  config.FsDriverFscache,
+			Backend: backendTypeOss,
+		},
+	}, summaries[:2])
+
+	_, err = InspectConfigDir(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+)
+
+// States of the circuit breaker of a mirror.
+const (
+	// The mirror is probed before use.
+	CircuitClosed = "closed"
+	// The mirror failed too often and is skipped until its backoff elapses.
+	CircuitOpen = "open"
+	// The backoff elapsed and the next probe decides whether the mirror is used again.
+	CircuitHalfOpen = "half-open"
+)
+
+const (
+	// Consecutive failed probes opening the circuit of mirrors without failure_limit.
+	defaultMirrorFailureLimit = 5
+	mirrorBackoffBase         = 10 * time.Second
+	mirrorBackoffMax          = 10 * time.Minute
+)
+
+// MirrorHealth is the health of a mirror, as seen by its probes.
+type MirrorHealth struct {
+	Host                string    `json:"host"`
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastProbe           time.Time `json:"last_probe,omitempty"`
+	OpenUntil           time.Time `json:"open_until,omitempty"`
+	// Disabled by hand, see DisableMirror.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+type mirrorCircuit struct {
+	MirrorHealth
+	// Times the circuit opened in a row, which the backoff grows with.
+	opens int
+	// Whether the single probe of a half-open circuit is running.
+	trial bool
+}
+
+// mirrorCircuits keeps a circuit breaker per mirror, so mirrors failing their probes are not
+// probed again on every mount but backed off from exponentially.
+type mirrorCircuits struct {
+	mu sync.Mutex
+	// Keyed by the mirrorKey of the mirror, like all maps below.
+	circuits map[string]*mirrorCircuit
+	disabled map[string]bool
+	// Mirrors selected from since startup, the ones which can be disabled.
+	known map[string]bool
+}
+
+var circuits = newMirrorCircuits()
+
+func newMirrorCircuits() *mirrorCircuits {
+	return &mirrorCircuits{circuits: map[string]*mirrorCircuit{}, disabled: map[string]bool{}, known: map[string]bool{}}
+}
+
+// mirrorKey returns the mirror host as "scheme://host:port", so that the hosts.toml form
+// "http://mirror:5000" and the backend form "mirror:5000" with scheme "http" are the same.
+func mirrorKey(host string) string {
+	scheme, h, err := splitMirrorURL(host)
+	if err != nil || h == "" {
+		return host
+	}
+	return scheme + "://" + h
+}
+
+// circuit returns the circuit of the mirror, creating a closed one if there is none.
+func (c *mirrorCircuits) circuit(host string) *mirrorCircuit {
+	key := mirrorKey(host)
+	m, ok := c.circuits[key]
+	if !ok {
+		m = &mirrorCircuit{MirrorHealth: MirrorHealth{Host: key, State: CircuitClosed}}
+		c.circuits[key] = m
+	}
+	return m
+}
+
+// see records the mirror as known.
+func (c *mirrorCircuits) see(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.known[mirrorKey(host)] = true
+}
+
+func (c *mirrorCircuits) isDisabled(host string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.disabled[mirrorKey(host)]
+}
+
+func (c *mirrorCircuits) setDisabled(host string, disabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := mirrorKey(host)
+	if !c.known[key] && !c.disabled[key] {
+		return errors.Wrapf(errUnknownMirror, "mirror %s", host)
+	}
+	if disabled {
+		c.disabled[key] = true
+	} else {
+		delete(c.disabled, key)
+	}
+	return nil
+}
+
+// allow returns whether the mirror may be probed. Only one probe is let through once the
+// backoff of an open circuit has elapsed.
+func (c *mirrorCircuits) allow(host string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.circuits[mirrorKey(host)]
+	if !ok {
+		return true
+	}
+	switch m.State {
+	case CircuitOpen:
+		if time.Now().Before(m.OpenUntil) {
+			return false
+		}
+		m.State = CircuitHalfOpen
+		m.trial = true
+		log.L.Infof("Circuit of mirror %s is half-open, probing it again", host)
+		return true
+	case CircuitHalfOpen:
+		if m.trial {
+			return false
+		}
+		m.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (c *mirrorCircuits) success(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.circuit(host)
+	if m.State != CircuitClosed {
+		log.L.Infof("Circuit of mirror %s is closed again", host)
+	}
+	m.State = CircuitClosed
+	m.ConsecutiveFailures = 0
+	m.LastProbe = time.Now()
+	m.OpenUntil = time.Time{}
+	m.opens = 0
+	m.trial = false
+}
+
+// failure records a failed probe of the mirror, and opens its circuit once the failure
+// limit is reached or the probe of a half-open circuit failed.
+func (c *mirrorCircuits) failure(mirror MirrorConfig, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.circuit(mirror.Host)
+	m.ConsecutiveFailures++
+	m.LastError = err.Error()
+	m.LastProbe = time.Now()
+	m.trial = false
+
+	limit := int(mirror.FailureLimit)
+	if limit == 0 {
+		limit = defaultMirrorFailureLimit
+	}
+	if m.State == CircuitHalfOpen || m.ConsecutiveFailures >= limit {
+		backoff := mirrorBackoff(m.opens)
+		m.opens++
+		m.State = CircuitOpen
+		m.OpenUntil = time.Now().Add(backoff)
+		log.L.Warnf("Circuit of mirror %s is open for %s after %d failures", mirror.Host, backoff.Round(time.Second), m.ConsecutiveFailures)
+	}
+}
+
+// mirrorBackoff returns how long a circuit stays open the opens+1st time in a row, doubling
+// up to mirrorBackoffMax and jittered so mirrors of many nodes aren't probed at once.
+func mirrorBackoff(opens int) time.Duration {
+	backoff := mirrorBackoffMax
+	if opens < 16 {
+		backoff = min(mirrorBackoffBase<<opens, mirrorBackoffMax)
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// states returns the health of the probed and disabled mirrors, sorted by host.
+func (c *mirrorCircuits) states() []MirrorHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	states := make([]MirrorHealth, 0, len(c.circuits))
+	for host, m := range c.circuits {
+		h := m.MirrorHealth
+		h.Disabled = c.disabled[host]
+		states = append(states, h)
+	}
+	for host := range c.disabled {
+		if _, ok := c.circuits[host]; !ok {
+			states = append(states, MirrorHealth{Host: host, State: CircuitClosed, Disabled: true})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+	return states
+}
+
+// MirrorHealthStates returns the health of the mirrors probed so far and of the disabled ones.
+func MirrorHealthStates() []MirrorHealth {
+	return circuits.states()
+}
+
+// errUnknownMirror is returned for mirrors no image was mounted with since startup.
+var errUnknownMirror = errors.New("unknown mirror")
+
+// IsUnknownMirror tells whether err is returned by DisableMirror or EnableMirror for a
+// mirror no image was mounted with.
+func IsUnknownMirror(err error) bool {
+	return errors.Is(err, errUnknownMirror)
+}
+
+// DisableMirror stops using the mirror, given by its host as in hosts.toml, e.g.
+// "http://mirror:5000", for new mounts until EnableMirror is called. Only mirrors selected
+// from since startup can be disabled.
+func DisableMirror(host string) error {
+	if err := circuits.setDisabled(host, true); err != nil {
+		return err
+	}
+	log.L.Infof("Mirror %s is disabled", mirrorKey(host))
+	return nil
+}
+
+// EnableMirror uses the mirror disabled by DisableMirror again.
+func EnableMirror(host string) error {
+	if err := circuits.setDisabled(host, false); err != nil {
+		return err
+	}
+	log.L.Infof("Mirror %s is enabled", mirrorKey(host))
+	return nil
+}
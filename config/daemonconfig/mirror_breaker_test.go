@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+func TestMirrorCircuits(t *testing.T) {
+	c := newMirrorCircuits()
+	mirror := MirrorConfig{Host: "http://mirror:5000", FailureLimit: 2}
+
+	require.True(t, c.allow(mirror.Host))
+	c.failure(mirror, errors.New("connection refused"))
+	require.True(t, c.allow(mirror.Host))
+	c.failure(mirror, errors.New("connection refused"))
+
+	states := c.states()
+	require.Len(t, states, 1)
+	require.Equal(t, CircuitOpen, states[0].State)
+	require.Equal(t, 2, states[0].ConsecutiveFailures)
+	require.Equal(t, "connection refused", states[0].LastError)
+	require.False(t, c.allow(mirror.Host))
+
+	// A single probe is let through once the backoff elapsed, and a failure opens the
+	// circuit again for longer.
+	c.circuits[mirror.Host].OpenUntil = time.Now()
+	require.True(t, c.allow(mirror.Host))
+	require.Equal(t, CircuitHalfOpen, c.states()[0].State)
+	require.False(t, c.allow(mirror.Host))
+	c.failure(mirror, errors.New("connection refused"))
+	require.Equal(t, CircuitOpen, c.states()[0].State)
+	require.Greater(t, time.Until(c.states()[0].OpenUntil), mirrorBackoffBase)
+
+	c.circuits[mirror.Host].OpenUntil = time.Now()
+	require.True(t, c.allow(mirror.Host))
+	c.success(mirror.Host)
+	require.Equal(t, CircuitClosed, c.states()[0].State)
+	require.Zero(t, c.states()[0].ConsecutiveFailures)
+	require.True(t, c.allow(mirror.Host))
+}
+
+func TestMirrorBackoff(t *testing.T) {
+	for opens, limit := range []time.Duration{mirrorBackoffBase, 2 * mirrorBackoffBase, 4 * mirrorBackoffBase} {
+		backoff := mirrorBackoff(opens)
+		require.GreaterOrEqual(t, backoff, limit/2)
+		require.LessOrEqual(t, backoff, limit)
+	}
+	require.LessOrEqual(t, mirrorBackoff(100), mirrorBackoffMax)
+}
+
+func TestSelectMirrorHost_OpenCircuit(t *testing.T) {
+	var probes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	oldCircuits := circuits
+	defer func() { circuits = oldCircuits }()
+	circuits = newMirrorCircuits()
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://mirror1:5000"]
+    ping_url = "`+srv.URL+`"
+    failure_limit = 1
+`)
+	// The failing mirror is not probed anymore while its circuit is open.
+	for i := 0; i < 3; i++ {
+		_, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+		require.Equal(t, testRegistryHost, host)
+	}
+	require.Equal(t, int32(1), probes.Load())
+	require.Equal(t, CircuitOpen, circuits.states()[0].State)
+}
+
+func TestSelectMirrorHost_DisabledMirror(t *testing.T) {
+	oldCircuits := circuits
+	defer func() { circuits = oldCircuits }()
+	circuits = newMirrorCircuits()
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://mirror1:5000"]
+  [host."http://mirror2:5000"]
+`)
+	// Only mirrors selected from are known.
+	require.True(t, IsUnknownMirror(DisableMirror("http://mirror1:5000")))
+	_, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, "mirror1:5000", host)
+	require.True(t, IsUnknownMirror(DisableMirror("http://unknown:5000")))
+
+	// The host is matched in any form, and reported like in hosts.toml.
+	require.NoError(t, DisableMirror("http://mirror1:5000/"))
+	_, host, _ = selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, "mirror2:5000", host)
+	states := MirrorHealthStates()
+	require.Len(t, states, 1)
+	require.True(t, states[0].Disabled)
+	require.Equal(t, "http://mirror1:5000", states[0].Host)
+
+	require.NoError(t, EnableMirror("http://mirror1:5000"))
+	_, host, _ = selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, "mirror1:5000", host)
+	require.Empty(t, MirrorHealthStates())
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	var m dto.Metric
+	require.NoError(t, c.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func TestSelectMirrorHost_Metrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	oldCircuits := circuits
+	defer func() { circuits = oldCircuits }()
+	circuits = newMirrorCircuits()
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://metrics-mirror1:5000"]
+    ping_url = "`+srv.URL+`"
+  [host."http://metrics-mirror2:5000"]
+`)
+	_, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, "metrics-mirror2:5000", host)
+	require.Equal(t, 1.0, counterValue(t, data.MirrorRequests.WithLabelValues("http://metrics-mirror1:5000")))
+	require.Equal(t, 1.0, counterValue(t, data.MirrorFailures.WithLabelValues("http://metrics-mirror1:5000")))
+	require.Equal(t, 1.0, counterValue(t, data.MirrorFallbacks.WithLabelValues("http://metrics-mirror1:5000", "mirror")))
+	require.Equal(t, 1.0, counterValue(t, data.MirrorRequests.WithLabelValues("http://metrics-mirror2:5000")))
+
+	require.NoError(t, DisableMirror("http://metrics-mirror2:5000"))
+	_, host, _ = selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, testRegistryHost, host)
+	require.Equal(t, 1.0, counterValue(t, data.MirrorFallbacks.WithLabelValues("http://metrics-mirror1:5000", "registry")))
+	require.Equal(t, 1.0, counterValue(t, data.MirrorFallbacks.WithLabelValues("http://metrics-mirror2:5000", "registry")))
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// Time the first address family is given before the other one is raced against it.
+const mirrorDialFallbackDelay = 300 * time.Millisecond
+
+// bracketIPv6 encloses a bare IPv6 literal host of rawURL, e.g. "http://fd00::1/healthz", in
+// brackets as URLs need it. A port can't follow a bare literal, as it would be taken for part
+// of the address.
+func bracketIPv6(rawURL string) string {
+	scheme, rest, hasScheme := strings.Cut(rawURL, "://")
+	if !hasScheme {
+		rest = rawURL
+	}
+	authority, path := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		authority, path = rest[:i], rest[i:]
+	}
+	if ip := net.ParseIP(authority); ip == nil || ip.To4() != nil {
+		return rawURL
+	}
+	if hasScheme {
+		return scheme + "://[" + authority + "]" + path
+	}
+	return "[" + authority + "]" + path
+}
+
+// mirrorDialer returns a dial function racing the address families of a dual-stack mirror,
+// so that a mirror which announces an address it doesn't answer on, typically IPv6, is still
+// reached over the other family within timeout.
+func mirrorDialer(timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: timeout, FallbackDelay: mirrorDialFallbackDelay}
+	return d.DialContext
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestBracketIPv6(t *testing.T) {
+	for input, expected := range map[string]string{
+		"http://fd00::1":          "http://[fd00::1]",
+		"fd00::1":                 "[fd00::1]",
+		"http://fd00::1/healthz":  "http://[fd00::1]/healthz",
+		"http://[fd00::1]:5000":   "http://[fd00::1]:5000",
+		"http://127.0.0.1:5000":   "http://127.0.0.1:5000",
+		"https://mirror:5000/v2/": "https://mirror:5000/v2/",
+		"":                        "",
+	} {
+		require.Equal(t, expected, bracketIPv6(input), input)
+	}
+
+	scheme, host, err := splitMirrorURL("fd00::1")
+	require.NoError(t, err)
+	require.Equal(t, "https", scheme)
+	require.Equal(t, "[fd00::1]", host)
+
+	require.Equal(t, "[fd00::1]_5000_", hostDirectory("[fd00::1]:5000"))
+	require.Equal(t, "[fd00::1]", hostDirectory("[fd00::1]"))
+}
+
+func TestSelectMirrorHost_IPv6(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+
+	tmpDir := t.TempDir()
+	// Brackets can't be used in TOML table keys.
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://::1"]
+    ping_url = "http://[::1]:`+port+`/healthz"
+`)
+	scheme, host, mirror := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, "http", scheme)
+	require.Equal(t, "[::1]", host)
+	require.Equal(t, "http://[::1]", mirror.Host)
+}
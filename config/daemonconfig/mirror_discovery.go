@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+const (
+	defaultDiscoveryRefreshInterval = 30 * time.Second
+	srvLookupTimeout                = 5 * time.Second
+)
+
+// lookupSRV is a variable so tests can substitute it.
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+var (
+	discovery   *MirrorDiscovery
+	discoveryMu sync.Mutex
+)
+
+// MirrorDiscovery keeps the mirrors listed by DNS SRV records, so in-cluster mirrors can be
+// added and removed without editing the hosts.toml files of every node.
+type MirrorDiscovery struct {
+	config config.MirrorDiscoveryConfig
+
+	mu sync.Mutex
+	// Keyed by the name of the SRV record.
+	mirrors map[string][]MirrorConfig
+}
+
+// InitMirrorDiscovery looks up the configured SRV records and refreshes them in the background
+// until ctx is done. This should be called once at startup if mirror discovery is configured.
+func InitMirrorDiscovery(ctx context.Context, c config.MirrorDiscoveryConfig) {
+	discoveryMu.Lock()
+	defer discoveryMu.Unlock()
+
+	if discovery != nil {
+		return
+	}
+
+	d := NewMirrorDiscovery(c)
+	d.Refresh(ctx)
+	go d.Run(ctx)
+	discovery = d
+	log.L.WithField("records", len(c.SRV)).Info("mirror discovery initialized")
+}
+
+func NewMirrorDiscovery(c config.MirrorDiscoveryConfig) *MirrorDiscovery {
+	return &MirrorDiscovery{config: c, mirrors: map[string][]MirrorConfig{}}
+}
+
+// Run refreshes the SRV records on the configured interval until ctx is done.
+func (d *MirrorDiscovery) Run(ctx context.Context) {
+	interval := d.config.RefreshInterval
+	if interval == 0 {
+		interval = defaultDiscoveryRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh looks up all SRV records. A record which doesn't exist has no mirrors, while the
+// mirrors of a record which temporarily fails to resolve are kept until it resolves again.
+func (d *MirrorDiscovery) Refresh(ctx context.Context) {
+	for _, r := range d.config.SRV {
+		mirrors, err := lookupSRVMirrors(ctx, r)
+		if err != nil && temporaryLookupError(err) {
+			log.L.WithError(err).Warnf("failed to look up mirrors of SRV record %s", r.Name)
+			continue
+		}
+		if err != nil {
+			log.L.WithError(err).Debugf("no mirrors for SRV record %s", r.Name)
+		}
+		d.mu.Lock()
+		d.mirrors[r.Name] = mirrors
+		d.mu.Unlock()
+	}
+}
+
+// Mirrors returns the discovered mirrors of registryHost, ordered like the SRV records
+// in the configuration.
+func (d *MirrorDiscovery) Mirrors(registryHost string) []MirrorConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var mirrors []MirrorConfig
+	for _, r := range d.config.SRV {
+		if !mirrorsRegistry(r.Registries, registryHost) {
+			continue
+		}
+		mirrors = append(mirrors, d.mirrors[r.Name]...)
+	}
+	return mirrors
+}
+
+// temporaryLookupError tells whether the lookup failed for a reason which may go away, like a
+// timeout or an unreachable DNS server, rather than the record not existing.
+func temporaryLookupError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound && (dnsErr.IsTemporary || dnsErr.IsTimeout)
+	}
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+func lookupSRVMirrors(ctx context.Context, r config.SRVMirrorConfig) ([]MirrorConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, srvLookupTimeout)
+	defer cancel()
+	// Targets come sorted by priority and randomized by weight.
+	_, addrs, err := lookupSRV(ctx, "", "", r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := r.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	mirrors := make([]MirrorConfig, 0, len(addrs))
+	for _, addr := range addrs {
+		host := net.JoinHostPort(strings.TrimSuffix(addr.Target, "."), strconv.Itoa(int(addr.Port)))
+		mirrors = append(mirrors, MirrorConfig{Host: scheme + "://" + host})
+	}
+	return mirrors, nil
+}
+
+// discoveredMirrors returns the mirrors of registryHost found by the global mirror discovery.
+func discoveredMirrors(registryHost string) []MirrorConfig {
+	discoveryMu.Lock()
+	d := discovery
+	discoveryMu.Unlock()
+
+	if d == nil {
+		return nil
+	}
+	return d.Mirrors(registryHost)
+}
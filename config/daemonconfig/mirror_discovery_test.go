@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestMirrorDiscovery(t *testing.T) {
+	records := map[string][]*net.SRV{
+		"_nydus-mirror._tcp.cluster.local": {
+			{Target: "mirror-0.mirror.cluster.local.", Port: 5000},
+			{Target: "mirror-1.mirror.cluster.local.", Port: 5000},
+		},
+		"_docker-mirror._tcp.cluster.local": {
+			{Target: "docker-mirror.cluster.local.", Port: 443},
+		},
+	}
+	oldLookupSRV := lookupSRV
+	defer func() { lookupSRV = oldLookupSRV }()
+	lookupSRV = func(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+		if name == "_flaky._tcp.cluster.local" {
+			return "", nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+		}
+		addrs, ok := records[name]
+		if !ok {
+			return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+		return name, addrs, nil
+	}
+
+	d := NewMirrorDiscovery(config.MirrorDiscoveryConfig{SRV: []config.SRVMirrorConfig{
+		{Name: "_nydus-mirror._tcp.cluster.local", Scheme: "http"},
+		{Name: "_docker-mirror._tcp.cluster.local", Registries: []string{"docker.io"}},
+	}})
+	d.Refresh(context.Background())
+
+	require.Equal(t, []MirrorConfig{
+		{Host: "http://mirror-0.mirror.cluster.local:5000"},
+		{Host: "http://mirror-1.mirror.cluster.local:5000"},
+		{Host: "https://docker-mirror.cluster.local:443"},
+	}, d.Mirrors("docker.io"))
+	require.Len(t, d.Mirrors(testRegistryHost), 2)
+
+	// Mirrors follow the records, and are dropped with their record.
+	records["_nydus-mirror._tcp.cluster.local"] = records["_nydus-mirror._tcp.cluster.local"][1:]
+	delete(records, "_docker-mirror._tcp.cluster.local")
+	d.Refresh(context.Background())
+	require.Equal(t, []MirrorConfig{
+		{Host: "http://mirror-1.mirror.cluster.local:5000"},
+	}, d.Mirrors("docker.io"))
+
+	// They are kept while a record temporarily fails to resolve.
+	flaky := NewMirrorDiscovery(config.MirrorDiscoveryConfig{SRV: []config.SRVMirrorConfig{{Name: "_flaky._tcp.cluster.local"}}})
+	flaky.mirrors["_flaky._tcp.cluster.local"] = []MirrorConfig{{Host: "https://flaky:5000"}}
+	flaky.Refresh(context.Background())
+	require.Len(t, flaky.Mirrors("docker.io"), 1)
+
+	oldDiscovery := discovery
+	defer func() { discovery = oldDiscovery }()
+	discovery = d
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://mirror1:5000"]
+    ping_url = "http://127.0.0.1:0"
+`)
+	// Discovered mirrors are tried after the ones of hosts.toml.
+	scheme, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, "mirror-1.mirror.cluster.local:5000", host)
+	require.Equal(t, "http", scheme)
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/registry"
+)
+
+const (
+	defaultFailbackInterval      = 30 * time.Second
+	defaultFailbackHealthyProbes = 3
+	defaultFailbackCooldown      = time.Minute
+)
+
+var (
+	failback   *MirrorFailback
+	failbackMu sync.Mutex
+)
+
+type fallenBackMirror struct {
+	mirror MirrorConfig
+	// When the mirror last failed a probe.
+	failedAt time.Time
+	// Successful probes in a row since then.
+	healthy int
+}
+
+// MirrorFailback probes the mirrors instances fell back from, and fails back to them once
+// they are healthy again. Instances keep the mirror selected on mount until their
+// configuration is pushed again, which selects the recovered mirror.
+type MirrorFailback struct {
+	interval      time.Duration
+	healthyProbes int
+	cooldown      time.Duration
+	timeout       time.Duration
+
+	mu sync.Mutex
+	// Keyed by the host of the mirror.
+	mirrors map[string]*fallenBackMirror
+}
+
+// InitMirrorFailback starts probing the mirrors fallen back from on the configured interval
+// until ctx is done, and calls push with the hosts of the ones which recovered, to select
+// them for the daemons again. This should be called once at startup if failback is configured.
+func InitMirrorFailback(ctx context.Context, c config.MirrorsConfig, push func(recovered []string) error) {
+	failbackMu.Lock()
+	defer failbackMu.Unlock()
+
+	if failback != nil {
+		return
+	}
+
+	f := NewMirrorFailback(c)
+	go f.Run(ctx, push)
+	failback = f
+	log.L.WithField("interval", f.interval).Info("mirror failback initialized")
+}
+
+func NewMirrorFailback(c config.MirrorsConfig) *MirrorFailback {
+	f := &MirrorFailback{
+		interval:      c.Failback.Interval,
+		healthyProbes: c.Failback.HealthyProbes,
+		cooldown:      c.Failback.Cooldown,
+		timeout:       c.ProbeTimeout,
+		mirrors:       map[string]*fallenBackMirror{},
+	}
+	if f.interval <= 0 {
+		f.interval = defaultFailbackInterval
+	}
+	if f.healthyProbes <= 0 {
+		f.healthyProbes = defaultFailbackHealthyProbes
+	}
+	if f.cooldown <= 0 {
+		f.cooldown = defaultFailbackCooldown
+	}
+	if f.timeout <= 0 {
+		f.timeout = defaultMirrorProbeTimeout
+	}
+	return f
+}
+
+// Run checks the mirrors fallen back from on the configured interval until ctx is done.
+func (f *MirrorFailback) Run(ctx context.Context, push func(recovered []string) error) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			recovered := f.Check()
+			if len(recovered) == 0 {
+				continue
+			}
+			if err := push(recovered); err != nil {
+				log.L.WithError(err).Errorf("failed to fail back to mirrors %v", recovered)
+				continue
+			}
+			log.L.Infof("Failed back to mirrors %v", recovered)
+		}
+	}
+}
+
+// fellBack records that the mirror was passed over. Only a failed probe restarts its
+// cooldown, skipping it for its open circuit or being disabled doesn't.
+func (f *MirrorFailback) fellBack(mirror MirrorConfig, failed bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m, ok := f.mirrors[mirror.Host]
+	if !ok {
+		m = &fallenBackMirror{failedAt: time.Now()}
+		f.mirrors[mirror.Host] = m
+	}
+	m.mirror = mirror
+	if failed {
+		m.failedAt, m.healthy = time.Now(), 0
+	}
+}
+
+// Check probes the mirrors fallen back from once, and returns the hosts of the ones which
+// passed enough probes in a row and did not fail for the cooldown. Their circuits are closed
+// and they are not probed anymore unless instances fall back from them again.
+func (f *MirrorFailback) Check() []string {
+	f.mu.Lock()
+	mirrors := make([]MirrorConfig, 0, len(f.mirrors))
+	for _, m := range f.mirrors {
+		mirrors = append(mirrors, m.mirror)
+	}
+	f.mu.Unlock()
+
+	var recovered []string
+	for _, mirror := range mirrors {
+		// Disabled mirrors are failed back to once they are enabled again.
+		if circuits.isDisabled(mirror.Host) {
+			continue
+		}
+		_, err := pingMirrorHost(mirror, f.timeout)
+
+		f.mu.Lock()
+		m, ok := f.mirrors[mirror.Host]
+		switch {
+		case !ok:
+		case err != nil:
+			log.L.WithError(err).Debugf("Mirror %s fallen back from is still failing", mirror.Host)
+			m.failedAt, m.healthy = time.Now(), 0
+		default:
+			m.healthy++
+			if m.healthy >= f.healthyProbes && time.Since(m.failedAt) >= f.cooldown {
+				delete(f.mirrors, mirror.Host)
+				recovered = append(recovered, mirror.Host)
+			}
+		}
+		f.mu.Unlock()
+	}
+
+	for _, host := range recovered {
+		circuits.success(host)
+		data.MirrorFailbacks.WithLabelValues(host).Inc()
+	}
+	return recovered
+}
+
+// FailsBackTo returns whether the registry backend of c, supplemented for the image, would
+// select one of the given mirrors over the one it fetches from now, which is the registry
+// if none of the mirrors of the image is selected.
+func FailsBackTo(c DaemonConfig, imageID string, labels map[string]string, mirrorHosts []string) bool {
+	backendType, bc := c.StorageBackend()
+	if backendType != backendTypeRegistry || bc == nil || bc.DisableMirrors {
+		return false
+	}
+	ref := imageID
+	if rewritten, ok := config.RewriteImageRef(imageID); ok {
+		ref = rewritten
+	}
+	image, err := registry.ParseImage(ref)
+	if err != nil {
+		return false
+	}
+	registryHost := image.Host
+	if registryHost == "docker.io" {
+		registryHost = "index.docker.io"
+	}
+	mirrors, err := imageMirrors(config.GetMirrorsConfig(), bc.originScheme(), registryHost, labels)
+	if err != nil {
+		return false
+	}
+	for _, mirror := range mirrors {
+		if _, host, err := splitMirrorURL(mirror.Host); err == nil && host == bc.Host {
+			return false
+		}
+		if slices.Contains(mirrorHosts, mirror.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// noteFallback records that a mount or reload passed over the mirror, because it failed a
+// probe or was skipped, if failback is configured.
+func noteFallback(mirror MirrorConfig, failed bool) {
+	failbackMu.Lock()
+	f := failback
+	failbackMu.Unlock()
+
+	if f != nil && !mirror.FromLabel {
+		f.fellBack(mirror, failed)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestMirrorFailback(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	oldCircuits := circuits
+	defer func() { circuits = oldCircuits }()
+	circuits = newMirrorCircuits()
+	oldFailback := failback
+	defer func() { failback = oldFailback }()
+	f := NewMirrorFailback(config.MirrorsConfig{
+		Failback: config.MirrorFailbackConfig{HealthyProbes: 2, Cooldown: time.Millisecond},
+	})
+	failback = f
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://mirror1:5000"]
+    ping_url = "`+srv.URL+`"
+    failure_limit = 1
+`)
+	_, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, testRegistryHost, host)
+	require.Empty(t, f.Check())
+
+	// The mirror is failed back to after two successful probes, although its circuit is open.
+	healthy.Store(true)
+	time.Sleep(2 * time.Millisecond)
+	require.Empty(t, f.Check())
+	require.Equal(t, CircuitOpen, circuits.states()[0].State)
+	require.Equal(t, []string{"http://mirror1:5000"}, f.Check())
+	require.Equal(t, CircuitClosed, circuits.states()[0].State)
+	require.Empty(t, f.Check())
+
+	// So the configuration pushed to the daemons selects it again.
+	_, host, _ = selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, "mirror1:5000", host)
+}
+
+func TestMirrorFailback_Cooldown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	oldCircuits := circuits
+	defer func() { circuits = oldCircuits }()
+	circuits = newMirrorCircuits()
+
+	f := NewMirrorFailback(config.MirrorsConfig{
+		Failback: config.MirrorFailbackConfig{HealthyProbes: 1, Cooldown: time.Hour},
+	})
+	mirror := MirrorConfig{Host: "http://mirror1:5000", PingURL: srv.URL}
+	f.fellBack(mirror, true)
+	require.Empty(t, f.Check())
+
+	// Skipping the mirror meanwhile doesn't restart the cooldown, failing does.
+	f.mirrors[mirror.Host].failedAt = time.Now().Add(-2 * time.Hour)
+	f.fellBack(mirror, false)
+	require.Equal(t, []string{mirror.Host}, f.Check())
+	f.fellBack(mirror, true)
+	require.Empty(t, f.Check())
+	delete(f.mirrors, mirror.Host)
+
+	// Disabled mirrors are not failed back to.
+	f.fellBack(mirror, true)
+	f.mirrors[mirror.Host].failedAt = time.Now().Add(-2 * time.Hour)
+	circuits.see(mirror.Host)
+	require.NoError(t, DisableMirror(mirror.Host))
+	require.Empty(t, f.Check())
+	require.NoError(t, EnableMirror(mirror.Host))
+	require.Equal(t, []string{mirror.Host}, f.Check())
+}
+
+func TestMirrorFailback_Run(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	oldCircuits := circuits
+	defer func() { circuits = oldCircuits }()
+	circuits = newMirrorCircuits()
+
+	f := NewMirrorFailback(config.MirrorsConfig{
+		Failback: config.MirrorFailbackConfig{Interval: 10 * time.Millisecond, HealthyProbes: 1, Cooldown: time.Nanosecond},
+	})
+	var pushes atomic.Int32
+	go f.Run(t.Context(), func([]string) error {
+		pushes.Add(1)
+		return nil
+	})
+
+	// Nothing is pushed until a mirror recovers.
+	time.Sleep(50 * time.Millisecond)
+	require.Zero(t, pushes.Load())
+
+	f.fellBack(MirrorConfig{Host: "http://mirror1:5000", PingURL: srv.URL}, true)
+	require.Eventually(t, func() bool { return pushes.Load() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(1), pushes.Load())
+}
+
+func TestFailsBackTo(t *testing.T) {
+	mirrorsDir := t.TempDir()
+	writeMirrorHostsToml(t, mirrorsDir, `
+[host."http://mirror1:5000"]
+[host."http://mirror2:5000"]
+`)
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{MirrorsConfig: config.MirrorsConfig{Dir: mirrorsDir}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	failsBackTo := func(host, recovered string) bool {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		cfg.Device.Backend.Config.Host = host
+		return FailsBackTo(cfg, testRegistryHost+"/app:latest", nil, []string{recovered})
+	}
+	// Only instances fetching from a mirror after the recovered one, or from the registry, are pushed.
+	require.True(t, failsBackTo("mirror2:5000", "http://mirror1:5000"))
+	require.True(t, failsBackTo(testRegistryHost, "http://mirror2:5000"))
+	require.False(t, failsBackTo("mirror1:5000", "http://mirror2:5000"))
+	require.False(t, failsBackTo("mirror1:5000", "http://mirror1:5000"))
+	require.False(t, failsBackTo(testRegistryHost, "http://other:5000"))
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+// Mirrors not selected from for this long are not probed anymore.
+const mirrorForgetAfter = time.Hour
+
+var (
+	prober   *MirrorProber
+	proberMu sync.Mutex
+)
+
+type mirrorLatency struct {
+	mirror   MirrorConfig
+	lastSeen time.Time
+	// Zero until the mirror has been probed.
+	latency time.Duration
+	failed  bool
+}
+
+// MirrorProber measures the latency of the mirrors selected from in the background, by
+// which mirrors of the same weight are ordered.
+type MirrorProber struct {
+	interval time.Duration
+	timeout  time.Duration
+
+	mu sync.Mutex
+	// Keyed by the host of the mirror.
+	mirrors map[string]*mirrorLatency
+}
+
+// InitMirrorProber starts measuring the latency of mirrors on the configured interval until
+// ctx is done. This should be called once at startup if latency probing is configured.
+func InitMirrorProber(ctx context.Context, c config.MirrorsConfig) {
+	proberMu.Lock()
+	defer proberMu.Unlock()
+
+	if prober != nil {
+		return
+	}
+
+	p := NewMirrorProber(c)
+	go p.Run(ctx)
+	prober = p
+	log.L.WithField("interval", c.LatencyProbeInterval).Info("mirror latency prober initialized")
+}
+
+func NewMirrorProber(c config.MirrorsConfig) *MirrorProber {
+	timeout := c.ProbeTimeout
+	if timeout <= 0 {
+		timeout = defaultMirrorProbeTimeout
+	}
+	return &MirrorProber{
+		interval: c.LatencyProbeInterval,
+		timeout:  timeout,
+		mirrors:  map[string]*mirrorLatency{},
+	}
+}
+
+// Run probes the known mirrors on the configured interval until ctx is done.
+func (p *MirrorProber) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.ProbeAll()
+		}
+	}
+}
+
+// remember adds the mirrors to the ones probed.
+func (p *MirrorProber) remember(mirrors []MirrorConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, m := range mirrors {
+		if l, ok := p.mirrors[m.Host]; ok {
+			l.mirror, l.lastSeen = m, now
+			continue
+		}
+		p.mirrors[m.Host] = &mirrorLatency{mirror: m, lastSeen: now}
+	}
+}
+
+// ProbeAll measures the latency of all known mirrors, and forgets the ones not selected
+// from for a while.
+func (p *MirrorProber) ProbeAll() {
+	p.mu.Lock()
+	var mirrors []MirrorConfig
+	for host, l := range p.mirrors {
+		if time.Since(l.lastSeen) > mirrorForgetAfter {
+			delete(p.mirrors, host)
+			continue
+		}
+		mirrors = append(mirrors, l.mirror)
+	}
+	p.mu.Unlock()
+
+	for _, m := range mirrors {
+		latency, err := p.probe(m)
+		if err != nil {
+			log.L.WithError(err).Debugf("failed to probe latency of mirror %s", m.Host)
+		}
+		p.mu.Lock()
+		if l, ok := p.mirrors[m.Host]; ok {
+			l.latency, l.failed = latency, err != nil
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *MirrorProber) probe(mirror MirrorConfig) (time.Duration, error) {
+	return pingMirrorHost(mirror, p.timeout)
+}
+
+// rank orders mirrors of the same weight by their latency. Mirrors not probed yet come after
+// the measured ones, and mirrors which failed their last probe last.
+func (p *MirrorProber) rank(mirrors []MirrorConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 0 for measured mirrors, 1 for unmeasured ones and 2 for failed ones.
+	class := func(m MirrorConfig) (int, time.Duration) {
+		l, ok := p.mirrors[m.Host]
+		switch {
+		case !ok || (l.latency == 0 && !l.failed):
+			return 1, 0
+		case l.failed:
+			return 2, 0
+		default:
+			return 0, l.latency
+		}
+	}
+	sort.SliceStable(mirrors, func(i, j int) bool {
+		if mirrors[i].Weight != mirrors[j].Weight {
+			return mirrors[i].Weight > mirrors[j].Weight
+		}
+		ci, li := class(mirrors[i])
+		cj, lj := class(mirrors[j])
+		if ci != cj {
+			return ci < cj
+		}
+		return li < lj
+	})
+}
+
+// rankMirrors orders mirrors by weight, and by latency if the global prober is running,
+// which starts probing them.
+func rankMirrors(mirrors []MirrorConfig) {
+	proberMu.Lock()
+	p := prober
+	proberMu.Unlock()
+
+	if p == nil {
+		sort.SliceStable(mirrors, func(i, j int) bool {
+			return mirrors[i].Weight > mirrors[j].Weight
+		})
+		return
+	}
+	p.remember(mirrors)
+	p.rank(mirrors)
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestRankMirrors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."`+failing.URL+`"]
+  [host."`+slow.URL+`"]
+  [host."`+fast.URL+`"]
+  [host."http://127.0.0.1:1"]
+    weight = 10
+`)
+	mirrorsConfig := config.MirrorsConfig{Dir: tmpDir, LatencyProbeInterval: time.Minute}
+
+	// Weights apply without probing latencies.
+	_, host, _ := selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, "127.0.0.1:1", host)
+
+	oldProber := prober
+	defer func() { prober = oldProber }()
+	p := NewMirrorProber(mirrorsConfig)
+	prober = p
+
+	// Mirrors are probed once they have been selected from.
+	_, host, _ = selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, "127.0.0.1:1", host)
+	p.ProbeAll()
+
+	mirrors, _, err := LoadMirrorsConfig(tmpDir, testRegistryHost)
+	require.NoError(t, err)
+	rankMirrors(mirrors)
+	var hosts []string
+	for _, m := range mirrors {
+		hosts = append(hosts, m.Host)
+	}
+	require.Equal(t, []string{"http://127.0.0.1:1", fast.URL, slow.URL, failing.URL}, hosts)
+
+	// Unprobed mirrors come after the measured ones.
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://new:5000"]
+  [host."`+slow.URL+`"]
+`)
+	_, host, _ = selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, strings.TrimPrefix(slow.URL, "http://"), host)
+}
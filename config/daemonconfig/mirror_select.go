@@ -0,0 +1,282 @@
+/*
+ * Copyright (c) 2020. Ant Group. All rights reserved.
+ * Copyright (c) 2022. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/registry"
+)
+
+const (
+	defaultMirrorProbeTimeout = 3 * time.Second
+	// Upper bound for scanning the mirrors config directory before each mount.
+	mirrorsLoadTimeout = 10 * time.Second
+)
+
+// selectMirrorHost returns the host and scheme of the first reachable mirror of the node for
+// the given registry host, see nodeMirrors and pickMirror.
+func selectMirrorHost(mirrorsConfig config.MirrorsConfig, registryHost string) (scheme string, host string,
+	selected *MirrorConfig) {
+	return pickMirror(mirrorsConfig, nodeMirrors(mirrorsConfig, "https", registryHost), registryHost)
+}
+
+// imageMirrors returns the mirrors of the node for the registry host, augmented or replaced
+// by the ones of the label.NydusMirrors label if label mirrors are allowed.
+func imageMirrors(mirrorsConfig config.MirrorsConfig, registryScheme, registryHost string, labels map[string]string) ([]MirrorConfig, error) {
+	value, ok := labels[label.NydusMirrors]
+	if !ok {
+		return nodeMirrors(mirrorsConfig, registryScheme, registryHost), nil
+	}
+	if !mirrorsConfig.AllowLabelMirrors {
+		log.L.Warnf("Ignoring label %s, mirrors from labels are not allowed", label.NydusMirrors)
+		return nodeMirrors(mirrorsConfig, registryScheme, registryHost), nil
+	}
+	mirrors, replace, err := parseMirrorsLabel(value)
+	if err != nil {
+		return nil, err
+	}
+	if replace {
+		return mirrors, nil
+	}
+	return append(mirrors, nodeMirrors(mirrorsConfig, registryScheme, registryHost)...), nil
+}
+
+// nodeMirrors loads mirror configs for the given registry host, followed by the discovered
+// ones and ordered by weight and latency, preceded by the local dfdaemon and Spegel if enabled.
+func nodeMirrors(mirrorsConfig config.MirrorsConfig, registryScheme, registryHost string) []MirrorConfig {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorsLoadTimeout)
+	defer cancel()
+	mirrors, err := LoadMirrorsTLSConfig(ctx, mirrorsConfig.Dir, registryHost)
+	if err != nil {
+		log.L.Warnf("Failed to load mirrors config for %s: %v, skipping its mirrors", registryHost, err)
+		mirrors = nil
+	}
+	mirrors = append(mirrors, discoveredMirrors(registryHost)...)
+	rankMirrors(mirrors)
+	// Mirrors on the node come first.
+	var local []MirrorConfig
+	if mirrorsConfig.Dragonfly.Enable {
+		local = append(local, dragonflyMirror(mirrorsConfig.Dragonfly, registryScheme, registryHost))
+	}
+	if mirrorsConfig.Spegel.Enable {
+		if mirror, ok := spegelMirror(mirrorsConfig.Spegel, registryHost); ok {
+			local = append(local, mirror)
+		}
+	}
+	return append(local, mirrors...)
+}
+
+// pickMirror returns the host and scheme of the first reachable mirror. If a mirror has no
+// PingURL it is used unconditionally, unless mirror probing is enabled in which case its
+// registry API root must respond.
+// Falls back to (registryHost, "") when no mirror is configured or reachable, in which case
+// the returned mirror is nil.
+func pickMirror(mirrorsConfig config.MirrorsConfig, mirrors []MirrorConfig, registryHost string) (scheme string, host string,
+	selected *MirrorConfig) {
+	timeout := mirrorsConfig.ProbeTimeout
+	if timeout <= 0 {
+		timeout = defaultMirrorProbeTimeout
+	}
+
+	var err error
+	// Mirrors passed over are counted as fallbacks to wherever the image is fetched from.
+	var skipped []string
+	fallback := func(target string) {
+		for _, h := range skipped {
+			data.MirrorFallbacks.WithLabelValues(h, target).Inc()
+		}
+	}
+
+	for _, mirror := range mirrors {
+		circuits.see(mirror.Host)
+		if circuits.isDisabled(mirror.Host) {
+			log.L.Debugf("Skipping disabled mirror %s", mirror.Host)
+			skipped = append(skipped, mirror.metricHost())
+			noteFallback(mirror, false)
+			continue
+		}
+		scheme, host, err = splitMirrorURL(mirror.Host)
+		if err != nil {
+			log.L.Warnf("Skipping due to Failing to split mirror host %s: %v", mirror.Host, err)
+			continue
+		}
+		data.MirrorRequests.WithLabelValues(mirror.metricHost()).Inc()
+
+		pingURL := mirror.PingURL
+		if pingURL == "" {
+			if !mirrorsConfig.ProbeMirrors {
+				fallback("mirror")
+				return scheme, host, &mirror
+			}
+			pingURL = fmt.Sprintf("%s://%s/v2/", scheme, host)
+		}
+
+		if !mirror.FromLabel && !circuits.allow(mirror.Host) {
+			log.L.Debugf("Skipping mirror %s with open circuit", mirror.Host)
+			skipped = append(skipped, mirror.metricHost())
+			noteFallback(mirror, false)
+			continue
+		}
+		if _, err := pingMirror(mirror, timeout, pingURL); err != nil {
+			log.L.Warnf("Mirror %s ping URL %s check failed with error %v, trying next mirror",
+				mirror.Host,
+				pingURL,
+				err,
+			)
+			skipped = append(skipped, mirror.metricHost())
+			if !mirror.FromLabel {
+				circuits.failure(mirror, err)
+				noteFallback(mirror, true)
+			}
+			continue
+		}
+		if !mirror.FromLabel {
+			circuits.success(mirror.Host)
+		}
+		fallback("mirror")
+		return scheme, host, &mirror
+	}
+
+	fallback("registry")
+	return "", registryHost, nil
+}
+
+// ActiveMirror returns the mirror the registry backend of the daemon configuration fetches
+// the image from, as "scheme://host:port" like in hosts.toml, false if it is the registry.
+func ActiveMirror(c DaemonConfig, imageID string) (string, bool) {
+	backendType, bc := c.StorageBackend()
+	if backendType != backendTypeRegistry || bc == nil || bc.Host == "" {
+		return "", false
+	}
+	image, err := registry.ParseImage(imageID)
+	if err != nil {
+		return "", false
+	}
+	switch bc.Host {
+	case image.Host, registry.ConvertToVPCHost(image.Host):
+		return "", false
+	case "index.docker.io":
+		if image.Host == "docker.io" {
+			return "", false
+		}
+	}
+	if bc.Scheme != "" {
+		return mirrorKey(bc.Scheme + "://" + bc.Host), true
+	}
+	return mirrorKey(bc.Host), true
+}
+
+// newMirrorClient returns an HTTP client honoring the TLS settings of the mirror.
+func newMirrorClient(mirror MirrorConfig, timeout time.Duration) *http.Client {
+	tlsConfig := &tls.Config{InsecureSkipVerify: mirror.SkipVerify}
+	if len(mirror.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, ca := range mirror.CACerts {
+			pem, err := os.ReadFile(ca)
+			if err != nil {
+				log.L.Warnf("Failed to read CA cert %s of mirror %s: %v", ca, mirror.Host, err)
+				continue
+			}
+			pool.AppendCertsFromPEM(pem)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if mirror.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(mirror.CertFile, mirror.KeyFile)
+		if err != nil {
+			log.L.Warnf("Failed to load client cert %s of mirror %s: %v", mirror.CertFile, mirror.Host, err)
+		} else {
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DialContext = mirrorDialer(timeout)
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// pingMirror probes the mirror at pingURL and records the outcome in the mirror metrics.
+func pingMirror(mirror MirrorConfig, timeout time.Duration, pingURL string) (time.Duration, error) {
+	start := time.Now()
+	err := probeMirror(newMirrorClient(mirror, timeout), pingURL, mirror.PingURL == "")
+	latency := time.Since(start)
+	if err != nil {
+		data.MirrorFailures.WithLabelValues(mirror.metricHost()).Inc()
+	} else {
+		data.MirrorPingLatency.WithLabelValues(mirror.metricHost()).Observe(float64(latency.Milliseconds()))
+	}
+	return latency, err
+}
+
+// pingMirrorHost pings the mirror on its ping URL, or on its registry API root without one.
+func pingMirrorHost(mirror MirrorConfig, timeout time.Duration) (time.Duration, error) {
+	scheme, host, err := splitMirrorURL(mirror.Host)
+	if err != nil {
+		return 0, err
+	}
+	pingURL := mirror.PingURL
+	if pingURL == "" {
+		pingURL = fmt.Sprintf("%s://%s/v2/", scheme, host)
+	}
+	return pingMirror(mirror, timeout, pingURL)
+}
+
+// probeMirror checks that the mirror answers on url. A ping URL must return a 2xx status,
+// while the registry API root only has to respond since it usually requires authentication.
+func probeMirror(client *http.Client, url string, reachableOnly bool) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if reachableOnly && resp.StatusCode < 500 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return errors.Errorf("statusCode %d, response '%s'", resp.StatusCode, string(body))
+}
+
+// splitMirrorURL splits a mirror host URL (e.g. "http://mirror:5000" or "http://[fd00::1]:5000")
+// into scheme and bare host. Scheme is forced to be https if not present.
+func splitMirrorURL(mirrorHost string) (scheme, host string, err error) {
+	mirrorHost = bracketIPv6(mirrorHost)
+	// url.Parse requires a scheme to properly works even if it doesn't returns an error
+	if !strings.HasPrefix(mirrorHost, "http://") && !strings.HasPrefix(mirrorHost, "https://") {
+		mirrorHost = "https://" + mirrorHost
+	}
+	value, err := url.Parse(mirrorHost)
+	if err != nil {
+		return "", "", err
+	}
+	return value.Scheme, value.Host, nil
+}
@@ -11,9 +11,15 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
 )
 
 var testRegistryHost = "fake-test.registry.com"
@@ -85,14 +91,14 @@ func TestSplitMirrorURL(t *testing.T) {
 }
 
 func TestSelectMirrorHost_NoConfig(t *testing.T) {
-	scheme, host, _ := selectMirrorHost("", testRegistryHost)
+	scheme, host, _ := selectMirrorHost(config.MirrorsConfig{}, testRegistryHost)
 	require.Equal(t, testRegistryHost, host)
 	require.Equal(t, "", scheme)
 }
 
 func TestSelectMirrorHost_EmptyDir(t *testing.T) {
 	tmpDir := t.TempDir()
-	scheme, host, _ := selectMirrorHost(tmpDir, testRegistryHost)
+	scheme, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
 	require.Equal(t, testRegistryHost, host)
 	require.Equal(t, "", scheme)
 }
@@ -103,7 +109,7 @@ func TestSelectMirrorHost_MirrorNoPingURL(t *testing.T) {
 [host]
   [host."http://mirror1:5000"]
 `)
-	scheme, host, _ := selectMirrorHost(tmpDir, testRegistryHost)
+	scheme, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
 	require.Equal(t, "mirror1:5000", host)
 	require.Equal(t, "http", scheme)
 }
@@ -120,7 +126,7 @@ func TestSelectMirrorHost_MirrorPingSucceeds(t *testing.T) {
   [host."http://mirror1:5000"]
     ping_url = "`+srv.URL+`"
 `)
-	scheme, host, _ := selectMirrorHost(tmpDir, testRegistryHost)
+	scheme, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
 	require.Equal(t, "mirror1:5000", host)
 	require.Equal(t, "http", scheme)
 }
@@ -137,7 +143,7 @@ func TestSelectMirrorHost_MirrorPingFails_FallbackToOrigin(t *testing.T) {
   [host."http://mirror1:5000"]
     ping_url = "`+srv.URL+`"
 `)
-	scheme, host, _ := selectMirrorHost(tmpDir, testRegistryHost)
+	scheme, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
 	require.Equal(t, testRegistryHost, host)
 	require.Equal(t, "", scheme)
 }
@@ -155,7 +161,296 @@ func TestSelectMirrorHost_FirstMirrorFails_SecondMirrorNoPing(t *testing.T) {
     ping_url = "`+srv.URL+`"
   [host."https://mirror2.example.com"]
 `)
-	scheme, host, _ := selectMirrorHost(tmpDir, testRegistryHost)
+	scheme, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
 	require.Equal(t, "mirror2.example.com", host)
 	require.Equal(t, "https", scheme)
 }
+
+func TestSelectMirrorHost_ProbeMirrors(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/", r.URL.Path)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."`+unhealthy.URL+`"]
+  [host."`+healthy.URL+`"]
+`)
+
+	// Without probing, the first mirror is used unconditionally.
+	_, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, strings.TrimPrefix(unhealthy.URL, "http://"), host)
+
+	scheme, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir, ProbeMirrors: true}, testRegistryHost)
+	require.Equal(t, strings.TrimPrefix(healthy.URL, "http://"), host)
+	require.Equal(t, "http", scheme)
+
+	healthy.Close()
+	scheme, host, _ = selectMirrorHost(config.MirrorsConfig{Dir: tmpDir, ProbeMirrors: true}, testRegistryHost)
+	require.Equal(t, testRegistryHost, host)
+	require.Equal(t, "", scheme)
+}
+
+func TestSelectMirrorHost_ProbeMirrorsTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."`+srv.URL+`"]
+`)
+	start := time.Now()
+	_, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir, ProbeMirrors: true, ProbeTimeout: 100 * time.Millisecond}, testRegistryHost)
+	require.Equal(t, testRegistryHost, host)
+	require.Less(t, time.Since(start), defaultMirrorProbeTimeout)
+}
+
+func TestSelectMirrorHost_ProbeMirrorsTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	mirrorHost := strings.TrimPrefix(srv.URL, "https://")
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."`+srv.URL+`"]
+`)
+	// The test server certificate is not trusted by default.
+	_, host, _ := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir, ProbeMirrors: true}, testRegistryHost)
+	require.Equal(t, testRegistryHost, host)
+
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."`+srv.URL+`"]
+    skip_verify = true
+`)
+	_, host, _ = selectMirrorHost(config.MirrorsConfig{Dir: tmpDir, ProbeMirrors: true}, testRegistryHost)
+	require.Equal(t, mirrorHost, host)
+}
+
+func TestSelectMirrorHost_MirrorTimeouts(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://mirror1:5000"]
+    connect_timeout = 3
+    timeout = 30
+  [host."http://mirror2:5000"]
+`)
+	_, host, mirror := selectMirrorHost(config.MirrorsConfig{Dir: tmpDir}, testRegistryHost)
+	require.Equal(t, "mirror1:5000", host)
+	require.NotNil(t, mirror)
+
+	bc := BackendConfig{Timeout: 5, ConnectTimeout: 5}
+	mirror.applyTimeouts(&bc)
+	dumped, err := DumpConfigString(&bc)
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"timeout":30,"connect_timeout":3`)
+
+	// Zero timeouts of a mirror inherit the backend-level ones.
+	mirrors, _, err := LoadMirrorsConfig(tmpDir, testRegistryHost)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 2)
+	bc = BackendConfig{Timeout: 5, ConnectTimeout: 5}
+	mirrors[1].applyTimeouts(&bc)
+	require.Equal(t, 5, bc.Timeout)
+	require.Equal(t, 5, bc.ConnectTimeout)
+
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://mirror1:5000"]
+    timeout = -1
+`)
+	_, _, err = LoadMirrorsConfig(tmpDir, testRegistryHost)
+	require.ErrorContains(t, err, "invalid timeout -1")
+}
+
+func TestSelectMirrorHost_Dragonfly(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	dfdaemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer dfdaemon.Close()
+
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://mirror1:5000"]
+`)
+	mirrorsConfig := config.MirrorsConfig{
+		Dir: tmpDir,
+		Dragonfly: config.DragonflyConfig{
+			Enable:       true,
+			ProxyAddress: "http://127.0.0.1:65001",
+			PingURL:      dfdaemon.URL + "/healthy",
+		},
+	}
+	scheme, host, mirror := selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, "127.0.0.1:65001", host)
+	require.Equal(t, "http", scheme)
+	require.NotNil(t, mirror)
+
+	bc := BackendConfig{Headers: map[string]string{"X-Custom": "value"}}
+	mirror.applyHeaders(&bc)
+	require.Equal(t, map[string]string{
+		"X-Custom":              "value",
+		dragonflyRegistryHeader: "https://" + testRegistryHost,
+	}, bc.Headers)
+	// dfdaemon fetches from plain HTTP registries over plain HTTP.
+	require.Equal(t, "http://"+testRegistryHost,
+		dragonflyMirror(mirrorsConfig.Dragonfly, "http", testRegistryHost).Headers[dragonflyRegistryHeader])
+
+	// Falls back to the configured mirrors, then to the origin while dfdaemon is unhealthy.
+	healthy.Store(false)
+	_, host, _ = selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, "mirror1:5000", host)
+	mirrorsConfig.Dir = ""
+	_, host, mirror = selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, testRegistryHost, host)
+	require.Nil(t, mirror)
+
+	healthy.Store(true)
+	_, host, _ = selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, "127.0.0.1:65001", host)
+}
+
+func TestSelectMirrorHost_Spegel(t *testing.T) {
+	spegel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/healthz", r.URL.Path)
+	}))
+	defer spegel.Close()
+
+	mirrorsConfig := config.MirrorsConfig{
+		Spegel: config.SpegelConfig{
+			Enable:     true,
+			Address:    spegel.URL,
+			Registries: []string{"docker.io", testRegistryHost},
+		},
+	}
+	scheme, host, mirror := selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, strings.TrimPrefix(spegel.URL, "http://"), host)
+	require.Equal(t, "http", scheme)
+	require.Equal(t, MirrorScopeBlobs, mirror.Scope)
+
+	_, host, _ = selectMirrorHost(mirrorsConfig, "index.docker.io")
+	require.Equal(t, strings.TrimPrefix(spegel.URL, "http://"), host)
+
+	// Registries not mirrored by Spegel are pulled from the origin.
+	_, host, mirror = selectMirrorHost(mirrorsConfig, "ghcr.io")
+	require.Equal(t, "ghcr.io", host)
+	require.Nil(t, mirror)
+
+	// So are all registries while Spegel is down.
+	spegel.Close()
+	_, host, _ = selectMirrorHost(mirrorsConfig, testRegistryHost)
+	require.Equal(t, testRegistryHost, host)
+}
+
+func TestWithoutMirrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host."http://mirror.example.com:5000"]
+`)
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{MirrorsConfig: config.MirrorsConfig{Dir: tmpDir}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.Backend.Config.RetryLimit = 3
+	origin := cfg.WithoutMirrors()
+
+	imageID := testRegistryHost + "/library/busybox:latest"
+	require.NoError(t, SupplementDaemonConfig(cfg, imageID, "1", false, nil, nil))
+	require.NoError(t, SupplementDaemonConfig(origin, imageID, "1", false, nil, nil))
+
+	require.Equal(t, "mirror.example.com:5000", cfg.Device.Backend.Config.Host)
+	require.False(t, cfg.Device.Backend.Config.Proxy.Fallback)
+
+	_, bc := origin.StorageBackend()
+	require.Equal(t, testRegistryHost, bc.Host)
+	require.Empty(t, bc.Scheme)
+	require.True(t, bc.Proxy.Fallback)
+	require.Equal(t, 3, bc.RetryLimit)
+}
+
+func TestImageMirrors_Label(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeMirrorHostsToml(t, tmpDir, `
+[host]
+  [host."http://mirror1:5000"]
+`)
+	mirrorsConfig := config.MirrorsConfig{Dir: tmpDir, AllowLabelMirrors: true}
+	labels := map[string]string{
+		label.NydusMirrors: `{"mirrors": [{"host": "https://experiment:5000", "scope": "blobs", "headers": {"X-Experiment": "1"}}]}`,
+	}
+
+	// Label mirrors are tried first.
+	mirrors, err := imageMirrors(mirrorsConfig, "https", testRegistryHost, labels)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 2)
+	require.Equal(t, "https://experiment:5000", mirrors[0].Host)
+	require.Equal(t, MirrorScopeBlobs, mirrors[0].Scope)
+	require.Equal(t, map[string]string{"X-Experiment": "1"}, mirrors[0].Headers)
+	require.Equal(t, "http://mirror1:5000", mirrors[1].Host)
+	scheme, host, _ := pickMirror(mirrorsConfig, mirrors, testRegistryHost)
+	require.Equal(t, "https", scheme)
+	require.Equal(t, "experiment:5000", host)
+
+	labels[label.NydusMirrors] = `{"replace": true, "mirrors": [{"host": "http://experiment:5000"}]}`
+	mirrors, err = imageMirrors(mirrorsConfig, "https", testRegistryHost, labels)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 1)
+	require.Equal(t, MirrorScopeAll, mirrors[0].Scope)
+	require.True(t, mirrors[0].FromLabel)
+	require.Equal(t, labelMirrorHost, mirrors[0].metricHost())
+
+	// Failing label mirrors get no circuit, any image could name a new one.
+	oldCircuits := circuits
+	defer func() { circuits = oldCircuits }()
+	circuits = newMirrorCircuits()
+	mirrors[0].PingURL = "http://127.0.0.1:1/healthz"
+	_, host, _ = pickMirror(mirrorsConfig, mirrors, testRegistryHost)
+	require.Equal(t, testRegistryHost, host)
+	require.Empty(t, circuits.states())
+
+	// The label is ignored unless allowed.
+	mirrors, err = imageMirrors(config.MirrorsConfig{Dir: tmpDir}, "https", testRegistryHost, labels)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 1)
+	require.Equal(t, "http://mirror1:5000", mirrors[0].Host)
+
+	for _, value := range []string{
+		`[`,
+		`{"mirrors": [{"host": "experiment:5000"}]}`,
+		`{"mirrors": [{"host": "http://experiment:5000", "scope": "manifests"}]}`,
+		`{"mirrors": [{"host": "http://experiment:5000", "ping_url": "experiment/healthz"}]}`,
+		`{"mirrors": [{"host": "http://experiment:5000", "timeout": -1}]}`,
+		`{"replace": true}`,
+	} {
+		_, err = imageMirrors(mirrorsConfig, "https", testRegistryHost, map[string]string{label.NydusMirrors: value})
+		require.Error(t, err, value)
+	}
+}
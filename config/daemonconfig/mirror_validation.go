@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+// MirrorConfigProblem is an issue of a hosts.toml file, e.g. a mirror which is skipped.
+type MirrorConfigProblem struct {
+	File string `json:"file"`
+	// Mirror the problem is about, empty if it is about the whole file.
+	Host    string `json:"host,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// ValidateMirrorsConfig checks the hosts.toml files of all registries in dir, and with probe
+// also whether their mirrors answer within timeout, 3s if 0. Unlike loading them, which skips
+// broken mirrors, it reports every problem.
+func ValidateMirrorsConfig(dir string, probe bool, timeout time.Duration) ([]MirrorConfigProblem, error) {
+	if timeout <= 0 {
+		timeout = defaultMirrorProbeTimeout
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read mirrors config directory %s", dir)
+	}
+	problems := []MirrorConfigProblem{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		hostDir := filepath.Join(dir, e.Name())
+		file := filepath.Join(hostDir, "hosts.toml")
+		b, err := os.ReadFile(file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				problems = append(problems, MirrorConfigProblem{File: file, Problem: err.Error()})
+			}
+			continue
+		}
+		problems = append(problems, validateHostsFile(file, hostDir, b, probe, timeout)...)
+	}
+	return problems, nil
+}
+
+func validateHostsFile(file, baseDir string, b []byte, probe bool, timeout time.Duration) []MirrorConfigProblem {
+	var problems []MirrorConfigProblem
+	add := func(host, format string, args ...interface{}) {
+		problems = append(problems, MirrorConfigProblem{File: file, Host: host, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	tree, err := toml.LoadBytes(b)
+	if err != nil {
+		add("", "invalid TOML: %v", err)
+		return problems
+	}
+	hosts, err := getSortedHosts(tree)
+	if err != nil {
+		add("", "%v", err)
+		return problems
+	}
+	c := struct {
+		HostConfigs map[string]HostFileConfig `toml:"host"`
+	}{}
+	if err := tree.Unmarshal(&c); err != nil {
+		add("", "invalid settings: %v", err)
+		return problems
+	}
+
+	for _, host := range hosts {
+		hc := c.HostConfigs[host]
+		server := bracketIPv6(host)
+		if !strings.Contains(server, "://") {
+			server = "https://" + server
+		}
+		if u, err := url.Parse(server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add(host, "host must be an http(s) URL like \"https://mirror:5000\"")
+			continue
+		} else if u.Path != "" && u.Path != "/" {
+			add(host, "path %s of the host is ignored, nydusd always requests /v2/", u.Path)
+		}
+		parsed, err := parseHostConfig(host, baseDir, hc)
+		if err != nil {
+			add(host, "mirror is skipped: %v", err)
+			continue
+		}
+		if !parsed.Pull {
+			add(host, "mirror is not used, it lacks the pull capability")
+			continue
+		}
+		names := make([]string, 0, len(parsed.Header))
+		for name := range parsed.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			values := parsed.Header[name]
+			if !httpguts.ValidHeaderFieldName(name) {
+				add(host, "invalid header name %q", name)
+			}
+			if len(values) > 1 {
+				add(host, "only the first value of header %s is sent", name)
+			}
+			for _, value := range values {
+				if !httpguts.ValidHeaderFieldValue(value) {
+					add(host, "invalid value of header %s", name)
+				}
+			}
+		}
+		if parsed.PingURL != "" {
+			if u, err := url.Parse(parsed.PingURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add(host, "ping_url %q must be an http(s) URL", parsed.PingURL)
+				continue
+			}
+		}
+		for _, f := range append(append([]string{}, parsed.CACerts...), parsed.CertFile, parsed.KeyFile) {
+			if f == "" {
+				continue
+			}
+			if _, err := os.Stat(f); err != nil {
+				add(host, "TLS file is not readable: %v", err)
+			}
+		}
+
+		if probe {
+			mirror := parseMirrorsConfig([]hostConfig{parsed})[0]
+			pingURL := mirror.PingURL
+			if pingURL == "" {
+				pingURL = fmt.Sprintf("%s://%s/v2/", parsed.Scheme, parsed.Host)
+			}
+			if err := probeMirror(newMirrorClient(mirror, timeout), pingURL, mirror.PingURL == ""); err != nil {
+				add(host, "ping URL %s is not reachable: %v", pingURL, err)
+			}
+		}
+	}
+	return problems
+}
+
+// CheckMirrorsConfig logs the problems of the mirrors config directory, e.g. at startup.
+func CheckMirrorsConfig(mirrorsConfig config.MirrorsConfig) {
+	problems, err := ValidateMirrorsConfig(mirrorsConfig.Dir, true, mirrorsConfig.ProbeTimeout)
+	if err != nil {
+		log.L.WithError(err).Warn("Failed to check mirrors config")
+		return
+	}
+	for _, p := range problems {
+		log.L.WithField("file", p.File).WithField("host", p.Host).Warnf("Mirrors config problem: %s", p.Problem)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMirrorsConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	writeMirrorHostsToml(t, dir, `
+[host."http://ok:5000"]
+  ping_url = "`+srv.URL+`/healthz"
+[host."http://down:5000"]
+  ping_url = "`+srv.URL+`/down"
+[host."ftp://mirror:21"]
+[host."http://mirror:5000/prefix"]
+  ping_url = "`+srv.URL+`/healthz"
+[host."http://bad-header:5000"]
+  ping_url = "`+srv.URL+`/healthz"
+  [host."http://bad-header:5000".header]
+    "X Bad" = "1"
+[host."http://bad-ping:5000"]
+  ping_url = "bad-ping:5000/healthz"
+[host."http://bad-scope:5000"]
+  scope = "manifests"
+[host."http://no-ca:5000"]
+  ping_url = "`+srv.URL+`/healthz"
+  ca_file = "/nonexistent/ca.pem"
+[host."http://push-only:5000"]
+  capabilities = ["push"]
+`)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "broken.io"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.io", "hosts.toml"), []byte(`[host`), 0600))
+
+	problems, err := ValidateMirrorsConfig(dir, false, time.Second)
+	require.NoError(t, err)
+	byHost := map[string]string{}
+	for _, p := range problems {
+		byHost[p.Host] = p.Problem
+	}
+	require.Len(t, byHost, 8)
+	require.Contains(t, byHost[""], "invalid TOML")
+	require.Contains(t, byHost["ftp://mirror:21"], "http(s) URL")
+	require.Contains(t, byHost["http://mirror:5000/prefix"], "path /prefix")
+	require.Contains(t, byHost["http://bad-header:5000"], "header name")
+	require.Contains(t, byHost["http://bad-ping:5000"], "ping_url")
+	require.Contains(t, byHost["http://bad-scope:5000"], "scope")
+	require.Contains(t, byHost["http://no-ca:5000"], "TLS file")
+	require.Contains(t, byHost["http://push-only:5000"], "pull capability")
+
+	problems, err = ValidateMirrorsConfig(dir, true, time.Second)
+	require.NoError(t, err)
+	var unreachable []string
+	for _, p := range problems {
+		if p.Host == "http://down:5000" {
+			unreachable = append(unreachable, p.Problem)
+		}
+	}
+	require.Len(t, unreachable, 1)
+	require.Contains(t, unreachable[0], "not reachable")
+
+	_, err = ValidateMirrorsConfig(filepath.Join(dir, "nonexistent"), false, 0)
+	require.Error(t, err)
+}
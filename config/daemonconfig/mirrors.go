@@ -7,17 +7,25 @@
 package daemonconfig
 
 import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/containerd/log"
 	"github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/fanout"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
 )
 
 type MirrorConfig struct {
@@ -26,6 +34,219 @@ type MirrorConfig struct {
 	HealthCheckInterval int
 	FailureLimit        uint8
 	PingURL             string
+	// TLS settings of the mirror, used by the snapshotter and nydusd instead of the ones
+	// of the backend.
+	CACerts    []string
+	SkipVerify bool
+	// Client certificate and key presented to the mirror.
+	CertFile string
+	KeyFile  string
+	// Request timeouts in seconds applied to the backend when the mirror is selected.
+	// Zero inherits the backend-level timeouts.
+	ConnectTimeout int
+	Timeout        int
+	// Mirrors of higher weight are tried first.
+	Weight int
+	// Requests served by the mirror, MirrorScopeAll or MirrorScopeBlobs.
+	Scope string
+	// Given by the label.NydusMirrors label of an image. Any image may name other ones, so
+	// they have no circuit, aren't failed back to and share the labelMirrorHost metrics.
+	FromLabel bool
+}
+
+// Host the metrics of all label mirrors are recorded for.
+const labelMirrorHost = "label"
+
+// metricHost returns the host the metrics of the mirror are recorded for.
+func (m *MirrorConfig) metricHost() string {
+	if m.FromLabel {
+		return labelMirrorHost
+	}
+	return m.Host
+}
+
+const (
+	// The mirror serves all requests of nydusd, the default.
+	MirrorScopeAll = "all"
+	// The mirror only serves blobs, e.g. a P2P cache, while manifests and tokens are still
+	// requested from the registry, so they are never stale.
+	MirrorScopeBlobs = "blobs"
+)
+
+// mirrorsLabel is the value of the label.NydusMirrors label. Label mirrors can't refer to
+// files of the node, so they are verified with the system CAs and the ca_file of the backend.
+type mirrorsLabel struct {
+	// Use only these mirrors instead of trying them before the ones of the node.
+	Replace bool `json:"replace"`
+	Mirrors []struct {
+		Host           string            `json:"host"`
+		Headers        map[string]string `json:"headers"`
+		PingURL        string            `json:"ping_url"`
+		Scope          string            `json:"scope"`
+		ConnectTimeout int               `json:"connect_timeout"`
+		Timeout        int               `json:"timeout"`
+	} `json:"mirrors"`
+}
+
+// parseMirrorsLabel returns the mirrors of the label.NydusMirrors label and whether they
+// replace the ones of the node.
+func parseMirrorsLabel(value string) ([]MirrorConfig, bool, error) {
+	var l mirrorsLabel
+	if err := json.Unmarshal([]byte(value), &l); err != nil {
+		return nil, false, errors.Wrapf(err, "parse label %s", label.NydusMirrors)
+	}
+	mirrors := make([]MirrorConfig, 0, len(l.Mirrors))
+	for _, m := range l.Mirrors {
+		m.Host, m.PingURL = bracketIPv6(m.Host), bracketIPv6(m.PingURL)
+		if u, err := url.Parse(m.Host); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, false, errors.Errorf("invalid mirror host %q in label %s", m.Host, label.NydusMirrors)
+		}
+		if m.PingURL != "" {
+			if u, err := url.Parse(m.PingURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, false, errors.Errorf("invalid ping URL %q in label %s", m.PingURL, label.NydusMirrors)
+			}
+		}
+		scope := m.Scope
+		switch scope {
+		case "":
+			scope = MirrorScopeAll
+		case MirrorScopeAll, MirrorScopeBlobs:
+		default:
+			return nil, false, errors.Errorf("invalid scope %q of mirror %s in label %s", m.Scope, m.Host, label.NydusMirrors)
+		}
+		if m.ConnectTimeout < 0 || m.Timeout < 0 {
+			return nil, false, errors.Errorf("invalid timeout of mirror %s in label %s", m.Host, label.NydusMirrors)
+		}
+		mirrors = append(mirrors, MirrorConfig{
+			Host:           m.Host,
+			Headers:        m.Headers,
+			PingURL:        m.PingURL,
+			Scope:          scope,
+			ConnectTimeout: m.ConnectTimeout,
+			Timeout:        m.Timeout,
+			FromLabel:      true,
+		})
+	}
+	if l.Replace && len(mirrors) == 0 {
+		return nil, false, errors.Errorf("no mirrors to replace the ones of the node in label %s", label.NydusMirrors)
+	}
+	return mirrors, l.Replace, nil
+}
+
+// applyTimeouts overrides the backend timeouts with the ones set for the mirror.
+func (m *MirrorConfig) applyTimeouts(bc *BackendConfig) {
+	if m.ConnectTimeout > 0 {
+		bc.ConnectTimeout = m.ConnectTimeout
+	}
+	if m.Timeout > 0 {
+		bc.Timeout = m.Timeout
+	}
+}
+
+// applyTLS replaces the TLS settings of the backend, which are meant for the registry, with
+// the ones of the mirror, so mirrors and registries can be verified differently. Only the
+// ca_file of the backend is kept, which is trusted in addition.
+func (m *MirrorConfig) applyTLS(bc *BackendConfig) {
+	bc.SkipVerify = m.SkipVerify
+	bc.CACertFiles = m.CACerts
+	bc.CertFile = m.CertFile
+	bc.KeyFile = m.KeyFile
+}
+
+// applyHeaders adds the headers of the mirror, e.g. the registry header of Dragonfly, to the
+// ones of the backend.
+func (m *MirrorConfig) applyHeaders(bc *BackendConfig) {
+	if len(m.Headers) == 0 {
+		return
+	}
+	headers := make(map[string]string, len(bc.Headers)+len(m.Headers))
+	for name, value := range bc.Headers {
+		headers[name] = value
+	}
+	for name, value := range m.Headers {
+		headers[name] = value
+	}
+	bc.Headers = headers
+}
+
+const (
+	defaultDragonflyProxyAddress = "http://127.0.0.1:4001"
+	defaultDragonflyPingURL      = "http://127.0.0.1:4003/healthy"
+	// Tells dfdaemon which registry to fetch the blobs from.
+	dragonflyRegistryHeader = "X-Dragonfly-Registry"
+)
+
+// DragonflyProxyAddress returns the proxy address of the local dfdaemon.
+func DragonflyProxyAddress(c config.DragonflyConfig) string {
+	if c.ProxyAddress == "" {
+		return defaultDragonflyProxyAddress
+	}
+	return c.ProxyAddress
+}
+
+// dragonflyMirror returns the mirror served by the local dfdaemon for the registry at
+// registryScheme://registryHost. It is always health checked, so the next mirror or the origin
+// is used while dfdaemon is down.
+func dragonflyMirror(c config.DragonflyConfig, registryScheme, registryHost string) MirrorConfig {
+	mirror := MirrorConfig{
+		Host:    DragonflyProxyAddress(c),
+		PingURL: c.PingURL,
+		Headers: map[string]string{dragonflyRegistryHeader: registryScheme + "://" + registryHost},
+	}
+	if mirror.PingURL == "" {
+		mirror.PingURL = defaultDragonflyPingURL
+	}
+	return mirror
+}
+
+// mirrorsRegistry returns whether registryHost is one of registries, or registries is empty.
+// Images of "docker.io" are pulled from "index.docker.io", which both name.
+func mirrorsRegistry(registries []string, registryHost string) bool {
+	if len(registries) == 0 || slices.Contains(registries, registryHost) {
+		return true
+	}
+	return registryHost == "index.docker.io" && slices.Contains(registries, "docker.io")
+}
+
+const defaultSpegelAddress = "http://127.0.0.1:30020"
+
+// spegelMirror returns the mirror served by the local Spegel, false if it doesn't mirror
+// registryHost. Spegel only serves content by digest, which is all nydusd fetches from the
+// mirror with MirrorScopeBlobs. It is always health checked.
+func spegelMirror(c config.SpegelConfig, registryHost string) (MirrorConfig, bool) {
+	if !mirrorsRegistry(c.Registries, registryHost) {
+		return MirrorConfig{}, false
+	}
+	mirror := MirrorConfig{
+		Host:    strings.TrimRight(c.Address, "/"),
+		PingURL: c.PingURL,
+		Scope:   MirrorScopeBlobs,
+	}
+	if mirror.Host == "" {
+		mirror.Host = defaultSpegelAddress
+	}
+	if mirror.PingURL == "" {
+		mirror.PingURL = mirror.Host + "/healthz"
+	}
+	return mirror, true
+}
+
+// peerMirrors returns the peers which announced to serve the blobs of the image. They hold all
+// of its blobs but nothing else, so they are only mirrors of blobs. The node authenticates to
+// them with its fan-out certificate.
+func peerMirrors(c config.FanOutConfig, imageID string) []MirrorConfig {
+	var mirrors []MirrorConfig
+	for _, address := range fanout.Peers(imageID) {
+		mirrors = append(mirrors, MirrorConfig{
+			Host:     address,
+			PingURL:  address + "/v2/",
+			Scope:    MirrorScopeBlobs,
+			CACerts:  []string{c.CAFile},
+			CertFile: c.CertFile,
+			KeyFile:  c.KeyFile,
+		})
+	}
+	return mirrors
 }
 
 // Copied from containerd, for compatibility with containerd's toml configuration file.
@@ -41,17 +262,34 @@ type HostFileConfig struct {
 	HealthCheckInterval int    `toml:"health_check_interval,omitempty"`
 	FailureLimit        uint8  `toml:"failure_limit,omitempty"`
 	PingURL             string `toml:"ping_url,omitempty"`
+	ConnectTimeout      int    `toml:"connect_timeout,omitempty"`
+	Timeout             int    `toml:"timeout,omitempty"`
+	Weight              int    `toml:"weight,omitempty"`
+	Scope               string `toml:"scope,omitempty"`
+	// CA bundle added to the ones of ca, and the client certificate and key.
+	CAFile   string `toml:"ca_file,omitempty"`
+	CertFile string `toml:"cert_file,omitempty"`
+	KeyFile  string `toml:"key_file,omitempty"`
 }
 
 type hostConfig struct {
 	Scheme string
 	Host   string
 	Header http.Header
+	// Whether the host may be pulled from, which is all nydusd does with mirrors.
+	Pull bool
 
 	CACerts             []string
+	SkipVerify          bool
+	CertFile            string
+	KeyFile             string
 	HealthCheckInterval int
 	FailureLimit        uint8
 	PingURL             string
+	ConnectTimeout      int
+	Timeout             int
+	Weight              int
+	Scope               string
 }
 
 func makeStringSlice(slice []interface{}, cb func(string) string) ([]string, error) {
@@ -79,6 +317,14 @@ func parseMirrorsConfig(hosts []hostConfig) []MirrorConfig {
 		parsedMirrors[i].HealthCheckInterval = host.HealthCheckInterval
 		parsedMirrors[i].FailureLimit = host.FailureLimit
 		parsedMirrors[i].PingURL = host.PingURL
+		parsedMirrors[i].CACerts = host.CACerts
+		parsedMirrors[i].SkipVerify = host.SkipVerify
+		parsedMirrors[i].CertFile = host.CertFile
+		parsedMirrors[i].KeyFile = host.KeyFile
+		parsedMirrors[i].ConnectTimeout = host.ConnectTimeout
+		parsedMirrors[i].Timeout = host.Timeout
+		parsedMirrors[i].Weight = host.Weight
+		parsedMirrors[i].Scope = host.Scope
 
 		if len(host.Header) > 0 {
 			mirrorHeader := make(map[string]string, len(host.Header))
@@ -98,7 +344,8 @@ func parseMirrorsConfig(hosts []hostConfig) []MirrorConfig {
 // hostDirectory converts ":port" to "_port_" in directory names
 func hostDirectory(host string) string {
 	idx := strings.LastIndex(host, ":")
-	if idx > 0 {
+	// Colons of IPv6 literals like "[fd00::1]" are no port.
+	if idx > 0 && idx > strings.LastIndex(host, "]") {
 		return host[:idx] + "_" + host[idx+1:] + "_"
 	}
 	return host
@@ -116,19 +363,44 @@ func hostPaths(root, host string) []string {
 	)
 }
 
-func hostDirFromRoot(root, host string) (string, error) {
+// File system accessors used while scanning the mirrors config directory.
+// They are variables so tests can substitute a slow file system.
+var (
+	statPath      = os.Stat
+	readHostsFile = os.ReadFile
+)
+
+// loadHostDirFromRoot loads the hosts of the first host directory of root matching host.
+// An unreadable or malformed directory is skipped in favor of the next matching one, e.g.
+// "_default", and an error is only returned if none of them could be loaded.
+func loadHostDirFromRoot(root, host string) ([]hostConfig, error) {
+	var errs []error
 	for _, p := range hostPaths(root, host) {
-		if _, err := os.Stat(p); err == nil {
-			return p, nil
-		} else if !os.IsNotExist(err) {
-			return "", err
+		if _, err := statPath(p); err != nil {
+			if !os.IsNotExist(err) {
+				log.L.Warnf("Skipping mirrors config %s: %v", p, err)
+				errs = append(errs, err)
+			}
+			continue
 		}
+
+		hosts, err := loadHostDir(p)
+		if err != nil {
+			log.L.Warnf("Skipping mirrors config %s: %v", p, err)
+			errs = append(errs, errors.Wrapf(err, "load %s", p))
+			continue
+		}
+		return hosts, nil
 	}
-	return "", nil
+	return nil, stderrors.Join(errs...)
 }
 
 // getSortedHosts returns the list of hosts as they defined in the file.
 func getSortedHosts(root *toml.Tree) ([]string, error) {
+	if !root.Has("host") {
+		// Only configures the registry itself, e.g. by `server` or `ca`.
+		return nil, nil
+	}
 	iter, ok := root.Get("host").(*toml.Tree)
 	if !ok {
 		return nil, errors.New("invalid `host` tree")
@@ -147,13 +419,23 @@ func getSortedHosts(root *toml.Tree) ([]string, error) {
 	return list, nil
 }
 
+// makeAbsPath resolves paths of the host directory relative to it, like containerd does.
+func makeAbsPath(p string, base string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(base, p)
+}
+
 // parseHostConfig returns the parsed host configuration, make sure the server is not null.
-func parseHostConfig(server string, config HostFileConfig) (hostConfig, error) {
+// Relative certificate paths are resolved against baseDir.
+func parseHostConfig(server, baseDir string, config HostFileConfig) (hostConfig, error) {
 	var (
 		result = hostConfig{}
 		err    error
 	)
 
+	server = bracketIPv6(server)
 	if !strings.HasPrefix(server, "http") {
 		server = "https://" + server
 	}
@@ -163,6 +445,23 @@ func parseHostConfig(server string, config HostFileConfig) (hostConfig, error) {
 	}
 	result.Scheme = u.Scheme
 	result.Host = u.Host
+	if config.OverridePath {
+		return hostConfig{}, fmt.Errorf("override_path of %s is not supported", server)
+	}
+
+	if len(config.Capabilities) > 0 {
+		for _, c := range config.Capabilities {
+			switch strings.ToLower(c) {
+			case "pull":
+				result.Pull = true
+			case "resolve", "push":
+			default:
+				return hostConfig{}, fmt.Errorf("unknown capability %v", c)
+			}
+		}
+	} else {
+		result.Pull = true
+	}
 
 	if config.Header != nil {
 		header := http.Header{}
@@ -185,9 +484,11 @@ func parseHostConfig(server string, config HostFileConfig) (hostConfig, error) {
 	if config.CACert != nil {
 		switch cert := config.CACert.(type) {
 		case string:
-			result.CACerts = []string{cert}
+			result.CACerts = []string{makeAbsPath(cert, baseDir)}
 		case []interface{}:
-			certs, err := makeStringSlice(cert, nil)
+			certs, err := makeStringSlice(cert, func(p string) string {
+				return makeAbsPath(p, baseDir)
+			})
 			if err != nil {
 				return hostConfig{}, fmt.Errorf("invalid type for ca: %w", err)
 			}
@@ -197,14 +498,99 @@ func parseHostConfig(server string, config HostFileConfig) (hostConfig, error) {
 		}
 	}
 
+	if config.CAFile != "" {
+		result.CACerts = append(result.CACerts, config.CAFile)
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return hostConfig{}, fmt.Errorf("cert_file and key_file of %s must be set together", server)
+	}
+	result.CertFile = config.CertFile
+	result.KeyFile = config.KeyFile
+	if config.Client != nil && config.CertFile == "" {
+		result.CertFile, result.KeyFile, err = parseClientPair(config.Client, baseDir)
+		if err != nil {
+			return hostConfig{}, fmt.Errorf("invalid client of %s: %w", server, err)
+		}
+	}
+
+	if config.SkipVerify != nil {
+		result.SkipVerify = *config.SkipVerify
+	}
+
 	result.HealthCheckInterval = config.HealthCheckInterval
 	result.FailureLimit = config.FailureLimit
-	result.PingURL = config.PingURL
+	result.PingURL = bracketIPv6(config.PingURL)
+
+	if config.ConnectTimeout < 0 {
+		return hostConfig{}, fmt.Errorf("invalid connect_timeout %d for %s, must not be negative", config.ConnectTimeout, server)
+	}
+	if config.Timeout < 0 {
+		return hostConfig{}, fmt.Errorf("invalid timeout %d for %s, must not be negative", config.Timeout, server)
+	}
+	result.ConnectTimeout = config.ConnectTimeout
+	result.Timeout = config.Timeout
+
+	if config.Weight < 0 {
+		return hostConfig{}, fmt.Errorf("invalid weight %d for %s, must not be negative", config.Weight, server)
+	}
+	result.Weight = config.Weight
+
+	switch config.Scope {
+	case "", MirrorScopeAll:
+		result.Scope = MirrorScopeAll
+	case MirrorScopeBlobs:
+		result.Scope = MirrorScopeBlobs
+	default:
+		return hostConfig{}, fmt.Errorf("invalid scope %q for %s, must be %s or %s", config.Scope, server, MirrorScopeAll, MirrorScopeBlobs)
+	}
 
 	return result, nil
 }
 
-func parseHostsFile(b []byte) ([]hostConfig, error) {
+// parseClientPair returns the first client certificate and key of the client setting of
+// containerd, which is either a certificate, a list of them or a list of certificate and
+// key pairs. A certificate without key must contain the key as well.
+func parseClientPair(client interface{}, baseDir string) (string, string, error) {
+	var pairs [][2]string
+	switch c := client.(type) {
+	case string:
+		pairs = append(pairs, [2]string{c, ""})
+	case []interface{}:
+		for _, pair := range c {
+			switch p := pair.(type) {
+			case string:
+				pairs = append(pairs, [2]string{p, ""})
+			case []interface{}:
+				slice, err := makeStringSlice(p, nil)
+				if err != nil {
+					return "", "", err
+				}
+				if len(slice) != 2 {
+					return "", "", fmt.Errorf("invalid pair %v", p)
+				}
+				pairs = append(pairs, [2]string{slice[0], slice[1]})
+			default:
+				return "", "", fmt.Errorf("invalid type %T", p)
+			}
+		}
+	default:
+		return "", "", fmt.Errorf("invalid type %T", c)
+	}
+	if len(pairs) == 0 {
+		return "", "", nil
+	}
+	if len(pairs) > 1 {
+		log.L.Warnf("only the first client certificate %s is presented to mirrors", pairs[0][0])
+	}
+
+	cert, key := makeAbsPath(pairs[0][0], baseDir), pairs[0][1]
+	if key == "" {
+		return cert, cert, nil
+	}
+	return cert, makeAbsPath(key, baseDir), nil
+}
+
+func parseHostsFile(baseDir string, b []byte) ([]hostConfig, error) {
 	tree, err := toml.LoadBytes(b)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse TOML: %w", err)
@@ -227,23 +613,33 @@ func parseHostsFile(b []byte) ([]hostConfig, error) {
 		return nil, err
 	}
 
-	// Parse hosts array
+	// Parse hosts array, skipping malformed entries unless all of them are.
+	var errs []error
 	for _, host := range orderedHosts {
 		if host != "" {
 			config := c.HostConfigs[host]
-			parsed, err := parseHostConfig(host, config)
+			parsed, err := parseHostConfig(host, baseDir, config)
 			if err != nil {
-				return nil, err
+				log.L.Warnf("Skipping malformed mirror %s: %v", host, err)
+				errs = append(errs, err)
+				continue
+			}
+			if !parsed.Pull {
+				log.L.Debugf("Skipping mirror %s without pull capability", host)
+				continue
 			}
 			hosts = append(hosts, parsed)
 		}
 	}
+	if len(hosts) == 0 && len(errs) > 0 {
+		return nil, stderrors.Join(errs...)
+	}
 
 	return hosts, nil
 }
 
 func loadHostDir(hostsDir string) ([]hostConfig, error) {
-	b, err := os.ReadFile(filepath.Join(hostsDir, "hosts.toml"))
+	b, err := readHostsFile(filepath.Join(hostsDir, "hosts.toml"))
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return nil, err
@@ -251,7 +647,7 @@ func loadHostDir(hostsDir string) ([]hostConfig, error) {
 		return []hostConfig{}, nil
 	}
 
-	hosts, err := parseHostsFile(b)
+	hosts, err := parseHostsFile(hostsDir, b)
 	if err != nil {
 		return nil, err
 	}
@@ -259,23 +655,59 @@ func loadHostDir(hostsDir string) ([]hostConfig, error) {
 	return hosts, nil
 }
 
+// LoadMirrorsConfig returns the mirrors of the registry host along with the CA certs of all
+// of them, deduplicated. See LoadMirrorsTLSConfig for mirrors with TLS settings of their own.
 func LoadMirrorsConfig(mirrorsConfigDir, registryHost string) ([]MirrorConfig, []string, error) {
+	return LoadMirrorsConfigContext(context.Background(), mirrorsConfigDir, registryHost)
+}
+
+// LoadMirrorsConfigContext is like LoadMirrorsConfig but gives up once ctx is done, so a slow
+// or hung mirrors config directory (e.g. on NFS) can't block the caller indefinitely.
+func LoadMirrorsConfigContext(ctx context.Context, mirrorsConfigDir, registryHost string) ([]MirrorConfig, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.Wrapf(err, "load mirrors config for %s", registryHost)
+	}
+
+	type result struct {
+		mirrors []MirrorConfig
+		caCerts []string
+		err     error
+	}
+	// Buffered so the scanning goroutine can exit even if nobody waits for it anymore.
+	ch := make(chan result, 1)
+	go func() {
+		mirrors, caCerts, err := loadMirrorsConfig(mirrorsConfigDir, registryHost)
+		ch <- result{mirrors, caCerts, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, errors.Wrapf(ctx.Err(), "load mirrors config for %s from %s", registryHost, mirrorsConfigDir)
+	case r := <-ch:
+		return r.mirrors, r.caCerts, r.err
+	}
+}
+
+// LoadMirrorsTLSConfig is like LoadMirrorsConfigContext, but leaves the CA certs in the TLS
+// settings of each mirror rather than merging them, so trusting the CA of one mirror doesn't
+// make it trusted for the others.
+func LoadMirrorsTLSConfig(ctx context.Context, mirrorsConfigDir, registryHost string) ([]MirrorConfig, error) {
+	mirrors, _, err := LoadMirrorsConfigContext(ctx, mirrorsConfigDir, registryHost)
+	return mirrors, err
+}
+
+func loadMirrorsConfig(mirrorsConfigDir, registryHost string) ([]MirrorConfig, []string, error) {
 	if mirrorsConfigDir == "" {
 		return nil, nil, nil
 	}
-	hostDir, err := hostDirFromRoot(mirrorsConfigDir, registryHost)
+	hosts, err := loadHostDirFromRoot(mirrorsConfigDir, registryHost)
 	if err != nil {
 		return nil, nil, err
 	}
-	if hostDir == "" {
+	if hosts == nil {
 		return nil, nil, nil
 	}
 
-	hosts, err := loadHostDir(hostDir)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	// Collect CA certs from all host entries and deduplicate.
 	seen := make(map[string]struct{})
 	var caCerts []string
@@ -7,11 +7,16 @@
 package daemonconfig
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/containerd/log"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -93,6 +98,69 @@ func TestLoadMirrorConfigCACerts(t *testing.T) {
 		require.NoError(t, err)
 		require.Nil(t, caCerts)
 	})
+
+	t.Run("ca_file and client cert", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		hostDir := filepath.Join(tmpDir, "certs.d", registryHost)
+		require.NoError(t, os.MkdirAll(hostDir, os.ModePerm))
+
+		hosts := `
+[host."https://mirror.example.com"]
+  ca = "/etc/ca1.pem"
+  ca_file = "/etc/internal-ca.pem"
+  cert_file = "/etc/client.crt"
+  key_file = "/etc/client.key"
+`
+		require.NoError(t, os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(hosts), 0600))
+
+		mirrors, caCerts, err := LoadMirrorsConfig(filepath.Join(tmpDir, "certs.d"), registryHost)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/etc/ca1.pem", "/etc/internal-ca.pem"}, caCerts)
+		require.Len(t, mirrors, 1)
+		require.Equal(t, "/etc/client.crt", mirrors[0].CertFile)
+		require.Equal(t, "/etc/client.key", mirrors[0].KeyFile)
+	})
+
+	t.Run("cert_file without key_file", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		hostDir := filepath.Join(tmpDir, "certs.d", registryHost)
+		require.NoError(t, os.MkdirAll(hostDir, os.ModePerm))
+
+		hosts := `
+[host."https://mirror.example.com"]
+  cert_file = "/etc/client.crt"
+`
+		require.NoError(t, os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(hosts), 0600))
+
+		_, _, err := LoadMirrorsConfig(filepath.Join(tmpDir, "certs.d"), registryHost)
+		require.Error(t, err)
+	})
+}
+
+func TestLoadMirrorsTLSConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	registryHost := "registry.docker.io"
+	hostDir := filepath.Join(tmpDir, registryHost)
+	require.NoError(t, os.MkdirAll(hostDir, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(`
+[host."https://internal.example.com"]
+  ca = "/etc/internal-ca.pem"
+  cert_file = "/etc/client.crt"
+  key_file = "/etc/client.key"
+[host."https://public.example.com"]
+  skip_verify = true
+`), 0600))
+
+	// Each mirror keeps TLS settings of its own.
+	mirrors, err := LoadMirrorsTLSConfig(context.Background(), tmpDir, registryHost)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 2)
+	require.Equal(t, []string{"/etc/internal-ca.pem"}, mirrors[0].CACerts)
+	require.Equal(t, "/etc/client.crt", mirrors[0].CertFile)
+	require.False(t, mirrors[0].SkipVerify)
+	require.Nil(t, mirrors[1].CACerts)
+	require.Empty(t, mirrors[1].CertFile)
+	require.True(t, mirrors[1].SkipVerify)
 }
 
 func TestLoadMirrorConfig(t *testing.T) {
@@ -164,3 +232,146 @@ func TestLoadMirrorConfig(t *testing.T) {
 	require.Equal(t, mirrors[0].Host, "http://p2p-mirror2:65001")
 	require.Equal(t, mirrors[0].Headers["X-Dragonfly-Registry"], "https://docker.hub.com")
 }
+
+func TestLoadMirrorsConfigContextCancel(t *testing.T) {
+	tmpDir := t.TempDir()
+	registryHost := "registry.example.com"
+	hostDir := filepath.Join(tmpDir, registryHost)
+	require.NoError(t, os.MkdirAll(hostDir, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(`
+[host."https://mirror.example.com"]
+`), 0600))
+
+	// Simulate a hung file system, e.g. an unresponsive NFS mount.
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	defer close(unblock)
+	origReadHostsFile := readHostsFile
+	readHostsFile = func(name string) ([]byte, error) {
+		close(entered)
+		<-unblock
+		return origReadHostsFile(name)
+	}
+	defer func() {
+		// Wait for the scanning goroutine to be stuck in the stub before restoring it.
+		<-entered
+		readHostsFile = origReadHostsFile
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	mirrors, _, err := LoadMirrorsConfigContext(ctx, tmpDir, registryHost)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Nil(t, mirrors)
+	require.Less(t, time.Since(start), 2*time.Second)
+
+	// A cancelled context fails without touching the file system.
+	_, _, err = LoadMirrorsConfigContext(ctx, tmpDir, registryHost)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLoadMirrorsConfigPartialFailure(t *testing.T) {
+	registryHost := "registry.example.com"
+	hook := logtest.NewLocal(log.L.Logger)
+	defer hook.Reset()
+
+	writeHosts := func(dir, content string) {
+		require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "hosts.toml"), []byte(content), 0600))
+	}
+
+	// A malformed entry does not drop the valid ones in the same file.
+	tmpDir := t.TempDir()
+	writeHosts(filepath.Join(tmpDir, registryHost), `
+[host."http://bad-mirror:5000"]
+  ca = 42
+[host."http://good-mirror:5000"]
+`)
+	mirrors, _, err := LoadMirrorsConfig(tmpDir, registryHost)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 1)
+	assert.Equal(t, "http://good-mirror:5000", mirrors[0].Host)
+	require.NotNil(t, hook.LastEntry())
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Contains(t, hook.LastEntry().Message, "bad-mirror")
+
+	// A malformed host directory falls back to the default one.
+	hook.Reset()
+	writeHosts(filepath.Join(tmpDir, registryHost), `not toml [`)
+	writeHosts(filepath.Join(tmpDir, "_default"), `
+[host."http://default-mirror:5000"]
+`)
+	mirrors, _, err = LoadMirrorsConfig(tmpDir, registryHost)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 1)
+	assert.Equal(t, "http://default-mirror:5000", mirrors[0].Host)
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Contains(t, hook.LastEntry().Message, registryHost)
+
+	// Only fail when nothing could be loaded.
+	writeHosts(filepath.Join(tmpDir, "_default"), `
+[host."http://bad-mirror:5000"]
+  ca = 42
+`)
+	_, _, err = LoadMirrorsConfig(tmpDir, registryHost)
+	require.Error(t, err)
+}
+
+func TestLoadMirrorConfigContainerdHosts(t *testing.T) {
+	mirrorsConfigDir := t.TempDir()
+	registryHost := "registry.docker.io"
+	hostDir := filepath.Join(mirrorsConfigDir, registryHost)
+	require.NoError(t, os.MkdirAll(hostDir, 0755))
+
+	// Files configuring only the registry itself have no mirrors.
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(`
+server = "https://registry.docker.io"
+ca = "/etc/containerd/certs.d/registry.docker.io/ca.crt"
+`), 0600))
+	mirrors, _, err := LoadMirrorsConfig(mirrorsConfigDir, registryHost)
+	require.NoError(t, err)
+	require.Empty(t, mirrors)
+
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(`
+server = "https://registry.docker.io"
+
+[host."https://push-only.example.com"]
+  capabilities = ["push"]
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+  ca = "ca.crt"
+  client = [["client.cert", "/etc/pki/client.key"], "other.pem"]
+  [host."https://mirror.example.com".header]
+    X-Mirror = "nydus"
+
+[host."https://bundle.example.com"]
+  client = "client.pem"
+
+[host."https://override.example.com/v2/mirror"]
+  override_path = true
+`), 0600))
+	mirrors, caCerts, err := LoadMirrorsConfig(mirrorsConfigDir, registryHost)
+	require.NoError(t, err)
+	require.Len(t, mirrors, 2)
+
+	require.Equal(t, "https://mirror.example.com", mirrors[0].Host)
+	require.Equal(t, []string{filepath.Join(hostDir, "ca.crt")}, mirrors[0].CACerts)
+	require.Equal(t, []string{filepath.Join(hostDir, "ca.crt")}, caCerts)
+	require.Equal(t, filepath.Join(hostDir, "client.cert"), mirrors[0].CertFile)
+	require.Equal(t, "/etc/pki/client.key", mirrors[0].KeyFile)
+	require.Equal(t, map[string]string{"X-Mirror": "nydus"}, mirrors[0].Headers)
+
+	// The key of a single certificate file is in the file as well.
+	require.Equal(t, "https://bundle.example.com", mirrors[1].Host)
+	require.Equal(t, filepath.Join(hostDir, "client.pem"), mirrors[1].CertFile)
+	require.Equal(t, filepath.Join(hostDir, "client.pem"), mirrors[1].KeyFile)
+
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(`
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "fetch"]
+`), 0600))
+	_, _, err = LoadMirrorsConfig(mirrorsConfigDir, registryHost)
+	require.ErrorContains(t, err, "unknown capability fetch")
+}
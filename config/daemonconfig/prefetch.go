@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+// applyPrefetchPolicy replaces the prefetch and read-ahead settings of c with the policy named
+// by the label.NydusPrefetchPolicy label, or else by the node-wide default of the backend type.
+// Without either, the settings of the template are kept.
+func applyPrefetchPolicy(c DaemonConfig, backendType StorageBackendType, labels map[string]string) error {
+	prefetch := config.GetPrefetchConfig()
+	name, ok := labels[label.NydusPrefetchPolicy]
+	if !ok {
+		name = prefetch.Defaults[backendType.String()]
+	}
+	if name == "" {
+		return nil
+	}
+	policy, ok := prefetch.Policies[name]
+	if !ok {
+		return errors.Errorf("unknown prefetch policy %q", name)
+	}
+
+	switch cfg := c.(type) {
+	case *FuseDaemonConfig:
+		cfg.FSPrefetch.Enable = policy.Enable
+		cfg.FSPrefetch.PrefetchAll = policy.PrefetchAll
+		cfg.FSPrefetch.ThreadsCount = policy.ThreadsCount
+		cfg.FSPrefetch.MergingSize = policy.MergingSize
+		cfg.FSPrefetch.BandwidthRate = policy.BandwidthRate
+	case *FscacheDaemonConfig:
+		cfg.Config.BlobPrefetchConfig = BlobPrefetchConfig{
+			Enable:        policy.Enable,
+			PrefetchAll:   policy.PrefetchAll,
+			ThreadsCount:  policy.ThreadsCount,
+			MergingSize:   policy.MergingSize,
+			BandwidthRate: policy.BandwidthRate,
+		}
+	}
+	for _, b := range c.BackendChain() {
+		b.Config.ReadAhead = policy.ReadAheadSec > 0
+		b.Config.ReadAheadSec = policy.ReadAheadSec
+	}
+	return nil
+}
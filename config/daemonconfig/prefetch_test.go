@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+func TestPrefetchPolicy(t *testing.T) {
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:       t.TempDir(),
+		DaemonMode: string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{PrefetchConfig: config.PrefetchConfig{
+			Policies: map[string]config.PrefetchPolicy{
+				"aggressive": {Enable: true, PrefetchAll: true, ThreadsCount: 16, ReadAheadSec: 60},
+				"lazy":       {},
+			},
+			Defaults: map[string]string{"oss": "lazy"},
+		}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	newConfig := func(backendType StorageBackendType) *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendType
+		cfg.Device.Backend.Config.EndPoint = "oss.example.com"
+		cfg.FSPrefetch.Enable = true
+		cfg.FSPrefetch.ThreadsCount = 4
+		return cfg
+	}
+
+	// The label selects the policy.
+	cfg := newConfig(backendTypeRegistry)
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/model:latest", "1", false,
+		map[string]string{label.NydusPrefetchPolicy: "aggressive"}, nil))
+	require.Equal(t, FSPrefetch{Enable: true, PrefetchAll: true, ThreadsCount: 16}, cfg.FSPrefetch)
+	require.True(t, cfg.Device.Backend.Config.ReadAhead)
+	require.Equal(t, 60, cfg.Device.Backend.Config.ReadAheadSec)
+
+	// Images without the label get the default of their backend type, if any.
+	cfg = newConfig(backendTypeOss)
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/web:latest", "2", false, nil, nil))
+	require.False(t, cfg.FSPrefetch.Enable)
+	require.False(t, cfg.Device.Backend.Config.ReadAhead)
+
+	cfg = newConfig(backendTypeRegistry)
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/web:latest", "3", false, nil, nil))
+	require.Equal(t, FSPrefetch{Enable: true, ThreadsCount: 4}, cfg.FSPrefetch)
+
+	err := SupplementDaemonConfig(newConfig(backendTypeRegistry), "registry.example.com/web:latest", "4", false,
+		map[string]string{label.NydusPrefetchPolicy: "unknown"}, nil)
+	require.ErrorContains(t, err, "unknown prefetch policy")
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/containerd/nydus-snapshotter/pkg/utils/redact"
+)
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// Redact returns a copy of the configuration c, or any part of it like a backend
+// configuration, for logs and API responses. It encodes to the same JSON as c except
+// that fields tagged with `secret:"true"` or registered with RegisterSecretFieldPath,
+// and credential headers like "Authorization", also of fallback backends and mirrors,
+// are masked. Unlike serializeWithSecretFilter, which drops secrets from configurations
+// nydusd gets its credentials for by other means, the fields are kept to tell that a
+// credential is set.
+func Redact(c interface{}) interface{} {
+	if c == nil {
+		return nil
+	}
+	return redactValue(reflect.ValueOf(c), "")
+}
+
+func redactValue(v reflect.Value, path string) interface{} {
+	if v.Type().Implements(jsonMarshalerType) {
+		return v.Interface()
+	}
+
+	//nolint:exhaustive
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), path)
+	case reflect.Struct:
+		result := make(map[string]interface{})
+		redactStruct(v, path, result)
+		return result
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if !hasStructs(v.Type().Elem()) {
+			return v.Interface()
+		}
+		result := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result[i] = redactValue(v.Index(i), path)
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if headers, ok := v.Interface().(map[string]string); ok && isHeadersPath(path) {
+			return redact.Headers(headers)
+		}
+		if !hasStructs(v.Type().Elem()) {
+			return v.Interface()
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			result[iter.Key().String()] = redactValue(iter.Value(), path)
+		}
+		return result
+	default:
+		return v.Interface()
+	}
+}
+
+func redactStruct(v reflect.Value, parent string, result map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field, fieldType := v.Field(i), t.Field(i)
+		if !fieldType.IsExported() {
+			continue
+		}
+		tags := strings.Split(fieldType.Tag.Get("json"), ",")
+		name := tags[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" && fieldType.Anonymous && field.Kind() == reflect.Struct {
+			redactStruct(field, parent, result)
+			continue
+		}
+		if name == "" {
+			name = fieldType.Name
+		}
+		if field.IsZero() && slices.Contains(tags[1:], "omitempty") {
+			continue
+		}
+
+		path := name
+		if parent != "" {
+			path = parent + "." + name
+		}
+		if fieldType.Tag.Get("secret") == "true" || isRegisteredSecretField(path) {
+			if !field.IsZero() {
+				result[name] = redact.Mask
+			} else {
+				result[name] = field.Interface()
+			}
+			continue
+		}
+		result[name] = redactValue(field, path)
+	}
+}
+
+// hasStructs tells whether values of t may contain structs to redact.
+func hasStructs(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	//nolint:exhaustive
+	switch t.Kind() {
+	case reflect.Struct, reflect.Interface:
+		return true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return hasStructs(t.Elem())
+	}
+	return false
+}
+
+func isHeadersPath(path string) bool {
+	return path == "headers" || strings.HasSuffix(path, ".headers") ||
+		path == "Headers" || strings.HasSuffix(path, ".Headers")
+}
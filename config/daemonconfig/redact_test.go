@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/utils/redact"
+)
+
+func TestRedact(t *testing.T) {
+	cfg := &FuseDaemonConfig{Device: &DeviceConfig{}, Mode: "direct"}
+	cfg.Device.Backend.BackendType = backendTypeRegistry
+	cfg.Device.Backend.Config = BackendConfig{
+		Host:    "registry.example.com",
+		Auth:    "dXNlcjpwYXNz",
+		Headers: map[string]string{"Authorization": "Bearer token", "X-Request-Source": "nydus"},
+	}
+	cfg.Device.Backend.Config.Proxy.Password = "proxy-pass"
+	cfg.Device.FallbackBackends = []FallbackBackend{{
+		BackendType: backendTypeOss,
+		Config:      BackendConfig{BucketName: "images", AccessKeyID: "id", AccessKeySecret: "key"},
+	}}
+
+	b, err := json.Marshal(Redact(cfg))
+	require.NoError(t, err)
+	for _, secret := range []string{"dXNlcjpwYXNz", "Bearer token", "proxy-pass", "\"id\"", "\"key\""} {
+		require.NotContains(t, string(b), secret)
+	}
+
+	var redacted FuseDaemonConfig
+	require.NoError(t, json.Unmarshal(b, &redacted))
+	bc := redacted.Device.Backend.Config
+	require.Equal(t, "registry.example.com", bc.Host)
+	require.Equal(t, redact.Mask, bc.Auth)
+	require.Empty(t, bc.RegistryToken)
+	require.Equal(t, map[string]string{"Authorization": redact.Mask, "X-Request-Source": "nydus"}, bc.Headers)
+	require.Equal(t, redact.Mask, bc.Proxy.Password)
+	require.Equal(t, "images", redacted.Device.FallbackBackends[0].Config.BucketName)
+	require.Equal(t, redact.Mask, redacted.Device.FallbackBackends[0].Config.AccessKeySecret)
+	require.Equal(t, "direct", redacted.Mode)
+
+	// The configuration itself is left untouched.
+	require.Equal(t, "dXNlcjpwYXNz", cfg.Device.Backend.Config.Auth)
+
+	// Configurations for backend source drop the secrets altogether.
+	b, err = json.Marshal(serializeWithSecretFilter(cfg))
+	require.NoError(t, err)
+	for _, secret := range []string{"dXNlcjpwYXNz", "Bearer token", "\"key\""} {
+		require.NotContains(t, string(b), secret)
+	}
+	require.Contains(t, string(b), "X-Request-Source")
+}
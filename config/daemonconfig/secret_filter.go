@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2020. Ant Group. All rights reserved.
+ * Copyright (c) 2022. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/containerd/nydus-snapshotter/pkg/utils/redact"
+)
+
+// nydusdConfig returns a copy of c without the fields only consumed by the snapshotter, see
+// BackendConfig, or c itself if it has none.
+func nydusdConfig(c interface{}) interface{} {
+	dc, ok := c.(DaemonConfig)
+	if !ok || reflect.ValueOf(dc).IsNil() {
+		return c
+	}
+	if !slices.ContainsFunc(dc.BackendChain(), func(b ChainedBackend) bool { return b.Config.hasSnapshotterFields() }) {
+		return c
+	}
+	clone := dc.Clone()
+	for _, b := range clone.BackendChain() {
+		b.Config.clearSnapshotterFields()
+	}
+	return clone
+}
+
+func (c *BackendConfig) hasSnapshotterFields() bool {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("nydusd") == "-" && !v.Field(i).IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *BackendConfig) clearSnapshotterFields() {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("nydusd") == "-" {
+			v.Field(i).SetZero()
+		}
+	}
+}
+
+var (
+	secretFieldPathsLock sync.RWMutex
+	secretFieldPaths     = map[string]struct{}{}
+)
+
+// RegisterSecretFieldPath marks an additional field as secret on top of the ones tagged
+// with `secret:"true"`, for deployments that consider more fields sensitive. The path is
+// made of dot separated JSON keys, e.g. "backend.config.host", and matches any field whose
+// full path ends with it.
+func RegisterSecretFieldPath(path string) {
+	secretFieldPathsLock.Lock()
+	defer secretFieldPathsLock.Unlock()
+	secretFieldPaths[strings.Trim(path, ".")] = struct{}{}
+}
+
+func isRegisteredSecretField(path string) bool {
+	secretFieldPathsLock.RLock()
+	defer secretFieldPathsLock.RUnlock()
+	for p := range secretFieldPaths {
+		if path == p || strings.HasSuffix(path, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRegisteredSecretFields() bool {
+	secretFieldPathsLock.RLock()
+	defer secretFieldPathsLock.RUnlock()
+	return len(secretFieldPaths) > 0
+}
+
+func serializeWithSecretFilter(obj interface{}) map[string]interface{} {
+	return serializeWithSecretFilterAt(obj, "", true)
+}
+
+// serializeWithoutRegisteredSecrets keeps the tagged secrets, which nydusd needs,
+// and only leaves out the fields registered with RegisterSecretFieldPath.
+func serializeWithoutRegisteredSecrets(obj interface{}) map[string]interface{} {
+	return serializeWithSecretFilterAt(obj, "", false)
+}
+
+func serializeWithSecretFilterAt(obj interface{}, parent string, tagged bool) map[string]interface{} {
+	result := make(map[string]interface{})
+	value := reflect.ValueOf(obj)
+	typeOfObj := reflect.TypeOf(obj)
+
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+		typeOfObj = typeOfObj.Elem()
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		fieldType := typeOfObj.Field(i)
+		secretTag := fieldType.Tag.Get("secret")
+		jsonTags := strings.Split(fieldType.Tag.Get("json"), ",")
+		omitemptyTag := false
+
+		// Like encoding/json, fields tagged "-" and unexported ones are left out, and so
+		// are the ones nydusd doesn't get.
+		if jsonTags[0] == "-" || !fieldType.IsExported() || fieldType.Tag.Get("nydusd") == "-" {
+			continue
+		}
+		if jsonTags[0] == "" {
+			jsonTags[0] = fieldType.Name
+		}
+
+		for _, tag := range jsonTags {
+			if tag == "omitempty" {
+				omitemptyTag = true
+				break
+			}
+		}
+
+		path := jsonTags[0]
+		if parent != "" {
+			path = parent + "." + path
+		}
+
+		if (tagged && secretTag == "true") || isRegisteredSecretField(path) {
+			continue
+		}
+
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			continue
+		}
+
+		if omitemptyTag && reflect.DeepEqual(reflect.Zero(field.Type()).Interface(), field.Interface()) {
+			continue
+		}
+
+		//nolint:exhaustive
+		switch fieldType.Type.Kind() {
+		case reflect.Struct:
+			result[jsonTags[0]] = serializeWithSecretFilterAt(field.Interface(), path, tagged)
+		case reflect.Ptr:
+			if fieldType.Type.Elem().Kind() == reflect.Struct {
+				result[jsonTags[0]] = serializeWithSecretFilterAt(field.Elem().Interface(), path, tagged)
+			} else {
+				result[jsonTags[0]] = field.Elem().Interface()
+			}
+		case reflect.Slice:
+			// E.g. fallback backends
+			if fieldType.Type.Elem().Kind() == reflect.Struct && !field.IsNil() {
+				items := make([]interface{}, field.Len())
+				for j := range items {
+					items[j] = serializeWithSecretFilterAt(field.Index(j).Interface(), path, tagged)
+				}
+				result[jsonTags[0]] = items
+			} else {
+				result[jsonTags[0]] = field.Interface()
+			}
+		case reflect.Map:
+			if headers, ok := field.Interface().(map[string]string); ok && tagged && isHeadersPath(path) {
+				filtered := make(map[string]string, len(headers))
+				for name, value := range headers {
+					if !redact.IsSecretHeader(name) {
+						filtered[name] = value
+					}
+				}
+				result[jsonTags[0]] = filtered
+			} else {
+				result[jsonTags[0]] = field.Interface()
+			}
+		default:
+			result[jsonTags[0]] = field.Interface()
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// Signing material is renewed this long before it expires.
+	signingRefreshMargin = 5 * time.Minute
+	signRequestTimeout   = 30 * time.Second
+)
+
+// SignRequest describes the backend a RequestSigner provides signing material for.
+type SignRequest struct {
+	BackendType string `json:"backend_type"`
+	// Registry host or object storage endpoint
+	Host       string `json:"host,omitempty"`
+	Repo       string `json:"repo,omitempty"`
+	BucketName string `json:"bucket_name,omitempty"`
+}
+
+// SigningMaterial is put into the backend configuration handed to nydusd, empty fields
+// leave the configuration as is.
+type SigningMaterial struct {
+	Headers         map[string]string `json:"headers,omitempty"`
+	Auth            string            `json:"auth,omitempty"`
+	RegistryToken   string            `json:"registry_token,omitempty"`
+	AccessKeyID     string            `json:"access_key_id,omitempty"`
+	AccessKeySecret string            `json:"access_key_secret,omitempty"`
+	SessionToken    string            `json:"session_token,omitempty"`
+	// When the material has to be replaced, zero if it does not expire
+	Expiration time.Time `json:"expiration,omitempty"`
+}
+
+// RequestSigner provides the material nydusd signs backend requests with, for signing
+// schemes nydusd has no built-in support for.
+type RequestSigner interface {
+	Sign(ctx context.Context, req SignRequest) (*SigningMaterial, error)
+}
+
+type signingKey struct {
+	signer string
+	req    SignRequest
+}
+
+var (
+	signersLock sync.RWMutex
+	signers     = map[string]RequestSigner{}
+	// Incremented whenever a signer is registered, so material signed by a replaced signer
+	// is not kept.
+	signersGeneration uint64
+
+	signingMaterialsLock sync.Mutex
+	signingMaterials     = map[signingKey]*SigningMaterial{}
+	// Concurrent requests for the same material share one call of the signer.
+	signingRequests singleflight.Group
+)
+
+// RegisterRequestSigner makes s available to backends configured with the signer name.
+// It replaces the signer registered before under the same name, and its material.
+func RegisterRequestSigner(name string, s RequestSigner) {
+	signersLock.Lock()
+	defer signersLock.Unlock()
+	signers[name] = s
+	signersGeneration++
+
+	signingMaterialsLock.Lock()
+	defer signingMaterialsLock.Unlock()
+	for key := range signingMaterials {
+		if key.signer == name {
+			delete(signingMaterials, key)
+		}
+	}
+}
+
+// applySigner puts the material of the signer of c into c and returns whether it contains
+// a registry credential. Material is shared between configurations until it is about to expire.
+func (c *BackendConfig) applySigner(backendType StorageBackendType) (bool, error) {
+	signersLock.RLock()
+	s, ok := signers[c.Signer]
+	generation := signersGeneration
+	signersLock.RUnlock()
+	if !ok {
+		return false, errors.Errorf("request signer %q is not registered", c.Signer)
+	}
+
+	host := c.Host
+	if host == "" {
+		host = c.EndPoint
+	}
+	key := signingKey{signer: c.Signer, req: SignRequest{
+		BackendType: backendType.String(),
+		Host:        host,
+		Repo:        c.Repo,
+		BucketName:  c.BucketName,
+	}}
+
+	signingMaterialsLock.Lock()
+	m, ok := signingMaterials[key]
+	signingMaterialsLock.Unlock()
+	if !ok || (!m.Expiration.IsZero() && time.Until(m.Expiration) < signingRefreshMargin) {
+		flight := fmt.Sprintf("%d/%s/%+v", generation, key.signer, key.req)
+		v, err, _ := signingRequests.Do(flight, func() (interface{}, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), signRequestTimeout)
+			defer cancel()
+			m, err := s.Sign(ctx, key.req)
+			if err != nil {
+				return nil, err
+			}
+			signersLock.RLock()
+			defer signersLock.RUnlock()
+			if generation == signersGeneration {
+				signingMaterialsLock.Lock()
+				signingMaterials[key] = m
+				signingMaterialsLock.Unlock()
+			}
+			return m, nil
+		})
+		if err != nil {
+			return false, errors.Wrapf(err, "sign requests with %s", c.Signer)
+		}
+		m = v.(*SigningMaterial)
+	}
+
+	if len(m.Headers) > 0 {
+		headers := make(map[string]string, len(c.Headers)+len(m.Headers))
+		for name, value := range c.Headers {
+			headers[name] = value
+		}
+		for name, value := range m.Headers {
+			headers[name] = value
+		}
+		c.Headers = headers
+	}
+	for _, f := range []struct {
+		field *string
+		value string
+	}{
+		{&c.Auth, m.Auth},
+		{&c.RegistryToken, m.RegistryToken},
+		{&c.AccessKeyID, m.AccessKeyID},
+		{&c.AccessKeySecret, m.AccessKeySecret},
+		{&c.SessionToken, m.SessionToken},
+	} {
+		if f.value != "" {
+			*f.field = f.value
+		}
+	}
+	c.Signer = ""
+	return m.Auth != "" || m.RegistryToken != "", nil
+}
+
+// NextSigningRefresh returns when the earliest signing material handed out so far should
+// be replaced, false if none expires. Expired material is forgotten.
+func NextSigningRefresh() (time.Time, bool) {
+	signingMaterialsLock.Lock()
+	defer signingMaterialsLock.Unlock()
+
+	var next time.Time
+	for key, m := range signingMaterials {
+		if m.Expiration.IsZero() {
+			continue
+		}
+		if time.Now().After(m.Expiration) {
+			delete(signingMaterials, key)
+			continue
+		}
+		if t := m.Expiration.Add(-signingRefreshMargin); next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return next, !next.IsZero()
+}
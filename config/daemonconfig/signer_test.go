@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signerFunc func(ctx context.Context, req SignRequest) (*SigningMaterial, error)
+
+func (f signerFunc) Sign(ctx context.Context, req SignRequest) (*SigningMaterial, error) {
+	return f(ctx, req)
+}
+
+func TestRequestSigner(t *testing.T) {
+	defer func() {
+		signers = map[string]RequestSigner{}
+		signingMaterials = map[signingKey]*SigningMaterial{}
+	}()
+
+	var requests []SignRequest
+	expiration := time.Now().Add(time.Hour)
+	RegisterRequestSigner("hmac", signerFunc(func(_ context.Context, req SignRequest) (*SigningMaterial, error) {
+		requests = append(requests, req)
+		return &SigningMaterial{Headers: map[string]string{"X-Signature": "sig"}, RegistryToken: "token", Expiration: expiration}, nil
+	}))
+
+	newConfig := func() *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		cfg.Device.Backend.Config.Signer = "hmac"
+		cfg.Device.Backend.Config.Headers = map[string]string{"X-Team": "infra"}
+		return cfg
+	}
+
+	cfg := newConfig()
+	result, err := SupplementDaemonConfigWithResult(cfg, "registry.example.com/app:latest", "1", false, nil, nil)
+	require.NoError(t, err)
+	require.True(t, result.AuthFilled)
+	bc := cfg.Device.Backend.Config
+	require.Equal(t, map[string]string{"X-Team": "infra", "X-Signature": "sig"}, bc.Headers)
+	require.Equal(t, "token", bc.RegistryToken)
+	require.Empty(t, bc.Signer)
+	require.Equal(t, []SignRequest{{BackendType: "registry", Host: "registry.example.com", Repo: "app"}}, requests)
+
+	next, ok := NextSigningRefresh()
+	require.True(t, ok)
+	require.Equal(t, expiration.Add(-signingRefreshMargin), next)
+
+	// Material is shared until it is about to expire.
+	require.NoError(t, SupplementDaemonConfig(newConfig(), "registry.example.com/app:latest", "2", false, nil, nil))
+	require.Len(t, requests, 1)
+	for _, m := range signingMaterials {
+		m.Expiration = time.Now().Add(time.Minute)
+	}
+	require.NoError(t, SupplementDaemonConfig(newConfig(), "registry.example.com/app:latest", "3", false, nil, nil))
+	require.Len(t, requests, 2)
+
+	// Registering the signer again drops its material.
+	RegisterRequestSigner("hmac", signers["hmac"])
+	_, ok = NextSigningRefresh()
+	require.False(t, ok)
+
+	cfg = newConfig()
+	cfg.Device.Backend.Config.Signer = "unknown"
+	require.ErrorContains(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "4", false, nil, nil), "not registered")
+}
+
+func TestRequestSignerConcurrent(t *testing.T) {
+	defer func() {
+		signers = map[string]RequestSigner{}
+		signingMaterials = map[signingKey]*SigningMaterial{}
+	}()
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	RegisterRequestSigner("slow", signerFunc(func(_ context.Context, req SignRequest) (*SigningMaterial, error) {
+		if req.Repo == "slow" {
+			calls.Add(1)
+			<-release
+		}
+		return &SigningMaterial{RegistryToken: req.Repo}, nil
+	}))
+	supplement := func(repo string) error {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeRegistry
+		cfg.Device.Backend.Config.Signer = "slow"
+		return SupplementDaemonConfig(cfg, "registry.example.com/"+repo+":latest", "1", false, nil, nil)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, supplement("slow"))
+		}()
+	}
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// A slow signer only holds up the requests for the same material.
+	require.NoError(t, supplement("fast"))
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestExecSigner(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "signer.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+grep -q '"backend_type":"oss"' || { echo "unexpected request" >&2; exit 1; }
+echo '{"access_key_id": "id", "access_key_secret": "secret", "expiration": "2030-01-01T00:00:00Z"}'
+`), 0700))
+
+	s := &ExecSigner{Path: script, Timeout: 10 * time.Second}
+	m, err := s.Sign(context.Background(), SignRequest{BackendType: "oss", Host: "oss.example.com"})
+	require.NoError(t, err)
+	require.Equal(t, "id", m.AccessKeyID)
+	require.Equal(t, "secret", m.AccessKeySecret)
+	require.Equal(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), m.Expiration)
+
+	_, err = s.Sign(context.Background(), SignRequest{BackendType: "s3"})
+	require.ErrorContains(t, err, "unexpected request")
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // Required by the signature of Alibaba Cloud RPC APIs
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSTSEndpoint     = "sts.aliyuncs.com"
+	defaultRoleSessionName = "nydus-snapshotter"
+	// Temporary credentials are refreshed this long before they expire.
+	stsRefreshMargin  = 5 * time.Minute
+	stsRequestTimeout = 10 * time.Second
+)
+
+// Temporary credentials issued by STS for an assumed role.
+type stsCredential struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	AccessKeySecret string    `json:"AccessKeySecret"`
+	SecurityToken   string    `json:"SecurityToken"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+var (
+	stsCredentialsLock sync.Mutex
+	// Keyed by the STS endpoint, role, session name and access key ID of the request.
+	stsCredentials = map[string]*stsCredential{}
+)
+
+// requestSTSCredential calls the AssumeRole API of STS with the access keys of c.
+// It is a variable so tests can substitute it.
+var requestSTSCredential = assumeRole
+
+// applySTSCredential replaces the access keys of c with temporary credentials of the role
+// given by RoleARN, so that nydusd never gets the long-lived keys. Credentials are shared
+// between configurations until they are about to expire.
+func (c *BackendConfig) applySTSCredential() error {
+	key := strings.Join([]string{c.stsEndpoint(), c.RoleARN, c.roleSessionName(), c.AccessKeyID}, "|")
+
+	stsCredentialsLock.Lock()
+	defer stsCredentialsLock.Unlock()
+	cred, ok := stsCredentials[key]
+	if !ok || time.Until(cred.Expiration) < stsRefreshMargin {
+		var err error
+		if cred, err = requestSTSCredential(c); err != nil {
+			return errors.Wrapf(err, "assume role %s", c.RoleARN)
+		}
+		stsCredentials[key] = cred
+	}
+
+	c.AccessKeyID = cred.AccessKeyID
+	c.AccessKeySecret = cred.AccessKeySecret
+	c.SessionToken = cred.SecurityToken
+	c.RoleARN = ""
+	c.RoleSessionName = ""
+	c.STSEndpoint = ""
+	c.RoleDurationSec = 0
+	return nil
+}
+
+// NextSTSRefresh returns when the earliest temporary credentials handed out so far should
+// be replaced, false if there are none. Expired credentials are forgotten.
+func NextSTSRefresh() (time.Time, bool) {
+	stsCredentialsLock.Lock()
+	defer stsCredentialsLock.Unlock()
+
+	var next time.Time
+	for key, cred := range stsCredentials {
+		if time.Now().After(cred.Expiration) {
+			delete(stsCredentials, key)
+			continue
+		}
+		if t := cred.Expiration.Add(-stsRefreshMargin); next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func (c *BackendConfig) stsEndpoint() string {
+	if c.STSEndpoint != "" {
+		return c.STSEndpoint
+	}
+	return defaultSTSEndpoint
+}
+
+func (c *BackendConfig) roleSessionName() string {
+	if c.RoleSessionName != "" {
+		return c.RoleSessionName
+	}
+	return defaultRoleSessionName
+}
+
+func assumeRole(c *BackendConfig) (*stsCredential, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	params := url.Values{
+		"Action":           {"AssumeRole"},
+		"Version":          {"2015-04-01"},
+		"Format":           {"JSON"},
+		"AccessKeyId":      {c.AccessKeyID},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureVersion": {"1.0"},
+		"SignatureNonce":   {hex.EncodeToString(nonce)},
+		"Timestamp":        {time.Now().UTC().Format("2006-01-02T15:04:05Z")},
+		"RoleArn":          {c.RoleARN},
+		"RoleSessionName":  {c.roleSessionName()},
+	}
+	if c.RoleDurationSec > 0 {
+		params.Set("DurationSeconds", strconv.Itoa(c.RoleDurationSec))
+	}
+	params.Set("Signature", signRPCRequest(http.MethodGet, params, c.AccessKeySecret))
+
+	endpoint := c.stsEndpoint()
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	client := &http.Client{Timeout: stsRequestTimeout}
+	resp, err := client.Get(endpoint + "/?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "read STS response")
+	}
+	var result struct {
+		Code        string
+		Message     string
+		Credentials *stsCredential
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, errors.Wrapf(err, "decode STS response with status %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || result.Credentials == nil {
+		return nil, errors.Errorf("STS responded with status %d: %s %s", resp.StatusCode, result.Code, result.Message)
+	}
+	return result.Credentials, nil
+}
+
+// signRPCRequest computes the signature of Alibaba Cloud RPC style APIs.
+func signRPCRequest(method string, params url.Values, secret string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, percentEncode(k)+"="+percentEncode(params.Get(k)))
+	}
+	stringToSign := method + "&" + percentEncode("/") + "&" + percentEncode(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func percentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSTSCredential(t *testing.T) {
+	defer func(f func(*BackendConfig) (*stsCredential, error)) {
+		requestSTSCredential = f
+		stsCredentials = map[string]*stsCredential{}
+	}(requestSTSCredential)
+
+	var requests int
+	expiration := time.Now().Add(time.Hour)
+	requestSTSCredential = func(c *BackendConfig) (*stsCredential, error) {
+		requests++
+		require.Equal(t, "acs:ram::123456:role/nydus", c.RoleARN)
+		require.Equal(t, "base-id", c.AccessKeyID)
+		return &stsCredential{AccessKeyID: "STS.id", AccessKeySecret: "sts-secret", SecurityToken: "token", Expiration: expiration}, nil
+	}
+
+	newConfig := func() *FuseDaemonConfig {
+		cfg := &FuseDaemonConfig{Device: &DeviceConfig{}}
+		cfg.Device.Backend.BackendType = backendTypeOss
+		cfg.Device.Backend.Config = BackendConfig{
+			EndPoint: "oss-cn-hangzhou.aliyuncs.com", BucketName: "images",
+			AccessKeyID: "base-id", AccessKeySecret: "base-secret", RoleARN: "acs:ram::123456:role/nydus",
+		}
+		require.NoError(t, cfg.Device.Backend.Config.Validate())
+		return cfg
+	}
+
+	cfg := newConfig()
+	require.NoError(t, SupplementDaemonConfig(cfg, "registry.example.com/app:latest", "1", false, nil, nil))
+	bc := cfg.Device.Backend.Config
+	require.Equal(t, "STS.id", bc.AccessKeyID)
+	require.Equal(t, "sts-secret", bc.AccessKeySecret)
+	require.Equal(t, "token", bc.SessionToken)
+	require.Empty(t, bc.RoleARN)
+	require.NoError(t, bc.Validate())
+
+	next, ok := NextSTSRefresh()
+	require.True(t, ok)
+	require.Equal(t, expiration.Add(-stsRefreshMargin), next)
+
+	// Credentials are shared until they are about to expire.
+	require.NoError(t, SupplementDaemonConfig(newConfig(), "registry.example.com/app:latest", "2", false, nil, nil))
+	require.Equal(t, 1, requests)
+	expiration = time.Now().Add(time.Minute)
+	for _, cred := range stsCredentials {
+		cred.Expiration = expiration
+	}
+	require.NoError(t, SupplementDaemonConfig(newConfig(), "registry.example.com/app:latest", "3", false, nil, nil))
+	require.Equal(t, 2, requests)
+
+	for _, cred := range stsCredentials {
+		cred.Expiration = time.Now().Add(-time.Second)
+	}
+	_, ok = NextSTSRefresh()
+	require.False(t, ok)
+
+	require.Error(t, (&BackendConfig{RoleARN: "arn:aws:iam::123456:role/nydus", AccessKeyID: "id", AccessKeySecret: "secret"}).Validate())
+	require.Error(t, (&BackendConfig{RoleARN: "acs:ram::123456:role/nydus"}).Validate())
+	require.Error(t, (&BackendConfig{RoleARN: "acs:ram::123456:role/nydus", AccessKeyID: "id", AccessKeySecret: "secret", SessionToken: "token"}).Validate())
+	require.Error(t, (&BackendConfig{RoleDurationSec: 60}).Validate())
+}
+
+func TestAssumeRole(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("RoleArn") != "acs:ram::123456:role/nydus" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"Code": "NoPermission", "Message": "not allowed"}`))
+			return
+		}
+		require.Equal(t, "AssumeRole", q.Get("Action"))
+		require.Equal(t, "id", q.Get("AccessKeyId"))
+		require.Equal(t, "nydus-snapshotter", q.Get("RoleSessionName"))
+		require.Equal(t, "3600", q.Get("DurationSeconds"))
+		signature := q.Get("Signature")
+		q.Del("Signature")
+		require.Equal(t, signRPCRequest(http.MethodGet, q, "secret"), signature)
+
+		_, _ = w.Write([]byte(`{"Credentials": {"AccessKeyId": "STS.id", "AccessKeySecret": "sts-secret",
+			"SecurityToken": "token", "Expiration": "2026-01-01T12:00:00Z"}}`))
+	}))
+	defer srv.Close()
+
+	bc := &BackendConfig{
+		AccessKeyID: "id", AccessKeySecret: "secret", STSEndpoint: srv.URL,
+		RoleARN: "acs:ram::123456:role/nydus", RoleDurationSec: 3600,
+	}
+	cred, err := assumeRole(bc)
+	require.NoError(t, err)
+	require.Equal(t, &stsCredential{
+		AccessKeyID: "STS.id", AccessKeySecret: "sts-secret", SecurityToken: "token",
+		Expiration: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	}, cred)
+
+	bc.RoleARN = "acs:ram::123456:role/other"
+	_, err = assumeRole(bc)
+	require.ErrorContains(t, err, "NoPermission not allowed")
+
+	require.Equal(t, "a%20b%2Ac~%2F", percentEncode("a b*c~/"))
+}
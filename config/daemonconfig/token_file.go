@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A bearer token read from a file, and the modification time of the file when it was read.
+type fileToken struct {
+	token   string
+	modTime time.Time
+}
+
+var (
+	fileTokensLock sync.Mutex
+	// Keyed by the path of the token file.
+	fileTokens = map[string]fileToken{}
+)
+
+// readTokenFile returns the bearer token in the file at path, read again only once the
+// file has changed, e.g. when kubelet rotates a projected service account token.
+func readTokenFile(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrap(err, "stat token file")
+	}
+
+	fileTokensLock.Lock()
+	defer fileTokensLock.Unlock()
+	if t, ok := fileTokens[path]; ok && t.modTime.Equal(fi.ModTime()) {
+		return t.token, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "read token file")
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", errors.Errorf("token file %s is empty", path)
+	}
+	fileTokens[path] = fileToken{token: token, modTime: fi.ModTime()}
+	return token, nil
+}
+
+// NextTokenFileRefresh returns when the earliest token file handed out so far has changed,
+// false if none has. Tokens of removed files are forgotten.
+func NextTokenFileRefresh() (time.Time, bool) {
+	fileTokensLock.Lock()
+	defer fileTokensLock.Unlock()
+
+	var next time.Time
+	for path, t := range fileTokens {
+		fi, err := os.Stat(path)
+		if err != nil {
+			delete(fileTokens, path)
+			continue
+		}
+		if m := fi.ModTime(); !m.Equal(t.modTime) && (next.IsZero() || m.Before(next)) {
+			next = m
+		}
+	}
+	return next, !next.IsZero()
+}
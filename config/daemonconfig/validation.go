@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2020. Ant Group. All rights reserved.
+ * Copyright (c) 2022. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+)
+
+// Validate checks the backend configuration for values nydusd would reject.
+// Suspicious but acceptable combinations are only logged.
+func (c *BackendConfig) Validate() error {
+	if errs := c.validationErrors(); len(errs) > 0 {
+		return errs[0]
+	}
+
+	for _, w := range c.warnings() {
+		log.L.Warn(w)
+	}
+
+	return nil
+}
+
+// validationErrors returns all the problems Validate would reject, in order.
+func (c *BackendConfig) validationErrors() []error {
+	var errs []error
+	if c.KeepAliveSec < 0 {
+		errs = append(errs, errors.Errorf("invalid keep_alive_sec %d, must not be negative", c.KeepAliveSec))
+	}
+	if c.IdleTimeoutSec < 0 {
+		errs = append(errs, errors.Errorf("invalid idle_timeout_sec %d, must not be negative", c.IdleTimeoutSec))
+	}
+	if c.MaxBandwidthBytesPerSec < 0 {
+		errs = append(errs, errors.Errorf("invalid max_bandwidth_bytes_per_sec %d, must not be negative", c.MaxBandwidthBytesPerSec))
+	}
+	if c.MaxBandwidthBurstBytes < 0 {
+		errs = append(errs, errors.Errorf("invalid max_bandwidth_burst_bytes %d, must not be negative", c.MaxBandwidthBurstBytes))
+	} else if c.MaxBandwidthBurstBytes > 0 && c.MaxBandwidthBytesPerSec == 0 {
+		errs = append(errs, &MissingFieldError{Field: "max_bandwidth_bytes_per_sec", RequiredBy: "max_bandwidth_burst_bytes"})
+	}
+	if c.MaxConcurrencyPerBlob < 0 {
+		errs = append(errs, errors.Errorf("invalid max_concurrency_per_blob %d, must not be negative", c.MaxConcurrencyPerBlob))
+	}
+	if c.SSEType == sseTypeKMS && c.SSEKMSKeyID == "" {
+		errs = append(errs, &MissingFieldError{Field: "sse_kms_key_id", RequiredBy: fmt.Sprintf("sse_type %q", c.SSEType)})
+	}
+	if c.AuthScheme != "" && c.AuthScheme != authSchemeBasic && c.AuthScheme != authSchemeBearer {
+		errs = append(errs, errors.Errorf("invalid auth_scheme %q, must be %s or %s", c.AuthScheme, authSchemeBasic, authSchemeBearer))
+	}
+	if c.TokenURL != "" {
+		if u, err := url.Parse(c.TokenURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.Errorf("invalid token_url %q, must be an http(s) URL", c.TokenURL))
+		}
+	}
+	if c.MetadataProxy != "" {
+		if u, err := url.Parse(c.MetadataProxy); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.Errorf("invalid metadata_proxy %q, must be an http(s) URL", c.MetadataProxy))
+		}
+	}
+	if c.MetadataURL != "" {
+		if u, err := url.Parse(c.MetadataURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.Errorf("invalid metadata_url %q, must be an http(s) URL", c.MetadataURL))
+		}
+	}
+	if strings.ContainsAny(tokenScopePlaceholders.Replace(c.TokenScope), "{}") {
+		errs = append(errs, errors.Errorf("invalid token_scope %q, only {host} and {repo} can be substituted", c.TokenScope))
+	}
+	if c.PresignExpirySec < 0 {
+		errs = append(errs, errors.Errorf("invalid presign_expiry_sec %d, must be positive", c.PresignExpirySec))
+	}
+	for _, e := range c.endpoints() {
+		if !isValidEndpoint(e) {
+			errs = append(errs, errors.Errorf("invalid endpoint %q, must be a host or an http(s) URL", e))
+		}
+	}
+	if c.SessionToken != "" && (c.AccessKeyID == "" || c.AccessKeySecret == "") {
+		errs = append(errs, &MissingFieldError{Field: "access_key_id and access_key_secret", RequiredBy: "session_token"})
+	}
+	if c.RoleARN != "" {
+		if !strings.HasPrefix(c.RoleARN, "acs:ram::") {
+			errs = append(errs, errors.Errorf("invalid role_arn %q, must be like acs:ram::<account>:role/<name>", c.RoleARN))
+		}
+		if c.AccessKeyID == "" || c.AccessKeySecret == "" {
+			errs = append(errs, &MissingFieldError{Field: "access_key_id and access_key_secret", RequiredBy: "role_arn"})
+		}
+		if c.SessionToken != "" {
+			errs = append(errs, errors.New("session_token conflicts with role_arn"))
+		}
+	}
+	if c.RoleDurationSec != 0 && (c.RoleDurationSec < 900 || c.RoleDurationSec > 43200) {
+		errs = append(errs, errors.Errorf("invalid role_duration_sec %d, must be between 900 and 43200", c.RoleDurationSec))
+	}
+	if c.STSEndpoint != "" && !isValidEndpoint(c.STSEndpoint) {
+		errs = append(errs, errors.Errorf("invalid sts_endpoint %q, must be a host or an http(s) URL", c.STSEndpoint))
+	}
+	if c.SASToken != "" && c.ManagedIdentity {
+		errs = append(errs, errors.New("sas_token conflicts with managed_identity"))
+	}
+	if c.ManagedIdentityClientID != "" && !c.ManagedIdentity {
+		errs = append(errs, &MissingFieldError{Field: "managed_identity", RequiredBy: "managed_identity_client_id"})
+	}
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.Errorf("invalid base_url %q, must be an http(s) URL", c.BaseURL))
+		}
+	}
+	if c.GatewayURL != "" {
+		if u, err := url.Parse(c.GatewayURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.Errorf("invalid gateway_url %q, must be an http(s) URL", c.GatewayURL))
+		}
+	}
+	if c.APISocket != "" && !filepath.IsAbs(c.APISocket) {
+		errs = append(errs, errors.Errorf("invalid api_socket %q, must be an absolute path", c.APISocket))
+	}
+	if c.Password != "" && c.Username == "" {
+		errs = append(errs, &MissingFieldError{Field: "username", RequiredBy: "password"})
+	}
+	if c.Proxy.Password != "" && c.Proxy.Username == "" {
+		errs = append(errs, &MissingFieldError{Field: "proxy username", RequiredBy: "proxy password"})
+	}
+	for _, h := range c.Proxy.NoProxy {
+		if h == "" || strings.ContainsAny(h, ", \t") {
+			errs = append(errs, errors.Errorf("invalid no_proxy entry %q", h))
+		}
+	}
+	for _, f := range []struct{ name, path string }{{"ca_file", c.CAFile}, {"cert_file", c.CertFile}, {"key_file", c.KeyFile}} {
+		if f.path != "" && !filepath.IsAbs(f.path) {
+			errs = append(errs, errors.Errorf("invalid %s %q, must be an absolute path", f.name, f.path))
+		}
+	}
+	if c.CertFile != "" && c.KeyFile == "" {
+		errs = append(errs, &MissingFieldError{Field: "key_file", RequiredBy: "cert_file"})
+	}
+	if c.KeyFile != "" && c.CertFile == "" {
+		errs = append(errs, &MissingFieldError{Field: "cert_file", RequiredBy: "key_file"})
+	}
+	if c.MetadataCertFile != "" && c.MetadataKeyFile == "" {
+		errs = append(errs, &MissingFieldError{Field: "metadata_key_file", RequiredBy: "metadata_cert_file"})
+	}
+	if c.MetadataKeyFile != "" && c.MetadataCertFile == "" {
+		errs = append(errs, &MissingFieldError{Field: "metadata_cert_file", RequiredBy: "metadata_key_file"})
+	}
+	for name := range c.Headers {
+		if name == "" || strings.ContainsAny(name, " \t:\r\n") {
+			errs = append(errs, errors.Errorf("invalid header name %q", name))
+		}
+	}
+	if c.CredentialsFile != "" && c.WorkloadIdentity {
+		errs = append(errs, errors.New("credentials_file conflicts with workload_identity"))
+	}
+	if c.Anonymous && (c.Password != "" || c.CredentialsFile != "" || c.WorkloadIdentity || c.AccessKeyID != "" || c.AccessKeySecret != "" || c.SessionToken != "" || c.SASToken != "" ||
+		c.ManagedIdentity || c.Auth != "" || c.RegistryToken != "") {
+		errs = append(errs, errors.New("anonymous access conflicts with the configured credentials"))
+	}
+	if c.PopulateFromRegistry && c.Dir == "" {
+		errs = append(errs, &MissingFieldError{Field: "dir", RequiredBy: "populate_from_registry"})
+	}
+	if c.PopulateFromRegistry && c.BlobFile != "" {
+		errs = append(errs, errors.New("blob_file conflicts with populate_from_registry"))
+	}
+	if c.PopulateConcurrency < 0 {
+		errs = append(errs, errors.Errorf("invalid populate_concurrency %d, must not be negative", c.PopulateConcurrency))
+	}
+	return errs
+}
+
+func isValidEndpoint(e string) bool {
+	if !strings.Contains(e, "://") {
+		e = "https://" + e
+	}
+	u, err := url.Parse(e)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return false
+		}
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") &&
+		strings.Trim(u.Path, "/") == "" && u.RawQuery == "" && u.User == nil
+}
+
+func (c *BackendConfig) warnings() []string {
+	var warnings []string
+	if c.IdleTimeoutSec > 0 && c.IdleTimeoutSec < c.KeepAliveSec {
+		warnings = append(warnings, fmt.Sprintf("idle_timeout_sec %d is shorter than keep_alive_sec %d, "+
+			"idle connections may be dropped before being kept alive", c.IdleTimeoutSec, c.KeepAliveSec))
+	}
+	if c.PresignExpirySec > maxPresignExpirySec {
+		warnings = append(warnings, fmt.Sprintf("presign_expiry_sec %d exceeds the maximum of %d accepted by S3, "+
+			"presigned URLs may be rejected", c.PresignExpirySec, maxPresignExpirySec))
+	}
+	if c.SkipVerify && c.CAFile != "" {
+		warnings = append(warnings, "skip_verify disables the verification against ca_file")
+	}
+	return warnings
+}
+
+// validateCacheOnly checks that a configuration without backend has a cache to serve blobs from.
+func validateCacheOnly(backendType StorageBackendType, workDir string) error {
+	if backendType == backendTypeNone && workDir == "" {
+		return errors.Errorf("cache work_dir is required by backend type %q", backendType)
+	}
+	return nil
+}
+
+// validateFallbacks validates the fallback backends of a configuration.
+func validateFallbacks(fallback *FallbackBackend, fallbacks []FallbackBackend) error {
+	if fallback != nil {
+		if err := fallback.validate(); err != nil {
+			return err
+		}
+	}
+	for i := range fallbacks {
+		if err := fallbacks[i].validate(); err != nil {
+			return errors.Wrapf(err, "fallback_backends[%d]", i)
+		}
+	}
+	return nil
+}
+
+// validate checks the fallback backend and normalizes its type.
+func (fb *FallbackBackend) validate() error {
+	backendType, err := ParseStorageBackendType(fb.BackendType.String())
+	if err != nil {
+		return errors.Wrap(err, "invalid fallback backend")
+	}
+	if backendType == backendTypeNone {
+		return errors.Errorf("invalid fallback backend type %q", backendType)
+	}
+	fb.BackendType = backendType
+	if err := fb.Config.Validate(); err != nil {
+		return errors.Wrap(err, "validate fallback backend config")
+	}
+	fb.Config.applyEndpoints()
+	return nil
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+)
+
+// VaultSignerName is the signer name backends refer to for credentials from Vault.
+const VaultSignerName = "vault"
+
+const (
+	defaultVaultJWTFile         = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	defaultVaultRefreshInterval = time.Hour
+	// Vault tokens are replaced this long before they expire.
+	vaultTokenRefreshMargin = time.Minute
+	vaultRequestTimeout     = 10 * time.Second
+)
+
+// VaultSigner is a RequestSigner reading the credentials of backends from HashiCorp Vault,
+// so that they are kept out of configuration templates. It logs in with the AppRole or
+// Kubernetes auth method and reads the secret of the backend, whose keys are put into the
+// backend configuration:
+//   - "username" and "password", or "auth", as registry basic auth
+//   - "token" as registry token
+//   - "access_key_id", "access_key_secret" and "session_token" as object storage keys,
+//     also named "access_key", "secret_key" and "security_token" by the AWS secrets engine
+//
+// The credentials are read again before their lease expires, or after the refresh interval
+// for secrets without lease.
+type VaultSigner struct {
+	cfg    config.VaultConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	token string
+	// Zero for tokens which don't expire, like root tokens
+	tokenExpiry time.Time
+}
+
+// NewVaultSigner creates a signer reading secrets from the Vault of cfg.
+func NewVaultSigner(cfg config.VaultConfig) (*VaultSigner, error) {
+	if cfg.AuthMount == "" {
+		cfg.AuthMount = cfg.AuthMethod
+	}
+	if cfg.JWTFile == "" {
+		cfg.JWTFile = defaultVaultJWTFile
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultVaultRefreshInterval
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read vault CA bundle")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in %s", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &VaultSigner{
+		cfg:    cfg,
+		client: &http.Client{Timeout: vaultRequestTimeout, Transport: transport},
+	}, nil
+}
+
+func (s *VaultSigner) Sign(ctx context.Context, req SignRequest) (*SigningMaterial, error) {
+	token, err := s.login(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "log in to vault")
+	}
+
+	path := s.secretPath(req)
+	var secret struct {
+		LeaseDuration int                    `json:"lease_duration"`
+		Data          map[string]interface{} `json:"data"`
+	}
+	if err := s.do(ctx, http.MethodGet, path, token, nil, &secret); err != nil {
+		return nil, errors.Wrapf(err, "read secret %s", path)
+	}
+	data := secret.Data
+	// The KV version 2 engine returns the secret along with its metadata.
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	m, err := signingMaterialOf(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "secret %s", path)
+	}
+	if secret.LeaseDuration > 0 {
+		m.Expiration = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+	} else {
+		// Material is replaced signingRefreshMargin before it expires.
+		m.Expiration = time.Now().Add(s.cfg.RefreshInterval + signingRefreshMargin)
+	}
+	return m, nil
+}
+
+func signingMaterialOf(data map[string]interface{}) (*SigningMaterial, error) {
+	get := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := data[k].(string); ok && v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	m := &SigningMaterial{
+		Auth:            get("auth"),
+		RegistryToken:   get("token", "registry_token"),
+		AccessKeyID:     get("access_key_id", "access_key"),
+		AccessKeySecret: get("access_key_secret", "secret_key"),
+		SessionToken:    get("session_token", "security_token"),
+	}
+	if username, password := get("username"), get("password"); username != "" || password != "" {
+		m.Auth = auth.PassKeyChain{Username: username, Password: password}.ToBase64()
+	}
+	if m.Auth == "" && m.RegistryToken == "" && m.AccessKeyID == "" {
+		return nil, errors.New("no credential found")
+	}
+	return m, nil
+}
+
+func (s *VaultSigner) secretPath(req SignRequest) string {
+	return strings.NewReplacer(
+		"{backend_type}", req.BackendType,
+		"{host}", req.Host,
+		"{repo}", req.Repo,
+		"{bucket}", req.BucketName,
+	).Replace(strings.Trim(s.cfg.SecretPath, "/"))
+}
+
+// login returns a Vault token, logging in again once the last one is about to expire.
+func (s *VaultSigner) login(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && (s.tokenExpiry.IsZero() || time.Until(s.tokenExpiry) > vaultTokenRefreshMargin) {
+		return s.token, nil
+	}
+
+	var body map[string]string
+	switch s.cfg.AuthMethod {
+	case "approle":
+		secretID, err := os.ReadFile(s.cfg.SecretIDFile)
+		if err != nil {
+			return "", errors.Wrap(err, "read secret ID")
+		}
+		body = map[string]string{"role_id": s.cfg.RoleID, "secret_id": strings.TrimSpace(string(secretID))}
+	case "kubernetes":
+		jwt, err := os.ReadFile(s.cfg.JWTFile)
+		if err != nil {
+			return "", errors.Wrap(err, "read service account token")
+		}
+		body = map[string]string{"role": s.cfg.Role, "jwt": strings.TrimSpace(string(jwt))}
+	default:
+		return "", errors.Errorf("unsupported auth method %q", s.cfg.AuthMethod)
+	}
+
+	var result struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := s.do(ctx, http.MethodPost, "auth/"+strings.Trim(s.cfg.AuthMount, "/")+"/login", "", body, &result); err != nil {
+		return "", err
+	}
+	if result.Auth.ClientToken == "" {
+		return "", errors.New("vault returned no client token")
+	}
+	s.token = result.Auth.ClientToken
+	s.tokenExpiry = time.Time{}
+	if result.Auth.LeaseDuration > 0 {
+		s.tokenExpiry = time.Now().Add(time.Duration(result.Auth.LeaseDuration) * time.Second)
+	}
+	return s.token, nil
+}
+
+func (s *VaultSigner) do(ctx context.Context, method, path, token string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.cfg.Address, "/")+"/v1/"+path, reader)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if s.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.cfg.Namespace)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errors.Wrap(err, "read vault response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusForbidden && token != "" {
+			// The token may have been revoked, log in again next time.
+			s.mu.Lock()
+			if s.token == token {
+				s.token = ""
+			}
+			s.mu.Unlock()
+		}
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(b, &e)
+		return errors.Errorf("vault responded with status %d: %s", resp.StatusCode, strings.Join(e.Errors, "; "))
+	}
+	return errors.Wrap(json.Unmarshal(b, result), "decode vault response")
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestVaultSigner(t *testing.T) {
+	var logins int
+	leaseDuration := 3600
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, map[string]string{"role_id": "nydus", "secret_id": "s3cret"}, body)
+			logins++
+			fmt.Fprintf(w, `{"auth": {"client_token": "vault-token", "lease_duration": %d}}`, leaseDuration)
+		case "/v1/secret/data/nydus/registry/registry.example.com":
+			require.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+			require.Equal(t, "team", r.Header.Get("X-Vault-Namespace"))
+			_, _ = io.WriteString(w, `{"data": {"data": {"username": "user", "password": "pass"}, "metadata": {"version": 2}}}`)
+		case "/v1/secret/data/nydus/s3/s3.example.com":
+			_, _ = io.WriteString(w, `{"lease_duration": 900, "data": {"access_key": "id", "secret_key": "key", "security_token": "session"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"errors": []}`)
+		}
+	}))
+	defer vault.Close()
+
+	secretIDFile := filepath.Join(t.TempDir(), "secret-id")
+	require.NoError(t, os.WriteFile(secretIDFile, []byte("s3cret\n"), 0600))
+	s, err := NewVaultSigner(config.VaultConfig{
+		Address:      vault.URL,
+		Namespace:    "team",
+		AuthMethod:   "approle",
+		RoleID:       "nydus",
+		SecretIDFile: secretIDFile,
+		SecretPath:   "secret/data/nydus/{backend_type}/{host}",
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	m, err := s.Sign(ctx, SignRequest{BackendType: "registry", Host: "registry.example.com", Repo: "app"})
+	require.NoError(t, err)
+	require.Equal(t, "dXNlcjpwYXNz", m.Auth)
+	require.WithinDuration(t, time.Now().Add(defaultVaultRefreshInterval+signingRefreshMargin), m.Expiration, time.Minute)
+
+	m, err = s.Sign(ctx, SignRequest{BackendType: "s3", Host: "s3.example.com", BucketName: "images"})
+	require.NoError(t, err)
+	require.Equal(t, &SigningMaterial{AccessKeyID: "id", AccessKeySecret: "key", SessionToken: "session", Expiration: m.Expiration}, m)
+	require.WithinDuration(t, time.Now().Add(15*time.Minute), m.Expiration, time.Minute)
+	require.Equal(t, 1, logins)
+
+	_, err = s.Sign(ctx, SignRequest{BackendType: "oss", Host: "oss.example.com"})
+	require.ErrorContains(t, err, "status 404")
+
+	// Tokens without lease don't expire and are kept.
+	leaseDuration = 0
+	s.token = ""
+	for i := 0; i < 2; i++ {
+		_, err = s.login(ctx)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, logins)
+}
@@ -12,10 +12,13 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/containerd/log"
 	"github.com/containerd/nydus-snapshotter/internal/logging"
 	"github.com/containerd/nydus-snapshotter/pkg/utils/mount"
+	"github.com/distribution/reference"
 	"github.com/pkg/errors"
 )
 
@@ -35,6 +38,16 @@ type GlobalConfig struct {
 	RootMountpoint   string
 	DaemonThreadsNum int
 	MirrorsConfig    MirrorsConfig
+	ThrottleConfig   ThrottleConfig
+	ProxyConfig      ProxyConfig
+	PrefetchConfig   PrefetchConfig
+	// Set by RemoteConfig.CacheOnlyOnOutage
+	CacheOnlyOnOutage   bool
+	MetadataCacheConfig MetadataCacheConfig
+	ClientCerts         map[string]ClientCertConfig
+	TokenFiles          map[string]string
+	SpiffeHosts         []string
+	Rewrites            []RewriteRule
 }
 
 func IsFusedevSharedModeEnabled() bool {
@@ -65,6 +78,103 @@ func GetMirrorsConfigDir() string {
 	return globalConfig.MirrorsConfig.Dir
 }
 
+func GetMirrorsConfig() MirrorsConfig {
+	return globalConfig.MirrorsConfig
+}
+
+func GetThrottleConfig() ThrottleConfig {
+	return globalConfig.ThrottleConfig
+}
+
+func GetProxyConfig() ProxyConfig {
+	return globalConfig.ProxyConfig
+}
+
+func GetPrefetchConfig() PrefetchConfig {
+	return globalConfig.PrefetchConfig
+}
+
+func GetCacheOnlyOnOutage() bool {
+	return globalConfig.CacheOnlyOnOutage
+}
+
+func GetMetadataCacheConfig() MetadataCacheConfig {
+	return globalConfig.MetadataCacheConfig
+}
+
+// GetClientCert returns the client certificate configured for the registry host.
+func GetClientCert(host string) (ClientCertConfig, bool) {
+	cert, ok := globalConfig.ClientCerts[host]
+	return cert, ok
+}
+
+// GetTokenFile returns the bearer token file configured for the most specific repository
+// path prefix of repo on host, e.g. "registry.example.com/team", or else for the host.
+func GetTokenFile(host, repo string) (string, bool) {
+	for repo != "" {
+		if path, ok := globalConfig.TokenFiles[host+"/"+repo]; ok {
+			return path, true
+		}
+		i := strings.LastIndex(repo, "/")
+		if i < 0 {
+			break
+		}
+		repo = repo[:i]
+	}
+	path, ok := globalConfig.TokenFiles[host]
+	return path, ok
+}
+
+// RewriteImage returns the registry host and repository the image named host/repo is fetched
+// as by the first matching rewrite rule, false if none matches.
+func RewriteImage(host, repo string) (string, string, bool) {
+	name := host + "/" + repo
+	for _, r := range globalConfig.Rewrites {
+		var rewritten string
+		if prefix, ok := strings.CutSuffix(r.From, "*"); ok {
+			rest, ok := strings.CutPrefix(name, prefix)
+			if !ok || rest == "" {
+				continue
+			}
+			rewritten = strings.TrimSuffix(r.To, "*") + rest
+		} else if name == r.From {
+			rewritten = r.To
+		} else {
+			continue
+		}
+		newHost, newRepo, _ := strings.Cut(rewritten, "/")
+		return newHost, newRepo, true
+	}
+	return host, repo, false
+}
+
+// RewriteImageRef returns the reference the image is fetched by according to the rewrite rules,
+// keeping its tag and digest, false if no rule matches.
+func RewriteImageRef(imageID string) (string, bool) {
+	named, err := reference.ParseDockerRef(imageID)
+	if err != nil {
+		return imageID, false
+	}
+	host, repo, ok := RewriteImage(reference.Domain(named), reference.Path(named))
+	if !ok {
+		return imageID, false
+	}
+	ref := host + "/" + repo
+	if tagged, ok := named.(reference.Tagged); ok {
+		ref += ":" + tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		ref += "@" + digested.Digest().String()
+	}
+	return ref, true
+}
+
+// IsSpiffeHost tells whether nydusd presents the X.509 SVID of the snapshotter to the
+// registry host.
+func IsSpiffeHost(host string) bool {
+	return slices.Contains(globalConfig.SpiffeHosts, host)
+}
+
 func GetFsDriver() string {
 	return globalConfig.origin.DaemonConfig.FsDriver
 }
@@ -177,6 +287,19 @@ func ProcessConfigurations(c *SnapshotterConfig) error {
 	globalConfig.RootMountpoint = filepath.Join(c.Root, "mnt")
 
 	globalConfig.MirrorsConfig = c.RemoteConfig.MirrorsConfig
+	globalConfig.ThrottleConfig = c.RemoteConfig.ThrottleConfig
+	globalConfig.ProxyConfig = c.RemoteConfig.ProxyConfig
+	globalConfig.PrefetchConfig = c.RemoteConfig.PrefetchConfig
+	globalConfig.CacheOnlyOnOutage = c.RemoteConfig.CacheOnlyOnOutage
+	globalConfig.MetadataCacheConfig = c.RemoteConfig.MetadataCacheConfig
+	globalConfig.ClientCerts = c.RemoteConfig.AuthConfig.ClientCerts
+	globalConfig.TokenFiles = c.RemoteConfig.AuthConfig.TokenFiles
+	globalConfig.Rewrites = c.RemoteConfig.Rewrites
+	if c.RemoteConfig.SpiffeConfig.WorkloadAPISocket != "" {
+		globalConfig.SpiffeHosts = c.RemoteConfig.SpiffeConfig.Hosts
+	} else {
+		globalConfig.SpiffeHosts = nil
+	}
 
 	m, err := parseDaemonMode(c.DaemonMode)
 	if err != nil {
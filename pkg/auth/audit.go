@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+)
+
+const (
+	// Source of images pulled without credential.
+	SourceAnonymous = "anonymous"
+	// Source of bearer tokens read from the token files of registries.
+	SourceTokenFile = "token-file"
+	// Source of credentials of Kubernetes secrets, scoped to the namespace of the pod.
+	sourceKubeSecret = "kubesecret"
+
+	// Number of credential uses kept for the audit trail.
+	auditTrailSize = 1024
+	// Lookups of the same credential for an image within this window, e.g. for each of
+	// its layers, are recorded as a single use.
+	auditMergeWindow = time.Minute
+)
+
+// CredentialUse is an entry of the audit trail, telling which credential source an image
+// was pulled with.
+type CredentialUse struct {
+	Ref string `json:"ref"`
+	// The provider which resolved the credential, e.g. "labels", "kubesecret" or
+	// "credential-helper", SourceTokenFile or SourceAnonymous.
+	Source string `json:"source"`
+	// Whether the credential was served from the keychain cache or the renewal store
+	// rather than asking the provider.
+	Cached    bool      `json:"cached"`
+	FirstUsed time.Time `json:"first_used"`
+	LastUsed  time.Time `json:"last_used"`
+	// Number of lookups merged into the entry
+	Count int `json:"count"`
+}
+
+var credentialAudit = newAuditTrail(auditTrailSize)
+
+// auditTrail keeps the latest credential uses, oldest first.
+type auditTrail struct {
+	mu      sync.Mutex
+	size    int
+	entries []CredentialUse
+	// Providers which resolved the credentials now cached, by image ref.
+	sources map[string]string
+}
+
+func newAuditTrail(size int) *auditTrail {
+	return &auditTrail{size: size, sources: make(map[string]string)}
+}
+
+// RecordCredentialUse adds the use of a credential of source to pull ref to the audit trail,
+// for sources outside the providers, like SourceTokenFile.
+func RecordCredentialUse(ref, source string) {
+	credentialAudit.record(ref, source, false)
+}
+
+// CredentialAudit returns the audit trail of credential uses, oldest first, only of the
+// image ref if not empty.
+func CredentialAudit(ref string) []CredentialUse {
+	return credentialAudit.list(ref)
+}
+
+func (a *auditTrail) record(ref, source string, cached bool) {
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if cached {
+		if s, ok := a.sources[ref]; ok {
+			source = s
+		}
+	} else {
+		a.sources[ref] = source
+	}
+
+	for i := len(a.entries) - 1; i >= 0; i-- {
+		e := &a.entries[i]
+		if now.Sub(e.LastUsed) > auditMergeWindow {
+			break
+		}
+		if e.Ref == ref {
+			if e.Source == source && e.Cached == cached {
+				e.LastUsed = now
+				e.Count++
+				return
+			}
+			break
+		}
+	}
+
+	if len(a.entries) == a.size {
+		dropped := a.entries[0].Ref
+		a.entries = a.entries[1:]
+		if !a.hasRef(dropped) {
+			delete(a.sources, dropped)
+		}
+	}
+	a.entries = append(a.entries, CredentialUse{
+		Ref: ref, Source: source, Cached: cached, FirstUsed: now, LastUsed: now, Count: 1,
+	})
+	log.L.WithFields(log.Fields{
+		"audit":  "credential",
+		"ref":    ref,
+		"source": source,
+		"cached": cached,
+	}).Info("credential used for image pull")
+}
+
+func (a *auditTrail) hasRef(ref string) bool {
+	for _, e := range a.entries {
+		if e.Ref == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *auditTrail) list(ref string) []CredentialUse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]CredentialUse, 0, len(a.entries))
+	for _, e := range a.entries {
+		if ref == "" || e.Ref == ref {
+			result = append(result, e)
+		}
+	}
+	return result
+}
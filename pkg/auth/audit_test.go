@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialAudit(t *testing.T) {
+	oldAudit, oldCache, oldStore := credentialAudit, keyChainCache, renewalStore
+	defer func() { credentialAudit, keyChainCache, renewalStore = oldAudit, oldCache, oldStore }()
+	credentialAudit = newAuditTrail(3)
+	keyChainCache = newKeyChainCacheStore(time.Hour)
+	renewalStore = nil
+
+	const ref = "registry.example.com/app:latest"
+	providers := []AuthProvider{&mockProvider{creds: &PassKeyChain{Username: "user", Password: "pass"}}}
+	// Lookups for each layer are merged.
+	require.NotNil(t, getRegistryKeyChainFromProviders(ref, nil, providers))
+	require.NotNil(t, getRegistryKeyChainFromProviders(ref, nil, providers))
+	require.NotNil(t, getRegistryKeyChainFromProviders(ref, nil, providers))
+
+	uses := CredentialAudit(ref)
+	require.Len(t, uses, 2)
+	require.Equal(t, "mockProvider", uses[0].Source)
+	require.False(t, uses[0].Cached)
+	require.Equal(t, 1, uses[0].Count)
+	// Cached credentials keep the source of their provider.
+	require.Equal(t, "mockProvider", uses[1].Source)
+	require.True(t, uses[1].Cached)
+	require.Equal(t, 2, uses[1].Count)
+
+	require.Nil(t, getRegistryKeyChainFromProviders("registry.example.com/public:latest", nil, []AuthProvider{&mockProvider{}}))
+	RecordCredentialUse("registry.internal/app:latest", SourceTokenFile)
+
+	// The oldest uses are dropped.
+	uses = CredentialAudit("")
+	require.Len(t, uses, 3)
+	require.Equal(t, ref, uses[0].Ref)
+	require.True(t, uses[0].Cached)
+	require.Equal(t, SourceAnonymous, uses[1].Source)
+	require.Equal(t, SourceTokenFile, uses[2].Source)
+	require.Empty(t, CredentialAudit("other.example.com/app:latest"))
+}
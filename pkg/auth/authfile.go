@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containerd/log"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+var (
+	authFileProvider   *AuthFileProvider
+	authFileProviderMu sync.Mutex
+)
+
+// HostAuth is the credential and client certificate of a registry host in the auth file.
+type HostAuth struct {
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Registry token, used instead of username and password
+	Token    string `toml:"token"`
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+}
+
+func (a HostAuth) validate() error {
+	if a.Token != "" && (a.Username != "" || a.Password != "") {
+		return errors.New("token can't be set along with username and password")
+	}
+	if (a.CertFile == "") != (a.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+	if a.CertFile != "" && (!filepath.IsAbs(a.CertFile) || !filepath.IsAbs(a.KeyFile)) {
+		return errors.New("cert_file and key_file must be absolute paths")
+	}
+	return nil
+}
+
+// AuthFileProvider serves the credentials of the auth file, which lists them by registry
+// host like the hosts.toml files of containerd, or by repository path prefix for tenants
+// sharing a registry:
+//
+//	[host."registry.example.com"]
+//	username = "user"
+//	password = "pass"
+//
+//	[host."registry.example.com/team-a"]
+//	username = "team-a"
+//	password = "pass"
+//
+//	[host."registry.internal:5000"]
+//	token = "token"
+//	cert_file = "/etc/nydus/certs/client.crt"
+//	key_file = "/etc/nydus/certs/client.key"
+type AuthFileProvider struct {
+	path string
+
+	mu    sync.RWMutex
+	hosts map[string]HostAuth
+}
+
+// InitAuthFileProvider initializes the global auth file provider with the file at path.
+// This should be called once at startup if an auth file is configured.
+func InitAuthFileProvider(path string) error {
+	authFileProviderMu.Lock()
+	defer authFileProviderMu.Unlock()
+
+	if authFileProvider != nil {
+		return nil
+	}
+
+	provider, err := NewAuthFileProvider(path)
+	if err != nil {
+		return err
+	}
+	authFileProvider = provider
+	log.L.WithField("path", path).Info("auth file provider initialized")
+	return nil
+}
+
+// NewAuthFileProvider creates a provider serving the credentials of the auth file at path.
+func NewAuthFileProvider(path string) (*AuthFileProvider, error) {
+	p := &AuthFileProvider{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReloadAuthFile reads the auth file again and drops the cached credentials, so that they
+// are looked up again. The previous credentials are kept if the file is invalid.
+func ReloadAuthFile() error {
+	authFileProviderMu.Lock()
+	p := authFileProvider
+	authFileProviderMu.Unlock()
+
+	if p == nil {
+		return nil
+	}
+	if err := p.Reload(); err != nil {
+		return err
+	}
+	InvalidateKeyChains("")
+	return nil
+}
+
+// GetAuthFileClientCert returns the client certificate and key of the registry host in the
+// auth file, if any.
+func GetAuthFileClientCert(host string) (string, string, bool) {
+	authFileProviderMu.Lock()
+	p := authFileProvider
+	authFileProviderMu.Unlock()
+
+	if p == nil {
+		return "", "", false
+	}
+	a, ok := p.hostAuth(host)
+	if !ok || a.CertFile == "" {
+		return "", "", false
+	}
+	return a.CertFile, a.KeyFile, true
+}
+
+// Reload reads the auth file again. The previous content is kept if the file is invalid.
+func (p *AuthFileProvider) Reload() error {
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return errors.Wrap(err, "read auth file")
+	}
+	var file struct {
+		Host map[string]HostAuth `toml:"host"`
+	}
+	if err := toml.Unmarshal(b, &file); err != nil {
+		return errors.Wrapf(err, "parse auth file %s", p.path)
+	}
+	for host, a := range file.Host {
+		if err := a.validate(); err != nil {
+			return errors.Wrapf(err, "auth of %s in %s", host, p.path)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hosts = file.Host
+	return nil
+}
+
+func (p *AuthFileProvider) hostAuth(key string) (HostAuth, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	a, ok := p.hosts[key]
+	if !ok && key == convertedDockerHost {
+		a, ok = p.hosts["docker.io"]
+	}
+	return a, ok
+}
+
+// CanRenew implements RenewableProvider. Renewal sees the credentials of the file as last
+// reloaded.
+func (p *AuthFileProvider) CanRenew() bool { return true }
+
+func (p *AuthFileProvider) String() string {
+	return "auth-file"
+}
+
+// GetCredentials returns the credential of the most specific repository path prefix of the
+// image, or of its registry host, in the auth file.
+func (p *AuthFileProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error) {
+	if req == nil || req.Ref == "" {
+		return nil, errors.New("ref not found in request")
+	}
+
+	_, keys, err := scopedKeys(req.Ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse reference %s", req.Ref)
+	}
+
+	for _, k := range keys {
+		a, ok := p.hostAuth(k.key)
+		switch {
+		case !ok:
+			continue
+		case a.Token != "":
+			return &PassKeyChain{Password: a.Token, Scope: k.scope}, nil
+		case a.Username != "" || a.Password != "":
+			return &PassKeyChain{Username: a.Username, Password: a.Password, Scope: k.scope}, nil
+		}
+		// Only a client certificate is configured for the key.
+	}
+	return nil, nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[host."registry.example.com"]
+username = "user"
+password = "pass"
+
+[host."registry.internal:5000"]
+token = "token"
+cert_file = "/etc/nydus/certs/client.crt"
+key_file = "/etc/nydus/certs/client.key"
+
+[host."docker.io"]
+username = "hub"
+password = "secret"
+
+[host."registry.example.com/team-a"]
+username = "team-a"
+password = "pass"
+`), 0600))
+
+	p, err := NewAuthFileProvider(path)
+	require.NoError(t, err)
+
+	kc, err := p.GetCredentials(&AuthRequest{Ref: "registry.example.com/app:latest"})
+	require.NoError(t, err)
+	require.Equal(t, &PassKeyChain{Username: "user", Password: "pass"}, kc)
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "registry.example.com/team-a/app:latest"})
+	require.NoError(t, err)
+	require.Equal(t, &PassKeyChain{Username: "team-a", Password: "pass", Scope: "team-a"}, kc)
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "registry.internal:5000/app:latest"})
+	require.NoError(t, err)
+	require.Equal(t, &PassKeyChain{Password: "token"}, kc)
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "busybox:latest"})
+	require.NoError(t, err)
+	require.Equal(t, "hub", kc.Username)
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "other.example.com/app:latest"})
+	require.NoError(t, err)
+	require.Nil(t, kc)
+
+	// Invalid content keeps the previous credentials.
+	require.NoError(t, os.WriteFile(path, []byte(`
+[host."registry.example.com"]
+username = "user"
+token = "token"
+`), 0600))
+	require.ErrorContains(t, p.Reload(), "token can't be set along with username and password")
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "registry.example.com/app:latest"})
+	require.NoError(t, err)
+	require.Equal(t, "pass", kc.Password)
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+[host."registry.example.com"]
+username = "user"
+password = "rotated"
+`), 0600))
+	require.NoError(t, p.Reload())
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "registry.example.com/app:latest"})
+	require.NoError(t, err)
+	require.Equal(t, "rotated", kc.Password)
+
+	_, err = NewAuthFileProvider(filepath.Join(t.TempDir(), "missing.toml"))
+	require.Error(t, err)
+}
+
+func TestReloadAuthFile(t *testing.T) {
+	oldProvider, oldCache := authFileProvider, keyChainCache
+	defer func() { authFileProvider, keyChainCache = oldProvider, oldCache }()
+
+	path := filepath.Join(t.TempDir(), "auth.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[host."registry.internal:5000"]
+username = "user"
+password = "old"
+cert_file = "/etc/nydus/certs/client.crt"
+key_file = "/etc/nydus/certs/client.key"
+`), 0600))
+	var err error
+	authFileProvider, err = NewAuthFileProvider(path)
+	require.NoError(t, err)
+	keyChainCache = newKeyChainCacheStore(time.Hour)
+
+	certFile, keyFile, ok := GetAuthFileClientCert("registry.internal:5000")
+	require.True(t, ok)
+	require.Equal(t, "/etc/nydus/certs/client.crt", certFile)
+	require.Equal(t, "/etc/nydus/certs/client.key", keyFile)
+	_, _, ok = GetAuthFileClientCert("registry.example.com")
+	require.False(t, ok)
+
+	const ref = "registry.internal:5000/app:latest"
+	providers := []AuthProvider{authFileProvider}
+	require.Equal(t, "old", getRegistryKeyChainFromProviders(ref, nil, providers).Password)
+
+	// Reloading drops the cached credentials.
+	require.NoError(t, os.WriteFile(path, []byte(`
+[host."registry.internal:5000"]
+username = "user"
+password = "new"
+`), 0600))
+	require.NoError(t, ReloadAuthFile())
+	require.Equal(t, "new", getRegistryKeyChainFromProviders(ref, nil, providers).Password)
+	_, _, ok = GetAuthFileClientCert("registry.internal:5000")
+	require.False(t, ok)
+}
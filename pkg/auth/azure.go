@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultAzureIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureManagementResource  = "https://management.azure.com/"
+	// ACR accepts refresh tokens as password of this user.
+	acrRefreshTokenUser = "00000000-0000-0000-0000-000000000000"
+	// Cached tokens are replaced this long before they expire.
+	azureTokenRefreshMargin = 5 * time.Minute
+	azureRequestTimeout     = 10 * time.Second
+)
+
+var (
+	azureProvider   *AzureProvider
+	azureProviderMu sync.Mutex
+)
+
+// AzureProvider exchanges the token of the managed identity of the node, obtained from the
+// instance metadata service, for ACR refresh tokens, so that images can be pulled from ACR
+// without distributing passwords.
+type AzureProvider struct {
+	imdsURL string
+	// Client ID of a user-assigned identity, empty for the system-assigned one
+	clientID string
+	// Scheme of the ACR token exchange endpoint, only changed by tests
+	scheme string
+	client *http.Client
+
+	// Concurrent requests share one token request to IMDS, and one exchange per registry host.
+	aadFetches   singleflight.Group
+	acrExchanges singleflight.Group
+
+	mu        sync.Mutex
+	aadToken  azureToken
+	acrTokens map[string]azureToken // registry host -> refresh token
+}
+
+type azureToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+func (t azureToken) validUntil(deadline time.Time) bool {
+	return t.token != "" && t.expiresAt.After(deadline)
+}
+
+// InitAzureProvider initializes the global Azure managed identity credential provider.
+// This should be called once at startup if managed identity auth is enabled.
+func InitAzureProvider(clientID string) {
+	azureProviderMu.Lock()
+	defer azureProviderMu.Unlock()
+
+	if azureProvider != nil {
+		return
+	}
+	azureProvider = NewAzureProvider(clientID)
+	log.L.WithField("client_id", clientID).Info("Azure managed identity credential provider initialized")
+}
+
+// NewAzureProvider creates a provider using the managed identity with clientID, or the
+// system-assigned identity if empty.
+func NewAzureProvider(clientID string) *AzureProvider {
+	return &AzureProvider{
+		imdsURL:   defaultAzureIMDSEndpoint,
+		clientID:  clientID,
+		scheme:    "https",
+		client:    &http.Client{Timeout: azureRequestTimeout},
+		acrTokens: make(map[string]azureToken),
+	}
+}
+
+// CanRenew implements RenewableProvider. Refresh tokens are exchanged again once they
+// are about to expire.
+func (p *AzureProvider) CanRenew() bool { return true }
+
+func (p *AzureProvider) String() string {
+	return "azure"
+}
+
+// GetCredentials returns an ACR refresh token for images of Azure Container Registry.
+func (p *AzureProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error) {
+	if req == nil || req.Ref == "" {
+		return nil, errors.New("ref not found in request")
+	}
+
+	_, host, err := parseReference(req.Ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse reference %s", req.Ref)
+	}
+	if !isACRRegistry(host) {
+		return nil, nil
+	}
+
+	return p.credentials(host, req.ValidUntil)
+}
+
+// credentials returns a refresh token of the registry host valid at least until validUntil.
+func (p *AzureProvider) credentials(host string, validUntil time.Time) (*PassKeyChain, error) {
+	deadline := time.Now().Add(azureTokenRefreshMargin)
+	if validUntil.After(deadline) {
+		deadline = validUntil
+	}
+
+	p.mu.Lock()
+	acrToken := p.acrTokens[host]
+	p.mu.Unlock()
+
+	// IMDS and the registry are not requested with the lock held, which would hold up
+	// requests served from the cache.
+	if !acrToken.validUntil(deadline) {
+		v, err, _ := p.acrExchanges.Do(host, func() (interface{}, error) {
+			aadToken, err := p.managedIdentityToken(deadline)
+			if err != nil {
+				return nil, errors.Wrap(err, "get managed identity token")
+			}
+			acrToken, err := p.exchangeACRToken(host, aadToken.token)
+			if err != nil {
+				return nil, errors.Wrapf(err, "exchange refresh token of %s", host)
+			}
+			p.mu.Lock()
+			p.acrTokens[host] = acrToken
+			p.mu.Unlock()
+			return acrToken, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		acrToken = v.(azureToken)
+	}
+
+	return &PassKeyChain{Username: acrRefreshTokenUser, Password: acrToken.token, Expiry: acrToken.expiresAt}, nil
+}
+
+// managedIdentityToken returns a token of the managed identity valid at least until deadline.
+func (p *AzureProvider) managedIdentityToken(deadline time.Time) (azureToken, error) {
+	p.mu.Lock()
+	aadToken := p.aadToken
+	p.mu.Unlock()
+	if aadToken.validUntil(deadline) {
+		return aadToken, nil
+	}
+
+	v, err, _ := p.aadFetches.Do("token", func() (interface{}, error) {
+		aadToken, err := p.fetchAADToken()
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.aadToken = aadToken
+		p.mu.Unlock()
+		return aadToken, nil
+	})
+	if err != nil {
+		return azureToken{}, err
+	}
+	return v.(azureToken), nil
+}
+
+func (p *AzureProvider) fetchAADToken() (azureToken, error) {
+	params := url.Values{"api-version": {"2018-02-01"}, "resource": {azureManagementResource}}
+	if p.clientID != "" {
+		params.Set("client_id", p.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, p.imdsURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return azureToken{}, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		// IMDS returns numbers as strings
+		ExpiresOn string `json:"expires_on"`
+	}
+	if err := p.do(req, &result); err != nil {
+		return azureToken{}, err
+	}
+	if result.AccessToken == "" {
+		return azureToken{}, errors.New("instance metadata service returned no access token")
+	}
+	expiresOn, err := strconv.ParseInt(result.ExpiresOn, 10, 64)
+	if err != nil {
+		return azureToken{}, errors.Wrapf(err, "invalid expires_on %q", result.ExpiresOn)
+	}
+	return azureToken{token: result.AccessToken, expiresAt: time.Unix(expiresOn, 0)}, nil
+}
+
+func (p *AzureProvider) exchangeACRToken(host, aadToken string) (azureToken, error) {
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"access_token": {aadToken},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.scheme+"://"+host+"/oauth2/exchange", strings.NewReader(form.Encode()))
+	if err != nil {
+		return azureToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var result struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := p.do(req, &result); err != nil {
+		return azureToken{}, err
+	}
+	if result.RefreshToken == "" {
+		return azureToken{}, errors.New("registry returned no refresh token")
+	}
+	token := azureToken{token: result.RefreshToken}
+	// Refresh tokens are JWTs, those not telling their expiry are exchanged again each time.
+	if expiresAt, ok := (PassKeyChain{Password: result.RefreshToken}).ExpiresAt(); ok {
+		token.expiresAt = expiresAt
+	}
+	return token, nil
+}
+
+func (p *AzureProvider) do(req *http.Request, result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), azureRequestTimeout)
+	defer cancel()
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errors.Wrap(err, "read response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s responded with status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return errors.Wrap(json.Unmarshal(body, result), "decode response")
+}
+
+// isACRRegistry tells whether host is an Azure Container Registry of any Azure cloud.
+func isACRRegistry(host string) bool {
+	host, _, _ = strings.Cut(host, ":")
+	for _, suffix := range []string{".azurecr.io", ".azurecr.cn", ".azurecr.us"} {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzureProvider(t *testing.T) {
+	var imdsRequests, exchanges atomic.Int32
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("client_id") != "kubelet-identity" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		imdsRequests.Add(1)
+		fmt.Fprintf(w, `{"access_token": "aad-token", "expires_on": "%d"}`, time.Now().Add(24*time.Hour).Unix())
+	}))
+	defer imds.Close()
+
+	exp := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/exchange" || r.FormValue("grant_type") != "access_token" ||
+			r.FormValue("access_token") != "aad-token" || r.FormValue("service") != r.Host {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		n := exchanges.Add(1)
+		claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp": %d, "n": %d}`, exp.Unix(), n)))
+		fmt.Fprintf(w, `{"refresh_token": "header.%s.signature"}`, claims)
+	}))
+	defer registry.Close()
+
+	p := NewAzureProvider("kubelet-identity")
+	p.imdsURL = imds.URL
+	p.scheme = "http"
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	kc, err := p.credentials(host, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, acrRefreshTokenUser, kc.Username)
+	assert.True(t, strings.HasPrefix(kc.Password, "header."))
+	expiry, ok := kc.ExpiresAt()
+	assert.True(t, ok)
+	assert.True(t, exp.Equal(expiry))
+
+	// Tokens are cached until they can't cover the requested validity anymore.
+	cached, err := p.credentials(host, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, kc.Password, cached.Password)
+	renewed, err := p.credentials(host, time.Now().Add(4*time.Hour))
+	require.NoError(t, err)
+	assert.NotEqual(t, kc.Password, renewed.Password)
+	assert.Equal(t, int32(2), exchanges.Load())
+	assert.Equal(t, int32(1), imdsRequests.Load())
+
+	// Other registries are left to other providers.
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "docker.io/library/busybox:latest"})
+	assert.NoError(t, err)
+	assert.Nil(t, kc)
+	assert.True(t, isACRRegistry("myregistry.azurecr.io"))
+}
+
+func TestAzureProvider_Concurrent(t *testing.T) {
+	var imdsRequests, exchanges atomic.Int32
+	release := make(chan struct{})
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		imdsRequests.Add(1)
+		fmt.Fprintf(w, `{"access_token": "aad-token", "expires_on": "%d"}`, time.Now().Add(24*time.Hour).Unix())
+	}))
+	defer imds.Close()
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchanges.Add(1)
+		<-release
+		claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp": %d}`, time.Now().Add(3*time.Hour).Unix())))
+		fmt.Fprintf(w, `{"refresh_token": "header.%s.signature"}`, claims)
+	}))
+	defer registry.Close()
+
+	p := NewAzureProvider("")
+	p.imdsURL = imds.URL
+	p.scheme = "http"
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.credentials(host, time.Time{})
+			assert.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool { return exchanges.Load() == 1 }, time.Second, 10*time.Millisecond)
+	// The cache is not locked while the registry is requested.
+	p.mu.Lock()
+	p.mu.Unlock()
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), exchanges.Load())
+	assert.Equal(t, int32(1), imdsRequests.Load())
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+)
+
+// keyChainCache caches the credentials resolved by the providers for a while, so that
+// the layers of an image and images pulled shortly after don't ask the providers again.
+// It is nil when caching is disabled (the default).
+var keyChainCache *keyChainCacheStore
+
+// InitKeyChainCache enables caching resolved credentials for ttl.
+func InitKeyChainCache(ttl time.Duration) {
+	keyChainCache = newKeyChainCacheStore(ttl)
+	log.L.WithField("ttl", ttl).Info("keychain cache initialized")
+}
+
+// InvalidateKeyChains drops the cached credentials of images of the registry host, e.g.
+// "docker.io", or of all images if host is empty, from both the keychain cache and the
+// renewal store. They are resolved again from the providers on next use, e.g. after
+// secrets are rotated. It returns the number of dropped credentials.
+func InvalidateKeyChains(host string) int {
+	var n int
+	if keyChainCache != nil {
+		n += keyChainCache.Invalidate(host)
+	}
+	if renewalStore != nil {
+		for _, entry := range renewalStore.Entries() {
+			if refOfHost(entry.ref, host) {
+				renewalStore.Remove(entry.ref)
+				n++
+			}
+		}
+	}
+	log.L.WithField("host", host).Infof("invalidated %d cached credentials", n)
+	return n
+}
+
+func refOfHost(ref, host string) bool {
+	if host == "" {
+		return true
+	}
+	_, refHost, err := parseReference(ref)
+	return err == nil && refHost == host
+}
+
+// cachedSource tells whether the credentials of the provider named source may be cached.
+// The ones of labels, the CRI request and Kubernetes secrets depend on the pod asking for
+// the image rather than on its ref alone, so they are resolved again for every request.
+func cachedSource(source string) bool {
+	switch source {
+	case "labels", "cri", sourceKubeSecret:
+		return false
+	}
+	return true
+}
+
+type keyChainCacheKey struct {
+	source string
+	ref    string
+}
+
+type cachedKeyChain struct {
+	keychain  *PassKeyChain
+	expiresAt time.Time
+}
+
+// keyChainCacheStore is a concurrency-safe in-memory cache of credentials keyed by image ref
+// and the provider which resolved them.
+type keyChainCacheStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[keyChainCacheKey]cachedKeyChain
+}
+
+func newKeyChainCacheStore(ttl time.Duration) *keyChainCacheStore {
+	return &keyChainCacheStore{ttl: ttl, entries: make(map[keyChainCacheKey]cachedKeyChain)}
+}
+
+// Add caches kc of source for ref for the TTL, or until kc expires if that is sooner.
+// Expired entries are swept, so refs which are not pulled anymore don't pile up.
+func (c *keyChainCacheStore) Add(source, ref string, kc *PassKeyChain) {
+	now := time.Now()
+	expiresAt := now.Add(c.ttl)
+	if expiry, ok := kc.ExpiresAt(); ok && expiry.Before(expiresAt) {
+		expiresAt = expiry
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[keyChainCacheKey{source, ref}] = cachedKeyChain{keychain: kc, expiresAt: expiresAt}
+}
+
+// Get returns the cached keychain of source for ref, or nil if not present or expired.
+func (c *keyChainCacheStore) Get(source, ref string) *PassKeyChain {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := keyChainCacheKey{source, ref}
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.keychain
+}
+
+// Invalidate drops the entries of images of host, or all entries if host is empty.
+func (c *keyChainCacheStore) Invalidate(host string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int
+	for key := range c.entries {
+		if refOfHost(key.ref, host) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyChainCache(t *testing.T) {
+	oldCache, oldStore := keyChainCache, renewalStore
+	defer func() { keyChainCache, renewalStore = oldCache, oldStore }()
+	keyChainCache, renewalStore = newKeyChainCacheStore(time.Minute), nil
+
+	const ref = "registry.example.com/app:latest"
+	provider := &mockProvider{creds: &PassKeyChain{Username: "user", Password: "old"}}
+	providers := []AuthProvider{provider}
+
+	kc := getRegistryKeyChainFromProviders(ref, nil, providers)
+	require.Equal(t, "old", kc.Password)
+
+	// Rotated secrets are only seen once the cache is invalidated.
+	provider.creds = &PassKeyChain{Username: "user", Password: "new"}
+	kc = getRegistryKeyChainFromProviders(ref, nil, providers)
+	require.Equal(t, "old", kc.Password)
+
+	require.Equal(t, 0, InvalidateKeyChains("docker.io"))
+	require.Equal(t, 1, InvalidateKeyChains("registry.example.com"))
+	kc = getRegistryKeyChainFromProviders(ref, nil, providers)
+	require.Equal(t, "new", kc.Password)
+
+	// Credentials of labels are neither served from nor added to the cache.
+	labels := map[string]string{label.NydusImagePullUsername: "label", label.NydusImagePullSecret: "secret"}
+	kc = getRegistryKeyChainFromProviders(ref, labels, []AuthProvider{NewLabelsProvider(), provider})
+	require.Equal(t, "secret", kc.Password)
+	kc = getRegistryKeyChainFromProviders(ref, nil, providers)
+	require.Equal(t, "new", kc.Password)
+
+	require.Equal(t, 1, InvalidateKeyChains(""))
+	require.Nil(t, keyChainCache.Get(provider.String(), ref))
+
+	// Credentials of Kubernetes secrets are scoped to namespaces, not cached by reference.
+	listener := &KubeSecretListener{dockerConfigs: map[string]*configfile.ConfigFile{
+		"default/pull": {AuthConfigs: map[string]types.AuthConfig{"registry.example.com": {Username: "user", Password: "secret"}}},
+	}}
+	defer func(l *KubeSecretListener) { kubeSecretListener = l }(kubeSecretListener)
+	kubeSecretListener = listener
+	kc = getRegistryKeyChainFromProviders(ref, nil, []AuthProvider{NewKubeSecretProvider()})
+	require.Equal(t, "secret", kc.Password)
+	require.Nil(t, keyChainCache.Get(sourceKubeSecret, ref))
+}
+
+func TestKeyChainCacheBySource(t *testing.T) {
+	oldCache, oldStore := keyChainCache, renewalStore
+	defer func() { keyChainCache, renewalStore = oldCache, oldStore }()
+	keyChainCache, renewalStore = newKeyChainCacheStore(time.Minute), nil
+
+	const ref = "registry.example.com/app:latest"
+	provider := &mockProvider{creds: &PassKeyChain{Username: "user", Password: "mock"}}
+	require.Equal(t, "mock", getRegistryKeyChainFromProviders(ref, nil, []AuthProvider{provider}).Password)
+
+	// Credentials cached for one provider are not served for another one.
+	other := &trackingProvider{}
+	kc := getRegistryKeyChainFromProviders(ref, nil, []AuthProvider{other})
+	require.NotEqual(t, "mock", kc.Password)
+	require.Equal(t, int32(1), other.calls.Load())
+
+	// Providers ahead of the cached one are still asked first.
+	labels := map[string]string{label.NydusImagePullUsername: "label", label.NydusImagePullSecret: "secret"}
+	kc = getRegistryKeyChainFromProviders(ref, labels, []AuthProvider{NewLabelsProvider(), provider})
+	require.Equal(t, "secret", kc.Password)
+	require.Nil(t, keyChainCache.Get("labels", ref))
+	provider.creds = &PassKeyChain{Username: "user", Password: "rotated"}
+	require.Equal(t, "mock", getRegistryKeyChainFromProviders(ref, nil, []AuthProvider{NewLabelsProvider(), provider}).Password)
+}
+
+func TestKeyChainCacheExpiry(t *testing.T) {
+	c := newKeyChainCacheStore(time.Hour)
+
+	c.Add("s", "a", &PassKeyChain{Password: "token", Expiry: time.Now().Add(-time.Second)})
+	require.Nil(t, c.Get("s", "a"))
+
+	c = newKeyChainCacheStore(time.Millisecond)
+	c.Add("s", "a", &PassKeyChain{Username: "user", Password: "pass"})
+	time.Sleep(5 * time.Millisecond)
+	require.Nil(t, c.Get("s", "a"))
+
+	// Expired entries are swept when adding.
+	c.Add("s", "b", &PassKeyChain{Username: "user", Password: "pass"})
+	c.Add("s", "c", &PassKeyChain{Username: "user", Password: "pass"})
+	time.Sleep(5 * time.Millisecond)
+	c.Add("s", "d", &PassKeyChain{Username: "user", Password: "pass"})
+	require.Len(t, c.entries, 1)
+}
@@ -0,0 +1,214 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: pkg/auth/credential/v1/credential.proto
+
+package credential
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetCredentialsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Registry host of the image, e.g. "registry.example.com:5000"
+	Host string `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	// Reference of the image, e.g. "registry.example.com:5000/app:latest"
+	Ref           string `protobuf:"bytes,2,opt,name=ref,proto3" json:"ref,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCredentialsRequest) Reset() {
+	*x = GetCredentialsRequest{}
+	mi := &file_pkg_auth_credential_v1_credential_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCredentialsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCredentialsRequest) ProtoMessage() {}
+
+func (x *GetCredentialsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_auth_credential_v1_credential_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCredentialsRequest.ProtoReflect.Descriptor instead.
+func (*GetCredentialsRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_auth_credential_v1_credential_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetCredentialsRequest) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *GetCredentialsRequest) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+type GetCredentialsResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Password string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	// Registry token, used instead of username and password
+	Token string `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`
+	// Seconds the credential is valid for, unknown if 0
+	ExpiresIn     int64 `protobuf:"varint,4,opt,name=expires_in,json=expiresIn,proto3" json:"expires_in,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCredentialsResponse) Reset() {
+	*x = GetCredentialsResponse{}
+	mi := &file_pkg_auth_credential_v1_credential_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCredentialsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCredentialsResponse) ProtoMessage() {}
+
+func (x *GetCredentialsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_auth_credential_v1_credential_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCredentialsResponse.ProtoReflect.Descriptor instead.
+func (*GetCredentialsResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_auth_credential_v1_credential_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetCredentialsResponse) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *GetCredentialsResponse) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *GetCredentialsResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *GetCredentialsResponse) GetExpiresIn() int64 {
+	if x != nil {
+		return x.ExpiresIn
+	}
+	return 0
+}
+
+var File_pkg_auth_credential_v1_credential_proto protoreflect.FileDescriptor
+
+const file_pkg_auth_credential_v1_credential_proto_rawDesc = "" +
+	"\n" +
+	"'pkg/auth/credential/v1/credential.proto\x12\x1fnydus.snapshotter.credential.v1\"=\n" +
+	"\x15GetCredentialsRequest\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x10\n" +
+	"\x03ref\x18\x02 \x01(\tR\x03ref\"\x85\x01\n" +
+	"\x16GetCredentialsResponse\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\x12\x14\n" +
+	"\x05token\x18\x03 \x01(\tR\x05token\x12\x1d\n" +
+	"\n" +
+	"expires_in\x18\x04 \x01(\x03R\texpiresIn2\x97\x01\n" +
+	"\x11CredentialService\x12\x81\x01\n" +
+	"\x0eGetCredentials\x126.nydus.snapshotter.credential.v1.GetCredentialsRequest\x1a7.nydus.snapshotter.credential.v1.GetCredentialsResponseBKZIgithub.com/containerd/nydus-snapshotter/pkg/auth/credential/v1;credentialb\x06proto3"
+
+var (
+	file_pkg_auth_credential_v1_credential_proto_rawDescOnce sync.Once
+	file_pkg_auth_credential_v1_credential_proto_rawDescData []byte
+)
+
+func file_pkg_auth_credential_v1_credential_proto_rawDescGZIP() []byte {
+	file_pkg_auth_credential_v1_credential_proto_rawDescOnce.Do(func() {
+		file_pkg_auth_credential_v1_credential_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pkg_auth_credential_v1_credential_proto_rawDesc), len(file_pkg_auth_credential_v1_credential_proto_rawDesc)))
+	})
+	return file_pkg_auth_credential_v1_credential_proto_rawDescData
+}
+
+var file_pkg_auth_credential_v1_credential_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pkg_auth_credential_v1_credential_proto_goTypes = []any{
+	(*GetCredentialsRequest)(nil),  // 0: nydus.snapshotter.credential.v1.GetCredentialsRequest
+	(*GetCredentialsResponse)(nil), // 1: nydus.snapshotter.credential.v1.GetCredentialsResponse
+}
+var file_pkg_auth_credential_v1_credential_proto_depIdxs = []int32{
+	0, // 0: nydus.snapshotter.credential.v1.CredentialService.GetCredentials:input_type -> nydus.snapshotter.credential.v1.GetCredentialsRequest
+	1, // 1: nydus.snapshotter.credential.v1.CredentialService.GetCredentials:output_type -> nydus.snapshotter.credential.v1.GetCredentialsResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_pkg_auth_credential_v1_credential_proto_init() }
+func file_pkg_auth_credential_v1_credential_proto_init() {
+	if File_pkg_auth_credential_v1_credential_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_auth_credential_v1_credential_proto_rawDesc), len(file_pkg_auth_credential_v1_credential_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pkg_auth_credential_v1_credential_proto_goTypes,
+		DependencyIndexes: file_pkg_auth_credential_v1_credential_proto_depIdxs,
+		MessageInfos:      file_pkg_auth_credential_v1_credential_proto_msgTypes,
+	}.Build()
+	File_pkg_auth_credential_v1_credential_proto = out.File
+	file_pkg_auth_credential_v1_credential_proto_goTypes = nil
+	file_pkg_auth_credential_v1_credential_proto_depIdxs = nil
+}
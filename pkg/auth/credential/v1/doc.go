@@ -0,0 +1,10 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package credential defines the gRPC service a credential service serves to the snapshotter.
+package credential
+
+//go:generate protoc --proto_path=../../../.. --go_out=../../../.. --go_opt=paths=source_relative --go-grpc_out=../../../.. --go-grpc_opt=paths=source_relative pkg/auth/credential/v1/credential.proto
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/docker/docker-credential-helpers/client"
+	helpercreds "github.com/docker/docker-credential-helpers/credentials"
+	"github.com/pkg/errors"
+)
+
+// Username of helper responses whose secret is an identity token.
+const identityTokenUsername = "<token>"
+
+// credentialHelperTimeout bounds a run of a helper, which may hang on a locked keychain. It is
+// a variable so tests can shorten it.
+var credentialHelperTimeout = 30 * time.Second
+
+var (
+	credHelperProvider   *CredentialHelperProvider
+	credHelperProviderMu sync.Mutex
+)
+
+// CredentialHelperProvider runs the docker-credential-<helper> programs configured for
+// registry hosts with the "get" command of the credential helper protocol, like docker
+// does for the credHelpers of its config.json, and optionally the "store" command.
+type CredentialHelperProvider struct {
+	// Registry host patterns, e.g. "*.dkr.ecr.*.amazonaws.com", to helper names, e.g. "ecr-login"
+	helpers map[string]string
+	// Store credentials renewed from other providers in the helpers, see Store
+	storeRenewed bool
+}
+
+// InitCredentialHelperProvider initializes the global credential helper provider.
+// This should be called once at startup if credential helpers are configured. With
+// storeRenewed, credentials renewed from other providers are stored in the helpers.
+func InitCredentialHelperProvider(helpers map[string]string, storeRenewed bool) {
+	credHelperProviderMu.Lock()
+	defer credHelperProviderMu.Unlock()
+
+	if credHelperProvider != nil {
+		return
+	}
+	credHelperProvider = NewCredentialHelperProvider(helpers)
+	credHelperProvider.storeRenewed = storeRenewed
+	log.L.WithField("helpers", helpers).Info("docker credential helper provider initialized")
+}
+
+func NewCredentialHelperProvider(helpers map[string]string) *CredentialHelperProvider {
+	return &CredentialHelperProvider{helpers: helpers}
+}
+
+// CanRenew implements RenewableProvider. Helpers are run again on every renewal.
+func (p *CredentialHelperProvider) CanRenew() bool { return true }
+
+func (p *CredentialHelperProvider) String() string {
+	return "credential-helper"
+}
+
+// GetCredentials runs the helper of the most specific pattern matching the registry host.
+func (p *CredentialHelperProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error) {
+	if req == nil || req.Ref == "" {
+		return nil, errors.New("ref not found in request")
+	}
+
+	_, host, err := parseReference(req.Ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse reference %s", req.Ref)
+	}
+
+	helper := p.helperOf(host)
+	if helper == "" {
+		return nil, nil
+	}
+
+	creds, err := client.Get(newHelperProgramFunc("docker-credential-"+helper), helperServerURL(host))
+	if err != nil {
+		if helpercreds.IsErrCredentialsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "run credential helper %s for %s", helper, host)
+	}
+	if creds.Username == identityTokenUsername {
+		return &PassKeyChain{IdentityToken: creds.Secret}, nil
+	}
+	if creds.Username == "" && creds.Secret == "" {
+		return nil, nil
+	}
+
+	return &PassKeyChain{Username: creds.Username, Password: creds.Secret}, nil
+}
+
+// Store runs the "store" command of the helper of the registry host of ref with kc, so that
+// other clients of the helper see the credential too. It does nothing if the host has no
+// helper, or kc is a bare registry token, which helpers have no username for.
+func (p *CredentialHelperProvider) Store(ref string, kc *PassKeyChain) error {
+	_, host, err := parseReference(ref)
+	if err != nil {
+		return errors.Wrapf(err, "parse reference %s", ref)
+	}
+	helper := p.helperOf(host)
+	if helper == "" {
+		return nil
+	}
+
+	creds := &helpercreds.Credentials{ServerURL: helperServerURL(host), Username: kc.Username, Secret: kc.Password}
+	if kc.IdentityToken != "" {
+		creds.Username, creds.Secret = identityTokenUsername, kc.IdentityToken
+	} else if kc.TokenBase() {
+		return nil
+	}
+	if err := client.Store(newHelperProgramFunc("docker-credential-"+helper), creds); err != nil {
+		return errors.Wrapf(err, "store credentials with credential helper %s for %s", helper, host)
+	}
+	return nil
+}
+
+// helperServerURL returns the server URL helpers know host by, docker hub is known by the
+// one docker uses.
+func helperServerURL(host string) string {
+	if host == convertedDockerHost || host == "docker.io" {
+		return dockerHost
+	}
+	return host
+}
+
+// helperOf returns the helper of the most specific pattern matching host, empty if none.
+func (p *CredentialHelperProvider) helperOf(host string) string {
+	var matching []string
+	for pattern := range p.helpers {
+		if matched, err := urlsMatchStr(pattern, host); err == nil && matched {
+			matching = append(matching, pattern)
+		}
+	}
+	if len(matching) == 0 {
+		return ""
+	}
+	// Patterns with fewer wildcards, then with more labels, are more specific, e.g. "gcr.io"
+	// before "*.io" and "*.dkr.ecr.*.amazonaws.com" before "*.amazonaws.com".
+	sort.Slice(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		if wa, wb := strings.Count(a, "*"), strings.Count(b, "*"); wa != wb {
+			return wa < wb
+		}
+		if la, lb := strings.Count(a, "."), strings.Count(b, "."); la != lb {
+			return la > lb
+		}
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+	return p.helpers[matching[0]]
+}
+
+// helperProgram runs a credential helper, which is killed after credentialHelperTimeout.
+type helperProgram struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+}
+
+func newHelperProgramFunc(name string) client.ProgramFunc {
+	return func(args ...string) client.Program {
+		ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stderr = os.Stderr
+		// Children of the helper keeping its output open don't hold the caller either.
+		cmd.WaitDelay = time.Second
+		return &helperProgram{cmd: cmd, cancel: cancel}
+	}
+}
+
+func (p *helperProgram) Output() ([]byte, error) {
+	defer p.cancel()
+	return p.cmd.Output()
+}
+
+func (p *helperProgram) Input(in io.Reader) {
+	p.cmd.Stdin = in
+}
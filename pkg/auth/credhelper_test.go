@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A helper answering the get command like docker-credential-ecr-login does.
+const testCredentialHelper = `#!/bin/sh
+if [ "$1" = store ]; then
+	cat > "$(dirname "$0")/stored"
+	exit 0
+fi
+[ "$1" = get ] || exit 1
+read -r server
+case "$server" in
+123456789012.dkr.ecr.us-east-1.amazonaws.com) echo '{"ServerURL":"'$server'","Username":"AWS","Secret":"ecr-token"}' ;;
+https://index.docker.io/v1/) echo '{"ServerURL":"'$server'","Username":"hubuser","Secret":"hubpass"}' ;;
+slow.example.com) exec sleep 5 ;;
+token.example.com) echo '{"ServerURL":"'$server'","Username":"<token>","Secret":"refresh"}' ;;
+*) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+
+func TestCredentialHelperProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(testCredentialHelper), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	p := NewCredentialHelperProvider(map[string]string{
+		"*.dkr.ecr.*.amazonaws.com": "test",
+		"docker.io":                 "test",
+		"token.example.com":         "test",
+		"missing.example.com":       "test",
+		"other.example.com":         "absent",
+	})
+
+	kc, err := p.GetCredentials(&AuthRequest{Ref: "123456789012.dkr.ecr.us-east-1.amazonaws.com/app:latest"})
+	require.NoError(t, err)
+	assert.Equal(t, &PassKeyChain{Username: "AWS", Password: "ecr-token"}, kc)
+
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "busybox:latest"})
+	require.NoError(t, err)
+	assert.Equal(t, &PassKeyChain{Username: "hubuser", Password: "hubpass"}, kc)
+
+	// Hosts the helper has no credential for, or without a helper, are left to other providers.
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "missing.example.com/app:latest"})
+	assert.NoError(t, err)
+	assert.Nil(t, kc)
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "ghcr.io/app:latest"})
+	assert.NoError(t, err)
+	assert.Nil(t, kc)
+
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "token.example.com/app:latest"})
+	require.NoError(t, err)
+	assert.Equal(t, &PassKeyChain{IdentityToken: "refresh"}, kc)
+	_, err = p.GetCredentials(&AuthRequest{Ref: "other.example.com/app:latest"})
+	assert.Error(t, err)
+
+	// Hung helpers are given up on.
+	oldTimeout := credentialHelperTimeout
+	defer func() { credentialHelperTimeout = oldTimeout }()
+	credentialHelperTimeout = 100 * time.Millisecond
+	p = NewCredentialHelperProvider(map[string]string{"slow.example.com": "test"})
+	start := time.Now()
+	_, err = p.GetCredentials(&AuthRequest{Ref: "slow.example.com/app:latest"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestCredentialHelperProvider_Store(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(testCredentialHelper), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	stored := func() string {
+		b, err := os.ReadFile(filepath.Join(dir, "stored"))
+		if os.IsNotExist(err) {
+			return ""
+		}
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	oldProvider, oldRenewable, oldStore := credHelperProvider, renewableProviders, renewalStore
+	defer func() { credHelperProvider, renewableProviders, renewalStore = oldProvider, oldRenewable, oldStore }()
+	credHelperProvider = nil
+	InitCredentialHelperProvider(map[string]string{"docker.io": "test", "token.example.com": "test"}, true)
+	renewalStore = newCredentialStore(time.Minute)
+	provider := &mockProvider{creds: &PassKeyChain{Username: "hubuser", Password: "renewed"}}
+	renewableProviders = func() []AuthProvider { return []AuthProvider{provider} }
+
+	// Credentials renewed from other providers are stored in the helper.
+	require.NotNil(t, RenewCredential("busybox:latest"))
+	assert.JSONEq(t, `{"ServerURL":"https://index.docker.io/v1/","Username":"hubuser","Secret":"renewed"}`, stored())
+
+	provider.creds = &PassKeyChain{IdentityToken: "refresh"}
+	require.NotNil(t, RenewCredential("token.example.com/app:latest"))
+	assert.JSONEq(t, `{"ServerURL":"token.example.com","Username":"<token>","Secret":"refresh"}`, stored())
+
+	// Hosts without helper, and bare registry tokens, are not stored.
+	require.NoError(t, os.Remove(filepath.Join(dir, "stored")))
+	require.NotNil(t, RenewCredential("ghcr.io/app:latest"))
+	provider.creds = &PassKeyChain{Password: "registry-token"}
+	require.NotNil(t, RenewCredential("busybox:latest"))
+	assert.Empty(t, stored())
+
+	// Credentials renewed from the helper itself are not stored back.
+	renewableProviders = func() []AuthProvider { return []AuthProvider{credHelperProvider} }
+	require.NotNil(t, RenewCredential("busybox:latest"))
+	assert.Empty(t, stored())
+}
+
+func TestCredentialHelperProvider_HelperOf(t *testing.T) {
+	p := NewCredentialHelperProvider(map[string]string{
+		"*.amazonaws.com":           "generic",
+		"*.dkr.ecr.*.amazonaws.com": "ecr-login",
+		"*.io":                      "wildcard",
+		"gcr.io":                    "gcr",
+		"zz.example.com":            "exact",
+		"*.example.com":             "example",
+	})
+	assert.Equal(t, "ecr-login", p.helperOf("123456789012.dkr.ecr.us-east-1.amazonaws.com"))
+	assert.Equal(t, "generic", p.helperOf("s3.amazonaws.com"))
+	assert.Equal(t, "gcr", p.helperOf("gcr.io"))
+	assert.Equal(t, "wildcard", p.helperOf("ghcr.io"))
+	assert.Equal(t, "exact", p.helperOf("zz.example.com"))
+	assert.Equal(t, "example", p.helperOf("a.example.com"))
+	assert.Empty(t, p.helperOf("quay.org"))
+}
@@ -9,6 +9,7 @@ package auth
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/containerd/containerd/v2/defaults"
@@ -29,6 +30,20 @@ const DefaultImageServiceAddress = "/run/containerd/containerd.sock"
 // Should be concurrency safe
 var credentials []resolver.Credential = make([]resolver.Credential, 0, 8)
 
+// Pull namespaces kept at most, the ones recorded longest ago are forgotten first.
+const maxPullNamespaces = 4096
+
+type pullNamespaceRecord struct {
+	namespace string
+	recorded  time.Time
+}
+
+var (
+	pullNamespacesMu sync.Mutex
+	// Image reference -> namespace of the pod which pulled it last, recorded by the CRI image proxy
+	pullNamespaces = map[string]pullNamespaceRecord{}
+)
+
 // CRIProvider retrieves credentials from CRI image pull requests.
 type CRIProvider struct{}
 
@@ -100,6 +115,22 @@ func newCRIConn(criAddr string) (*grpc.ClientConn, error) {
 // This should be called once at startup to enable CRI credential capture.
 // from stargz-snapshotter/cmd/containerd-stargz-grpc/main.go#main
 func AddImageProxy(ctx context.Context, rpc *grpc.Server, imageServiceAddress string) {
+	criCred, criAddr := addImageProxy(ctx, rpc, imageServiceAddress)
+	credentials = append(credentials, criCred)
+
+	log.G(ctx).WithField("target-image-service", criAddr).Info("setup image proxy keychain")
+}
+
+// AddPullNamespaceProxy sets up a CRI image proxy that only records the pod namespace of
+// image pulls, which scopes kube secrets, without capturing credentials.
+// This should be called once at startup, instead of AddImageProxy.
+func AddPullNamespaceProxy(ctx context.Context, rpc *grpc.Server, imageServiceAddress string) {
+	_, criAddr := addImageProxy(ctx, rpc, imageServiceAddress)
+
+	log.G(ctx).WithField("target-image-service", criAddr).Info("setup image proxy recording pull namespaces")
+}
+
+func addImageProxy(ctx context.Context, rpc *grpc.Server, imageServiceAddress string) (resolver.Credential, string) {
 	criAddr := DefaultImageServiceAddress
 	if imageServiceAddress != "" {
 		criAddr = imageServiceAddress
@@ -114,9 +145,52 @@ func AddImageProxy(ctx context.Context, rpc *grpc.Server, imageServiceAddress st
 		return runtime.NewImageServiceClient(conn), nil
 	})
 
-	runtime.RegisterImageServiceServer(rpc, criServer)
+	runtime.RegisterImageServiceServer(rpc, &namespaceRecorder{ImageServiceServer: criServer})
+	return criCred, criAddr
+}
 
-	credentials = append(credentials, criCred)
+// namespaceRecorder records the pod namespace of images pulled through the CRI image proxy,
+// which scopes the kube secrets their credentials are looked up from.
+type namespaceRecorder struct {
+	runtime.ImageServiceServer
+}
 
-	log.G(ctx).WithField("target-image-service", criAddr).Info("setup image proxy keychain")
+func (s *namespaceRecorder) PullImage(ctx context.Context, req *runtime.PullImageRequest) (*runtime.PullImageResponse, error) {
+	if ns := req.GetSandboxConfig().GetMetadata().GetNamespace(); ns != "" {
+		recordPullNamespace(req.GetImage().GetImage(), ns)
+	}
+	return s.ImageServiceServer.PullImage(ctx, req)
+}
+
+func recordPullNamespace(ref, namespace string) {
+	refSpec, _, err := parseReference(ref)
+	if err != nil {
+		return
+	}
+	pullNamespacesMu.Lock()
+	defer pullNamespacesMu.Unlock()
+	key := refSpec.String()
+	if _, ok := pullNamespaces[key]; !ok && len(pullNamespaces) >= maxPullNamespaces {
+		var oldest string
+		for k, r := range pullNamespaces {
+			if oldest == "" || r.recorded.Before(pullNamespaces[oldest].recorded) {
+				oldest = k
+			}
+		}
+		delete(pullNamespaces, oldest)
+	}
+	pullNamespaces[key] = pullNamespaceRecord{namespace: namespace, recorded: time.Now()}
+}
+
+// pullNamespace returns the namespace of the pod which pulled ref last through the CRI
+// image proxy, false if unknown.
+func pullNamespace(ref string) (string, bool) {
+	refSpec, _, err := parseReference(ref)
+	if err != nil {
+		return "", false
+	}
+	pullNamespacesMu.Lock()
+	defer pullNamespacesMu.Unlock()
+	r, ok := pullNamespaces[refSpec.String()]
+	return r.namespace, ok
 }
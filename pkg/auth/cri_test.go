@@ -8,6 +8,7 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"path/filepath"
 	"testing"
@@ -142,4 +143,28 @@ func TestFromImagePull(t *testing.T) {
 	assertions.NoError(err)
 	assertions.Equal("digest", kc.Username)
 	assertions.Equal("dpwd", kc.Password)
+
+	// The pod namespace of pulls is recorded for scoping kube secrets.
+	_, err = criClient.PullImage(ctx, &runtime.PullImageRequest{
+		Image:         &runtime.ImageSpec{Image: "busybox:1.36"},
+		SandboxConfig: &runtime.PodSandboxConfig{Metadata: &runtime.PodSandboxMetadata{Namespace: "team-a"}},
+	})
+	assertions.NoError(err)
+	ns, ok := pullNamespace("docker.io/library/busybox:1.36")
+	assertions.True(ok)
+	assertions.Equal("team-a", ns)
+	_, ok = pullNamespace(tagImage)
+	assertions.False(ok)
+}
+
+func TestPullNamespacesBounded(t *testing.T) {
+	defer func() { pullNamespaces = map[string]pullNamespaceRecord{} }()
+	pullNamespaces = map[string]pullNamespaceRecord{}
+
+	for i := 0; i < maxPullNamespaces+1; i++ {
+		recordPullNamespace(fmt.Sprintf("docker.io/library/app%d:latest", i), "team-a")
+	}
+	assert.Len(t, pullNamespaces, maxPullNamespaces)
+	_, ok := pullNamespace(fmt.Sprintf("docker.io/library/app%d:latest", maxPullNamespaces))
+	assert.True(t, ok)
 }
@@ -12,6 +12,7 @@ import (
 
 	dockerconfig "github.com/docker/cli/cli/config"
 	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
 	"github.com/pkg/errors"
 )
 
@@ -47,11 +48,19 @@ func (p *DockerProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error)
 		return nil, errors.New("ref not found in request")
 	}
 
-	_, host, err := parseReference(req.Ref)
+	host, keys, err := scopedKeys(req.Ref)
 	if err != nil {
 		return nil, errors.Wrapf(err, "parse reference %s", req.Ref)
 	}
 
+	// Credentials of repositories, stored under their path like "registry.example.com/team",
+	// take precedence over the ones of the registry.
+	for _, k := range keys[:len(keys)-1] {
+		if kc := scopedAuthConfig(p.dockerConfig, k); kc != nil {
+			return kc, nil
+		}
+	}
+
 	// The host of docker hub image will be converted to `registry-1.docker.io` in:
 	// github.com/containerd/containerd/remotes/docker/registry.go
 	// But we need use the key `https://index.docker.io/v1/` to find auth from docker config.
@@ -64,6 +73,9 @@ func (p *DockerProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error)
 		return nil, errors.Wrapf(err, "no auth from docker config for host %s", host)
 	}
 
+	if authConfig.IdentityToken != "" {
+		return &PassKeyChain{IdentityToken: authConfig.IdentityToken}, nil
+	}
 	// Do not return partially empty auth. It makes caller life easier.
 	if len(authConfig.Username) == 0 || len(authConfig.Password) == 0 {
 		return nil, fmt.Errorf("auth config not complete for host: %s", host)
@@ -74,3 +86,38 @@ func (p *DockerProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error)
 		Password: authConfig.Password,
 	}, nil
 }
+
+// GetProxyKeyChain returns the credential of an HTTP proxy host, e.g. "proxy:3128", from
+// Docker's config.json, or nil if there is none.
+func GetProxyKeyChain(host string) *PassKeyChain {
+	authConfig, err := dockerconfig.LoadDefaultConfigFile(os.Stderr).GetAuthConfig(host)
+	if err != nil || authConfig.Username == "" || authConfig.Password == "" {
+		return nil
+	}
+
+	return &PassKeyChain{
+		Username: authConfig.Username,
+		Password: authConfig.Password,
+	}
+}
+
+// scopedAuthConfig returns the complete credential stored under the key of docker config c,
+// or nil. Repository keys are only looked up in the auths of c, not in credential stores.
+func scopedAuthConfig(c *configfile.ConfigFile, k scopedKey) *PassKeyChain {
+	var authConfig types.AuthConfig
+	if k.scope != "" {
+		authConfig = c.AuthConfigs[k.key]
+	} else {
+		var err error
+		if authConfig, err = c.GetAuthConfig(k.key); err != nil {
+			return nil
+		}
+	}
+	if authConfig.IdentityToken != "" {
+		return &PassKeyChain{IdentityToken: authConfig.IdentityToken, Scope: k.scope}
+	}
+	if authConfig.Username == "" || authConfig.Password == "" {
+		return nil
+	}
+	return &PassKeyChain{Username: authConfig.Username, Password: authConfig.Password, Scope: k.scope}
+}
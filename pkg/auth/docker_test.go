@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	dockerconfig "github.com/docker/cli/cli/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -91,3 +92,23 @@ func TestDockerCred(t *testing.T) {
 	assert.Equal(auth.Username, extraUser)
 	assert.Equal(auth.Password, extraPass)
 }
+
+func TestDockerScopedCred(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, configFile),
+		[]byte(fmt.Sprintf(testConfigFmt, extraHost, base64.StdEncoding.EncodeToString([]byte(extraUser+":"+extraPass)),
+			extraHost+"/team-a", base64.StdEncoding.EncodeToString([]byte("team-a:"+extraPass)))),
+		0600)
+	assert.NoError(t, err)
+	cfg, err := dockerconfig.Load(dir)
+	assert.NoError(t, err)
+	p := &DockerProvider{dockerConfig: cfg}
+
+	auth, err := p.GetCredentials(&AuthRequest{Ref: extraHost + "/team-a/app/web:latest"})
+	assert.NoError(t, err)
+	assert.Equal(t, &PassKeyChain{Username: "team-a", Password: extraPass, Scope: "team-a"}, auth)
+
+	auth, err = p.GetCredentials(&AuthRequest{Ref: extraHost + "/team-b/app:latest"})
+	assert.NoError(t, err)
+	assert.Equal(t, &PassKeyChain{Username: extraUser, Password: extraPass}, auth)
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Credentials are renewed this long before they expire.
+const credentialExpiryMargin = 30 * time.Minute
+
+// ExpiresAt returns when the credential expires, false if it can't tell. Besides the expiry
+// set by providers, it understands ECR authorization tokens, whose password is a base64
+// encoded JSON document with the expiration, and JWT bearer tokens with an exp claim.
+func (kc PassKeyChain) ExpiresAt() (time.Time, bool) {
+	if !kc.Expiry.IsZero() {
+		return kc.Expiry, true
+	}
+	if parts := strings.Split(kc.Password, "."); len(parts) == 3 {
+		var claims struct {
+			Exp int64 `json:"exp"`
+		}
+		if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil &&
+			json.Unmarshal(payload, &claims) == nil && claims.Exp > 0 {
+			return time.Unix(claims.Exp, 0), true
+		}
+		return time.Time{}, false
+	}
+
+	var token struct {
+		Expiration int64 `json:"expiration"`
+	}
+	if data, err := base64.StdEncoding.DecodeString(kc.Password); err == nil &&
+		json.Unmarshal(data, &token) == nil && token.Expiration > 0 {
+		return time.Unix(token.Expiration, 0), true
+	}
+	return time.Time{}, false
+}
+
+// CredentialExpiring tells whether the stored credential of ref expires soon and should
+// be renewed, false if there is none or its expiry is unknown.
+func CredentialExpiring(ref string) bool {
+	if renewalStore == nil {
+		return false
+	}
+	renewalStore.mu.RLock()
+	defer renewalStore.mu.RUnlock()
+	entry, ok := renewalStore.entries[ref]
+	return ok && !entry.expiresAt.IsZero() && time.Until(entry.expiresAt) < credentialExpiryMargin
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassKeyChainExpiresAt(t *testing.T) {
+	exp := time.Now().Add(12 * time.Hour).Truncate(time.Second)
+
+	ecr := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`{"payload":"p","datakey":"d","version":"2","type":"DATA_KEY","expiration":%d}`, exp.Unix())))
+	at, ok := PassKeyChain{Username: "AWS", Password: ecr}.ExpiresAt()
+	require.True(t, ok)
+	assert.True(t, exp.Equal(at))
+
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"puller","exp":%d}`, exp.Unix())))
+	at, ok = PassKeyChain{Password: "eyJhbGciOiJSUzI1NiJ9." + claims + ".c2lnbmF0dXJl"}.ExpiresAt()
+	require.True(t, ok)
+	assert.True(t, exp.Equal(at))
+
+	_, ok = PassKeyChain{Username: "user", Password: "secret"}.ExpiresAt()
+	assert.False(t, ok)
+}
+
+func TestCredentialExpiring(t *testing.T) {
+	oldStore := renewalStore
+	defer func() { renewalStore = oldStore }()
+	renewalStore = newCredentialStore(5 * time.Minute)
+
+	token := func(exp time.Time) *PassKeyChain {
+		return &PassKeyChain{Username: "AWS", Password: base64.StdEncoding.EncodeToString(
+			[]byte(fmt.Sprintf(`{"expiration":%d}`, exp.Unix())))}
+	}
+	renewalStore.Add("fresh", token(time.Now().Add(12*time.Hour)))
+	renewalStore.Add("expiring", token(time.Now().Add(10*time.Minute)))
+	renewalStore.Add("expired", token(time.Now().Add(-time.Minute)))
+	renewalStore.Add("unknown", &PassKeyChain{Username: "user", Password: "secret"})
+
+	assert.False(t, CredentialExpiring("fresh"))
+	assert.True(t, CredentialExpiring("expiring"))
+	assert.True(t, CredentialExpiring("expired"))
+	assert.False(t, CredentialExpiring("unknown"))
+	assert.False(t, CredentialExpiring("missing"))
+
+	// Expired credentials are not served anymore.
+	assert.NotNil(t, GetStoredCredential("expiring"))
+	assert.Nil(t, GetStoredCredential("expired"))
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultGCPMetadataHost = "metadata.google.internal"
+	gcpTokenPath           = "/computeMetadata/v1/instance/service-accounts/default/token"
+	// The metadata server refreshes tokens 5 minutes before they expire, so cached ones are
+	// replaced a bit earlier.
+	gcpTokenRefreshMargin = 6 * time.Minute
+	gcpRequestTimeout     = 5 * time.Second
+)
+
+var (
+	gcpProvider   *GCPProvider
+	gcpProviderMu sync.Mutex
+)
+
+// GCPProvider retrieves OAuth access tokens of the service account of the GCE instance, or
+// the one bound to the GKE workload identity, from the metadata server. They are handed to
+// nydusd as registry_token of Artifact Registry and Container Registry images.
+type GCPProvider struct {
+	tokenURL string
+	client   *http.Client
+
+	// Concurrent requests for a token share one request to the metadata server.
+	fetches singleflight.Group
+
+	mu    sync.Mutex
+	token string
+	// Zero if no token has been fetched yet
+	expiresAt time.Time
+}
+
+// InitGCPProvider initializes the global GCP metadata server credential provider.
+// This should be called once at startup if workload identity is enabled.
+func InitGCPProvider() {
+	gcpProviderMu.Lock()
+	defer gcpProviderMu.Unlock()
+
+	if gcpProvider != nil {
+		return
+	}
+	gcpProvider = NewGCPProvider()
+	log.L.Info("GCP metadata credential provider initialized")
+}
+
+// NewGCPProvider creates a provider talking to the metadata server, or to the host named
+// by GCE_METADATA_HOST like Google's client libraries do.
+func NewGCPProvider() *GCPProvider {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = defaultGCPMetadataHost
+	}
+	return &GCPProvider{
+		tokenURL: "http://" + host + gcpTokenPath,
+		client:   &http.Client{Timeout: gcpRequestTimeout},
+	}
+}
+
+// CanRenew implements RenewableProvider. Tokens are fetched again from the metadata
+// server once they are about to expire.
+func (p *GCPProvider) CanRenew() bool { return true }
+
+func (p *GCPProvider) String() string {
+	return "gcp"
+}
+
+// GetCredentials returns an access token for images of Google registries, which is cached
+// until shortly before it expires, or until req.ValidUntil can't be met anymore.
+func (p *GCPProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error) {
+	if req == nil || req.Ref == "" {
+		return nil, errors.New("ref not found in request")
+	}
+
+	_, host, err := parseReference(req.Ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse reference %s", req.Ref)
+	}
+	if !isGCPRegistry(host) {
+		return nil, nil
+	}
+
+	validUntil := time.Now().Add(gcpTokenRefreshMargin)
+	if req.ValidUntil.After(validUntil) {
+		validUntil = req.ValidUntil
+	}
+	p.mu.Lock()
+	token, expiresAt := p.token, p.expiresAt
+	p.mu.Unlock()
+	if token != "" && expiresAt.After(validUntil) {
+		return &PassKeyChain{Password: token, Expiry: expiresAt}, nil
+	}
+
+	// The metadata server is not requested with the lock held, which would hold up
+	// requests served from the cache.
+	v, err, _ := p.fetches.Do("token", func() (interface{}, error) {
+		kc, err := p.fetchToken()
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.token, p.expiresAt = kc.Password, kc.Expiry
+		p.mu.Unlock()
+		return kc, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get access token for %s", host)
+	}
+	kc := *v.(*PassKeyChain)
+	return &kc, nil
+}
+
+func (p *GCPProvider) fetchToken() (*PassKeyChain, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gcpRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.tokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "request metadata server")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "read metadata server response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("metadata server responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, errors.Wrap(err, "decode metadata server response")
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("metadata server returned no access token")
+	}
+
+	return &PassKeyChain{
+		Password: token.AccessToken,
+		Expiry:   time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// isGCPRegistry tells whether host is Artifact Registry or Container Registry.
+func isGCPRegistry(host string) bool {
+	host, _, _ = strings.Cut(host, ":")
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev")
+}
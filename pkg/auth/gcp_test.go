@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCPProvider(t *testing.T) {
+	var requests atomic.Int32
+	var expiresIn atomic.Int64
+	expiresIn.Store(3599)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != gcpTokenPath || r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		n := requests.Add(1)
+		fmt.Fprintf(w, `{"access_token": "ya29.token-%d", "expires_in": %d, "token_type": "Bearer"}`, n, expiresIn.Load())
+	}))
+	defer server.Close()
+
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	p := NewGCPProvider()
+
+	kc, err := p.GetCredentials(&AuthRequest{Ref: "us-docker.pkg.dev/project/repo/app:latest"})
+	require.NoError(t, err)
+	require.NotNil(t, kc)
+	// Handed to nydusd as registry_token.
+	assert.True(t, kc.TokenBase())
+	assert.Equal(t, "ya29.token-1", kc.Password)
+	expiry, ok := kc.ExpiresAt()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Minute)
+
+	// The token is cached until it can't cover the requested validity anymore.
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "gcr.io/project/app:latest"})
+	require.NoError(t, err)
+	assert.Equal(t, "ya29.token-1", kc.Password)
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "eu.gcr.io/project/app:latest", ValidUntil: time.Now().Add(2 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, "ya29.token-2", kc.Password)
+
+	// Other registries are left to other providers.
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "docker.io/library/busybox:latest"})
+	assert.NoError(t, err)
+	assert.Nil(t, kc)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// Tokens about to expire are replaced.
+	expiresIn.Store(60)
+	_, err = p.GetCredentials(&AuthRequest{Ref: "gcr.io/project/app:latest", ValidUntil: time.Now().Add(3 * time.Hour)})
+	require.NoError(t, err)
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "gcr.io/project/app:latest"})
+	require.NoError(t, err)
+	assert.Equal(t, "ya29.token-4", kc.Password)
+}
+
+func TestGCPProvider_Concurrent(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		fmt.Fprint(w, `{"access_token": "ya29.token", "expires_in": 3599}`)
+	}))
+	defer server.Close()
+
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	p := NewGCPProvider()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			kc, err := p.GetCredentials(&AuthRequest{Ref: "gcr.io/project/app:latest"})
+			assert.NoError(t, err)
+			assert.Equal(t, "ya29.token", kc.Password)
+		}()
+	}
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, 10*time.Millisecond)
+	// The cache is not locked while the metadata server is requested.
+	p.mu.Lock()
+	p.mu.Unlock()
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/v2/pkg/dialer"
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	credentialv1 "github.com/containerd/nydus-snapshotter/pkg/auth/credential/v1"
+)
+
+const (
+	// CredentialService is the gRPC service a credential service has to serve, defined in
+	// credential/v1/credential.proto, also the name its serving status is reported under by
+	// the standard health service.
+	CredentialService = "nydus.snapshotter.credential.v1.CredentialService"
+
+	defaultGRPCCredentialTimeout = 5 * time.Second
+	// How long the serving status of the credential service is trusted.
+	grpcHealthCheckInterval = 10 * time.Second
+)
+
+var (
+	grpcProvider   *GRPCProvider
+	grpcProviderMu sync.Mutex
+)
+
+// GRPCProvider retrieves credentials from a local gRPC credential service, so that platform
+// teams can plug in their token brokers. Services implementing the standard gRPC health
+// service are not asked while they report not to be serving.
+type GRPCProvider struct {
+	address string
+	timeout time.Duration
+	conn    *grpc.ClientConn
+	client  credentialv1.CredentialServiceClient
+	health  healthpb.HealthClient
+
+	mu sync.Mutex
+	// Error of the last health check, and when it was done
+	healthErr   error
+	healthCheck time.Time
+}
+
+// InitGRPCProvider initializes the global gRPC credential provider.
+// This should be called once at startup if a credential service is configured.
+func InitGRPCProvider(address string, timeout time.Duration) error {
+	grpcProviderMu.Lock()
+	defer grpcProviderMu.Unlock()
+
+	if grpcProvider != nil {
+		return nil
+	}
+
+	provider, err := NewGRPCProvider(address, timeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to create gRPC credential provider")
+	}
+
+	grpcProvider = provider
+	log.L.WithField("address", address).Info("gRPC credential provider initialized")
+	return nil
+}
+
+// NewGRPCProvider creates a provider talking to the credential service listening on address,
+// e.g. "/run/credential.sock" or "unix:///run/credential.sock", waiting up to timeout for each
+// request, 5s if not positive. The connection is established lazily, so the service does not
+// need to be up yet.
+func NewGRPCProvider(address string, timeout time.Duration) (*GRPCProvider, error) {
+	if address == "" {
+		return nil, errors.New("credential service address cannot be empty")
+	}
+
+	conn, err := grpc.NewClient(dialer.DialAddress(address),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(dialer.ContextDialer),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create client for %s", address)
+	}
+
+	if timeout <= 0 {
+		timeout = defaultGRPCCredentialTimeout
+	}
+	return &GRPCProvider{
+		address: address,
+		timeout: timeout,
+		conn:    conn,
+		client:  credentialv1.NewCredentialServiceClient(conn),
+		health:  healthpb.NewHealthClient(conn),
+	}, nil
+}
+
+// CanRenew implements RenewableProvider. Services are asked again on renewal, e.g. for
+// tokens about to expire.
+func (p *GRPCProvider) CanRenew() bool { return true }
+
+func (p *GRPCProvider) String() string {
+	return "grpc"
+}
+
+// GetCredentials asks the credential service for the registry host of the image. Errors, e.g.
+// when the service is unreachable, let the next providers in the chain serve the request.
+func (p *GRPCProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error) {
+	if req == nil || req.Ref == "" {
+		return nil, errors.New("ref not found in request")
+	}
+
+	_, host, err := parseReference(req.Ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse reference %s", req.Ref)
+	}
+
+	if err := p.checkHealth(); err != nil {
+		return nil, errors.Wrapf(err, "credential service %s", p.address)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	out, err := p.client.GetCredentials(ctx, &credentialv1.GetCredentialsRequest{Host: host, Ref: req.Ref})
+	if err != nil {
+		return nil, errors.Wrapf(err, "request credentials for %s from %s", host, p.address)
+	}
+
+	kc := &PassKeyChain{Username: out.GetUsername(), Password: out.GetPassword()}
+	if token := out.GetToken(); token != "" {
+		kc = &PassKeyChain{Password: token}
+	}
+	if kc.Username == "" && kc.Password == "" {
+		return nil, nil
+	}
+	if expiresIn := out.GetExpiresIn(); expiresIn > 0 {
+		kc.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	return kc, nil
+}
+
+// checkHealth returns an error while the service reports not to be serving, asking it at
+// most every grpcHealthCheckInterval. Services not reporting a status are taken as serving.
+func (p *GRPCProvider) checkHealth() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.healthCheck.IsZero() && time.Since(p.healthCheck) < grpcHealthCheckInterval {
+		return p.healthErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	resp, err := p.health.Check(ctx, &healthpb.HealthCheckRequest{Service: CredentialService})
+	switch {
+	case status.Code(err) == codes.Unimplemented || status.Code(err) == codes.NotFound:
+		// No health service, or no status reported for the credential service.
+		p.healthErr = nil
+	case err != nil:
+		p.healthErr = errors.Wrap(err, "check health")
+	case resp.GetStatus() != healthpb.HealthCheckResponse_SERVING:
+		p.healthErr = errors.Errorf("not serving, status %s", resp.GetStatus())
+	default:
+		p.healthErr = nil
+	}
+	p.healthCheck = time.Now()
+	if p.healthErr != nil {
+		log.L.WithError(p.healthErr).Warnf("credential service %s is unhealthy", p.address)
+	}
+	return p.healthErr
+}
+
+// Close releases the connection to the credential service.
+func (p *GRPCProvider) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	credentialv1 "github.com/containerd/nydus-snapshotter/pkg/auth/credential/v1"
+)
+
+// startCredentialService serves credentials from creds, keyed by registry host, on a unix socket.
+func startCredentialService(t *testing.T, creds map[string][2]string) string {
+	sock, _ := startCredentialServiceWithHealth(t, creds, false)
+	return sock
+}
+
+// startCredentialServiceWithHealth is startCredentialService also serving the health service if
+// withHealth is set. Credentials with an empty username are returned as token expiring in a minute.
+func startCredentialServiceWithHealth(t *testing.T, creds map[string][2]string, withHealth bool) (string, *health.Server) {
+	t.Helper()
+
+	sock := filepath.Join(t.TempDir(), "credential.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	credentialv1.RegisterCredentialServiceServer(srv, &credentialService{creds: creds})
+	var healthSrv *health.Server
+	if withHealth {
+		healthSrv = health.NewServer()
+		healthpb.RegisterHealthServer(srv, healthSrv)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	return sock, healthSrv
+}
+
+type credentialService struct {
+	credentialv1.UnimplementedCredentialServiceServer
+	creds map[string][2]string
+}
+
+func (s *credentialService) GetCredentials(_ context.Context, req *credentialv1.GetCredentialsRequest) (*credentialv1.GetCredentialsResponse, error) {
+	cred, ok := s.creds[req.GetHost()]
+	if !ok {
+		return &credentialv1.GetCredentialsResponse{}, nil
+	}
+	if cred[0] == "" {
+		return &credentialv1.GetCredentialsResponse{Token: cred[1], ExpiresIn: 60}, nil
+	}
+	return &credentialv1.GetCredentialsResponse{Username: cred[0], Password: cred[1]}, nil
+}
+
+func TestGRPCProvider(t *testing.T) {
+	sock := startCredentialService(t, map[string][2]string{
+		"registry.example.com": {"user", "pass"},
+	})
+
+	p, err := NewGRPCProvider(sock, 0)
+	require.NoError(t, err)
+	defer p.Close()
+
+	kc, err := p.GetCredentials(&AuthRequest{Ref: "registry.example.com/library/nginx:latest"})
+	require.NoError(t, err)
+	require.NotNil(t, kc)
+	assert.Equal(t, "user", kc.Username)
+	assert.Equal(t, "pass", kc.Password)
+
+	kc, err = p.GetCredentials(&AuthRequest{Ref: "other.example.com/library/nginx:latest"})
+	require.NoError(t, err)
+	assert.Nil(t, kc)
+
+	_, err = p.GetCredentials(&AuthRequest{})
+	require.Error(t, err)
+
+	_, err = NewGRPCProvider("", 0)
+	require.Error(t, err)
+}
+
+func TestGRPCProviderFallback(t *testing.T) {
+	p, err := NewGRPCProvider(filepath.Join(t.TempDir(), "missing.sock"), time.Second)
+	require.NoError(t, err)
+	defer p.Close()
+
+	_, err = p.GetCredentials(&AuthRequest{Ref: "registry.example.com/library/nginx:latest"})
+	require.Error(t, err)
+
+	// An unreachable credential service falls back to the next providers.
+	fallback := &mockNonRenewableProvider{creds: &PassKeyChain{Username: "docker", Password: "secret"}}
+	kc := fetchFromProviders(&AuthRequest{Ref: "registry.example.com/library/nginx:latest"},
+		[]AuthProvider{p, fallback})
+	require.NotNil(t, kc)
+	assert.Equal(t, "docker", kc.Username)
+}
+
+func TestGRPCProviderToken(t *testing.T) {
+	sock := startCredentialService(t, map[string][2]string{
+		"registry.example.com": {"", "token"},
+	})
+
+	p, err := NewGRPCProvider(sock, 0)
+	require.NoError(t, err)
+	defer p.Close()
+	require.True(t, p.CanRenew())
+
+	kc, err := p.GetCredentials(&AuthRequest{Ref: "registry.example.com/library/nginx:latest"})
+	require.NoError(t, err)
+	require.NotNil(t, kc)
+	assert.Empty(t, kc.Username)
+	assert.Equal(t, "token", kc.Password)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), kc.Expiry, 5*time.Second)
+}
+
+func TestGRPCProviderHealth(t *testing.T) {
+	sock, healthSrv := startCredentialServiceWithHealth(t, map[string][2]string{
+		"registry.example.com": {"user", "pass"},
+	}, true)
+	const ref = "registry.example.com/library/nginx:latest"
+
+	p, err := NewGRPCProvider(sock, 0)
+	require.NoError(t, err)
+	defer p.Close()
+
+	// Services not reporting the status of the credential service are asked.
+	kc, err := p.GetCredentials(&AuthRequest{Ref: ref})
+	require.NoError(t, err)
+	require.NotNil(t, kc)
+
+	healthSrv.SetServingStatus(CredentialService, healthpb.HealthCheckResponse_NOT_SERVING)
+	p.healthCheck = time.Time{}
+	_, err = p.GetCredentials(&AuthRequest{Ref: ref})
+	require.ErrorContains(t, err, "not serving")
+
+	// The status is only checked again after a while.
+	healthSrv.SetServingStatus(CredentialService, healthpb.HealthCheckResponse_SERVING)
+	_, err = p.GetCredentials(&AuthRequest{Ref: ref})
+	require.ErrorContains(t, err, "not serving")
+
+	p.healthCheck = time.Time{}
+	kc, err = p.GetCredentials(&AuthRequest{Ref: ref})
+	require.NoError(t, err)
+	assert.Equal(t, "user", kc.Username)
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+
+	remoteauth "github.com/containerd/nydus-snapshotter/pkg/remote/remotes/docker/auth"
+)
+
+const (
+	identityTokenClientID       = "nydus-snapshotter"
+	identityTokenRequestTimeout = 10 * time.Second
+	// Lifetime of access tokens whose response has no expires_in, as the distribution
+	// token specification prescribes.
+	defaultAccessTokenLifetime = 60 * time.Second
+	// Access tokens not exchanged again for this long after they expired aren't used anymore.
+	accessTokenForgetAfter = 10 * time.Minute
+)
+
+// identityTokenClient sends the token exchange requests. It is a variable so tests can
+// substitute a client trusting their registry.
+var identityTokenClient = &http.Client{Timeout: identityTokenRequestTimeout}
+
+// An access token exchanged for an identity token, and when it should be replaced.
+type accessToken struct {
+	token     string
+	expiresAt time.Time
+	refreshAt time.Time
+}
+
+var (
+	accessTokensLock sync.Mutex
+	// Keyed by registry host, repository and digest of the identity token.
+	accessTokens = map[string]accessToken{}
+	// Exchanges in flight, so concurrent mounts of an image share one.
+	accessTokenExchanges singleflight.Group
+)
+
+// ExchangeIdentityToken returns a keychain with a bearer access token to pull repo from the
+// registry host, obtained from the token server of the registry with the OAuth2 refresh
+// token grant for the identity token of kc, e.g. saved by `docker login` with an OAuth2
+// identity provider. The registry is reached by scheme, https if empty. Access tokens are
+// shared until a third of their lifetime is left.
+func ExchangeIdentityToken(scheme, host, repo string, kc *PassKeyChain) (*PassKeyChain, error) {
+	if kc == nil || kc.IdentityToken == "" {
+		return kc, nil
+	}
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	digest := sha256.Sum256([]byte(kc.IdentityToken))
+	key := strings.Join([]string{scheme, host, repo, hex.EncodeToString(digest[:])}, "|")
+
+	accessTokensLock.Lock()
+	t, ok := accessTokens[key]
+	accessTokensLock.Unlock()
+	if !ok || !time.Now().Before(t.refreshAt) {
+		v, err, _ := accessTokenExchanges.Do(key, func() (interface{}, error) {
+			t, err := requestAccessToken(scheme, host, repo, kc.IdentityToken)
+			if err != nil {
+				return nil, err
+			}
+			accessTokensLock.Lock()
+			accessTokens[key] = t
+			accessTokensLock.Unlock()
+			return t, nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "exchange identity token for %s/%s", host, repo)
+		}
+		t = v.(accessToken)
+	}
+	return &PassKeyChain{Password: t.token, Scope: kc.Scope, Expiry: t.expiresAt}, nil
+}
+
+// NextIdentityTokenRefresh returns when the earliest access token handed out so far should
+// be replaced, false if there are none. Tokens are kept past their expiry, so an instance
+// still using one gets a new one, and only forgotten once no instance asked for a new one
+// for accessTokenForgetAfter.
+func NextIdentityTokenRefresh() (time.Time, bool) {
+	accessTokensLock.Lock()
+	defer accessTokensLock.Unlock()
+
+	var next time.Time
+	for key, t := range accessTokens {
+		if time.Since(t.expiresAt) > accessTokenForgetAfter {
+			delete(accessTokens, key)
+			continue
+		}
+		if next.IsZero() || t.refreshAt.Before(next) {
+			next = t.refreshAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func requestAccessToken(scheme, host, repo, identityToken string) (accessToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), identityTokenRequestTimeout)
+	defer cancel()
+
+	// The token server is announced by the challenge of the registry.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+host+"/v2/", nil)
+	if err != nil {
+		return accessToken{}, err
+	}
+	resp, err := identityTokenClient.Do(req)
+	if err != nil {
+		return accessToken{}, errors.Wrap(err, "ping registry")
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	var realm, service string
+	for _, c := range remoteauth.ParseAuthHeader(resp.Header) {
+		if c.Scheme == remoteauth.BearerAuth {
+			realm, service = c.Parameters["realm"], c.Parameters["service"]
+			break
+		}
+	}
+	if realm == "" {
+		return accessToken{}, errors.Errorf("registry returned no bearer challenge, status %d", resp.StatusCode)
+	}
+
+	issuedAt := time.Now()
+	tr, err := remoteauth.FetchTokenWithOAuth(ctx, identityTokenClient, nil, identityTokenClientID, remoteauth.TokenOptions{
+		Realm:   realm,
+		Service: service,
+		Scopes:  []string{"repository:" + repo + ":pull"},
+		Secret:  identityToken,
+	})
+	if err != nil {
+		return accessToken{}, err
+	}
+
+	lifetime := time.Duration(tr.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultAccessTokenLifetime
+	}
+	return accessToken{
+		token:     tr.AccessToken,
+		expiresAt: issuedAt.Add(lifetime),
+		refreshAt: issuedAt.Add(lifetime - lifetime/3),
+	}, nil
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeIdentityToken(t *testing.T) {
+	var exchanges atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry.example.com"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/token":
+			require.NoError(t, r.ParseForm())
+			if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "identity" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			require.Equal(t, "registry.example.com", r.Form.Get("service"))
+			require.Equal(t, "repository:team/app:pull", r.Form.Get("scope"))
+			exchanges.Add(1)
+			fmt.Fprintf(w, `{"access_token":"access-%d","expires_in":300}`, exchanges.Load())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	oldClient, oldTokens := identityTokenClient, accessTokens
+	defer func() { identityTokenClient, accessTokens = oldClient, oldTokens }()
+	identityTokenClient = server.Client()
+	accessTokens = map[string]accessToken{}
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	kc, err := ExchangeIdentityToken("", host, "team/app", &PassKeyChain{IdentityToken: "identity", Scope: "team"})
+	require.NoError(t, err)
+	require.Equal(t, "access-1", kc.Password)
+	require.True(t, kc.TokenBase())
+	require.Equal(t, "team", kc.Scope)
+	require.WithinDuration(t, time.Now().Add(300*time.Second), kc.Expiry, 5*time.Second)
+
+	next, ok := NextIdentityTokenRefresh()
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(200*time.Second), next, 5*time.Second)
+
+	// The access token is reused until it is due for refresh.
+	kc, err = ExchangeIdentityToken("", host, "team/app", &PassKeyChain{IdentityToken: "identity"})
+	require.NoError(t, err)
+	require.Equal(t, "access-1", kc.Password)
+	for key, token := range accessTokens {
+		token.refreshAt = time.Now()
+		accessTokens[key] = token
+	}
+	kc, err = ExchangeIdentityToken("", host, "team/app", &PassKeyChain{IdentityToken: "identity"})
+	require.NoError(t, err)
+	require.Equal(t, "access-2", kc.Password)
+
+	_, err = ExchangeIdentityToken("", host, "team/app", &PassKeyChain{IdentityToken: "revoked"})
+	require.Error(t, err)
+
+	basic := &PassKeyChain{Username: "user", Password: "pass"}
+	kc, err = ExchangeIdentityToken("", host, "team/app", basic)
+	require.NoError(t, err)
+	require.Equal(t, basic, kc)
+
+	// Expired tokens are still refreshed, until no instance asked for them for a while.
+	for key, token := range accessTokens {
+		token.refreshAt, token.expiresAt = time.Now().Add(-time.Minute), time.Now().Add(-time.Second)
+		accessTokens[key] = token
+	}
+	next, ok = NextIdentityTokenRefresh()
+	require.True(t, ok)
+	require.True(t, next.Before(time.Now()))
+	for key, token := range accessTokens {
+		token.expiresAt = time.Now().Add(-accessTokenForgetAfter - time.Second)
+		accessTokens[key] = token
+	}
+	_, ok = NextIdentityTokenRefresh()
+	require.False(t, ok)
+}
+
+func TestExchangeIdentityToken_Scheme(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/token":
+			fmt.Fprint(w, `{"access_token":"access"}`)
+		}
+	}))
+	defer server.Close()
+
+	oldTokens := accessTokens
+	defer func() { accessTokens = oldTokens }()
+	accessTokens = map[string]accessToken{}
+
+	kc, err := ExchangeIdentityToken("http", strings.TrimPrefix(server.URL, "http://"), "app", &PassKeyChain{IdentityToken: "identity"})
+	require.NoError(t, err)
+	require.Equal(t, "access", kc.Password)
+}
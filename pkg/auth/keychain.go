@@ -30,6 +30,13 @@ var (
 type PassKeyChain struct {
 	Username string
 	Password string
+	// Scope restricts the credential to a repository path prefix, e.g. "team-a"
+	// covers "team-a/app". Empty means the credential is valid for the whole registry.
+	Scope string
+	// When the credential expires, if the provider knows it
+	Expiry time.Time
+	// OAuth2 refresh token to exchange for access tokens, see ExchangeIdentityToken
+	IdentityToken string
 }
 
 func FromBase64(str string) (PassKeyChain, error) {
@@ -54,6 +61,15 @@ func (kc PassKeyChain) ToBase64() string {
 	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", kc.Username, kc.Password)))
 }
 
+// InScope reports whether the credential can be used to access repo.
+func (kc PassKeyChain) InScope(repo string) bool {
+	scope := strings.Trim(kc.Scope, "/")
+	if scope == "" {
+		return true
+	}
+	return repo == scope || strings.HasPrefix(repo, scope+"/")
+}
+
 // TokenBase check if PassKeyChain is token based, when username is empty and password is not empty
 // then password is registry token
 func (kc PassKeyChain) TokenBase() bool {
@@ -67,15 +83,32 @@ func (kc PassKeyChain) TokenBase() bool {
 // available at pull time via snapshot labels and are not accessible during
 // renewal. It is a variable so tests can substitute a different builder.
 var renewableProviders = func() []AuthProvider {
-	providers := []AuthProvider{NewDockerProvider()}
+	var providers []AuthProvider
+	if grpcProvider != nil {
+		providers = append(providers, grpcProvider)
+	}
+	if authFileProvider != nil {
+		providers = append(providers, authFileProvider)
+	}
+	providers = append(providers, NewDockerProvider())
+	if credHelperProvider != nil {
+		providers = append(providers, credHelperProvider)
+	}
 	if kubeletProvider != nil {
 		providers = append(providers, kubeletProvider)
 	}
+	if gcpProvider != nil {
+		providers = append(providers, gcpProvider)
+	}
+	if azureProvider != nil {
+		providers = append(providers, azureProvider)
+	}
 	return append(providers, NewKubeSecretProvider())
 }
 
 // buildProviders returns the full ordered list of auth providers.
-// Priority: labels > CRI > docker > kubelet > kubesecret.
+// Priority: labels > CRI > gRPC credential service > auth file > docker > credential helpers >
+// kubelet > gcp > azure > kubesecret.
 // It is a variable so tests can substitute a different builder.
 var buildProviders = func() []AuthProvider {
 	return append([]AuthProvider{NewLabelsProvider(), NewCRIProvider()}, renewableProviders()...)
@@ -83,15 +116,22 @@ var buildProviders = func() []AuthProvider {
 
 // GetRegistryKeyChain retrieves image pull credentials from the first provider
 // that returns a result, checked in priority order:
-// 1. credential renewal store (if enabled)
+// 1. credential renewal store and keychain cache (if enabled)
 // 2. username and secrets labels
 // 3. cri request
-// 4. docker config
-// 5. kubelet credential helpers
-// 6. k8s docker config secret
+// 4. gRPC credential service
+// 5. auth file
+// 6. docker config
+// 7. docker credential helpers
+// 8. kubelet credential helpers
+// 9. GCP metadata server
+// 10. Azure managed identity
+// 11. k8s docker config secret
 //
 // When a renewable provider returns credentials and the renewal store is
-// enabled, the credentials are cached for periodic renewal.
+// enabled, the credentials are cached for periodic renewal. With the keychain
+// cache enabled, credentials of providers not depending on the pod, see
+// cachedSource, are cached for its TTL.
 func GetRegistryKeyChain(ref string, labels map[string]string) *PassKeyChain {
 	return getRegistryKeyChainFromProviders(ref, labels, buildProviders())
 }
@@ -105,22 +145,41 @@ func getRegistryKeyChainFromProviders(ref string, labels map[string]string, prov
 	if renewalStore != nil {
 		if kc := renewalStore.Get(ref); kc != nil {
 			logger.Debug("serving credentials from renewal store")
+			credentialAudit.record(ref, "renewal-store", true)
 			return kc
 		}
 		// If not available, request credentials valid until the next renewal tick.
 		authReq.ValidUntil = time.Now().Add(renewalStore.renewInterval)
 	}
-	return fetchFromProviders(authReq, providers)
+	kc, source, cached := fetchWithSource(authReq, providers, keyChainCache)
+	credentialAudit.record(ref, source, cached)
+	return kc
 }
 
 // fetchFromProviders walks providers in order and returns credentials from the
 // first one that succeeds. If the winning provider is renewable and the renewal
 // store is active, the credentials are cached for periodic renewal.
 func fetchFromProviders(req *AuthRequest, providers []AuthProvider) *PassKeyChain {
+	kc, _, _ := fetchWithSource(req, providers, nil)
+	return kc
+}
+
+// fetchWithSource is fetchFromProviders also returning the name of the provider of the
+// credentials, SourceAnonymous if none has any. With cache, the credentials of providers
+// are served from and added to it, and whether they were served from it is returned.
+func fetchWithSource(req *AuthRequest, providers []AuthProvider, cache *keyChainCacheStore) (*PassKeyChain, string, bool) {
 	logger := log.L.WithField("ref", req.Ref)
 
 	var errs []error
 	for _, provider := range providers {
+		source := provider.String()
+		useCache := cache != nil && cachedSource(source)
+		if useCache {
+			if kc := cache.Get(source, req.Ref); kc != nil {
+				logger.Debugf("serving credentials of %s from keychain cache", source)
+				return kc, source, true
+			}
+		}
 		logger.Debugf("Trying to get credentials from %s", provider)
 		kc, err := provider.GetCredentials(req)
 		if err != nil {
@@ -134,14 +193,17 @@ func fetchFromProviders(req *AuthRequest, providers []AuthProvider) *PassKeyChai
 					renewalStore.Add(req.Ref, kc)
 				}
 			}
-			return kc
+			if useCache {
+				cache.Add(source, req.Ref, kc)
+			}
+			return kc, source, false
 		}
 	}
 
 	if len(errs) > 0 {
 		logger.WithError(stderrors.Join(errs...)).Warn("Could not get registry credentials.")
 	}
-	return nil
+	return nil, SourceAnonymous, false
 }
 
 func GetKeyChainByRef(ref string, labels map[string]string) (*PassKeyChain, error) {
@@ -157,6 +219,11 @@ func (kc PassKeyChain) Resolve(_ authn.Resource) (authn.Authenticator, error) {
 // toAuthConfig convert PassKeyChain to authn.AuthConfig when kc is token based,
 // RegistryToken is preferred to
 func (kc PassKeyChain) toAuthConfig() authn.AuthConfig {
+	if kc.IdentityToken != "" {
+		return authn.AuthConfig{
+			IdentityToken: kc.IdentityToken,
+		}
+	}
 	if kc.TokenBase() {
 		return authn.AuthConfig{
 			RegistryToken: kc.Password,
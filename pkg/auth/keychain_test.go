@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPassKeyChainInScope(t *testing.T) {
+	kc := PassKeyChain{Username: "user", Password: "pass"}
+	assert.True(t, kc.InScope("team-a/app"))
+
+	kc.Scope = "team-a"
+	assert.True(t, kc.InScope("team-a"))
+	assert.True(t, kc.InScope("team-a/app"))
+	assert.False(t, kc.InScope("team-b/app"))
+	assert.False(t, kc.InScope("team-ab/app"))
+
+	kc.Scope = "/team-a/app/"
+	assert.True(t, kc.InScope("team-a/app"))
+	assert.False(t, kc.InScope("team-a/other"))
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/docker/cli/cli/config/configfile"
@@ -25,7 +27,10 @@ var (
 	configMu           sync.Mutex
 )
 
-// KubeSecretProvider implements AuthProvider for Kubernetes secrets.
+// KubeSecretProvider implements AuthProvider for Kubernetes secrets. It is no
+// RenewableProvider, and its credentials are not cached either: both are keyed by
+// reference only, while the secrets are scoped to the namespace of the pod. The
+// informer keeps them current anyway.
 type KubeSecretProvider struct{}
 
 // NewKubeSecretProvider creates a new Kubernetes secret-based auth provider.
@@ -33,12 +38,8 @@ func NewKubeSecretProvider() *KubeSecretProvider {
 	return &KubeSecretProvider{}
 }
 
-// CanRenew implements RenewableProvider. KubeSecret credentials can be
-// refreshed because the underlying informer watches for secret changes.
-func (p *KubeSecretProvider) CanRenew() bool { return true }
-
 func (p *KubeSecretProvider) String() string {
-	return "kubesecret"
+	return sourceKubeSecret
 }
 
 // GetCredentials retrieves credentials from Kubernetes secrets.
@@ -52,12 +53,25 @@ func (p *KubeSecretProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, er
 		return nil, errors.New("ref not found in request")
 	}
 
-	_, host, err := parseReference(req.Ref)
+	host, keys, err := scopedKeys(req.Ref)
 	if err != nil {
 		return nil, errors.Wrapf(err, "parse reference %s", req.Ref)
 	}
 
-	passKey := kubeSecretListener.GetCredentialsStore(host)
+	// Images pulled by pods are only given the secrets of their namespace.
+	if ns, ok := pullNamespace(req.Ref); ok {
+		passKey := kubeSecretListener.getCredentialsStore(keys, ns)
+		if passKey == nil {
+			return nil, fmt.Errorf("no kube secret credentials found for host %s in namespace %s", host, ns)
+		}
+		return passKey, nil
+	}
+	// Secrets of selected namespaces are not handed to images of unknown pods.
+	if kubeSecretListener.namespaced {
+		return nil, errors.Errorf("namespace of the pull of %s is unknown", req.Ref)
+	}
+
+	passKey := kubeSecretListener.getCredentialsStore(keys, "")
 	if passKey == nil {
 		return nil, fmt.Errorf("no kube secret credentials found for host: %s", host)
 	}
@@ -66,11 +80,18 @@ func (p *KubeSecretProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, er
 }
 
 type KubeSecretListener struct {
+	// Keyed by <namespace>/<name> of the secret
 	dockerConfigs map[string]*configfile.ConfigFile
-	informer      cache.SharedIndexInformer
+	informers     []cache.SharedIndexInformer
+	// Whether only some namespaces are watched, whose secrets are only used by images
+	// pulled by pods of the namespace.
+	namespaced bool
 }
 
-func InitKubeSecretListener(ctx context.Context, kubeconfigPath string) error {
+// InitKubeSecretListener watches the dockerconfigjson secrets of the given namespaces,
+// of all namespaces if none are given. The secrets of given namespaces are only used for
+// images pulled by pods of the namespace, see AddPullNamespaceProxy.
+func InitKubeSecretListener(ctx context.Context, kubeconfigPath string, namespaces []string) error {
 	configMu.Lock()
 	defer configMu.Unlock()
 	if kubeSecretListener != nil {
@@ -78,6 +99,7 @@ func InitKubeSecretListener(ctx context.Context, kubeconfigPath string) error {
 	}
 	kubeSecretListener = &KubeSecretListener{
 		dockerConfigs: make(map[string]*configfile.ConfigFile),
+		namespaced:    len(namespaces) > 0,
 	}
 
 	if kubeconfigPath != "" {
@@ -105,7 +127,7 @@ func InitKubeSecretListener(ctx context.Context, kubeconfigPath string) error {
 		logrus.WithError(err).Warningf("failed to create kubernetes client")
 		return err
 	}
-	if err := kubeSecretListener.SyncKubeSecrets(ctx, clientset); err != nil {
+	if err := kubeSecretListener.SyncKubeSecrets(ctx, clientset, namespaces); err != nil {
 		logrus.WithError(err).Warningf("failed to sync secrets")
 		return err
 	}
@@ -134,26 +156,45 @@ func (kubelistener *KubeSecretListener) deleteDockerConfig(key string) {
 	configMu.Unlock()
 }
 
-func (kubelistener *KubeSecretListener) SyncKubeSecrets(ctx context.Context, clientset *kubernetes.Clientset) error {
-	if kubelistener.informer != nil {
+func (kubelistener *KubeSecretListener) SyncKubeSecrets(ctx context.Context, clientset *kubernetes.Clientset, namespaces []string) error {
+	if len(kubelistener.informers) != 0 {
 		return nil
 	}
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	for _, ns := range namespaces {
+		informer, err := kubelistener.newInformer(clientset, ns)
+		if err != nil {
+			return errors.Wrapf(err, "watch secrets of namespace %q", ns)
+		}
+		kubelistener.informers = append(kubelistener.informers, informer)
+		go informer.Run(ctx.Done())
+	}
+	for _, informer := range kubelistener.informers {
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			return fmt.Errorf("timed out for syncing cache")
+		}
+	}
+	return nil
+}
+
+func (kubelistener *KubeSecretListener) newInformer(clientset *kubernetes.Clientset, namespace string) (cache.SharedIndexInformer, error) {
 	informer := cache.NewSharedIndexInformer(
 		&cache.ListWatch{
 			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
 				options.FieldSelector = "type=" + string(corev1.SecretTypeDockerConfigJson)
-				return clientset.CoreV1().Secrets(metav1.NamespaceAll).List(context.Background(), options)
+				return clientset.CoreV1().Secrets(namespace).List(context.Background(), options)
 			},
 			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
 				options.FieldSelector = "type=" + string(corev1.SecretTypeDockerConfigJson)
-				return clientset.CoreV1().Secrets(metav1.NamespaceAll).Watch(context.Background(), options)
+				return clientset.CoreV1().Secrets(namespace).Watch(context.Background(), options)
 			}},
 		&corev1.Secret{},
 		0,
 		cache.Indexers{},
 	)
-	kubelistener.informer = informer
-	_, err := kubelistener.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			key, err := cache.MetaNamespaceKeyFunc(obj)
 			if err != nil {
@@ -185,28 +226,32 @@ func (kubelistener *KubeSecretListener) SyncKubeSecrets(ctx context.Context, cli
 		}},
 	)
 	if err != nil {
-		return errors.Wrap(err, "add event handler to informer")
-	}
-	go kubelistener.informer.Run(ctx.Done())
-	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
-		return fmt.Errorf("timed out for syncing cache")
+		return nil, errors.Wrap(err, "add event handler to informer")
 	}
-	return nil
+	return informer, nil
 }
 
 func (kubelistener *KubeSecretListener) GetCredentialsStore(host string) *PassKeyChain {
+	return kubelistener.getCredentialsStore([]scopedKey{{key: host}}, "")
+}
+
+// getCredentialsStore looks up the auth for the most specific of keys in the secrets of
+// namespace, of all watched namespaces if empty. Secrets are searched in the order of
+// their keys.
+func (kubelistener *KubeSecretListener) getCredentialsStore(keys []scopedKey, namespace string) *PassKeyChain {
 	configMu.Lock()
 	defer configMu.Unlock()
-	for _, dockerConfig := range kubelistener.dockerConfigs {
-		// Find the auth for the host.
-		authConfig, err := dockerConfig.GetAuthConfig(host)
-		if err != nil {
-			continue
+	names := make([]string, 0, len(kubelistener.dockerConfigs))
+	for name := range kubelistener.dockerConfigs {
+		if namespace == "" || strings.HasPrefix(name, namespace+"/") {
+			names = append(names, name)
 		}
-		if len(authConfig.Username) != 0 && len(authConfig.Password) != 0 {
-			return &PassKeyChain{
-				Username: authConfig.Username,
-				Password: authConfig.Password,
+	}
+	sort.Strings(names)
+	for _, k := range keys {
+		for _, name := range names {
+			if kc := scopedAuthConfig(kubelistener.dockerConfigs[name], k); kc != nil {
+				return kc
 			}
 		}
 	}
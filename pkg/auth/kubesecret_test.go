@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/docker/cli/cli/config/configfile"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -34,7 +35,7 @@ func TestGetCredentialsStore(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	// Host may not has kubeconfig, so ignore the error and continue the test
-	_ = InitKubeSecretListener(ctx, "")
+	_ = InitKubeSecretListener(ctx, "", nil)
 	assert.NotNil(kubeSecretListener)
 
 	var obj interface{} = &corev1.Secret{
@@ -63,3 +64,71 @@ func TestGetCredentialsStore(t *testing.T) {
 	auth = kubeSecretListener.GetCredentialsStore(extraHost)
 	assert.Nil(auth)
 }
+
+func TestGetNamespacedCredentials(t *testing.T) {
+	assert := assert.New(t)
+	listener := &KubeSecretListener{dockerConfigs: map[string]*configfile.ConfigFile{}}
+	defer func(l *KubeSecretListener) { kubeSecretListener = l }(kubeSecretListener)
+	kubeSecretListener = listener
+
+	secret := func(user string) *corev1.Secret {
+		return &corev1.Secret{Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(testDockerConfigJSONFmt, extraHost, user,
+				registryPass, registryEmail, base64.StdEncoding.EncodeToString([]byte(user+":"+registryPass)))),
+		}}
+	}
+	assert.NoError(listener.addDockerConfig("team-a/pull", secret("a")))
+	assert.NoError(listener.addDockerConfig("team-b/pull", secret("b")))
+
+	// Without a known namespace all secrets are candidates, the first by key wins.
+	ref := extraHost + "/team/app:latest"
+	auth, err := NewKubeSecretProvider().GetCredentials(&AuthRequest{Ref: ref})
+	assert.NoError(err)
+	assert.Equal("a", auth.Username)
+
+	recordPullNamespace(ref, "team-b")
+	defer func() {
+		pullNamespacesMu.Lock()
+		defer pullNamespacesMu.Unlock()
+		pullNamespaces = map[string]pullNamespaceRecord{}
+	}()
+	auth, err = NewKubeSecretProvider().GetCredentials(&AuthRequest{Ref: ref})
+	assert.NoError(err)
+	assert.Equal("b", auth.Username)
+
+	recordPullNamespace(ref, "team-c")
+	_, err = NewKubeSecretProvider().GetCredentials(&AuthRequest{Ref: ref})
+	assert.Error(err)
+
+	// With selected namespaces, images of unknown pods get no secrets.
+	listener.namespaced = true
+	_, err = NewKubeSecretProvider().GetCredentials(&AuthRequest{Ref: extraHost + "/other/app:latest"})
+	assert.ErrorContains(err, "unknown")
+}
+
+func TestGetScopedCredentials(t *testing.T) {
+	assert := assert.New(t)
+	listener := &KubeSecretListener{dockerConfigs: map[string]*configfile.ConfigFile{}}
+	defer func(l *KubeSecretListener) { kubeSecretListener = l }(kubeSecretListener)
+	kubeSecretListener = listener
+
+	secret := func(key, user string) *corev1.Secret {
+		return &corev1.Secret{Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(testDockerConfigJSONFmt, key, user,
+				registryPass, registryEmail, base64.StdEncoding.EncodeToString([]byte(user+":"+registryPass)))),
+		}}
+	}
+	// The secret of the registry is sorted first, but the one of the repository is more specific.
+	assert.NoError(listener.addDockerConfig("a/registry", secret(extraHost, "registry")))
+	assert.NoError(listener.addDockerConfig("b/team", secret(extraHost+"/team-a", "team-a")))
+
+	auth, err := NewKubeSecretProvider().GetCredentials(&AuthRequest{Ref: extraHost + "/team-a/app:latest"})
+	assert.NoError(err)
+	assert.Equal("team-a", auth.Username)
+	assert.Equal("team-a", auth.Scope)
+
+	auth, err = NewKubeSecretProvider().GetCredentials(&AuthRequest{Ref: extraHost + "/team-ab/app:latest"})
+	assert.NoError(err)
+	assert.Equal("registry", auth.Username)
+	assert.Empty(auth.Scope)
+}
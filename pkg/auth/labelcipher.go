@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/containerd/log"
+	distribution "github.com/distribution/reference"
+	"github.com/pkg/errors"
+)
+
+// EncryptedLabelPrefix marks label values encrypted with the label encryption key.
+const EncryptedLabelPrefix = "enc:v1:"
+
+const labelKeySize = 32
+
+var (
+	labelCipher *LabelCipher
+	// Whether plain credential labels are refused, once all clients encrypt them.
+	labelCipherRequired bool
+	labelCipherMu       sync.Mutex
+)
+
+// LabelCipher encrypts and decrypts the values of credential labels with AES-256-GCM, so
+// that they are not readable by anyone who can list snapshots. The image ref and the label
+// name are bound to the value, which can't be moved to another image or label.
+type LabelCipher struct {
+	aead cipher.AEAD
+}
+
+// InitLabelEncryption initializes the global label cipher with the key in keyFile. Plain
+// credential labels are still accepted with a warning while clients migrate, unless required.
+// This should be called once at startup if label encryption is configured.
+func InitLabelEncryption(keyFile string, required bool) error {
+	labelCipherMu.Lock()
+	defer labelCipherMu.Unlock()
+
+	if labelCipher != nil {
+		return nil
+	}
+
+	c, err := NewLabelCipher(keyFile)
+	if err != nil {
+		return err
+	}
+	labelCipher = c
+	labelCipherRequired = required
+	log.L.WithField("key_file", keyFile).WithField("required", required).Info("label encryption initialized")
+	return nil
+}
+
+// NewLabelCipher creates a cipher with the 32 bytes key in keyFile, raw or base64 encoded.
+func NewLabelCipher(keyFile string) (*LabelCipher, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read label encryption key")
+	}
+	key := b
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b))); err == nil && len(decoded) == labelKeySize {
+		key = decoded
+	}
+	if len(key) != labelKeySize {
+		return nil, errors.Errorf("label encryption key in %s must have %d bytes", keyFile, labelKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &LabelCipher{aead: aead}, nil
+}
+
+// Encrypt returns the encrypted value of the label name of the image ref, prefixed with
+// EncryptedLabelPrefix.
+func (c *LabelCipher) Encrypt(ref, name, value string) (string, error) {
+	ad, err := labelAdditionalData(ref, name)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "generate nonce")
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), ad)
+	return EncryptedLabelPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plain value of the label name of the image ref encrypted by Encrypt.
+func (c *LabelCipher) Decrypt(ref, name, value string) (string, error) {
+	ad, err := labelAdditionalData(ref, name)
+	if err != nil {
+		return "", err
+	}
+	encoded, ok := strings.CutPrefix(value, EncryptedLabelPrefix)
+	if !ok {
+		return "", errors.Errorf("label %s is not encrypted", name)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.Wrapf(err, "decode label %s", name)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.Errorf("encrypted label %s is too short", name)
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return "", errors.Wrapf(err, "decrypt label %s of %s", name, ref)
+	}
+	return string(plain), nil
+}
+
+// labelAdditionalData returns the additional data values are sealed with, the normalized
+// image ref, so that e.g. "busybox" and "docker.io/library/busybox:latest" are alike, and
+// the label name.
+func labelAdditionalData(ref, name string) ([]byte, error) {
+	named, err := distribution.ParseDockerRef(ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse reference %q of label %s", ref, name)
+	}
+	return []byte(named.String() + "\x00" + name), nil
+}
+
+// credentialLabel returns the plain value of the credential label name of the image ref,
+// decrypting it if label encryption is enabled. Plain values are refused if encryption is
+// required, unless optional, e.g. usernames.
+func credentialLabel(ref string, labels map[string]string, name string, optional bool) (string, error) {
+	value := labels[name]
+	labelCipherMu.Lock()
+	c, required := labelCipher, labelCipherRequired
+	labelCipherMu.Unlock()
+
+	if c == nil || value == "" {
+		return value, nil
+	}
+	if !strings.HasPrefix(value, EncryptedLabelPrefix) {
+		if optional {
+			return value, nil
+		}
+		if !required {
+			log.L.Warnf("credential label %s is not encrypted", name)
+			return value, nil
+		}
+	}
+	return c.Decrypt(ref, name, value)
+}
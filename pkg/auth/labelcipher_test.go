@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package auth
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+func TestLabelCipher(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "label.key")
+	key := strings.Repeat("k", labelKeySize)
+	require.NoError(t, os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString([]byte(key))+"\n"), 0600))
+
+	c, err := NewLabelCipher(keyFile)
+	require.NoError(t, err)
+	const ref = "registry.example.com/app:latest"
+	encrypted, err := c.Encrypt(ref, label.NydusImagePullSecret, "pass")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(encrypted, EncryptedLabelPrefix))
+	require.NotContains(t, encrypted, "pass")
+
+	// Raw keys work alike.
+	rawKeyFile := filepath.Join(dir, "raw.key")
+	require.NoError(t, os.WriteFile(rawKeyFile, []byte(key), 0600))
+	raw, err := NewLabelCipher(rawKeyFile)
+	require.NoError(t, err)
+	plain, err := raw.Decrypt(ref, label.NydusImagePullSecret, encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "pass", plain)
+
+	// Values are bound to their label and image.
+	_, err = c.Decrypt(ref, label.NydusImagePullUsername, encrypted)
+	require.Error(t, err)
+	_, err = c.Decrypt("registry.example.com/other:latest", label.NydusImagePullSecret, encrypted)
+	require.Error(t, err)
+	_, err = c.Decrypt(ref, label.NydusImagePullSecret, "pass")
+	require.ErrorContains(t, err, "not encrypted")
+
+	require.NoError(t, os.WriteFile(rawKeyFile, []byte("short"), 0600))
+	_, err = NewLabelCipher(rawKeyFile)
+	require.ErrorContains(t, err, "32 bytes")
+
+	oldCipher, oldRequired := labelCipher, labelCipherRequired
+	defer func() { labelCipher, labelCipherRequired = oldCipher, oldRequired }()
+	labelCipher = c
+
+	encryptedLabels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   encrypted,
+	}
+	kc, err := NewLabelsProvider().GetCredentials(&AuthRequest{Ref: ref, Labels: encryptedLabels})
+	require.NoError(t, err)
+	require.Equal(t, &PassKeyChain{Username: "user", Password: "pass"}, kc)
+	// Refs are compared normalized.
+	encrypted, err = c.Encrypt("busybox", label.NydusImagePullSecret, "pass")
+	require.NoError(t, err)
+	plain, err = c.Decrypt("docker.io/library/busybox:latest", label.NydusImagePullSecret, encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "pass", plain)
+	// Labels copied to the snapshots of another image are refused.
+	_, err = NewLabelsProvider().GetCredentials(&AuthRequest{Ref: "registry.example.com/other:latest", Labels: encryptedLabels})
+	require.Error(t, err)
+
+	plainLabels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "pass",
+	}
+	// Plain secrets are accepted while clients migrate.
+	kc, err = NewLabelsProvider().GetCredentials(&AuthRequest{Labels: plainLabels})
+	require.NoError(t, err)
+	require.Equal(t, &PassKeyChain{Username: "user", Password: "pass"}, kc)
+
+	// And refused once encryption is required.
+	labelCipherRequired = true
+	_, err = NewLabelsProvider().GetCredentials(&AuthRequest{Labels: plainLabels})
+	require.Error(t, err)
+}
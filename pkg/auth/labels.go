@@ -30,18 +30,25 @@ func (p *LabelsProvider) GetCredentials(req *AuthRequest) (*PassKeyChain, error)
 		return nil, errors.New("labels not found in request")
 	}
 
-	u, found := req.Labels[label.NydusImagePullUsername]
-	if !found || u == "" {
+	u, err := credentialLabel(req.Ref, req.Labels, label.NydusImagePullUsername, true)
+	if err != nil {
+		return nil, err
+	}
+	if u == "" {
 		return nil, errors.New("username label not found")
 	}
 
-	pass, found := req.Labels[label.NydusImagePullSecret]
-	if !found || pass == "" {
+	pass, err := credentialLabel(req.Ref, req.Labels, label.NydusImagePullSecret, false)
+	if err != nil {
+		return nil, err
+	}
+	if pass == "" {
 		return nil, errors.New("password label not found")
 	}
 
 	return &PassKeyChain{
 		Username: u,
 		Password: pass,
+		Scope:    req.Labels[label.NydusImagePullScope],
 	}, nil
 }
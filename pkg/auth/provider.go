@@ -7,6 +7,7 @@
 package auth
 
 import (
+	"strings"
 	"time"
 
 	"github.com/containerd/containerd/v2/pkg/reference"
@@ -61,3 +62,32 @@ func parseReference(ref string) (refSpec reference.Spec, host string, err error)
 
 	return refSpec, host, nil
 }
+
+// scopedKey is a key credentials of an image may be stored under, and the repository
+// path prefix the key restricts them to, empty for the registry host.
+type scopedKey struct {
+	key   string
+	scope string
+}
+
+// scopedKeys returns the keys of the credentials of ref from the most specific one, e.g.
+// "registry.example.com/team/app", over its parent paths, e.g. "registry.example.com/team",
+// to the registry host, so that tenants sharing a registry get their own credentials.
+func scopedKeys(ref string) (string, []scopedKey, error) {
+	refSpec, host, err := parseReference(ref)
+	if err != nil {
+		return "", nil, err
+	}
+
+	repo := strings.TrimPrefix(refSpec.Locator, host+"/")
+	var keys []scopedKey
+	for repo != "" {
+		keys = append(keys, scopedKey{key: host + "/" + repo, scope: repo})
+		i := strings.LastIndex(repo, "/")
+		if i < 0 {
+			break
+		}
+		repo = repo[:i]
+	}
+	return host, append(keys, scopedKey{key: host}), nil
+}
@@ -38,12 +38,18 @@ func GetStoredCredential(ref string) *PassKeyChain {
 // provider list and caches them in the global store. Returns the keychain
 // on success or nil on failure. Emits renewal metrics.
 func RenewCredential(ref string) *PassKeyChain {
-	kc := fetchFromProviders(
+	kc, source, _ := fetchWithSource(
 		&AuthRequest{Ref: ref, ValidUntil: time.Now().Add(renewalStore.renewInterval)},
 		renewableProviders(),
+		nil,
 	)
 	if kc != nil {
 		data.CredentialRenewals.WithLabelValues(ref, "success").Inc()
+		if p := credHelperProvider; p != nil && p.storeRenewed && source != p.String() {
+			if err := p.Store(ref, kc); err != nil {
+				log.L.WithField("ref", ref).WithError(err).Warn("failed to store renewed credentials")
+			}
+		}
 	} else {
 		log.L.WithField("ref", ref).Warn("credential renewal returned no credentials from any provider")
 		data.CredentialRenewals.WithLabelValues(ref, "failure").Inc()
@@ -77,6 +83,8 @@ type credentialEntry struct {
 	ref       string
 	keychain  *PassKeyChain
 	renewedAt time.Time
+	// Zero if the credential does not tell
+	expiresAt time.Time
 }
 
 // --- credentialStore ---
@@ -102,21 +110,23 @@ func (s *credentialStore) Add(ref string, kc *PassKeyChain) {
 	defer s.mu.Unlock()
 
 	log.L.WithField("ref", ref).Debug("adding credential entry to store")
+	expiresAt, _ := kc.ExpiresAt()
 	s.entries[ref] = &credentialEntry{
 		ref:       ref,
 		keychain:  kc,
 		renewedAt: time.Now(),
+		expiresAt: expiresAt,
 	}
 	data.CredentialStoreEntries.WithLabelValues(ref).Set(1)
 }
 
-// Get returns the cached keychain for ref, or nil if not present.
+// Get returns the cached keychain for ref, or nil if not present or expired.
 func (s *credentialStore) Get(ref string) *PassKeyChain {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	entry, ok := s.entries[ref]
-	if !ok {
+	if !ok || (!entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt)) {
 		return nil
 	}
 	return entry.keychain
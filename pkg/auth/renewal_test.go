@@ -81,7 +81,7 @@ func TestRenewableProviderTypeAssertion(t *testing.T) {
 		{"LabelsProvider is not renewable", NewLabelsProvider(), false},
 		{"CRIProvider is not renewable", NewCRIProvider(), false},
 		{"DockerProvider is renewable", NewDockerProvider(), true},
-		{"KubeSecretProvider is renewable", NewKubeSecretProvider(), true},
+		{"KubeSecretProvider is not renewable", NewKubeSecretProvider(), false},
 		{"KubeletProvider is renewable", &KubeletProvider{}, true},
 	}
 
@@ -39,6 +39,8 @@ const (
 	endpointCacheMetrics = "/api/v1/metrics/blobcache"
 	// Fetch metrics about inflighting operations.
 	endpointInflightMetrics = "/api/v1/metrics/inflight"
+	// Fetch metrics of the storage backend, including per-blob ones.
+	endpointBackendMetrics = "/api/v1/metrics/backend"
 	// Request nydus daemon to retrieve its runtime states from the supervisor, recovering states for failover.
 	endpointTakeOver = "/api/v1/daemon/fuse/takeover"
 	// Request nydus daemon to send its runtime states to the supervisor, preparing for failover.
@@ -65,6 +67,8 @@ type NydusdClient interface {
 	GetDaemonInfo() (*types.DaemonInfo, error)
 
 	Mount(mountpoint, bootstrap, daemonConfig string) error
+	// Swap the configuration of a mounted instance, e.g. to point it to another backend
+	Remount(mountpoint, bootstrap, daemonConfig string) error
 	Umount(mountpoint string) error
 
 	BindBlob(daemonConfig string) error
@@ -73,6 +77,7 @@ type NydusdClient interface {
 	GetFsMetrics(sid string) (*types.FsMetrics, error)
 	GetInflightMetrics() (*types.InflightMetrics, error)
 	GetCacheMetrics(sid string) (*types.CacheMetrics, error)
+	GetBackendMetrics(sid string) (*types.BackendMetrics, error)
 
 	UpdateConfig(id string, params map[string]string) error
 
@@ -244,6 +249,19 @@ func (c *nydusdClient) Mount(mp, bootstrap, mountConfig string) error {
 	return c.request(http.MethodPost, url, bytes.NewBuffer(cmd), nil)
 }
 
+func (c *nydusdClient) Remount(mp, bootstrap, mountConfig string) error {
+	cmd, err := json.Marshal(types.NewMountRequest(bootstrap, mountConfig))
+	if err != nil {
+		return errors.Wrap(err, "construct remount request")
+	}
+
+	query := query{}
+	query.Add("mountpoint", mp)
+	url := c.url(endpointMount, query)
+
+	return c.request(http.MethodPut, url, bytes.NewBuffer(cmd), nil)
+}
+
 func (c *nydusdClient) Umount(mp string) error {
 	query := query{}
 	query.Add("mountpoint", mp)
@@ -326,6 +344,23 @@ func (c *nydusdClient) GetCacheMetrics(sid string) (*types.CacheMetrics, error)
 	return &m, nil
 }
 
+func (c *nydusdClient) GetBackendMetrics(sid string) (*types.BackendMetrics, error) {
+	query := query{}
+	if sid != "" {
+		query.Add("id", "/"+sid)
+	}
+
+	url := c.url(endpointBackendMetrics, query)
+	var m types.BackendMetrics
+	if err := c.request(http.MethodGet, url, nil, func(resp *http.Response) error {
+		return decode(resp, &m)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
 func (c *nydusdClient) UpdateConfig(id string, params map[string]string) error {
 	body, err := json.Marshal(params)
 	if err != nil {
@@ -146,3 +146,68 @@ func TestUpdateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestRemount(t *testing.T) {
+	var gotMountpoint string
+	var gotBody types.MountRequest
+
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/api/v1/mount", r.URL.Path)
+
+		gotMountpoint = r.URL.Query().Get("mountpoint")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	listener, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	ts.Listener = listener
+	ts.Start()
+	defer ts.Close()
+
+	client, err := NewNydusClient(sock)
+	require.NoError(t, err)
+
+	require.NoError(t, client.Remount("/snap-1", "/snapshots/1/fs/image/image.boot", `{"device":{}}`))
+	assert.Equal(t, "/snap-1", gotMountpoint)
+	assert.Equal(t, types.NewMountRequest("/snapshots/1/fs/image/image.boot", `{"device":{}}`), gotBody)
+}
+
+func TestGetBackendMetrics(t *testing.T) {
+	var gotID string
+
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/api/v1/metrics/backend", r.URL.Path)
+
+		gotID = r.URL.Query().Get("id")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "/snap-1", "backend_type": "registry", "read_count": 3, "blobs": [
+			{"blob_id": "blob-1", "read_count": 3, "read_retries": 1, "read_amount_total": 4096,
+			 "read_cumulative_latency_millis_total": 70, "read_latency_dist": [0, 2, 1, 0, 0, 0, 0, 0]}]}`))
+	}))
+	listener, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	ts.Listener = listener
+	ts.Start()
+	defer ts.Close()
+
+	client, err := NewNydusClient(sock)
+	require.NoError(t, err)
+
+	m, err := client.GetBackendMetrics("snap-1")
+	require.NoError(t, err)
+	assert.Equal(t, "/snap-1", gotID)
+	assert.Equal(t, "registry", m.BackendType)
+	require.Len(t, m.Blobs, 1)
+	assert.Equal(t, types.BlobBackendMetrics{
+		BlobID:                           "blob-1",
+		ReadCount:                        3,
+		ReadRetries:                      1,
+		ReadAmountTotal:                  4096,
+		ReadCumulativeLatencyMillisTotal: 70,
+		ReadLatencyDist:                  []uint64{0, 2, 1, 0, 0, 0, 0, 0},
+	}, m.Blobs[0])
+}
@@ -290,7 +290,7 @@ func (d *Daemon) sharedErofsMount(ra *rafs.Rafs) error {
 	}
 
 	// TODO: Why fs cache needing this work dir?
-	if err := os.MkdirAll(ra.FscacheWorkDir(), 0755); err != nil {
+	if err := os.MkdirAll(ra.FscacheWorkDir(), daemonconfig.FscacheWorkDirMode); err != nil {
 		return errors.Wrapf(err, "failed to create fscache work dir %s", ra.FscacheWorkDir())
 	}
 
@@ -540,6 +540,58 @@ func (d *Daemon) UpdateAuthConfig(snapshotID string, kc *auth.PassKeyChain) erro
 	return client.UpdateConfig(apiID, map[string]string{"registry_auth": kc.ToBase64()})
 }
 
+// ReloadConfig replaces the configuration of the given rafs instance on disk and, for
+// fusedev, remounts the instance in the running nydusd so that new backend settings take
+// effect without remounting containers. Fscache instances pick it up when bound again,
+// only their registry auth is updated in the running nydusd.
+func (d *Daemon) ReloadConfig(r *rafs.Rafs, cfg daemonconfig.DaemonConfig) error {
+	var configFile, mountpoint, apiID string
+	if d.IsSharedDaemon() {
+		configFile = d.ConfigFile(r.SnapshotID)
+		mountpoint = r.RelaMountpoint()
+		apiID = "/" + r.SnapshotID
+	} else {
+		configFile = d.ConfigFile("")
+		mountpoint = "/"
+		apiID = "/"
+	}
+
+	if err := cfg.DumpFile(configFile); err != nil {
+		return errors.Wrap(err, "write reloaded daemon config")
+	}
+	if !d.IsSharedDaemon() {
+		d.Config = cfg
+	}
+	if d.States.FsDriver == config.FsDriverFscache {
+		_, bc := cfg.StorageBackend()
+		if bc == nil || bc.Auth == "" {
+			return nil
+		}
+		client, err := d.GetClient()
+		if err != nil {
+			return errors.Wrap(err, "get client for config reload")
+		}
+		return client.UpdateConfig(apiID, map[string]string{"registry_auth": bc.Auth})
+	}
+	if d.States.FsDriver != config.FsDriverFusedev {
+		return nil
+	}
+
+	bootstrap, err := r.BootstrapFile()
+	if err != nil {
+		return err
+	}
+	content, err := cfg.DumpString()
+	if err != nil {
+		return errors.Wrap(err, "dump reloaded daemon config")
+	}
+	client, err := d.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "get client for config reload")
+	}
+	return client.Remount(mountpoint, bootstrap, content)
+}
+
 func (d *Daemon) GetCacheMetrics(sid string) (*types.CacheMetrics, error) {
 	c, err := d.GetClient()
 	if err != nil {
@@ -548,6 +600,14 @@ func (d *Daemon) GetCacheMetrics(sid string) (*types.CacheMetrics, error) {
 	return c.GetCacheMetrics(sid)
 }
 
+func (d *Daemon) GetBackendMetrics(sid string) (*types.BackendMetrics, error) {
+	c, err := d.GetClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "get backend metrics")
+	}
+	return c.GetBackendMetrics(sid)
+}
+
 func (d *Daemon) GetClient() (NydusdClient, error) {
 	d.cmu.Lock()
 	defer d.cmu.Unlock()
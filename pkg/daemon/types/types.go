@@ -102,3 +102,27 @@ type CacheMetrics struct {
 	BufferedBackendSize          uint64   `json:"buffered_backend_size"`
 	DataAllReady                 bool     `json:"data_all_ready"`
 }
+
+type BackendMetrics struct {
+	ID                               string `json:"id"`
+	BackendType                      string `json:"backend_type"`
+	ReadCount                        uint64 `json:"read_count"`
+	ReadErrors                       uint64 `json:"read_errors"`
+	ReadAmountTotal                  uint64 `json:"read_amount_total"`
+	ReadCumulativeLatencyMillisTotal uint64 `json:"read_cumulative_latency_millis_total"`
+	// Whether the backends are unreachable and only cached data is served,
+	// see cache_only_on_outage of the backend configuration.
+	Degraded bool                 `json:"degraded"`
+	Blobs    []BlobBackendMetrics `json:"blobs"`
+}
+
+// BlobBackendMetrics are the backend metrics of a single blob. ReadLatencyDist counts the
+// reads taking up to 1, 20, 50, 100, 500, 1000, 2000 and more than 2000 milliseconds.
+type BlobBackendMetrics struct {
+	BlobID                           string   `json:"blob_id"`
+	ReadCount                        uint64   `json:"read_count"`
+	ReadRetries                      uint64   `json:"read_retries"`
+	ReadAmountTotal                  uint64   `json:"read_amount_total"`
+	ReadCumulativeLatencyMillisTotal uint64   `json:"read_cumulative_latency_millis_total"`
+	ReadLatencyDist                  []uint64 `json:"read_latency_dist"`
+}
@@ -0,0 +1,649 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package fanout hands the blobs prefetched on a node on to the other nodes, either by seeding
+// them in the local Dragonfly dfdaemon or by serving them and announcing them to peers.
+package fanout
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/remote"
+	"github.com/containerd/nydus-snapshotter/pkg/remote/remotes"
+	"github.com/containerd/nydus-snapshotter/pkg/remote/remotes/docker"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/registry"
+)
+
+const (
+	defaultAnnounceTTL = 10 * time.Minute
+	announceTimeout    = 10 * time.Second
+
+	endpointAnnounce = "/api/v1/fanout/announce"
+
+	// Tells dfdaemon which registry to fetch the blobs from, as for the mirror of dfdaemon.
+	dragonflyRegistryHeader = "X-Dragonfly-Registry"
+)
+
+var (
+	fanOut   *FanOut
+	fanOutMu sync.Mutex
+)
+
+// Announcement tells peers that the blobs of an image are served by a node.
+type Announcement struct {
+	Image string `json:"image"`
+	// URL of the node, serving the registry API for blobs
+	Address string   `json:"address"`
+	Blobs   []string `json:"blobs,omitempty"`
+	// Withdraws an earlier announcement once the node no longer serves the blobs.
+	Withdraw bool `json:"withdraw,omitempty"`
+}
+
+// FanOut seeds the blobs of images prefetched on the node and keeps track of the images peers
+// announced.
+type FanOut struct {
+	config config.FanOutConfig
+	// Proxy of the local dfdaemon in FanOutModeDragonfly.
+	dragonflyProxy *url.URL
+	// Blobs served to peers in FanOutModeGossip, named by their sha256 digest.
+	dir string
+	// Mutual TLS of peers in FanOutModeGossip, for serving as well as for requests to peers.
+	tls    *tls.Config
+	client *http.Client
+
+	mu sync.Mutex
+	// Images seeded by the node, keyed by snapshot ID.
+	seeds map[string]seed
+	// Expiry of the announcements of peers, keyed by image reference and peer address.
+	peers map[string]map[string]time.Time
+}
+
+type seed struct {
+	image string
+	blobs []string
+	// Whether all blobs are stored and announced, rather than still being fetched.
+	ready bool
+}
+
+// InitFanOut starts handing prefetched blobs on to peers until ctx is done. In gossip mode, the
+// blobs are stored in dir. This should be called once at startup if fan-out is enabled.
+func InitFanOut(ctx context.Context, c config.FanOutConfig, dragonflyProxy, dir string) error {
+	fanOutMu.Lock()
+	defer fanOutMu.Unlock()
+
+	if fanOut != nil {
+		return nil
+	}
+
+	f, err := NewFanOut(c, dragonflyProxy, dir)
+	if err != nil {
+		return err
+	}
+	if c.Mode == config.FanOutModeGossip {
+		// The images of blobs stored by an earlier run are not known, so they can't be served.
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Wrapf(err, "clean fan-out directory %s", dir)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrapf(err, "create fan-out directory %s", dir)
+		}
+		l, err := net.Listen("tcp", c.ListenAddress)
+		if err != nil {
+			return errors.Wrapf(err, "listen on %s", c.ListenAddress)
+		}
+		l = tls.NewListener(l, f.tls)
+		server := &http.Server{Handler: f.Handler(), ReadHeaderTimeout: announceTimeout}
+		go func() {
+			if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+				log.L.WithError(err).Error("Fan-out server stopped")
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		go f.Run(ctx)
+	}
+	fanOut = f
+	log.L.WithField("mode", c.Mode).Info("fan-out of prefetched blobs initialized")
+	return nil
+}
+
+func NewFanOut(c config.FanOutConfig, dragonflyProxy, dir string) (*FanOut, error) {
+	f := &FanOut{
+		config: c,
+		dir:    dir,
+		client: &http.Client{Timeout: announceTimeout},
+		seeds:  map[string]seed{},
+		peers:  map[string]map[string]time.Time{},
+	}
+	switch c.Mode {
+	case config.FanOutModeDragonfly:
+		u, err := url.Parse(dragonflyProxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse dragonfly proxy address %s", dragonflyProxy)
+		}
+		f.dragonflyProxy = u
+	case config.FanOutModeGossip:
+		tlsConfig, err := peerTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		f.tls = tlsConfig
+		f.client.Transport = transport
+	}
+	return f, nil
+}
+
+// peerTLSConfig returns the TLS configuration presenting the certificate of the node to peers,
+// and requiring and verifying theirs.
+func peerTLSConfig(c config.FanOutConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load fan-out certificate %s", c.CertFile)
+	}
+	pem, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read fan-out CA %s", c.CAFile)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificate in fan-out CA %s", c.CAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func getFanOut() *FanOut {
+	fanOutMu.Lock()
+	defer fanOutMu.Unlock()
+	return fanOut
+}
+
+// Enabled returns whether prefetched blobs are handed on to peers.
+func Enabled() bool {
+	return getFanOut() != nil
+}
+
+// Seed hands the blobs of the image mounted as snapshotID on to peers, see FanOut.Seed.
+func Seed(ctx context.Context, snapshotID, image, registryScheme string, blobIDs []string, keyChain *auth.PassKeyChain) error {
+	f := getFanOut()
+	if f == nil {
+		return nil
+	}
+	return f.Seed(ctx, snapshotID, image, registryScheme, blobIDs, keyChain)
+}
+
+// Release stops serving the blobs seeded for snapshotID, see FanOut.Release.
+func Release(snapshotID string) {
+	if f := getFanOut(); f != nil {
+		f.Release(snapshotID)
+	}
+}
+
+// Peers returns the addresses of the peers serving the blobs of image.
+func Peers(image string) []string {
+	f := getFanOut()
+	if f == nil {
+		return nil
+	}
+	return f.Peers(image)
+}
+
+// Seed fetches the blobs of the image from the registry once more in full: through dfdaemon, so
+// that it seeds them to peers, or into the node to serve them to the peers, which are told so.
+// The blobs are expected to be prefetched already, so their chunks are not fetched twice by
+// nydusd. Images fetched with credentials are not served to peers, which would have to be
+// trusted with the credentials to fetch them from the node.
+func (f *FanOut) Seed(ctx context.Context, snapshotID, image, registryScheme string, blobIDs []string, keyChain *auth.PassKeyChain) error {
+	gossip := f.config.Mode == config.FanOutModeGossip
+	if gossip && private(image, keyChain) {
+		log.L.Debugf("Not serving blobs of image %s fetched with credentials to peers", image)
+		return nil
+	}
+
+	fetcher, err := f.fetcher(ctx, image, registryScheme, keyChain)
+	if err != nil {
+		return err
+	}
+
+	if gossip {
+		// Recorded before fetching, so that Release during the fetch stops it and cleans up.
+		f.mu.Lock()
+		f.seeds[snapshotID] = seed{image: image, blobs: blobIDs}
+		f.mu.Unlock()
+	}
+	for _, id := range blobIDs {
+		dgst := digest.NewDigestFromEncoded(digest.SHA256, id)
+		if err := dgst.Validate(); err != nil {
+			f.Release(snapshotID)
+			return errors.Wrapf(err, "invalid blob ID %s", id)
+		}
+		if !gossip {
+			err = fetchBlob(ctx, fetcher, dgst, io.Discard)
+		} else if !f.seeding(snapshotID) {
+			log.L.Debugf("Snapshot %s was released while seeding image %s", snapshotID, image)
+			f.removeUnused(blobIDs)
+			return nil
+		} else {
+			err = f.storeBlob(ctx, fetcher, dgst)
+		}
+		if err != nil {
+			f.Release(snapshotID)
+			return errors.Wrapf(err, "seed blob %s of %s", id, image)
+		}
+	}
+	log.L.Infof("Seeded %d blobs of image %s to peers", len(blobIDs), image)
+	if f.config.Mode == config.FanOutModeDragonfly {
+		return nil
+	}
+	return f.serve(ctx, snapshotID, image, blobIDs)
+}
+
+// private returns whether the image is fetched with credentials, by keyChain or a token file.
+func private(image string, keyChain *auth.PassKeyChain) bool {
+	if keyChain != nil {
+		return true
+	}
+	parsed, err := registry.ParseImage(image)
+	if err != nil {
+		return true
+	}
+	_, ok := config.GetTokenFile(parsed.Host, parsed.Repo)
+	return ok
+}
+
+// seeding returns whether the blobs of snapshotID are still to be seeded, i.e. it was not released.
+func (f *FanOut) seeding(snapshotID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.seeds[snapshotID]
+	return ok
+}
+
+// serve starts serving the stored blobs of the image and announces them to the peers, unless
+// snapshotID was released in the meantime.
+func (f *FanOut) serve(ctx context.Context, snapshotID, image string, blobIDs []string) error {
+	f.mu.Lock()
+	s, ok := f.seeds[snapshotID]
+	if ok {
+		s.ready = true
+		f.seeds[snapshotID] = s
+	}
+	f.mu.Unlock()
+	if !ok {
+		f.removeUnused(blobIDs)
+		return nil
+	}
+	return f.announce(ctx, Announcement{Image: image, Address: f.config.AdvertiseAddress, Blobs: blobIDs})
+}
+
+// Release removes the blobs seeded for snapshotID unless another snapshot still needs them, in
+// which case the peers are told to no longer pull the image from the node.
+func (f *FanOut) Release(snapshotID string) {
+	f.mu.Lock()
+	released, ok := f.seeds[snapshotID]
+	delete(f.seeds, snapshotID)
+	var imageSeeded bool
+	for _, s := range f.seeds {
+		imageSeeded = imageSeeded || (s.ready && s.image == released.image)
+	}
+	f.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	f.removeUnused(released.blobs)
+	// Peers were only told of the image once it was ready.
+	if released.ready && !imageSeeded {
+		go func() {
+			if err := f.announce(context.Background(), Announcement{
+				Image: released.image, Address: f.config.AdvertiseAddress, Withdraw: true,
+			}); err != nil {
+				log.L.WithError(err).Warnf("Failed to withdraw image %s from peers", released.image)
+			}
+		}()
+	}
+}
+
+// removeUnused removes the stored blobs no other snapshot is seeding.
+func (f *FanOut) removeUnused(blobIDs []string) {
+	f.mu.Lock()
+	used := map[string]bool{}
+	for _, s := range f.seeds {
+		for _, id := range s.blobs {
+			used[id] = true
+		}
+	}
+	f.mu.Unlock()
+
+	for _, id := range blobIDs {
+		if used[id] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(f.dir, id)); err != nil && !os.IsNotExist(err) {
+			log.L.WithError(err).Warnf("Failed to remove seeded blob %s", id)
+		}
+	}
+}
+
+// Peers returns the addresses of the peers whose announcement of image has not expired.
+func (f *FanOut) Peers(image string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var peers []string
+	for address, expiry := range f.peers[image] {
+		if time.Now().Before(expiry) {
+			peers = append(peers, address)
+		}
+	}
+	slices.Sort(peers)
+	return peers
+}
+
+// Run renews the announcements of the seeded images before peers expire them, and forgets the
+// expired announcements of peers, until ctx is done.
+func (f *FanOut) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.ttl() / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		f.mu.Lock()
+		announcements := map[string]Announcement{}
+		for _, s := range f.seeds {
+			if s.ready {
+				announcements[s.image] = Announcement{Image: s.image, Address: f.config.AdvertiseAddress, Blobs: s.blobs}
+			}
+		}
+		for image, peers := range f.peers {
+			for address, expiry := range peers {
+				if time.Now().After(expiry) {
+					delete(peers, address)
+				}
+			}
+			if len(peers) == 0 {
+				delete(f.peers, image)
+			}
+		}
+		f.mu.Unlock()
+
+		for _, a := range announcements {
+			if err := f.announce(ctx, a); err != nil {
+				log.L.WithError(err).Warnf("Failed to renew announcement of image %s", a.Image)
+			}
+		}
+	}
+}
+
+func (f *FanOut) ttl() time.Duration {
+	if f.config.AnnounceTTL > 0 {
+		return f.config.AnnounceTTL
+	}
+	return defaultAnnounceTTL
+}
+
+// fetcher returns the fetcher of the blobs of image, through the local dfdaemon in dragonfly
+// mode and from the registry otherwise. dfdaemon fetches from the registry over registryScheme,
+// "https" if empty.
+func (f *FanOut) fetcher(ctx context.Context, image, registryScheme string, keyChain *auth.PassKeyChain) (remotes.Fetcher, error) {
+	if f.config.Mode != config.FanOutModeDragonfly {
+		return remote.New(keyChain, false).Fetcher(ctx, image)
+	}
+
+	credFunc := func(string) (string, string, error) {
+		if keyChain == nil {
+			return "", "", nil
+		}
+		if keyChain.IdentityToken != "" {
+			return "", keyChain.IdentityToken, nil
+		}
+		return keyChain.Username, keyChain.Password, nil
+	}
+	if registryScheme == "" {
+		registryScheme = "https"
+	}
+	authorizer := docker.NewDockerAuthorizer(docker.WithAuthCreds(credFunc))
+	resolver := docker.NewResolver(docker.ResolverOptions{
+		Hosts: func(host string) ([]docker.RegistryHost, error) {
+			if host == "docker.io" {
+				host = "index.docker.io"
+			}
+			return []docker.RegistryHost{{
+				Client:       http.DefaultClient,
+				Authorizer:   authorizer,
+				Host:         f.dragonflyProxy.Host,
+				Scheme:       f.dragonflyProxy.Scheme,
+				Path:         "/v2",
+				Capabilities: docker.HostCapabilityPull | docker.HostCapabilityResolve,
+				Header:       http.Header{dragonflyRegistryHeader: []string{registryScheme + "://" + host}},
+			}}, nil
+		},
+	})
+	fetcher, err := resolver.Fetcher(ctx, image)
+	if err != nil {
+		return nil, errors.Wrap(err, "get fetcher")
+	}
+	return fetcher, nil
+}
+
+// storeBlob fetches the blob into the directory of seeded blobs, unless it is there already.
+func (f *FanOut) storeBlob(ctx context.Context, fetcher remotes.Fetcher, dgst digest.Digest) error {
+	target := filepath.Join(f.dir, dgst.Encoded())
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+	tmp, err := os.CreateTemp(f.dir, dgst.Encoded()+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := fetchBlob(ctx, fetcher, dgst, tmp); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "write %s", tmp.Name())
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), target), "rename %s", tmp.Name())
+}
+
+// fetchBlob copies the blob to w and verifies its digest.
+func fetchBlob(ctx context.Context, fetcher remotes.Fetcher, dgst digest.Digest, w io.Writer) error {
+	// The size of the blob is not known.
+	rc, err := fetcher.Fetch(ctx, ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayer, Digest: dgst, Size: -1})
+	if err != nil {
+		return errors.Wrap(err, "fetch blob")
+	}
+	defer rc.Close()
+
+	verifier := dgst.Verifier()
+	if _, err := io.Copy(io.MultiWriter(w, verifier), rc); err != nil {
+		return errors.Wrap(err, "read blob")
+	}
+	if !verifier.Verified() {
+		return errors.New("digest mismatch")
+	}
+	return nil
+}
+
+// announce sends the announcement to all peers, except the node itself.
+func (f *FanOut) announce(ctx context.Context, a Announcement) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal announcement")
+	}
+	var errs []error
+	for _, peer := range f.config.Peers {
+		peer = strings.TrimRight(peer, "/")
+		if peer == strings.TrimRight(f.config.AdvertiseAddress, "/") {
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+endpointAnnounce, bytes.NewReader(body))
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "announce to %s", peer))
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := f.client.Do(req)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "announce to %s", peer))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			errs = append(errs, errors.Errorf("announce to %s: %s", peer, resp.Status))
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// Handler serves the announcements of peers and, like a registry, the seeded blobs. It expects
+// to be served with the TLS configuration of the node, and only answers peers which presented
+// a certificate of the fan-out CA.
+func (f *FanOut) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpointAnnounce, f.handleAnnounce)
+	mux.HandleFunc("/v2/", f.handleBlob)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "peer certificate required", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// isPeer returns whether address is one of the configured peers.
+func (f *FanOut) isPeer(address string) bool {
+	for _, peer := range f.config.Peers {
+		if strings.TrimRight(peer, "/") == address {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FanOut) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var a Announcement
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&a); err != nil {
+		http.Error(w, fmt.Sprintf("invalid announcement: %v", err), http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(a.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || a.Image == "" {
+		http.Error(w, "announcement needs an image and an http(s) address", http.StatusBadRequest)
+		return
+	}
+	a.Address = strings.TrimRight(a.Address, "/")
+	// Peers become mirrors of the image, so no other address may be announced.
+	if !f.isPeer(a.Address) {
+		http.Error(w, fmt.Sprintf("%s is not a peer", a.Address), http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	if a.Withdraw {
+		delete(f.peers[a.Image], a.Address)
+	} else {
+		if f.peers[a.Image] == nil {
+			f.peers[a.Image] = map[string]time.Time{}
+		}
+		f.peers[a.Image][a.Address] = time.Now().Add(f.ttl())
+	}
+	f.mu.Unlock()
+	log.L.Debugf("Peer %s announced image %s, withdrawn %v", a.Address, a.Image, a.Withdraw)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleBlob serves "/v2/" as API root and "/v2/<repository>/blobs/<digest>" of seeded blobs,
+// including the ranges nydusd requests chunks by.
+func (f *FanOut) handleBlob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	i := strings.LastIndex(r.URL.Path, "/blobs/")
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	dgst, err := digest.Parse(r.URL.Path[i+len("/blobs/"):])
+	if err != nil || dgst.Algorithm() != digest.SHA256 || !f.seeded(dgst.Encoded()) {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(filepath.Join(f.dir, dgst.Encoded()))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	http.ServeContent(w, r, "", stat.ModTime(), file)
+}
+
+// seeded returns whether the blob is seeded for any snapshot.
+func (f *FanOut) seeded(blobID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.seeds {
+		if s.ready && slices.Contains(s.blobs, blobID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package fanout
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/remote/remotes/docker"
+)
+
+var testBlob = []byte("nydus blob data")
+
+func newRegistry(t *testing.T, blob []byte, check func(r *http.Request)) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	dgst := digest.FromBytes(testBlob)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/library/app/blobs/"+dgst.String() {
+			http.NotFound(w, r)
+			return
+		}
+		if check != nil {
+			check(r)
+		}
+		requests.Add(1)
+		w.Write(blob)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestSeed_Dragonfly(t *testing.T) {
+	dgst := digest.FromBytes(testBlob)
+	var registryHeader atomic.Value
+	dfdaemon, requests := newRegistry(t, testBlob, func(r *http.Request) {
+		registryHeader.Store(r.Header.Get(dragonflyRegistryHeader))
+	})
+
+	f, err := NewFanOut(config.FanOutConfig{Enable: true, Mode: config.FanOutModeDragonfly}, dfdaemon.URL, "")
+	require.NoError(t, err)
+	require.NoError(t, f.Seed(context.Background(), "snap1", "registry.local/library/app:latest", "",
+		[]string{dgst.Encoded()}, nil))
+	require.EqualValues(t, 1, requests.Load())
+	require.Equal(t, "https://registry.local", registryHeader.Load())
+	require.NoError(t, f.Seed(context.Background(), "snap2", "registry.local/library/app:latest", "http",
+		[]string{dgst.Encoded()}, nil))
+	require.Equal(t, "http://registry.local", registryHeader.Load())
+	// Nothing is served by the node itself.
+	require.False(t, f.seeded(dgst.Encoded()))
+
+	corrupted, _ := newRegistry(t, []byte("corrupted"), nil)
+	f, err = NewFanOut(config.FanOutConfig{Enable: true, Mode: config.FanOutModeDragonfly}, corrupted.URL, "")
+	require.NoError(t, err)
+	require.ErrorContains(t, f.Seed(context.Background(), "snap1", "registry.local/library/app:latest", "",
+		[]string{dgst.Encoded()}, nil), "digest mismatch")
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
+
+// newPeerCerts writes a CA and a certificate of 127.0.0.1 signed by it to dir, and returns the
+// fan-out configuration using them.
+func newPeerCerts(t *testing.T, dir string) config.FanOutConfig {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fan-out CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caTmpl, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	c := config.FanOutConfig{
+		Enable:   true,
+		Mode:     config.FanOutModeGossip,
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "node.pem"),
+		KeyFile:  filepath.Join(dir, "node-key.pem"),
+	}
+	writePEM(t, c.CAFile, "CERTIFICATE", caDER)
+	writePEM(t, c.CertFile, "CERTIFICATE", der)
+	writePEM(t, c.KeyFile, "PRIVATE KEY", keyDER)
+	return c
+}
+
+func newGossipNode(t *testing.T, c config.FanOutConfig) (*FanOut, *httptest.Server) {
+	f, err := NewFanOut(c, "", t.TempDir())
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(f.Handler())
+	srv.TLS = f.tls
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	f.config.AdvertiseAddress = srv.URL
+	return f, srv
+}
+
+func TestGossip(t *testing.T) {
+	ctx := context.Background()
+	image := "registry.local/library/app:latest"
+	dgst := digest.FromBytes(testBlob)
+	registry, _ := newRegistry(t, testBlob, nil)
+
+	c := newPeerCerts(t, t.TempDir())
+	b, bServer := newGossipNode(t, c)
+	a, aServer := newGossipNode(t, c)
+	a.config.Peers = []string{bServer.URL}
+	b.config.Peers = []string{aServer.URL}
+
+	resolver := docker.NewResolver(docker.ResolverOptions{
+		Hosts: docker.ConfigureDefaultRegistries(
+			docker.WithPlainHTTP(docker.MatchAllHosts),
+			docker.WithHostTranslator(func(string) (string, error) {
+				return strings.TrimPrefix(registry.URL, "http://"), nil
+			}),
+		),
+	})
+	fetcher, err := resolver.Fetcher(ctx, image)
+	require.NoError(t, err)
+	a.seeds["snap1"] = seed{image: image, blobs: []string{dgst.Encoded()}}
+	require.NoError(t, a.storeBlob(ctx, fetcher, dgst))
+	require.NoError(t, a.serve(ctx, "snap1", image, []string{dgst.Encoded()}))
+	require.Equal(t, []string{aServer.URL}, b.Peers(image))
+	require.Empty(t, b.Peers("registry.local/library/other:latest"))
+
+	// Peers pull chunks by range.
+	req, err := http.NewRequest(http.MethodGet, aServer.URL+"/v2/library/app/blobs/"+dgst.String(), nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=6-9")
+	resp, err := b.client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	require.Equal(t, "blob", string(body))
+
+	a.Release("snap1")
+	_, err = os.Stat(filepath.Join(a.dir, dgst.Encoded()))
+	require.True(t, os.IsNotExist(err))
+	require.Eventually(t, func() bool { return len(b.Peers(image)) == 0 }, 5*time.Second, 10*time.Millisecond)
+	resp, err = b.client.Get(aServer.URL + "/v2/library/app/blobs/" + dgst.String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Clients without a certificate of the fan-out CA are refused.
+	_, err = aServer.Client().Get(aServer.URL + "/v2/")
+	require.Error(t, err)
+
+	// Snapshots released while their blobs are fetched are neither served nor announced.
+	a.seeds["snap2"] = seed{image: image, blobs: []string{dgst.Encoded()}}
+	require.NoError(t, a.storeBlob(ctx, fetcher, dgst))
+	a.Release("snap2")
+	require.NoError(t, a.serve(ctx, "snap2", image, []string{dgst.Encoded()}))
+	require.Empty(t, a.seeds)
+	_, err = os.Stat(filepath.Join(a.dir, dgst.Encoded()))
+	require.True(t, os.IsNotExist(err))
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, b.Peers(image))
+}
+
+func TestSeed_Private(t *testing.T) {
+	dgst := digest.FromBytes(testBlob)
+	registry, requests := newRegistry(t, testBlob, nil)
+	f, _ := newGossipNode(t, newPeerCerts(t, t.TempDir()))
+
+	// Blobs of images fetched with credentials are not served to peers.
+	require.NoError(t, f.Seed(context.Background(), "snap1", strings.TrimPrefix(registry.URL, "http://")+"/library/app:latest", "http",
+		[]string{dgst.Encoded()}, &auth.PassKeyChain{Username: "user", Password: "secret"}))
+	require.Zero(t, requests.Load())
+	require.False(t, f.seeded(dgst.Encoded()))
+}
+
+func TestPeers_Expiry(t *testing.T) {
+	c := newPeerCerts(t, t.TempDir())
+	c.Peers = []string{"https://10.0.0.2:8091"}
+	f, srv := newGossipNode(t, c)
+	f.config.AnnounceTTL = time.Millisecond
+	body := `{"image":"registry.local/library/app:latest","address":"https://10.0.0.2:8091/"}`
+	resp, err := f.client.Post(srv.URL+endpointAnnounce, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Eventually(t, func() bool {
+		return len(f.Peers("registry.local/library/app:latest")) == 0
+	}, 5*time.Second, time.Millisecond)
+
+	resp, err = f.client.Post(srv.URL+endpointAnnounce, "application/json", strings.NewReader(`{"image":"app","address":"10.0.0.2"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Only the configured peers may be announced.
+	body = `{"image":"registry.local/library/app:latest","address":"https://attacker:8091"}`
+	resp, err = f.client.Post(srv.URL+endpointAnnounce, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Empty(t, f.Peers("registry.local/library/app:latest"))
+}
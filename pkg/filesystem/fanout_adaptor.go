@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/cache"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/fanout"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+const (
+	prefetchPollInterval = 5 * time.Second
+	// Images not prefetched by then are not handed on to peers.
+	prefetchWaitTimeout = time.Hour
+)
+
+// fanOut hands the blobs of the instance on to peers once nydusd has prefetched all of them.
+// Instances without prefetch, unmounted before, or failing to prefetch in time are skipped.
+func (fs *Filesystem) fanOut(d *daemon.Daemon, rafs *racache.Rafs, imageID, registryScheme string, labels map[string]string) {
+	sid := cacheMetricsID(d, rafs)
+	ticker := time.NewTicker(prefetchPollInterval)
+	defer ticker.Stop()
+	timeout := time.After(prefetchWaitTimeout)
+	for {
+		metrics, err := d.GetCacheMetrics(sid)
+		if err != nil {
+			log.L.WithError(err).Debugf("Not handing blobs of snapshot %s on to peers", rafs.SnapshotID)
+			return
+		}
+		if metrics.PrefetchWorkers == 0 {
+			return
+		}
+		if metrics.DataAllReady {
+			var blobIDs []string
+			seen := map[string]bool{}
+			for _, f := range metrics.UnderlyingFiles {
+				id := cache.ExtractBlobIDFromFilename(filepath.Base(f))
+				if seen[id] || digest.NewDigestFromEncoded(digest.SHA256, id).Validate() != nil {
+					continue
+				}
+				seen[id] = true
+				blobIDs = append(blobIDs, id)
+			}
+			// Images are handed on by the name they are fetched by.
+			ref, authLabels := imageID, labels
+			if rewritten, ok := config.RewriteImageRef(imageID); ok {
+				ref, authLabels = rewritten, nil
+			}
+			if err := fanout.Seed(context.Background(), rafs.SnapshotID, ref, registryScheme, blobIDs,
+				auth.GetRegistryKeyChain(ref, authLabels)); err != nil {
+				log.L.WithError(err).Warnf("Failed to hand blobs of image %s on to peers", imageID)
+			}
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			log.L.Infof("Image %s is not prefetched after %s, not handing its blobs on to peers", imageID, prefetchWaitTimeout)
+			return
+		}
+	}
+}
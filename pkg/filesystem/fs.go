@@ -22,10 +22,11 @@ import (
 	"github.com/containerd/containerd/v2/core/snapshots/storage"
 	snpkg "github.com/containerd/containerd/v2/pkg/snapshotters"
 	"github.com/containerd/log"
-	"github.com/mohae/deepcopy"
 	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/containerd/nydus-snapshotter/config"
 	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
@@ -33,6 +34,7 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/fanout"
 	"github.com/containerd/nydus-snapshotter/pkg/index"
 	"github.com/containerd/nydus-snapshotter/pkg/label"
 	"github.com/containerd/nydus-snapshotter/pkg/manager"
@@ -57,6 +59,10 @@ type Filesystem struct {
 	nydusdBinaryPath    string
 	rootMountpoint      string
 	snapshotMutexMap    sync.Map
+	// Limit and deduplicate blob downloads into a populated localfs backend
+	populateLimiterOnce sync.Once
+	populateSem         *semaphore.Weighted
+	populateGroup       singleflight.Group
 }
 
 // NewFileSystem initialize Filesystem instance
@@ -268,26 +274,7 @@ func (fs *Filesystem) WaitUntilReady(snapshotID string) error {
 			return err
 		}
 
-		// For shared daemons, we need to use the correct cache ID to query metrics.
-		// For fscache, the cache is registered with fscacheID (a digest), not the raw snapshot ID.
-		// For fusedev, the cache is registered with the snapshot ID.
-		sid := ""
-		if d.IsSharedDaemon() {
-			if rafs.GetFsDriver() == config.FsDriverFscache {
-				// For fscache, use the fscache ID from annotations if available
-				if fscacheID, ok := rafs.Annotations[racache.AnnoFsCacheID]; ok && fscacheID != "" {
-					sid = fscacheID
-				} else {
-					// Fallback: compute fscacheID if not in annotations yet
-					sid = erofs.FscacheID(rafs.SnapshotID)
-				}
-			} else {
-				// For fusedev, use the snapshot ID directly
-				sid = rafs.SnapshotID
-			}
-		}
-
-		cacheMetrics, err := d.GetCacheMetrics(sid)
+		cacheMetrics, err := d.GetCacheMetrics(cacheMetricsID(d, rafs))
 		if err != nil {
 			return errors.Wrapf(err, "failed to get cache metric")
 		}
@@ -313,6 +300,26 @@ func (fs *Filesystem) WaitUntilReady(snapshotID string) error {
 	return nil
 }
 
+// cacheMetricsID returns the ID to query the cache metrics of the instance from its daemon.
+func cacheMetricsID(d *daemon.Daemon, rafs *racache.Rafs) string {
+	// For shared daemons, we need to use the correct cache ID to query metrics.
+	// For fscache, the cache is registered with fscacheID (a digest), not the raw snapshot ID.
+	// For fusedev, the cache is registered with the snapshot ID.
+	if !d.IsSharedDaemon() {
+		return ""
+	}
+	if rafs.GetFsDriver() == config.FsDriverFscache {
+		// For fscache, use the fscache ID from annotations if available
+		if fscacheID, ok := rafs.Annotations[racache.AnnoFsCacheID]; ok && fscacheID != "" {
+			return fscacheID
+		}
+		// Fallback: compute fscacheID if not in annotations yet
+		return erofs.FscacheID(rafs.SnapshotID)
+	}
+	// For fusedev, use the snapshot ID directly
+	return rafs.SnapshotID
+}
+
 // Mount will be called when containerd snapshotter prepare remote snapshotter
 // this method will fork nydus daemon and manage it in the internal store, and indexed by snapshotID
 // It must set up all necessary resources during Mount procedure and revoke any step if necessary.
@@ -365,7 +372,10 @@ func (fs *Filesystem) Mount(ctx context.Context, snapshotID string, labels map[s
 		return errors.Wrapf(err, "get filesystem manager for snapshot %s", snapshotID)
 	}
 
-	var d *daemon.Daemon
+	var (
+		d              *daemon.Daemon
+		registryScheme string
+	)
 	if fsDriver == config.FsDriverFscache || fsDriver == config.FsDriverFusedev {
 		bootstrap, err := rafs.BootstrapFile()
 		if err != nil {
@@ -407,11 +417,16 @@ func (fs *Filesystem) Mount(ctx context.Context, snapshotID string, labels map[s
 			daemonconfig.WorkDir:   workDir,
 			daemonconfig.CacheDir:  cacheDir,
 		}
-		cfg := deepcopy.Copy(*fsManager.DaemonConfig).(daemonconfig.DaemonConfig)
-		err = daemonconfig.SupplementDaemonConfig(cfg, imageID, snapshotID, false, labels, params)
+		cfg := fsManager.GetDaemonConfig().Clone()
+		result, err := daemonconfig.SupplementDaemonConfigWithResult(cfg, imageID, snapshotID, false, labels, params)
 		if err != nil {
 			return errors.Wrap(err, "supplement configuration")
 		}
+		log.L.Debugf("Supplemented %s backend configuration for snapshot %s, host %q, auth filled %v",
+			result.Backend, snapshotID, result.Host, result.AuthFilled)
+		registryScheme = result.Scheme
+		keepReloadLabels(rafs, labels)
+		rafs.Mirror, _ = daemonconfig.ActiveMirror(cfg, imageID)
 
 		// TODO: How to manage rafs configurations on-disk? separated json config file or DB record?
 		// In order to recover erofs mount, the configuration file has to be persisted.
@@ -493,11 +508,27 @@ func (fs *Filesystem) Mount(ctx context.Context, snapshotID string, labels map[s
 			}
 			return errors.Wrapf(err, "create instance %s", snapshotID)
 		}
+		if d != nil && fanout.Enabled() && labels[label.NydusFanOut] == "true" {
+			go fs.fanOut(d, rafs, imageID, registryScheme, labels)
+		}
 	}
 
 	return nil
 }
 
+// Labels the backend configuration depends on, kept with the RAFS instance so that the
+// configuration can be regenerated on reload.
+var reloadLabels = []string{label.NydusBackend, label.NydusBackendObjectPrefix, label.NydusBackendBucket,
+	label.NydusBackendRedirectedHost, label.NydusIPFSBlobCIDs, label.NydusPrefetchPolicy, label.NydusMirrors}
+
+func keepReloadLabels(rafs *racache.Rafs, labels map[string]string) {
+	for _, k := range reloadLabels {
+		if v, ok := labels[k]; ok {
+			rafs.AddAnnotation(k, v)
+		}
+	}
+}
+
 func (fs *Filesystem) getSnapshotMutex(snapshotID string) *sync.Mutex {
 	mu, _ := fs.snapshotMutexMap.LoadOrStore(snapshotID, &sync.Mutex{})
 	return mu.(*sync.Mutex)
@@ -557,6 +588,7 @@ func (fs *Filesystem) Umount(_ context.Context, snapshotID string) error {
 	if fsDriver == config.FsDriverNodev {
 		return nil
 	}
+	fanout.Release(snapshotID)
 	fsManager, err := fs.getManager(fsDriver)
 	if err != nil {
 		return errors.Wrapf(err, "get manager for filesystem instance %s", rafs.DaemonID)
@@ -780,7 +812,7 @@ func (fs *Filesystem) initSharedDaemon(fsManager *manager.Manager) (err error) {
 	// Shared nydusd daemon does not need configuration to start process but
 	// it is loaded when requesting mount api
 	// Dump the configuration file since it is reloaded when recovering the nydusd
-	d.Config = *fsManager.DaemonConfig
+	d.Config = fsManager.GetDaemonConfig()
 	err = d.Config.DumpFile(d.ConfigFile(""))
 	if err != nil && !errors.Is(err, errdefs.ErrAlreadyExists) {
 		return errors.Wrapf(err, "dump configuration file %s", d.ConfigFile(""))
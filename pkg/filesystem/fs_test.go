@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+func TestKeepReloadLabels(t *testing.T) {
+	require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{
+		Root:         t.TempDir(),
+		DaemonMode:   string(config.DaemonModeDedicated),
+		RemoteConfig: config.RemoteConfig{MirrorsConfig: config.MirrorsConfig{AllowLabelMirrors: true}},
+	}))
+	defer func() {
+		require.NoError(t, config.ProcessConfigurations(&config.SnapshotterConfig{DaemonMode: string(config.DaemonModeDedicated)}))
+	}()
+
+	rafs, err := racache.NewRafs("1", "registry.example.com/app:latest", config.FsDriverFusedev)
+	require.NoError(t, err)
+	keepReloadLabels(rafs, map[string]string{
+		label.NydusMirrors: `{"replace": true, "mirrors": [{"host": "http://p2p.local:65001"}]}`,
+		label.CRIImageRef:  "registry.example.com/app:latest",
+	})
+	require.NotContains(t, rafs.Annotations, label.CRIImageRef)
+
+	// A reload supplements the configuration from the annotations, and keeps the mirror of the label.
+	cfg := &daemonconfig.FuseDaemonConfig{Device: &daemonconfig.DeviceConfig{}}
+	cfg.Device.Backend.BackendType = "registry"
+	require.NoError(t, daemonconfig.SupplementDaemonConfig(cfg, rafs.ImageID, rafs.SnapshotID, false, rafs.Annotations, nil))
+	require.Equal(t, "p2p.local:65001", cfg.Device.Backend.Config.Host)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	snpkg "github.com/containerd/containerd/v2/pkg/snapshotters"
+	"github.com/containerd/log"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/remote"
+	"github.com/containerd/nydus-snapshotter/pkg/remote/remotes"
+)
+
+const defaultPopulateConcurrency = 4
+
+// localfsToPopulate returns the localfs backend of the daemon configuration template
+// if the snapshotter downloads blobs into its directory, nil otherwise.
+func (fs *Filesystem) localfsToPopulate() *daemonconfig.BackendConfig {
+	for _, fsDriver := range []string{config.FsDriverFusedev, config.FsDriverFscache} {
+		if m, ok := fs.enabledManagers[fsDriver]; ok {
+			if c := m.GetDaemonConfig(); c != nil {
+				return daemonconfig.PopulatedLocalfs(c)
+			}
+		}
+	}
+	return nil
+}
+
+func (fs *Filesystem) LocalfsPopulateEnabled() bool {
+	return fs.localfsToPopulate() != nil
+}
+
+// PopulateLocalfsBlob downloads the nydus data blob of a layer from the registry of its
+// image into the directory of the localfs backend, unless it's already there.
+func (fs *Filesystem) PopulateLocalfsBlob(ctx context.Context, labels map[string]string) error {
+	bc := fs.localfsToPopulate()
+	if bc == nil {
+		return nil
+	}
+
+	ref, ok := labels[snpkg.TargetRefLabel]
+	if !ok {
+		return errors.Errorf("not found image reference label")
+	}
+	blobDigest := digest.Digest(labels[snpkg.TargetLayerDigestLabel])
+	if blobDigest.Validate() != nil {
+		return errors.Errorf("not found layer digest label")
+	}
+
+	blobPath := filepath.Join(bc.Dir, blobDigest.Hex())
+	if _, err := os.Stat(blobPath); err == nil {
+		return nil
+	}
+
+	limiter := fs.populateLimiter(bc.PopulateConcurrency)
+	if err := limiter.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer limiter.Release(1)
+
+	// Layers shared by images being pulled at the same time are downloaded once.
+	_, err, _ := fs.populateGroup.Do(blobPath, func() (interface{}, error) {
+		if _, err := os.Stat(blobPath); err == nil {
+			return nil, nil
+		}
+		log.L.Infof("Populating localfs blob %s of image %s", blobDigest, ref)
+		return nil, downloadBlob(ctx, ref, labels, blobDigest, blobPath, config.GetSkipSSLVerify())
+	})
+	return err
+}
+
+func (fs *Filesystem) populateLimiter(concurrency int) *semaphore.Weighted {
+	fs.populateLimiterOnce.Do(func() {
+		if concurrency <= 0 {
+			concurrency = defaultPopulateConcurrency
+		}
+		fs.populateSem = semaphore.NewWeighted(int64(concurrency))
+	})
+	return fs.populateSem
+}
+
+// downloadBlob fetches the blob from the registry of ref and verifies it before moving
+// it to blobPath, with the credentials for ref and the snapshot labels. Partial downloads
+// are hidden files, which nydusd ignores.
+func downloadBlob(ctx context.Context, ref string, labels map[string]string, blobDigest digest.Digest, blobPath string, insecure bool) error {
+	// Like nydusd, rewritten images are fetched by their new name, without the credentials
+	// of labels meant for the original registry.
+	if rewritten, ok := config.RewriteImageRef(ref); ok {
+		ref, labels = rewritten, nil
+	}
+	keyChain, err := auth.GetKeyChainByRef(ref, labels)
+	if err != nil {
+		return errors.Wrap(err, "get key chain")
+	}
+	r := remote.New(keyChain, insecure)
+	rc, err := fetchBlob(ctx, r, ref, blobDigest)
+	if err != nil && r.RetryWithPlainHTTP(ref, err) {
+		rc, err = fetchBlob(ctx, r, ref, blobDigest)
+	}
+	if err != nil && r.RetryAnonymously(ref, err) {
+		rc, err = fetchBlob(ctx, r, ref, blobDigest)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fetch blob %s", blobDigest)
+	}
+	defer rc.Close()
+
+	dir := filepath.Dir(blobPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "create localfs dir %s", dir)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(blobPath)+".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "create temporary blob file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	verifier := blobDigest.Verifier()
+	if _, err := io.Copy(io.MultiWriter(tmp, verifier), rc); err != nil {
+		return errors.Wrapf(err, "download blob %s", blobDigest)
+	}
+	if !verifier.Verified() {
+		return errors.Errorf("digest mismatch of downloaded blob %s", blobDigest)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "close temporary blob file")
+	}
+	return os.Rename(tmp.Name(), blobPath)
+}
+
+func fetchBlob(ctx context.Context, r *remote.Remote, ref string, blobDigest digest.Digest) (io.ReadCloser, error) {
+	fetcher, err := r.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	fetcherByDigest, ok := fetcher.(remotes.FetcherByDigest)
+	if !ok {
+		return nil, errors.Errorf("fetcher %T does not implement remotes.FetcherByDigest", fetcher)
+	}
+	rc, _, err := fetcherByDigest.FetchByDigest(ctx, blobDigest)
+	return rc, err
+}
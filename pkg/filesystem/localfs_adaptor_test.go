@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+func TestDownloadBlob(t *testing.T) {
+	blob := []byte("nydus blob")
+	blobDigest := digest.FromBytes(blob)
+	corrupted := digest.FromString("other blob")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/library/app/blobs/" + blobDigest.String(), "/v2/library/app/blobs/" + corrupted.String():
+			_, _ = w.Write(blob)
+		case "/v2/private/app/blobs/" + blobDigest.String():
+			if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/library/app:latest"
+	dir := filepath.Join(t.TempDir(), "blobs")
+	blobPath := filepath.Join(dir, blobDigest.Hex())
+	require.NoError(t, downloadBlob(context.Background(), ref, nil, blobDigest, blobPath, true))
+	data, err := os.ReadFile(blobPath)
+	require.NoError(t, err)
+	require.Equal(t, blob, data)
+
+	err = downloadBlob(context.Background(), ref, nil, corrupted, filepath.Join(dir, corrupted.Hex()), true)
+	require.ErrorContains(t, err, "digest mismatch")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// The credentials of the snapshot labels are used.
+	privateRef := strings.TrimPrefix(srv.URL, "http://") + "/private/app:latest"
+	privatePath := filepath.Join(t.TempDir(), blobDigest.Hex())
+	labels := map[string]string{
+		label.NydusImagePullUsername: "user",
+		label.NydusImagePullSecret:   "pass",
+	}
+	require.NoError(t, downloadBlob(context.Background(), privateRef, labels, blobDigest, privatePath, true))
+	require.FileExists(t, privatePath)
+}
@@ -102,7 +102,10 @@ func (d *detector) checkIndexAlternative(ctx context.Context, ref string, manife
 
 	desc, err := handle()
 	if err != nil && d.remote.RetryWithPlainHTTP(ref, err) {
-		return handle()
+		desc, err = handle()
+	}
+	if err != nil && d.remote.RetryAnonymously(ref, err) {
+		desc, err = handle()
 	}
 
 	return desc, err
@@ -176,7 +179,10 @@ func (d *detector) fetchMetadata(ctx context.Context, ref string, desc ocispec.D
 
 	err := handle()
 	if err != nil && d.remote.RetryWithPlainHTTP(ref, err) {
-		return handle()
+		err = handle()
+	}
+	if err != nil && d.remote.RetryAnonymously(ref, err) {
+		err = handle()
 	}
 
 	return err
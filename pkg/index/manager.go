@@ -16,6 +16,7 @@ import (
 	"github.com/pkg/errors"
 	"golang.org/x/sync/singleflight"
 
+	"github.com/containerd/nydus-snapshotter/config"
 	"github.com/containerd/nydus-snapshotter/pkg/auth"
 )
 
@@ -40,6 +41,9 @@ func NewManager(insecure bool) *Manager {
 // CheckIndexAlternative attempts to find a nydus alternative manifest
 // within an OCI index manifest for the specified manifest digest.
 func (manager *Manager) CheckIndexAlternative(ctx context.Context, ref string, manifestDigest digest.Digest) (*ocispec.Descriptor, error) {
+	if rewritten, ok := config.RewriteImageRef(ref); ok {
+		ref = rewritten
+	}
 	nydusDesc, err, _ := manager.sg.Do(manifestDigest.String(), func() (interface{}, error) {
 		// Try to get nydus metadata layer descriptor from LRU cache.
 		desc, ok := manager.cache.Get(manifestDigest)
@@ -90,6 +94,9 @@ func (manager *Manager) TryFetchMetadata(ctx context.Context, ref string, manife
 		return errors.Wrap(err, "check index alternative")
 	}
 
+	if rewritten, ok := config.RewriteImageRef(ref); ok {
+		ref = rewritten
+	}
 	keyChain, err := auth.GetKeyChainByRef(ref, nil)
 	if err != nil {
 		return errors.Wrap(err, "get key chain")
@@ -44,13 +44,40 @@ const (
 	NydusImagePullSecret = "containerd.io/snapshot/pullsecret"
 	// Annotation containing username to pull images from registry, set by the snapshotter.
 	NydusImagePullUsername = "containerd.io/snapshot/pullusername"
+	// Annotation containing the repository path prefix the pull secret is restricted to, set by the snapshotter.
+	NydusImagePullScope = "containerd.io/snapshot/pullscope"
 	// Proxy image pull actions to other agents.
 	NydusProxyMode = "containerd.io/snapshot/nydus-proxy-mode"
 	// A bool flag to enable integrity verification of meta data blob
 	NydusSignature = "containerd.io/snapshot/nydus-signature"
+	// Per-image object key prefix overriding `object_prefix` of object storage backends.
+	NydusBackendObjectPrefix = "containerd.io/snapshot/nydus-backend-object-prefix"
+	// Per-image bucket overriding `bucket_name` of OSS, S3 and GCS backends.
+	NydusBackendBucket = "containerd.io/snapshot/nydus-backend-bucket"
+	// Per-image host overriding `blob_redirected_host` of registry backends.
+	NydusBackendRedirectedHost = "containerd.io/snapshot/nydus-backend-redirected-host"
+	// Per-image backend replacing the one of the nydusd configuration template, as JSON
+	// object like `{"type": "oss", "config": {...}}`.
+	NydusBackend = "containerd.io/snapshot/nydus-backend"
+	// Per-image prefetch policy, naming one of the policies of the snapshotter configuration,
+	// e.g. to prefetch large model images aggressively.
+	NydusPrefetchPolicy = "containerd.io/snapshot/nydus-prefetch-policy"
+	// Per-image mirrors tried before the ones of the node, or instead of them, as JSON object
+	// like `{"replace": false, "mirrors": [{"host": "http://mirror:5000"}]}`. Only honored if
+	// allowed by the snapshotter configuration.
+	NydusMirrors = "containerd.io/snapshot/nydus-mirrors"
+	// Hand the blobs of the image on to peers once prefetched, if prefetch fan-out is enabled.
+	// The node fetches each blob from the registry once more for it, so it is meant for images
+	// pulled by many nodes.
+	NydusFanOut = "containerd.io/snapshot/nydus-fan-out"
+	// CIDs of the blobs of an image for IPFS backends, as comma separated "<digest>=<cid>" pairs.
+	NydusIPFSBlobCIDs = "containerd.io/snapshot/nydus-ipfs-cids"
 
 	// A bool flag to mark the blob as a estargz data blob, set by the snapshotter.
 	StargzLayer = "containerd.io/snapshot/stargz"
+	// Why the registry failed the preparation of the snapshot, e.g. "unauthorized", "forbidden"
+	// or "network", set by the snapshotter.
+	NydusRemoteError = "containerd.io/snapshot/nydus-remote-error"
 
 	// volatileOpt is a key of an optional label to each snapshot.
 	// If this optional label of a snapshot is specified, when mounted to rootdir
@@ -17,6 +17,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/command"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
@@ -36,6 +37,12 @@ const endpointGetBackend string = "/api/v1/daemons/%s/backend"
 //     ensure the daemon has reached specified state.
 //   - `d` may have not been inserted into daemonStates and store yet.
 func (m *Manager) StartDaemon(d *daemon.Daemon) error {
+	if c, ok := m.GetDaemonConfig().(*daemonconfig.FscacheDaemonConfig); ok {
+		if err := daemonconfig.EnsureFscacheWorkDir(c); err != nil {
+			return err
+		}
+	}
+
 	cmd, err := m.BuildDaemonCommand(d, "", false)
 	if err != nil {
 		return errors.Wrapf(err, "create command for daemon %s", d.ID())
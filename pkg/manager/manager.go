@@ -41,7 +41,9 @@ type Manager struct {
 	//
 	// The `daemonCache` is cache for nydusd daemons stored in `store`.
 	// You should update `store` first before modifying cached state.
-	daemonCache      *DaemonCache
+	daemonCache *DaemonCache
+	// Protect `DaemonConfig` against reloads, see GetDaemonConfig
+	configMu         sync.RWMutex
 	DaemonConfig     *daemonconfig.DaemonConfig // Daemon configuration template.
 	CgroupMgr        *cgroup.Manager
 	monitor          LivenessMonitor
@@ -111,6 +113,23 @@ func (m *Manager) Unlock() {
 	m.mu.Unlock()
 }
 
+// GetDaemonConfig returns the daemon configuration template, nil if there is none.
+func (m *Manager) GetDaemonConfig() daemonconfig.DaemonConfig {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	if m.DaemonConfig == nil {
+		return nil
+	}
+	return *m.DaemonConfig
+}
+
+// SetDaemonConfig replaces the daemon configuration template used for new instances.
+func (m *Manager) SetDaemonConfig(c daemonconfig.DaemonConfig) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.DaemonConfig = &c
+}
+
 func (m *Manager) CacheDir() string {
 	return m.cacheDir
 }
@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package manager
+
+import (
+	stderrors "errors"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+// ReloadDaemonConfig replaces the daemon configuration template and regenerates the
+// configuration of all RAFS instances served by running FUSE daemons from it, pushing it
+// to nydusd so that e.g. rotated backend endpoints take effect without remounting.
+// Fscache instances only get the new template when mounted again.
+func (m *Manager) ReloadDaemonConfig(template daemonconfig.DaemonConfig) error {
+	if m.GetDaemonConfig() == nil {
+		return nil
+	}
+	m.SetDaemonConfig(template)
+	if m.FsDriver != config.FsDriverFusedev {
+		log.L.Infof("Reloaded %s daemon config template, it applies to new mounts only", m.FsDriver)
+		return nil
+	}
+	return m.updateRafsConfigs("reload config", func(r *rafs.Rafs, current daemonconfig.DaemonConfig) (daemonconfig.DaemonConfig, error) {
+		return m.reloadRafsConfig(r, current, template)
+	})
+}
+
+// RefreshCredentials fills the current credentials into the configuration of the RAFS
+// instances of running daemons, FUSE and fscache ones, and pushes it to nydusd. Nothing
+// but the credentials changes, the template isn't read again.
+func (m *Manager) RefreshCredentials() error {
+	template := m.GetDaemonConfig()
+	if template == nil {
+		return nil
+	}
+	params := map[string]string{daemonconfig.CacheDir: m.CacheDir()}
+	return m.updateRafsConfigs("refresh credentials", func(r *rafs.Rafs, current daemonconfig.DaemonConfig) (daemonconfig.DaemonConfig, error) {
+		if err := daemonconfig.RefreshCredentials(current, template, r.ImageID, r.SnapshotID, r.Annotations, params); err != nil {
+			return nil, err
+		}
+		return current, nil
+	})
+}
+
+// ReselectMirrors selects the mirrors of the RAFS instances of running FUSE daemons again,
+// e.g. after the mirrors configuration changed, and pushes the configurations whose mirror
+// changed. The template isn't read again and nothing but the mirror changes.
+func (m *Manager) ReselectMirrors() error {
+	return m.reselectMirrors(func(*rafs.Rafs, daemonconfig.DaemonConfig) bool { return true })
+}
+
+// FailBackMirrors selects the mirrors again for the RAFS instances of running FUSE daemons
+// which would prefer one of the recovered mirrors over the one they fetch from now.
+func (m *Manager) FailBackMirrors(recovered []string) error {
+	return m.reselectMirrors(func(r *rafs.Rafs, current daemonconfig.DaemonConfig) bool {
+		return daemonconfig.FailsBackTo(current, r.ImageID, r.Annotations, recovered)
+	})
+}
+
+func (m *Manager) reselectMirrors(filter func(r *rafs.Rafs, current daemonconfig.DaemonConfig) bool) error {
+	template := m.GetDaemonConfig()
+	if template == nil || m.FsDriver != config.FsDriverFusedev {
+		return nil
+	}
+	params := map[string]string{daemonconfig.CacheDir: m.CacheDir()}
+	return m.updateRafsConfigs("reselect mirror", func(r *rafs.Rafs, current daemonconfig.DaemonConfig) (daemonconfig.DaemonConfig, error) {
+		if !filter(r, current) {
+			return nil, nil
+		}
+		changed, err := daemonconfig.ReselectMirror(current, template, r.ImageID, r.SnapshotID, r.Annotations, params)
+		if err != nil || !changed {
+			return nil, err
+		}
+		return current, nil
+	})
+}
+
+type rafsInstance struct {
+	d *daemon.Daemon
+	r *rafs.Rafs
+}
+
+// updateRafsConfigs pushes the configuration returned by update for each RAFS instance of
+// the running daemons, nil to leave it. The manager is only locked to list the instances,
+// as update may take a while to e.g. fetch credentials.
+func (m *Manager) updateRafsConfigs(action string, update func(r *rafs.Rafs, current daemonconfig.DaemonConfig) (daemonconfig.DaemonConfig, error)) error {
+	var instances []rafsInstance
+	m.Lock()
+	for _, d := range m.ListDaemons() {
+		if d.State() != types.DaemonStateRunning {
+			continue
+		}
+		for _, r := range d.RafsCache.List() {
+			if r.ImageID != "" {
+				instances = append(instances, rafsInstance{d: d, r: r})
+			}
+		}
+	}
+	m.Unlock()
+
+	var errs []error
+	for _, i := range instances {
+		if err := m.updateRafsConfig(i.d, i.r, update); err != nil {
+			errs = append(errs, errors.Wrapf(err, "%s of snapshot %s on daemon %s", action, i.r.SnapshotID, i.d.ID()))
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+func (m *Manager) updateRafsConfig(d *daemon.Daemon, r *rafs.Rafs, update func(r *rafs.Rafs, current daemonconfig.DaemonConfig) (daemonconfig.DaemonConfig, error)) error {
+	current, err := daemonconfig.NewDaemonConfig(d.States.FsDriver, instanceConfigFile(d, r))
+	if err != nil {
+		return errors.Wrap(err, "load current daemon config")
+	}
+	cfg, err := update(r, current)
+	if err != nil || cfg == nil {
+		return err
+	}
+	// The instance may have been unmounted meanwhile.
+	if d.RafsCache.Get(r.SnapshotID) == nil {
+		return nil
+	}
+	if err := d.ReloadConfig(r, cfg); err != nil {
+		return err
+	}
+	if mirror, _ := daemonconfig.ActiveMirror(cfg, r.ImageID); mirror != r.Mirror {
+		r.Mirror = mirror
+		return errors.Wrap(m.UpdateRafsInstance(r), "update instance")
+	}
+	return nil
+}
+
+// instanceConfigFile returns the configuration file of the RAFS instance served by d.
+func instanceConfigFile(d *daemon.Daemon, r *rafs.Rafs) string {
+	if d.IsSharedDaemon() {
+		return d.ConfigFile(r.SnapshotID)
+	}
+	return d.ConfigFile("")
+}
+
+// AllowMetadataCacheHosts lets the metadata cache forward the requests of the RAFS instances
+// of the daemons, e.g. of the ones recovered from an earlier run of the snapshotter.
+func (m *Manager) AllowMetadataCacheHosts() {
+	for _, d := range m.ListDaemons() {
+		for _, r := range d.RafsCache.List() {
+			c, err := daemonconfig.NewDaemonConfig(d.States.FsDriver, instanceConfigFile(d, r))
+			if err != nil {
+				log.L.WithError(err).Debugf("Failed to load config of snapshot %s", r.SnapshotID)
+				continue
+			}
+			daemonconfig.AllowMetadataCacheHosts(c)
+		}
+	}
+}
+
+func (m *Manager) reloadRafsConfig(r *rafs.Rafs, current, template daemonconfig.DaemonConfig) (daemonconfig.DaemonConfig, error) {
+	// The backend labels of the image are kept as annotations of the instance.
+	cfg := template.Clone()
+	params := map[string]string{daemonconfig.CacheDir: m.CacheDir()}
+	result, err := daemonconfig.SupplementDaemonConfigWithResult(cfg, r.ImageID, r.SnapshotID, false, r.Annotations, params)
+	if err != nil {
+		return nil, errors.Wrap(err, "supplement configuration")
+	}
+	if !result.AuthFilled {
+		// Credentials from pull secrets are not available anymore, keep the ones in use.
+		_, cur := current.StorageBackend()
+		_, next := cfg.StorageBackend()
+		next.Auth, next.RegistryToken = cur.Auth, cur.RegistryToken
+	}
+	log.L.Infof("Reloaded %s backend configuration of snapshot %s", result.Backend, r.SnapshotID)
+	return cfg, nil
+}
@@ -0,0 +1,467 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package metacache implements the caching proxy nydusd daemons of a node send their
+// HEAD, manifest and token requests to. Requests are addressed by the original URL as
+// path, i.e. "<proxy>/<scheme>/<host>/<path>", and identical requests are sent upstream
+// once, both when they are in flight at the same time and while the response is cached.
+// Only the registries and mirrors daemons were pointed at, and the token services they
+// name, are forwarded to.
+package metacache
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultTTL        = 30 * time.Second
+	defaultMaxEntries = 1024
+	// Manifests and tokens are small, larger responses are not buffered.
+	maxBodySize = 4 << 20
+	// Tokens are dropped from the cache this long before they expire.
+	tokenExpiryMargin = 10 * time.Second
+	// Lifetime of tokens without expires_in, as defined by the token spec.
+	defaultTokenLifetime = 60 * time.Second
+	upstreamTimeout      = 30 * time.Second
+)
+
+// Request headers forwarded upstream, responses differ by the first two.
+var forwardedHeaders = []string{"Accept", "Authorization", "User-Agent"}
+
+// Token service of a registry named in the WWW-Authenticate header of its responses.
+var realmPattern = regexp.MustCompile(`realm="([^"]+)"`)
+
+// Manifests, by tag or digest, of a repository.
+var manifestPathPattern = regexp.MustCompile(`^/v2/.+/manifests/[^/]+$`)
+
+// Response headers not stored with cached responses, as they only apply to the connection
+// they were received on or to the client which received them.
+var unstoredHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Set-Cookie",
+}
+
+var (
+	cache   *Cache
+	cacheMu sync.Mutex
+)
+
+type response struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	client     *http.Client
+
+	group   singleflight.Group
+	mu      sync.Mutex
+	entries map[string]*response
+	// Hosts requests may be forwarded to.
+	allowed map[string]bool
+	// Token services, by host and path, named by the allowed hosts.
+	realms map[string]bool
+}
+
+type Opt func(c *Cache)
+
+// WithTTL sets how long successful responses are cached, 30s if not positive.
+func WithTTL(ttl time.Duration) Opt {
+	return func(c *Cache) {
+		if ttl > 0 {
+			c.ttl = ttl
+		}
+	}
+}
+
+// WithMaxEntries limits the number of cached responses, 1024 if not positive.
+func WithMaxEntries(n int) Opt {
+	return func(c *Cache) {
+		if n > 0 {
+			c.maxEntries = n
+		}
+	}
+}
+
+// WithInsecure skips the verification of registry certificates.
+func WithInsecure(insecure bool) Opt {
+	return func(c *Cache) {
+		if insecure {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec // Requested by skip_ssl_verify
+			c.client.Transport = transport
+		}
+	}
+}
+
+func New(opts ...Opt) *Cache {
+	c := &Cache{
+		ttl:        defaultTTL,
+		maxEntries: defaultMaxEntries,
+		entries:    map[string]*response{},
+		allowed:    map[string]bool{},
+		realms:     map[string]bool{},
+	}
+	c.client = &http.Client{Timeout: upstreamTimeout, CheckRedirect: c.checkRedirect}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// InitCache starts the cache on addr until ctx is done. This should be called once at
+// startup if the metadata cache is configured.
+func InitCache(ctx context.Context, addr string, opts ...Opt) error {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if cache != nil {
+		return nil
+	}
+	c := New(opts...)
+	if err := c.Serve(ctx, addr); err != nil {
+		return err
+	}
+	cache = c
+	return nil
+}
+
+// AllowHost lets the cache forward requests to the registry or mirror at u, e.g.
+// "https://registry.example.com", see Cache.AllowHost. It does nothing without a cache.
+func AllowHost(u *url.URL) {
+	cacheMu.Lock()
+	c := cache
+	cacheMu.Unlock()
+
+	if c != nil {
+		c.AllowHost(u)
+	}
+}
+
+// AllowHost lets the cache forward requests to the host of u. The token service the registry
+// API root at u refers to is allowed along with it, as nydusd requests its tokens through the
+// cache after being challenged by blob requests sent past it.
+func (c *Cache) AllowHost(u *url.URL) {
+	if !c.allow(u.Host) {
+		return
+	}
+	go func() {
+		root := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/v2/"}
+		ctx, cancel := context.WithTimeout(context.Background(), upstreamTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, root.String(), nil)
+		if err != nil {
+			return
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			log.L.WithError(err).Debugf("Failed to look up token service of %s", u.Host)
+			return
+		}
+		resp.Body.Close()
+		c.allowRealm(resp.Header)
+	}()
+}
+
+// allow adds host to the allowed ones, false if it was already.
+func (c *Cache) allow(host string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.allowed[host] {
+		return false
+	}
+	c.allowed[host] = true
+	return true
+}
+
+func (c *Cache) isAllowed(host string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.allowed[host]
+}
+
+// allowRealm allows the token service named in the WWW-Authenticate header of a response.
+func (c *Cache) allowRealm(header http.Header) {
+	for _, challenge := range header.Values("WWW-Authenticate") {
+		m := realmPattern.FindStringSubmatch(challenge)
+		if m == nil {
+			continue
+		}
+		if realm, err := url.Parse(m[1]); err == nil && realm.Host != "" {
+			c.allow(realm.Host)
+			c.mu.Lock()
+			c.realms[realm.Host+realm.Path] = true
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *Cache) isRealm(u *url.URL) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.realms[u.Host+u.Path]
+}
+
+// checkRedirect follows redirects to allowed hosts only, others are returned to the
+// daemon unfollowed.
+func (c *Cache) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if !c.isAllowed(req.URL.Host) {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+// Serve listens on the TCP address addr and serves the proxy until ctx is done.
+func (c *Cache) Serve(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "metadata cache listener, addr=%s", addr)
+	}
+	server := &http.Server{Handler: c, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.L.Errorf("Metadata cache fails to serve %s: %v", addr, err)
+		}
+	}()
+	return nil
+}
+
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	upstream, err := upstreamURL(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !c.isAllowed(upstream.Host) {
+		http.Error(w, fmt.Sprintf("%s is not a registry or mirror of the node", upstream.Host), http.StatusForbidden)
+		return
+	}
+
+	if !c.cacheable(r.Method, upstream) {
+		resp, err := c.forward(r.Context(), r, upstream)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		copyHeader(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	resp, err := c.get(r, upstream)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	copyHeader(w.Header(), resp.header)
+	w.WriteHeader(resp.status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(resp.body)
+	}
+}
+
+// get returns the cached response of the request, or sends it upstream once for all
+// callers asking at the same time.
+func (c *Cache) get(r *http.Request, upstream *url.URL) (*response, error) {
+	key := cacheKey(r, upstream)
+	if resp := c.lookup(key); resp != nil {
+		return resp, nil
+	}
+
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		if resp := c.lookup(key); resp != nil {
+			return resp, nil
+		}
+		// Callers going away must not fail the others waiting for the same response.
+		ctx := context.WithoutCancel(r.Context())
+		resp, err := c.fetch(ctx, r, upstream)
+		if err != nil {
+			return nil, err
+		}
+		c.store(key, resp)
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*response), nil
+}
+
+func (c *Cache) fetch(ctx context.Context, r *http.Request, upstream *url.URL) (*response, error) {
+	resp, err := c.forward(ctx, r, upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read response of %s", upstream.Redacted())
+	}
+	if len(body) > maxBodySize {
+		return nil, errors.Errorf("response of %s exceeds %d bytes", upstream.Redacted(), maxBodySize)
+	}
+
+	header := resp.Header.Clone()
+	for _, name := range header.Values("Connection") {
+		for _, h := range strings.Split(name, ",") {
+			header.Del(strings.TrimSpace(h))
+		}
+	}
+	for _, name := range unstoredHeaders {
+		header.Del(name)
+	}
+	result := &response{status: resp.StatusCode, header: header, body: body}
+	if ttl := c.expiry(resp, body); ttl > 0 {
+		result.expires = time.Now().Add(ttl)
+	}
+	return result, nil
+}
+
+func (c *Cache) forward(ctx context.Context, r *http.Request, upstream *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, r.Method, upstream.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range forwardedHeaders {
+		if v, ok := r.Header[h]; ok {
+			req.Header[h] = v
+		}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request %s", upstream.Redacted())
+	}
+	c.allowRealm(resp.Header)
+	return resp, nil
+}
+
+// expiry returns how long resp may be served from the cache, zero if not at all.
+func (c *Cache) expiry(resp *http.Response, body []byte) time.Duration {
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return 0
+	}
+	ttl := c.ttl
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if json.Unmarshal(body, &token) == nil && (token.Token != "" || token.AccessToken != "") {
+		lifetime := defaultTokenLifetime
+		if token.ExpiresIn > 0 {
+			lifetime = time.Duration(token.ExpiresIn) * time.Second
+		}
+		ttl = min(ttl, lifetime-tokenExpiryMargin)
+	}
+	return ttl
+}
+
+func (c *Cache) lookup(key string) *response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(resp.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return resp
+}
+
+func (c *Cache) store(key string, resp *response) {
+	if resp.expires.IsZero() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// Responses are cached for a short time only, so rather than tracking their use
+		// the new one is just not cached if all entries are still valid.
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+	c.entries[key] = resp
+}
+
+// upstreamURL returns the original URL of a request to the proxy.
+func upstreamURL(u *url.URL) (*url.URL, error) {
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 3)
+	if len(parts) < 2 || (parts[0] != "http" && parts[0] != "https") || parts[1] == "" {
+		return nil, errors.Errorf("invalid path %q, expect /<scheme>/<host>/<path>", u.Path)
+	}
+	upstream := &url.URL{Scheme: parts[0], Host: parts[1], Path: "/", RawQuery: u.RawQuery}
+	if len(parts) == 3 {
+		upstream.Path += parts[2]
+	}
+	return upstream, nil
+}
+
+// cacheable tells whether the request is a HEAD request, or a GET request of a manifest
+// or of a token from a token service named by an allowed host. Other responses, like blob
+// data, are never buffered.
+func (c *Cache) cacheable(method string, u *url.URL) bool {
+	return method == http.MethodHead || manifestPathPattern.MatchString(u.Path) || c.isRealm(u)
+}
+
+func cacheKey(r *http.Request, upstream *url.URL) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + upstream.String() + "\n"))
+	for _, name := range forwardedHeaders[:2] {
+		h.Write([]byte(name + ": " + strings.Join(r.Header.Values(name), ",") + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package metacache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case r.URL.Path == "/token":
+			_, _ = io.WriteString(w, `{"token": "abc", "expires_in": 5}`)
+		case strings.Contains(r.URL.Path, "/manifests/"):
+			<-release
+			w.Header().Set("Docker-Content-Digest", "sha256:1234")
+			_, _ = io.WriteString(w, "manifest of "+r.Header.Get("Authorization"))
+		default:
+			_, _ = io.WriteString(w, "blob")
+		}
+	}))
+	defer registry.Close()
+
+	c := New(WithTTL(time.Minute))
+	proxy := httptest.NewServer(c)
+	defer proxy.Close()
+	base := proxy.URL + "/http/" + strings.TrimPrefix(registry.URL, "http://")
+	c.allow(strings.TrimPrefix(registry.URL, "http://"))
+
+	get := func(path, auth string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, base+path, nil)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	// Identical requests in flight at the same time are sent upstream once.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, body := get("/v2/app/manifests/latest", "Bearer a")
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "sha256:1234", resp.Header.Get("Docker-Content-Digest"))
+			require.Equal(t, "manifest of Bearer a", body)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), requests.Load())
+
+	// Cached responses are served without asking the registry again, but differ by credential.
+	_, body := get("/v2/app/manifests/latest", "Bearer a")
+	require.Equal(t, "manifest of Bearer a", body)
+	require.Equal(t, int32(1), requests.Load())
+	_, body = get("/v2/app/manifests/latest", "Bearer b")
+	require.Equal(t, "manifest of Bearer b", body)
+	require.Equal(t, int32(2), requests.Load())
+
+	// Blobs are never cached.
+	get("/v2/app/blobs/sha256:5678", "")
+	get("/v2/app/blobs/sha256:5678", "")
+	require.Equal(t, int32(4), requests.Load())
+
+	// Tokens expiring sooner than the margin are not cached.
+	_, body = get("/token", "")
+	require.Contains(t, body, "abc")
+	get("/token", "")
+	require.Equal(t, int32(6), requests.Load())
+
+	resp, err := http.Get(proxy.URL + "/ftp/example.com/file")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCacheAllowedHosts(t *testing.T) {
+	var requests atomic.Int32
+	var tokenServer *httptest.Server
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+tokenServer.URL+`/token",service="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer registry.Close()
+	tokenServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"token": "abc", "expires_in": 300}`)
+	}))
+	defer tokenServer.Close()
+
+	c := New()
+	proxy := httptest.NewServer(c)
+	defer proxy.Close()
+	status := func(method, upstream string) int {
+		req, err := http.NewRequest(method, proxy.URL+"/http/"+strings.TrimPrefix(upstream, "http://"), nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Hosts daemons were not pointed at are not forwarded to.
+	require.Equal(t, http.StatusForbidden, status(http.MethodGet, registry.URL+"/v2/"))
+	require.Equal(t, http.StatusForbidden, status(http.MethodGet, tokenServer.URL+"/token"))
+	require.Zero(t, requests.Load())
+
+	// Allowing a registry allows the token service it challenges with.
+	u, err := url.Parse(registry.URL)
+	require.NoError(t, err)
+	c.AllowHost(u)
+	require.Eventually(t, func() bool {
+		return status(http.MethodGet, tokenServer.URL+"/token") == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusUnauthorized, status(http.MethodHead, registry.URL+"/v2/app/manifests/latest"))
+
+	// Only requests reading from the registry are forwarded.
+	require.Equal(t, http.StatusMethodNotAllowed, status(http.MethodPost, registry.URL+"/v2/app/blobs/uploads/"))
+	require.Equal(t, http.StatusMethodNotAllowed, status(http.MethodDelete, registry.URL+"/v2/app/manifests/latest"))
+}
+
+func TestCacheCacheable(t *testing.T) {
+	var requests atomic.Int32
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "elsewhere")
+	}))
+	defer elsewhere.Close()
+	var registry *httptest.Server
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case r.URL.Path == "/v2/":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+registry.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/token", r.URL.Path == "/other-token":
+			_, _ = io.WriteString(w, `{"token": "abc", "expires_in": 300}`)
+		case r.URL.Path == "/v2/app/manifests/redirected":
+			http.Redirect(w, r, elsewhere.URL+"/manifest", http.StatusTemporaryRedirect)
+		default:
+			w.Header().Set("Connection", "X-Hop")
+			w.Header().Set("X-Hop", "1")
+			w.Header().Set("Set-Cookie", "session=1")
+			w.Header().Set("Docker-Content-Digest", "sha256:1234")
+			_, _ = io.WriteString(w, "content")
+		}
+	}))
+	defer registry.Close()
+
+	c := New(WithTTL(time.Minute))
+	proxy := httptest.NewServer(c)
+	defer proxy.Close()
+	base := proxy.URL + "/http/" + strings.TrimPrefix(registry.URL, "http://")
+	c.allow(strings.TrimPrefix(registry.URL, "http://"))
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func(path string) *http.Response {
+		resp, err := client.Get(base + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	count := func(path string) int32 {
+		before := requests.Load()
+		get(path)
+		return requests.Load() - before
+	}
+
+	// Only manifests and tokens of the token service of a registry are cached.
+	get("/v2/app/manifests/latest")
+	require.Zero(t, count("/v2/app/manifests/latest"))
+	get("/v2/app/tags/list")
+	require.Equal(t, int32(1), count("/v2/app/tags/list"))
+	get("/token")
+	require.Equal(t, int32(1), count("/token"))
+	get("/v2/")
+	get("/token")
+	require.Zero(t, count("/token"))
+	get("/other-token")
+	require.Equal(t, int32(1), count("/other-token"))
+
+	// Headers of the connection and the client are not stored.
+	resp := get("/v2/app/manifests/latest")
+	require.Equal(t, "sha256:1234", resp.Header.Get("Docker-Content-Digest"))
+	require.Empty(t, resp.Header.Get("Set-Cookie"))
+	require.Empty(t, resp.Header.Get("X-Hop"))
+
+	// Redirects to hosts the daemons were not pointed at are not followed.
+	resp = get("/v2/app/manifests/redirected")
+	require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	require.Equal(t, elsewhere.URL+"/manifest", resp.Header.Get("Location"))
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := New(WithTTL(time.Minute))
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+
+	require.Equal(t, time.Minute, c.expiry(resp, []byte("manifest")))
+	require.Equal(t, 50*time.Second, c.expiry(resp, []byte(`{"token": "abc"}`)))
+	require.Equal(t, time.Minute, c.expiry(resp, []byte(`{"access_token": "abc", "expires_in": 300}`)))
+
+	resp.Header.Set("Cache-Control", "no-store")
+	require.Zero(t, c.expiry(resp, []byte("manifest")))
+	resp = &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{}}
+	require.Zero(t, c.expiry(resp, nil))
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"github.com/containerd/log"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type BackendMetricsCollector struct {
+	Metrics     *types.BackendMetrics
+	BackendType string
+	Host        string
+}
+
+type BackendMetricsVecCollector struct {
+	MetricsVec []BackendMetricsCollector
+}
+
+func (b *BackendMetricsCollector) Collect() {
+	b.collect(map[[3]string]struct{}{})
+}
+
+// collect skips the blobs in seen, since a blob shared by several images of a daemon
+// may be reported by each of them.
+func (b *BackendMetricsCollector) collect(seen map[[3]string]struct{}) {
+	if b.Metrics == nil {
+		log.L.Warnf("can not collect backend metrics: Metrics is nil")
+		return
+	}
+
+	backendType := b.BackendType
+	if backendType == "" {
+		backendType = b.Metrics.BackendType
+	}
+	for _, blob := range b.Metrics.Blobs {
+		key := [3]string{backendType, b.Host, blob.BlobID}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		data.BackendBlobReadBytes.WithLabelValues(key[:]...).Set(float64(blob.ReadAmountTotal))
+		data.BackendBlobReadRetries.WithLabelValues(key[:]...).Set(float64(blob.ReadRetries))
+		latency, err := data.BackendBlobReadLatency.ToConstSummary(blob.ReadLatencyDist,
+			float64(blob.ReadCumulativeLatencyMillisTotal), key[:]...)
+		if err != nil {
+			log.L.Warnf("failed to new const summary for blob %s, error: %v", blob.BlobID, err)
+			continue
+		}
+		data.BackendBlobReadLatency.Save(latency)
+	}
+}
+
+func (b *BackendMetricsVecCollector) Clear() {
+	data.BackendBlobReadLatency.Clear()
+}
+
+func (b *BackendMetricsVecCollector) Collect() {
+	b.Clear()
+	seen := map[[3]string]struct{}{}
+	for _, backendMetrics := range b.MetricsVec {
+		backendMetrics.collect(seen)
+	}
+}
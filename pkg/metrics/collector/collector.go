@@ -68,3 +68,7 @@ func NewCacheMetricsCollector(m *types.CacheMetrics, imageRef, daemonID string)
 func NewCacheMetricsVecCollector() *CacheMetricsVecCollector {
 	return &CacheMetricsVecCollector{}
 }
+
+func NewBackendMetricsVecCollector() *BackendMetricsVecCollector {
+	return &BackendMetricsVecCollector{}
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	mtypes "github.com/containerd/nydus-snapshotter/pkg/metrics/types"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/types/ttl"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var backendBlobLabels = []string{backendTypeLabel, registryHostLabel, blobIDLabel}
+
+var (
+	BackendBlobReadBytes = ttl.NewGaugeVecWithTTL(
+		prometheus.GaugeOpts{
+			Name: "nydusd_backend_blob_read_bytes",
+			Help: "Total bytes of a blob downloaded from the storage backend.",
+		},
+		backendBlobLabels,
+		ttl.DefaultTTL,
+	)
+	BackendBlobReadRetries = ttl.NewGaugeVecWithTTL(
+		prometheus.GaugeOpts{
+			Name: "nydusd_backend_blob_read_retries",
+			Help: "Total number of retried requests for a blob to the storage backend.",
+		},
+		backendBlobLabels,
+		ttl.DefaultTTL,
+	)
+
+	BackendBlobReadLatency = &mtypes.MetricSummary{
+		Desc: prometheus.NewDesc(
+			"nydusd_backend_blob_read_latency_milliseconds",
+			"Latency percentiles of reading a blob from the storage backend, in milliseconds.",
+			backendBlobLabels,
+			prometheus.Labels{},
+		),
+		Bounds:    []float64{1, 20, 50, 100, 500, 1000, 2000},
+		Quantiles: []float64{0.5, 0.9, 0.99},
+	}
+)
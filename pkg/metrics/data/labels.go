@@ -1,10 +1,15 @@
 package data
 
 const (
-	imageRefLabel         = "image_ref"
-	nydusdEventLabel      = "nydusd_event"
-	nydusdVersionLabel    = "version"
-	daemonIDLabel         = "daemon_id"
-	snapshotEventLabel    = "snapshot_operation"
-	credentialResultLabel = "result"
+	imageRefLabel             = "image_ref"
+	nydusdEventLabel          = "nydusd_event"
+	nydusdVersionLabel        = "version"
+	daemonIDLabel             = "daemon_id"
+	snapshotEventLabel        = "snapshot_operation"
+	credentialResultLabel     = "result"
+	backendTypeLabel          = "backend_type"
+	registryHostLabel         = "registry_host"
+	blobIDLabel               = "blob_id"
+	mirrorHostLabel           = "mirror_host"
+	mirrorFallbackTargetLabel = "target"
 )
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var mirrorPingBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+var (
+	// MirrorRequests counts the mounts which tried to fetch the image from a mirror.
+	MirrorRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_mirror_requests_total",
+			Help: "Total number of mounts which tried a mirror, labeled by mirror host.",
+		},
+		[]string{mirrorHostLabel},
+	)
+
+	// MirrorFailures counts the failed pings of a mirror, on mounts and by the latency prober.
+	MirrorFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_mirror_failures_total",
+			Help: "Total number of failed pings of a mirror, labeled by mirror host.",
+		},
+		[]string{mirrorHostLabel},
+	)
+
+	// MirrorFallbacks counts the mounts which passed over an unusable mirror, labeled by
+	// whether they went on to the next mirror or to the origin registry.
+	MirrorFallbacks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_mirror_fallbacks_total",
+			Help: "Total number of mounts which fell back from a failing, backed off or disabled mirror, labeled by mirror host and target (mirror or registry).",
+		},
+		[]string{mirrorHostLabel, mirrorFallbackTargetLabel},
+	)
+
+	// MirrorFailbacks counts the times running instances were pointed back at a recovered mirror.
+	MirrorFailbacks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_mirror_failbacks_total",
+			Help: "Total number of times running instances were failed back to a recovered mirror, labeled by mirror host.",
+		},
+		[]string{mirrorHostLabel},
+	)
+
+	MirrorPingLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "snapshotter_mirror_ping_latency_milliseconds",
+			Help:    "Latency of successful pings of a mirror, labeled by mirror host.",
+			Buckets: mirrorPingBuckets,
+		},
+		[]string{mirrorHostLabel},
+	)
+)
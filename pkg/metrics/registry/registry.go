@@ -50,6 +50,14 @@ func init() {
 		data.CacheBlobDeletionErrors,
 		data.CredentialRenewals,
 		data.CredentialStoreEntries,
+		data.BackendBlobReadBytes,
+		data.BackendBlobReadRetries,
+		data.BackendBlobReadLatency,
+		data.MirrorRequests,
+		data.MirrorFailures,
+		data.MirrorFallbacks,
+		data.MirrorFailbacks,
+		data.MirrorPingLatency,
 	)
 
 	for _, m := range data.MetricHists {
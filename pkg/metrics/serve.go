@@ -17,6 +17,8 @@ import (
 
 	"github.com/containerd/log"
 	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
 	"github.com/containerd/nydus-snapshotter/pkg/manager"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
@@ -30,6 +32,7 @@ type Server struct {
 	snCollectors      []*collector.SnapshotterMetricsCollector
 	fsCollector       *collector.FsMetricsVecCollector
 	cacheCollector    *collector.CacheMetricsVecCollector
+	backendCollector  *collector.BackendMetricsVecCollector
 	inflightCollector *collector.InflightMetricsVecCollector
 	hungIOInterval    time.Duration
 	collectInterval   time.Duration
@@ -73,6 +76,7 @@ func NewServer(ctx context.Context, opts ...ServerOpt) (*Server, error) {
 	s.fsCollector = collector.NewFsMetricsVecCollector()
 	s.inflightCollector = collector.NewInflightMetricsVecCollector(s.hungIOInterval)
 	s.cacheCollector = collector.NewCacheMetricsVecCollector()
+	s.backendCollector = collector.NewBackendMetricsVecCollector()
 	for _, pm := range s.managers {
 		snCollector, err := collector.NewSnapshotterMetricsCollector(ctx, pm.CacheDir(), os.Getpid())
 		if err != nil {
@@ -188,6 +192,63 @@ func (s *Server) CollectCacheMetrics(ctx context.Context) {
 	}
 }
 
+func (s *Server) CollectBackendMetrics(ctx context.Context) {
+	var backendMetricsVec []collector.BackendMetricsCollector
+
+	for _, pm := range s.managers {
+		daemons := pm.ListDaemons()
+		for _, d := range daemons {
+			// Skip daemons that are not serving
+			if d.State() != types.DaemonStateRunning {
+				continue
+			}
+
+			for _, i := range d.RafsCache.List() {
+				var sid string
+
+				if d.IsSharedDaemon() {
+					sid = i.SnapshotID
+				} else {
+					sid = ""
+				}
+
+				backendMetrics, err := d.GetBackendMetrics(sid)
+				if err != nil {
+					log.G(ctx).Errorf("failed to get backend metric: %v", err)
+					continue
+				}
+
+				backendType, host := instanceBackend(d, sid)
+				backendMetricsVec = append(backendMetricsVec, collector.BackendMetricsCollector{
+					Metrics:     backendMetrics,
+					BackendType: backendType,
+					Host:        host,
+				})
+			}
+		}
+	}
+
+	if backendMetricsVec != nil {
+		s.backendCollector.MetricsVec = backendMetricsVec
+		s.backendCollector.Collect()
+	}
+}
+
+// instanceBackend returns the backend type and the registry host or object storage endpoint
+// from the configuration the instance was mounted with.
+func instanceBackend(d *daemon.Daemon, sid string) (string, string) {
+	c, err := daemonconfig.NewDaemonConfig(d.States.FsDriver, d.ConfigFile(sid))
+	if err != nil {
+		log.L.Debugf("Failed to load config of daemon %s instance %q: %v", d.ID(), sid, err)
+		return "", ""
+	}
+	backendType, bc := c.StorageBackend()
+	if bc.Host != "" {
+		return backendType.String(), bc.Host
+	}
+	return backendType.String(), bc.EndPoint
+}
+
 func (s *Server) CollectInflightMetrics(ctx context.Context) {
 	inflightMetricsVec := make([]*types.InflightMetrics, 0, 16)
 	for _, pm := range s.managers {
@@ -234,6 +295,7 @@ outer:
 		case <-timer.C:
 			s.CollectFsMetrics(ctx)
 			s.CollectCacheMetrics(ctx)
+			s.CollectBackendMetrics(ctx)
 			s.CollectDaemonResourceMetrics(ctx)
 			// Collect snapshotter metrics.
 			for _, snCollector := range s.snCollectors {
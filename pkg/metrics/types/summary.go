@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package fs
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricSummary exposes latency percentiles estimated from the distributions reported by nydusd.
+type MetricSummary struct {
+	Desc *prometheus.Desc
+	// Upper bounds of the ranges of a distribution, except for the last range which is unbounded.
+	Bounds    []float64
+	Quantiles []float64
+
+	// Save the last generated summary metric
+	constSummaries []prometheus.Metric
+}
+
+func (s *MetricSummary) ToConstSummary(dist []uint64, sum float64, labelValues ...string) (prometheus.Metric, error) {
+	if len(dist) != len(s.Bounds)+1 {
+		return nil, fmt.Errorf("length of distribution(%d) does not match bounds(%d): %+v", len(dist), len(s.Bounds), s.Bounds)
+	}
+
+	var count uint64
+	for _, c := range dist {
+		count += c
+	}
+	quantiles := make(map[float64]float64, len(s.Quantiles))
+	for _, q := range s.Quantiles {
+		quantiles[q] = s.estimate(dist, count, q)
+	}
+
+	return prometheus.NewConstSummary(s.Desc, count, sum, quantiles, labelValues...)
+}
+
+// estimate returns the upper bound of the range the q-quantile falls in.
+func (s *MetricSummary) estimate(dist []uint64, count uint64, q float64) float64 {
+	if count == 0 {
+		return math.NaN()
+	}
+	var cumulative uint64
+	for i, c := range dist[:len(s.Bounds)] {
+		cumulative += c
+		if float64(cumulative) >= q*float64(count) {
+			return s.Bounds[i]
+		}
+	}
+	return math.Inf(1)
+}
+
+func (s *MetricSummary) Clear() {
+	s.constSummaries = nil
+}
+
+func (s *MetricSummary) Save(m prometheus.Metric) {
+	s.constSummaries = append(s.constSummaries, m)
+}
+
+// Implement prometheus.Collector interface
+func (s *MetricSummary) Describe(ch chan<- *prometheus.Desc) {
+	if s.Desc != nil {
+		ch <- s.Desc
+	}
+}
+
+func (s *MetricSummary) Collect(ch chan<- prometheus.Metric) {
+	for _, summary := range s.constSummaries {
+		ch <- summary
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mirrorcrd
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+var (
+	controller   *Controller
+	controllerMu sync.Mutex
+)
+
+// Controller renders the NydusMirrorConfig resources selecting a node into its mirrors
+// directory, from where they are loaded like hosts.toml files written by hand.
+type Controller struct {
+	dir      string
+	nodeName string
+
+	// Serializes the renders triggered by both informers.
+	mu      sync.Mutex
+	configs cache.SharedIndexInformer
+	node    cache.SharedIndexInformer
+}
+
+// InitController watches the NydusMirrorConfig resources and the node until ctx is done.
+// This should be called once at startup if mirrors from Kubernetes are enabled.
+func InitController(ctx context.Context, c config.KubernetesMirrorsConfig, dir string) error {
+	controllerMu.Lock()
+	defer controllerMu.Unlock()
+
+	if controller != nil {
+		return nil
+	}
+
+	loadingRule := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRule.ExplicitPath = c.KubeconfigPath
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRule,
+		&clientcmd.ConfigOverrides{},
+	).ClientConfig()
+	if err != nil {
+		return errors.Wrap(err, "load kubeconfig")
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return errors.Wrap(err, "create kubernetes dynamic client")
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return errors.Wrap(err, "create kubernetes client")
+	}
+
+	nodeName := c.NodeName
+	if nodeName == "" {
+		nodeName = os.Getenv("NODE_NAME")
+	}
+	if nodeName == "" {
+		if nodeName, err = os.Hostname(); err != nil {
+			return errors.Wrap(err, "get node name")
+		}
+	}
+
+	ctrl := NewController(dir, nodeName, dynamicClient, clientset)
+	if err := ctrl.Start(ctx); err != nil {
+		return err
+	}
+	controller = ctrl
+	log.L.WithField("node", nodeName).Info("mirrors of NydusMirrorConfig resources are rendered")
+	return nil
+}
+
+func NewController(dir, nodeName string, dynamicClient dynamic.Interface, clientset kubernetes.Interface) *Controller {
+	configs := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0).
+		ForResource(GroupVersionResource).Informer()
+	node := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+		})).Core().V1().Nodes().Informer()
+	return newController(dir, nodeName, configs, node)
+}
+
+func newController(dir, nodeName string, configs, node cache.SharedIndexInformer) *Controller {
+	return &Controller{dir: dir, nodeName: nodeName, configs: configs, node: node}
+}
+
+// Start runs the informers until ctx is done and renders the mirrors once they are synced.
+// It doesn't wait for that, the files rendered before, e.g. by an earlier run, are used
+// meanwhile.
+func (c *Controller) Start(ctx context.Context) error {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.sync() },
+		UpdateFunc: func(_, _ interface{}) { c.sync() },
+		DeleteFunc: func(interface{}) { c.sync() },
+	}
+	for _, informer := range []cache.SharedIndexInformer{c.configs, c.node} {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return errors.Wrap(err, "add event handler to informer")
+		}
+		go informer.Run(ctx.Done())
+	}
+	go func() {
+		if !cache.WaitForCacheSync(ctx.Done(), c.configs.HasSynced, c.node.HasSynced) {
+			log.L.Warn("Stopped before NydusMirrorConfig resources were synced")
+			return
+		}
+		c.sync()
+	}()
+	return nil
+}
+
+// sync renders the current resources into the mirrors directory.
+func (c *Controller) sync() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Rendering a partial list would remove the mirrors of resources not listed yet.
+	if !c.configs.HasSynced() || !c.node.HasSynced() {
+		return
+	}
+
+	var node labels.Set
+	if obj, ok, _ := c.node.GetStore().GetByKey(c.nodeName); ok {
+		node = obj.(*corev1.Node).Labels
+	} else {
+		log.L.Warnf("Node %s not found, only NydusMirrorConfig resources without node selector apply", c.nodeName)
+	}
+
+	var configs []*NydusMirrorConfig
+	for _, obj := range c.configs.GetStore().List() {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		var mc NydusMirrorConfig
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &mc); err != nil {
+			log.L.WithError(err).Warnf("Skipping invalid NydusMirrorConfig %s", u.GetName())
+			continue
+		}
+		configs = append(configs, &mc)
+	}
+
+	if err := write(c.dir, render(configs, node)); err != nil {
+		log.L.WithError(err).Warn("Failed to write mirrors of NydusMirrorConfig resources")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mirrorcrd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+)
+
+func newMirrorConfig(t *testing.T, name string, spec NydusMirrorConfigSpec) *unstructured.Unstructured {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&NydusMirrorConfig{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersionResource.GroupVersion().String(), Kind: "NydusMirrorConfig"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       spec,
+	})
+	require.NoError(t, err)
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func newInformer(objType, list runtime.Object, w watch.Interface) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc:  func(metav1.ListOptions) (runtime.Object, error) { return list, nil },
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) { return w, nil },
+	}, objType, 0, cache.Indexers{})
+}
+
+func TestController(t *testing.T) {
+	dir := t.TempDir()
+	// Files written by hand are left alone.
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "ghcr.io"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ghcr.io", hostsFile), []byte(`[host."http://manual:5000"]`), 0644))
+
+	all := newMirrorConfig(t, "b-all", NydusMirrorConfigSpec{Registries: []RegistryMirrors{{
+		Host:    "docker.io",
+		Mirrors: []Mirror{{Host: "http://fallback:5000", Weight: 1}},
+	}}})
+	gpu := newMirrorConfig(t, "a-gpu", NydusMirrorConfigSpec{
+		NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "gpu"}},
+		Registries: []RegistryMirrors{{
+			Host: "docker.io",
+			Mirrors: []Mirror{{
+				Host:    "http://p2p.local:65001",
+				PingURL: "http://p2p.local:65001/healthz",
+				Scope:   daemonconfig.MirrorScopeBlobs,
+				Headers: map[string]string{"X-Pool": `gpu "a"`},
+			}},
+		}, {
+			Host:    "ghcr.io",
+			Mirrors: []Mirror{{Host: "http://p2p.local:65001"}},
+		}},
+	})
+	configs := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{*all, *gpu}}
+	nodes := &corev1.NodeList{Items: []corev1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"pool": "gpu"}},
+	}}}
+	configsWatch, nodeWatch := watch.NewFake(), watch.NewFake()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newController(dir, "node1",
+		newInformer(&unstructured.Unstructured{}, configs, configsWatch),
+		newInformer(&corev1.Node{}, nodes, nodeWatch))
+	require.NoError(t, c.Start(ctx))
+
+	// The mirrors are rendered once the informers synced.
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "docker.io", hostsFile))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	mirrors, _, err := daemonconfig.LoadMirrorsConfig(dir, "docker.io")
+	require.NoError(t, err)
+	require.Len(t, mirrors, 2)
+	require.Equal(t, "http://p2p.local:65001", mirrors[0].Host)
+	require.Equal(t, "http://p2p.local:65001/healthz", mirrors[0].PingURL)
+	require.Equal(t, daemonconfig.MirrorScopeBlobs, mirrors[0].Scope)
+	require.Equal(t, `gpu "a"`, mirrors[0].Headers["X-Pool"])
+	require.Equal(t, "http://fallback:5000", mirrors[1].Host)
+	require.Equal(t, 1, mirrors[1].Weight)
+
+	b, err := os.ReadFile(filepath.Join(dir, "ghcr.io", hostsFile))
+	require.NoError(t, err)
+	require.Equal(t, `[host."http://manual:5000"]`, string(b))
+
+	// The mirrors of resources no longer selecting the node are removed.
+	nodeWatch.Modify(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"pool": "cpu"}},
+	})
+	require.Eventually(t, func() bool {
+		mirrors, _, err := daemonconfig.LoadMirrorsConfig(dir, "docker.io")
+		return err == nil && len(mirrors) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	configsWatch.Delete(all)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "docker.io"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = os.Stat(filepath.Join(dir, "ghcr.io", hostsFile))
+	require.NoError(t, err)
+}
+
+func TestRender(t *testing.T) {
+	files := render([]*NydusMirrorConfig{{
+		ObjectMeta: metav1.ObjectMeta{Name: "invalid"},
+		Spec: NydusMirrorConfigSpec{Registries: []RegistryMirrors{
+			{Host: "../etc", Mirrors: []Mirror{{Host: "http://mirror:5000"}}},
+			{Host: "docker.io", Mirrors: []Mirror{{Host: "http://mirror:5000", FailureLimit: 300}}},
+		}},
+	}}, nil)
+	require.Empty(t, files)
+
+	files = render([]*NydusMirrorConfig{{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls"},
+		Spec: NydusMirrorConfigSpec{Registries: []RegistryMirrors{{Host: "registry.local:5000", Mirrors: []Mirror{{
+			Host:       "https://mirror:5000",
+			SkipVerify: true,
+			CAFile:     "/etc/pki/mirror.pem",
+			Timeout:    10,
+		}}}}},
+	}}, nil)
+	require.Equal(t, generatedHeader+`
+[host."https://mirror:5000"]
+  timeout = 10
+  skip_verify = true
+  ca_file = "/etc/pki/mirror.pem"
+`, string(files["registry.local:5000"]))
+}
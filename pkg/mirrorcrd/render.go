@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mirrorcrd
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/continuity"
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// generatedHeader marks the hosts.toml files owned by the controller. Files without it were
+// written by hand and are never touched.
+const generatedHeader = "# Generated by nydus-snapshotter from NydusMirrorConfig resources, do not edit.\n"
+
+const hostsFile = "hosts.toml"
+
+// render returns the hosts.toml files of the resources selecting the node, keyed by the host
+// directory of their registry. Mirrors of a registry listed by several resources follow each
+// other in the order of the resource names. Invalid parts of a resource are skipped.
+func render(configs []*NydusMirrorConfig, node labels.Set) map[string][]byte {
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+
+	mirrors := map[string][]Mirror{}
+	for _, c := range configs {
+		if c.Spec.NodeSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(c.Spec.NodeSelector)
+			if err != nil {
+				log.L.WithError(err).Warnf("Skipping NydusMirrorConfig %s with invalid node selector", c.Name)
+				continue
+			}
+			if !selector.Matches(node) {
+				continue
+			}
+		}
+		for _, r := range c.Spec.Registries {
+			if r.Host == "" || r.Host == "." || r.Host == ".." || strings.ContainsAny(r.Host, `/\`) {
+				log.L.Warnf("Skipping registry %q of NydusMirrorConfig %s", r.Host, c.Name)
+				continue
+			}
+			for _, m := range r.Mirrors {
+				if m.FailureLimit < 0 || m.FailureLimit > 255 {
+					log.L.Warnf("Skipping mirror %s of NydusMirrorConfig %s with invalid failure limit %d",
+						m.Host, c.Name, m.FailureLimit)
+					continue
+				}
+				mirrors[r.Host] = append(mirrors[r.Host], m)
+			}
+		}
+	}
+
+	files := make(map[string][]byte, len(mirrors))
+	for host, m := range mirrors {
+		files[host] = renderHostsFile(m)
+	}
+	return files
+}
+
+// renderHostsFile writes the mirrors as hosts of a hosts.toml file, which are tried in the
+// order of the file.
+func renderHostsFile(mirrors []Mirror) []byte {
+	var b bytes.Buffer
+	b.WriteString(generatedHeader)
+	for _, m := range mirrors {
+		table := "host." + quote(m.Host)
+		fmt.Fprintf(&b, "\n[%s]\n", table)
+		writeString := func(key, value string) {
+			if value != "" {
+				fmt.Fprintf(&b, "  %s = %s\n", key, quote(value))
+			}
+		}
+		writeInt := func(key string, value int) {
+			if value != 0 {
+				fmt.Fprintf(&b, "  %s = %d\n", key, value)
+			}
+		}
+		writeString("ping_url", m.PingURL)
+		writeInt("weight", m.Weight)
+		writeString("scope", m.Scope)
+		writeInt("failure_limit", m.FailureLimit)
+		writeInt("health_check_interval", m.HealthCheckInterval)
+		writeInt("connect_timeout", m.ConnectTimeout)
+		writeInt("timeout", m.Timeout)
+		if m.SkipVerify {
+			b.WriteString("  skip_verify = true\n")
+		}
+		writeString("ca_file", m.CAFile)
+		writeString("cert_file", m.CertFile)
+		writeString("key_file", m.KeyFile)
+		if len(m.Headers) > 0 {
+			names := make([]string, 0, len(m.Headers))
+			for name := range m.Headers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fmt.Fprintf(&b, "  [%s.header]\n", table)
+			for _, name := range names {
+				fmt.Fprintf(&b, "    %s = %s\n", quote(name), quote(m.Headers[name]))
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// quote returns s as TOML basic string.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\u%04x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// write replaces the generated hosts.toml files in dir with files, keyed by host directory,
+// and removes the generated ones no longer wanted.
+func write(dir string, files map[string][]byte) error {
+	var errs []error
+	for host, b := range files {
+		p := filepath.Join(dir, host, hostsFile)
+		old, err := os.ReadFile(p)
+		switch {
+		case err == nil && !bytes.HasPrefix(old, []byte(generatedHeader)):
+			log.L.Warnf("Not overwriting mirrors config %s, which was not generated", p)
+			continue
+		case err == nil && bytes.Equal(old, b):
+			continue
+		case err != nil && !os.IsNotExist(err):
+			errs = append(errs, errors.Wrapf(err, "read %s", p))
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			errs = append(errs, errors.Wrapf(err, "create %s", filepath.Dir(p)))
+			continue
+		}
+		if err := continuity.AtomicWriteFile(p, b, 0644); err != nil {
+			errs = append(errs, errors.Wrapf(err, "write %s", p))
+			continue
+		}
+		log.L.Infof("Mirrors config %s is updated", p)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return stderrors.Join(append(errs, errors.Wrapf(err, "read %s", dir))...)
+	}
+	for _, e := range entries {
+		if _, ok := files[e.Name()]; ok || !e.IsDir() {
+			continue
+		}
+		p := filepath.Join(dir, e.Name(), hostsFile)
+		old, err := os.ReadFile(p)
+		if err != nil || !bytes.HasPrefix(old, []byte(generatedHeader)) {
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			errs = append(errs, errors.Wrapf(err, "remove %s", p))
+			continue
+		}
+		// Kept if anything else is in there, e.g. certificates.
+		_ = os.Remove(filepath.Dir(p))
+		log.L.Infof("Mirrors config %s is removed", p)
+	}
+	return stderrors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mirrorcrd
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupVersionResource of the cluster scoped NydusMirrorConfig resource, defined by
+// misc/snapshotter/nydus-mirror-config-crd.yaml.
+var GroupVersionResource = schema.GroupVersionResource{
+	Group:    "nydus.containerd.io",
+	Version:  "v1alpha1",
+	Resource: "nydusmirrorconfigs",
+}
+
+// NydusMirrorConfig declares the mirrors of registries on the nodes it selects.
+type NydusMirrorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NydusMirrorConfigSpec `json:"spec"`
+}
+
+type NydusMirrorConfigSpec struct {
+	// Labels of the nodes the mirrors are used on, all nodes if nil.
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	Registries   []RegistryMirrors     `json:"registries"`
+}
+
+type RegistryMirrors struct {
+	// Directory of the registry in the mirrors directory, e.g. "docker.io",
+	// "registry.local:5000" or "_default".
+	Host    string   `json:"host"`
+	Mirrors []Mirror `json:"mirrors"`
+}
+
+// Mirror has the same settings as a host of hosts.toml. Files are paths on the nodes.
+type Mirror struct {
+	Host                string            `json:"host"`
+	Headers             map[string]string `json:"headers,omitempty"`
+	PingURL             string            `json:"pingURL,omitempty"`
+	Weight              int               `json:"weight,omitempty"`
+	Scope               string            `json:"scope,omitempty"`
+	FailureLimit        int               `json:"failureLimit,omitempty"`
+	HealthCheckInterval int               `json:"healthCheckInterval,omitempty"`
+	ConnectTimeout      int               `json:"connectTimeout,omitempty"`
+	Timeout             int               `json:"timeout,omitempty"`
+	SkipVerify          bool              `json:"skipVerify,omitempty"`
+	CAFile              string            `json:"caFile,omitempty"`
+	CertFile            string            `json:"certFile,omitempty"`
+	KeyFile             string            `json:"keyFile,omitempty"`
+}
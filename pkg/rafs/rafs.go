@@ -121,6 +121,8 @@ type Rafs struct {
 	// 2. Absolute path to each rafs instance root directory.
 	Mountpoint  string
 	Annotations map[string]string
+	// Mirror the instance fetches from as set in its configuration, empty if the registry.
+	Mirror string
 }
 
 func NewRafs(snapshotID, imageID, fsDriver string) (*Rafs, error) {
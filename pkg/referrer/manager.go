@@ -10,6 +10,7 @@ import (
 	"context"
 
 	"github.com/containerd/log"
+	"github.com/containerd/nydus-snapshotter/config"
 	"github.com/containerd/nydus-snapshotter/pkg/auth"
 	"github.com/golang/groupcache/lru"
 	"github.com/opencontainers/go-digest"
@@ -37,6 +38,9 @@ func NewManager(insecure bool) *Manager {
 // CheckReferrer attempts to fetch the referrers and parse out
 // the nydus image by specified manifest digest.
 func (manager *Manager) CheckReferrer(ctx context.Context, ref string, manifestDigest digest.Digest) (*ocispec.Descriptor, error) {
+	if rewritten, ok := config.RewriteImageRef(ref); ok {
+		ref = rewritten
+	}
 	metaLayer, err, _ := manager.sg.Do(manifestDigest.String(), func() (interface{}, error) {
 		// Try to get nydus metadata layer descriptor from LRU cache.
 		if metaLayer, ok := manager.cache.Get(manifestDigest); ok {
@@ -78,6 +82,9 @@ func (manager *Manager) TryFetchMetadata(ctx context.Context, ref string, manife
 		return errors.Wrap(err, "check referrer")
 	}
 
+	if rewritten, ok := config.RewriteImageRef(ref); ok {
+		ref = rewritten
+	}
 	keyChain, err := auth.GetKeyChainByRef(ref, nil)
 	if err != nil {
 		return errors.Wrap(err, "get key chain")
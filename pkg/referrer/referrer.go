@@ -97,7 +97,10 @@ func (r *referrer) checkReferrer(ctx context.Context, ref string, manifestDigest
 
 	desc, err := handle()
 	if err != nil && r.remote.RetryWithPlainHTTP(ref, err) {
-		return handle()
+		desc, err = handle()
+	}
+	if err != nil && r.remote.RetryAnonymously(ref, err) {
+		desc, err = handle()
 	}
 
 	return desc, err
@@ -135,7 +138,10 @@ func (r *referrer) fetchMetadata(ctx context.Context, ref string, desc ocispec.D
 
 	err := handle()
 	if err != nil && r.remote.RetryWithPlainHTTP(ref, err) {
-		return handle()
+		err = handle()
+	}
+	if err != nil && r.remote.RetryAnonymously(ref, err) {
+		err = handle()
 	}
 
 	return err
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package remote
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/containerd/errdefs"
+	"github.com/pkg/errors"
+
+	remoteerrors "github.com/containerd/nydus-snapshotter/pkg/remote/remotes/errors"
+)
+
+// ErrorClass tells why a registry request failed.
+type ErrorClass string
+
+const (
+	ErrorClassUnknown ErrorClass = ""
+	// The registry requires credentials, or rejected the given ones.
+	ErrorClassUnauthorized ErrorClass = "unauthorized"
+	// The credentials are not allowed to access the repository.
+	ErrorClassForbidden ErrorClass = "forbidden"
+	ErrorClassNotFound  ErrorClass = "not_found"
+	// The registry could not be reached.
+	ErrorClassNetwork ErrorClass = "network"
+)
+
+// Describe returns a message explaining the class to users.
+func (c ErrorClass) Describe() string {
+	switch c {
+	case ErrorClassUnauthorized:
+		return "registry credentials are missing or invalid"
+	case ErrorClassForbidden:
+		return "registry credentials are not allowed to pull the image"
+	case ErrorClassNotFound:
+		return "image not found in registry"
+	case ErrorClassNetwork:
+		return "registry is unreachable"
+	default:
+		return "registry request failed"
+	}
+}
+
+// ClassifyError tells whether err of a registry request is an authentication or
+// authorization failure, or a network error, rather than a problem of the image.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassUnknown
+	}
+
+	var status remoteerrors.ErrUnexpectedStatus
+	if errors.As(err, &status) {
+		switch status.StatusCode {
+		case http.StatusUnauthorized:
+			return ErrorClassUnauthorized
+		case http.StatusForbidden:
+			return ErrorClassForbidden
+		case http.StatusNotFound:
+			return ErrorClassNotFound
+		}
+		return ErrorClassUnknown
+	}
+	if errdefs.IsNotFound(err) {
+		return ErrorClassNotFound
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded) ||
+		isErrConnectionRefused(err) {
+		return ErrorClassNetwork
+	}
+	return ErrorClassUnknown
+}
@@ -51,14 +51,28 @@ type Remote struct {
 	// HTTP fallback is only allowed when insecure is true,
 	// matching Docker's --insecure-registry semantics.
 	insecure bool
+	// Whether a credential is available, and whether requests are sent without it
+	// since the registry rejected it.
+	withCredential bool
+	anonymous      bool
 }
 
 func New(keyChain *auth.PassKeyChain, insecure bool) *Remote {
+	remote := &Remote{
+		withPlainHTTP:  false,
+		insecure:       insecure,
+		withCredential: keyChain != nil,
+	}
+
 	// nolint:unparam
 	credFunc := func(string) (string, string, error) {
-		if keyChain == nil {
+		if keyChain == nil || remote.anonymous {
 			return "", "", nil
 		}
+		// An empty username makes the authorizer use the secret as refresh token.
+		if keyChain.IdentityToken != "" {
+			return "", keyChain.IdentityToken, nil
+		}
 		return keyChain.Username, keyChain.Password, nil
 	}
 
@@ -72,7 +86,7 @@ func New(keyChain *auth.PassKeyChain, insecure bool) *Remote {
 		return client
 	}
 
-	resolverFunc := func(plainHTTP bool) remotes.Resolver {
+	remote.resolverFunc = func(plainHTTP bool) remotes.Resolver {
 		registryHosts := docker.ConfigureDefaultRegistries(
 			docker.WithAuthorizer(
 				docker.NewDockerAuthorizer(
@@ -91,11 +105,7 @@ func New(keyChain *auth.PassKeyChain, insecure bool) *Remote {
 		})
 	}
 
-	return &Remote{
-		resolverFunc:  resolverFunc,
-		withPlainHTTP: false,
-		insecure:      insecure,
-	}
+	return remote
 }
 
 func (remote *Remote) RetryWithPlainHTTP(ref string, err error) bool {
@@ -122,6 +132,22 @@ func (remote *Remote) RetryWithPlainHTTP(ref string, err error) bool {
 	return remote.withPlainHTTP
 }
 
+// RetryAnonymously tells whether the request failing with err should be retried without
+// credential, which is the case once the registry rejected the credential, so that public
+// repositories can still be pulled when the credential found for them is wrong or stale.
+func (remote *Remote) RetryAnonymously(ref string, err error) bool {
+	if !remote.withCredential || remote.anonymous {
+		return false
+	}
+	if class := ClassifyError(err); class != ErrorClassUnauthorized && class != ErrorClassForbidden {
+		return false
+	}
+
+	log.G(context.TODO()).WithError(err).Warnf("registry rejected credential for %s, retrying anonymously", ref)
+	remote.anonymous = true
+	return true
+}
+
 func (remote *Remote) Resolve(_ context.Context, _ string) remotes.Resolver {
 	return remote.resolverFunc(remote.withPlainHTTP)
 }
@@ -7,10 +7,19 @@
 package remote
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"testing"
 
+	"github.com/containerd/errdefs"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	remoteerrors "github.com/containerd/nydus-snapshotter/pkg/remote/remotes/errors"
 )
 
 func TestRetryWithPlainHTTP(t *testing.T) {
@@ -72,3 +81,33 @@ func TestRetryWithPlainHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryAnonymously(t *testing.T) {
+	const ref = "myregistry.example.com/repo/image:latest"
+	unauthorized := fmt.Errorf("fetch token: %w", remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusUnauthorized})
+
+	r := New(nil, false)
+	assert.False(t, r.RetryAnonymously(ref, unauthorized))
+
+	r = New(&auth.PassKeyChain{Username: "user", Password: "wrong"}, false)
+	assert.False(t, r.RetryAnonymously(ref, fmt.Errorf("some unrelated error")))
+	assert.True(t, r.RetryAnonymously(ref, unauthorized))
+	// Requests are retried anonymously once.
+	assert.False(t, r.RetryAnonymously(ref, unauthorized))
+}
+
+func TestClassifyError(t *testing.T) {
+	statusErr := func(code int) error {
+		return errors.Wrap(remoteerrors.ErrUnexpectedStatus{StatusCode: code}, "resolve")
+	}
+
+	assert.Equal(t, ErrorClassUnknown, ClassifyError(nil))
+	assert.Equal(t, ErrorClassUnauthorized, ClassifyError(statusErr(http.StatusUnauthorized)))
+	assert.Equal(t, ErrorClassForbidden, ClassifyError(statusErr(http.StatusForbidden)))
+	assert.Equal(t, ErrorClassNotFound, ClassifyError(statusErr(http.StatusNotFound)))
+	assert.Equal(t, ErrorClassUnknown, ClassifyError(statusErr(http.StatusInternalServerError)))
+	assert.Equal(t, ErrorClassNotFound, ClassifyError(fmt.Errorf("manifest: %w", errdefs.ErrNotFound)))
+	assert.Equal(t, ErrorClassNetwork, ClassifyError(&url.Error{Op: "Get", URL: "https://myregistry.example.com/v2/", Err: &net.DNSError{IsNotFound: true}}))
+	assert.Equal(t, ErrorClassNetwork, ClassifyError(context.DeadlineExceeded))
+	assert.Equal(t, ErrorClassUnknown, ClassifyError(fmt.Errorf("invalid nydus manifest")))
+}
@@ -0,0 +1,400 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package spiffe obtains the X.509 SVID of the snapshotter from the SPIFFE Workload API of
+// a SPIRE agent, for nydusd to authenticate to blob services by mTLS.
+package spiffe
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/v2/pkg/dialer"
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// FetchX509SVIDMethod is the server streaming method of the Workload API sending the
+	// X.509 SVIDs of the workload, and again whenever they are rotated.
+	FetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+	// Metadata the Workload API requires on every request.
+	workloadAPIHeader = "workload.spiffe.io"
+
+	retryInterval    = 5 * time.Second
+	firstSVIDTimeout = 10 * time.Second
+
+	certFileName   = "svid.pem"
+	keyFileName    = "svid_key.pem"
+	bundleFileName = "bundle.pem"
+	// Symlink to the directory of the files of the current SVID.
+	currentDirName = "current"
+)
+
+var (
+	source   *X509Source
+	sourceMu sync.Mutex
+)
+
+// X509SVID names the PEM files of an X.509 SVID, its certificate chain and private key,
+// and of the trust bundle of its trust domain.
+type X509SVID struct {
+	ID         string
+	CertFile   string
+	KeyFile    string
+	BundleFile string
+	NotAfter   time.Time
+}
+
+// X509Source keeps the X.509 SVID streamed by the Workload API in PEM files, replaced
+// whenever the SPIRE agent rotates the SVID.
+type X509Source struct {
+	address string
+	// SPIFFE ID of the SVID to use, the first one sent if empty
+	id  string
+	dir string
+
+	conn *grpc.ClientConn
+
+	mu   sync.Mutex
+	svid *X509SVID
+	// When the SVID was last replaced by a rotated one, zero before
+	rotated time.Time
+	ready   chan struct{}
+}
+
+// InitX509Source initializes the global X.509 SVID source with the Workload API at address.
+// The SVID is received in the background and kept up to date until ctx is done.
+// This should be called once at startup if SPIFFE authentication is enabled.
+func InitX509Source(ctx context.Context, address, id, dir string) error {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+
+	if source != nil {
+		return nil
+	}
+
+	s, err := NewX509Source(address, id, dir)
+	if err != nil {
+		return err
+	}
+	go s.Run(ctx)
+	go func() {
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+		case <-time.After(firstSVIDTimeout):
+			log.L.WithField("address", address).Warn("no X.509 SVID from the SPIFFE Workload API yet")
+		}
+	}()
+	source = s
+	log.L.WithField("address", address).Info("SPIFFE X.509 SVID source initialized")
+	return nil
+}
+
+// GetX509SVID returns the current X.509 SVID of the global source, false if there is none yet.
+func GetX509SVID() (X509SVID, bool) {
+	sourceMu.Lock()
+	s := source
+	sourceMu.Unlock()
+
+	if s == nil {
+		return X509SVID{}, false
+	}
+	return s.SVID()
+}
+
+// NextRotation returns when the SVID was last rotated, for daemons to get the new one,
+// false if it never was.
+func NextRotation() (time.Time, bool) {
+	sourceMu.Lock()
+	s := source
+	sourceMu.Unlock()
+
+	if s == nil {
+		return time.Time{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotated, !s.rotated.IsZero()
+}
+
+// NewX509Source creates a source talking to the Workload API listening on address, e.g.
+// "/run/spire/sockets/agent.sock", writing the SVID with the SPIFFE ID id, or the first
+// one if empty, to dir.
+func NewX509Source(address, id, dir string) (*X509Source, error) {
+	if address == "" {
+		return nil, errors.New("workload API address cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "create SVID directory")
+	}
+
+	conn, err := grpc.NewClient(dialer.DialAddress(address),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(dialer.ContextDialer),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create client for %s", address)
+	}
+	return &X509Source{address: address, id: id, dir: dir, conn: conn, ready: make(chan struct{})}, nil
+}
+
+// SVID returns the current X.509 SVID, false if none has been received yet.
+func (s *X509Source) SVID() (X509SVID, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.svid == nil {
+		return X509SVID{}, false
+	}
+	return *s.svid, true
+}
+
+// Run watches the SVIDs sent by the Workload API until ctx is done, reconnecting when the
+// stream breaks, e.g. while the SPIRE agent restarts.
+func (s *X509Source) Run(ctx context.Context) {
+	defer s.conn.Close()
+	for {
+		err := s.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.L.WithError(err).WithField("address", s.address).Warn("failed to watch X.509 SVIDs")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (s *X509Source) watch(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx, workloadAPIHeader, "true"))
+	defer cancel()
+
+	stream, err := s.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, FetchX509SVIDMethod)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(dynamicpb.NewMessage(x509SVIDRequestDesc)); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		resp := dynamicpb.NewMessage(x509SVIDResponseDesc)
+		if err := stream.RecvMsg(resp); err != nil {
+			return err
+		}
+		if err := s.update(resp); err != nil {
+			log.L.WithError(err).Error("failed to update X.509 SVID")
+		}
+	}
+}
+
+// update writes the SVID of the X509SVIDResponse message resp.
+func (s *X509Source) update(resp protoreflect.Message) error {
+	svids := parseX509SVIDResponse(resp)
+	var selected *x509SVID
+	for i := range svids {
+		if s.id == "" || svids[i].id == s.id {
+			selected = &svids[i]
+			break
+		}
+	}
+	if selected == nil {
+		return errors.Errorf("workload API sent no SVID with SPIFFE ID %q", s.id)
+	}
+
+	certs, err := x509.ParseCertificates(selected.certs)
+	if err != nil {
+		return errors.Wrapf(err, "parse certificates of SVID %s", selected.id)
+	}
+	if len(certs) == 0 {
+		return errors.Errorf("SVID %s has no certificate", selected.id)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(selected.key); err != nil {
+		return errors.Wrapf(err, "parse private key of SVID %s", selected.id)
+	}
+	bundle, err := x509.ParseCertificates(selected.bundle)
+	if err != nil {
+		return errors.Wrapf(err, "parse trust bundle of SVID %s", selected.id)
+	}
+
+	current := filepath.Join(s.dir, currentDirName)
+	svid := &X509SVID{
+		ID:         selected.id,
+		CertFile:   filepath.Join(current, certFileName),
+		KeyFile:    filepath.Join(current, keyFileName),
+		BundleFile: filepath.Join(current, bundleFileName),
+		NotAfter:   certs[0].NotAfter,
+	}
+	if err := writeSVIDFiles(s.dir, []svidFile{
+		{certFileName, encodePEM("CERTIFICATE", certs), 0644},
+		{keyFileName, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: selected.key}), 0600},
+		{bundleFileName, encodePEM("CERTIFICATE", bundle), 0644},
+	}); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.svid == nil {
+		close(s.ready)
+	} else {
+		s.rotated = time.Now()
+	}
+	s.svid = svid
+	log.L.WithField("spiffe_id", svid.ID).WithField("not_after", svid.NotAfter).Info("received X.509 SVID")
+	return nil
+}
+
+func encodePEM(blockType string, certs []*x509.Certificate) []byte {
+	var b []byte
+	for _, c := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: c.Raw})...)
+	}
+	return b
+}
+
+type svidFile struct {
+	name string
+	data []byte
+	perm os.FileMode
+}
+
+// writeSVIDFiles writes files into a new directory of dir and atomically points the current
+// symlink at it, so that nydusd never reads the certificate of one SVID with the key of
+// another. The directory of the previous SVID is removed.
+func writeSVIDFiles(dir string, files []svidFile) error {
+	tmp, err := os.MkdirTemp(dir, ".svid-")
+	if err != nil {
+		return errors.Wrap(err, "create SVID directory")
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(tmp, f.name), f.data, f.perm); err != nil {
+			os.RemoveAll(tmp)
+			return errors.Wrapf(err, "write %s", f.name)
+		}
+	}
+
+	current := filepath.Join(dir, currentDirName)
+	previous, _ := os.Readlink(current)
+	link := current + ".tmp"
+	os.Remove(link)
+	if err := os.Symlink(filepath.Base(tmp), link); err != nil {
+		os.RemoveAll(tmp)
+		return errors.Wrap(err, "link SVID directory")
+	}
+	if err := os.Rename(link, current); err != nil {
+		os.Remove(link)
+		os.RemoveAll(tmp)
+		return errors.Wrap(err, "replace SVID directory")
+	}
+	if previous != "" {
+		os.RemoveAll(filepath.Join(dir, previous))
+	}
+	return nil
+}
+
+// An X509SVID message of the Workload API.
+type x509SVID struct {
+	id string
+	// DER encoded certificate chain, leaf first
+	certs []byte
+	// DER encoded PKCS#8 private key
+	key []byte
+	// DER encoded CA certificates of the trust domain
+	bundle []byte
+}
+
+// The Workload API messages used, described as in workload.proto of the SPIFFE specification:
+//
+//	message X509SVIDRequest {}
+//
+//	message X509SVIDResponse {
+//	  repeated X509SVID svids = 1;
+//	  ...
+//	}
+//
+//	message X509SVID {
+//	  string spiffe_id = 1;
+//	  bytes x509_svid = 2;
+//	  bytes x509_svid_key = 3;
+//	  bytes bundle = 4;
+//	  ...
+//	}
+var (
+	x509SVIDRequestDesc  protoreflect.MessageDescriptor
+	x509SVIDResponseDesc protoreflect.MessageDescriptor
+)
+
+func init() {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(num),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   typ.Enum(),
+		}
+	}
+	svids := field("svids", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	svids.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	svids.TypeName = proto.String(".X509SVID")
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:   proto.String("workload.proto"),
+		Syntax: proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("X509SVIDRequest")},
+			{Name: proto.String("X509SVIDResponse"), Field: []*descriptorpb.FieldDescriptorProto{svids}},
+			{Name: proto.String("X509SVID"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("spiffe_id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("x509_svid", 2, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+				field("x509_svid_key", 3, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+				field("bundle", 4, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+			}},
+		},
+	}, nil)
+	if err != nil {
+		panic(errors.Wrap(err, "describe workload API messages"))
+	}
+	x509SVIDRequestDesc = fd.Messages().ByName("X509SVIDRequest")
+	x509SVIDResponseDesc = fd.Messages().ByName("X509SVIDResponse")
+}
+
+// parseX509SVIDResponse returns the SVIDs of the X509SVIDResponse message resp.
+func parseX509SVIDResponse(resp protoreflect.Message) []x509SVID {
+	list := resp.Get(resp.Descriptor().Fields().ByNumber(1)).List()
+	svids := make([]x509SVID, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		m := list.Get(i).Message()
+		fields := m.Descriptor().Fields()
+		svids = append(svids, x509SVID{
+			id:     m.Get(fields.ByNumber(1)).String(),
+			certs:  m.Get(fields.ByNumber(2)).Bytes(),
+			key:    m.Get(fields.ByNumber(3)).Bytes(),
+			bundle: m.Get(fields.ByNumber(4)).Bytes(),
+		})
+	}
+	return svids
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package spiffe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newSVID returns an X509SVID message with a self-signed certificate for id.
+func newSVID(t *testing.T, id string) protoreflect.Message {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	u, err := url.Parse(id)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "nydus"},
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	svids := x509SVIDResponseDesc.Fields().ByNumber(1)
+	svid := dynamicpb.NewMessage(svids.Message())
+	fields := svid.Descriptor().Fields()
+	svid.Set(fields.ByNumber(1), protoreflect.ValueOfString(id))
+	svid.Set(fields.ByNumber(2), protoreflect.ValueOfBytes(cert))
+	svid.Set(fields.ByNumber(3), protoreflect.ValueOfBytes(keyDER))
+	svid.Set(fields.ByNumber(4), protoreflect.ValueOfBytes(cert))
+	return svid
+}
+
+func svidResponse(svids ...protoreflect.Message) protoreflect.Message {
+	resp := dynamicpb.NewMessage(x509SVIDResponseDesc)
+	list := resp.Mutable(x509SVIDResponseDesc.Fields().ByNumber(1)).List()
+	for _, svid := range svids {
+		list.Append(protoreflect.ValueOfMessage(svid))
+	}
+	return resp
+}
+
+// startWorkloadAPI serves the responses sent to the channel to FetchX509SVID streams.
+func startWorkloadAPI(t *testing.T, responses <-chan protoreflect.Message) string {
+	address := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", address)
+	require.NoError(t, err)
+
+	server := grpc.NewServer(
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			if method, _ := grpc.Method(stream.Context()); method != FetchX509SVIDMethod {
+				return status.Error(codes.Unimplemented, method)
+			}
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			if len(md.Get(workloadAPIHeader)) == 0 {
+				return status.Error(codes.InvalidArgument, "security header missing from request")
+			}
+			if err := stream.RecvMsg(dynamicpb.NewMessage(x509SVIDRequestDesc)); err != nil {
+				return err
+			}
+			for {
+				select {
+				case <-stream.Context().Done():
+					return nil
+				case resp := <-responses:
+					if err := stream.SendMsg(resp.Interface()); err != nil {
+						return err
+					}
+				}
+			}
+		}))
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+	return address
+}
+
+func TestX509Source(t *testing.T) {
+	responses := make(chan protoreflect.Message, 1)
+	address := startWorkloadAPI(t, responses)
+
+	dir := t.TempDir()
+	s, err := NewX509Source(address, "spiffe://example.org/nydus", dir)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	responses <- svidResponse(newSVID(t, "spiffe://example.org/other"), newSVID(t, "spiffe://example.org/nydus"))
+	select {
+	case <-s.ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no SVID received")
+	}
+
+	svid, ok := s.SVID()
+	require.True(t, ok)
+	require.Equal(t, "spiffe://example.org/nydus", svid.ID)
+	require.Equal(t, filepath.Join(dir, "current", "svid.pem"), svid.CertFile)
+	_, err = tls.LoadX509KeyPair(svid.CertFile, svid.KeyFile)
+	require.NoError(t, err)
+	fi, err := os.Stat(svid.KeyFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	bundle, err := os.ReadFile(svid.BundleFile)
+	require.NoError(t, err)
+	require.Contains(t, string(bundle), "BEGIN CERTIFICATE")
+
+	s.mu.Lock()
+	require.True(t, s.rotated.IsZero())
+	s.mu.Unlock()
+
+	// The SVID is replaced when rotated.
+	old, err := os.ReadFile(svid.CertFile)
+	require.NoError(t, err)
+	responses <- svidResponse(newSVID(t, "spiffe://example.org/nydus"))
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return !s.rotated.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+	rotated, err := os.ReadFile(svid.CertFile)
+	require.NoError(t, err)
+	require.NotEqual(t, old, rotated)
+	_, err = tls.LoadX509KeyPair(svid.CertFile, svid.KeyFile)
+	require.NoError(t, err)
+	// Only the directory of the current SVID is kept.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// Responses without the SVID are ignored.
+	require.Error(t, s.update(svidResponse(newSVID(t, "spiffe://example.org/other"))))
+	current, err := os.ReadFile(svid.CertFile)
+	require.NoError(t, err)
+	require.Equal(t, rotated, current)
+}
+
+func TestParseX509SVIDResponse(t *testing.T) {
+	b, err := proto.Marshal(svidResponse(newSVID(t, "spiffe://example.org/nydus")).Interface())
+	require.NoError(t, err)
+	// Fields not described are skipped.
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, "internal")
+	resp := dynamicpb.NewMessage(x509SVIDResponseDesc)
+	require.NoError(t, proto.Unmarshal(b, resp))
+	svids := parseX509SVIDResponse(resp)
+	require.Len(t, svids, 1)
+	require.Equal(t, "spiffe://example.org/nydus", svids[0].id)
+
+	require.Error(t, proto.Unmarshal([]byte{0x0a, 0x10}, dynamicpb.NewMessage(x509SVIDResponseDesc)))
+}
@@ -24,6 +24,9 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
@@ -43,8 +46,24 @@ const (
 	endpointDaemonRecords  string = "/api/v1/daemons/records"
 	endpointDaemonsUpgrade string = "/api/v1/daemons/upgrade"
 	endpointPrefetch       string = "/api/v1/prefetch"
+	// Reload the nydusd configuration template and push it to running daemons
+	endpointDaemonsConfigReload string = "/api/v1/daemons/config/reload"
 	// Provide backend information
 	endpointGetBackend string = "/api/v1/daemons/{id}/backend"
+	// Drop cached registry credentials, of the registry given by the "host" query parameter
+	// or of all registries, e.g. after secrets are rotated
+	endpointKeyChains string = "/api/v1/auth/keychains"
+	// List the credential sources images were pulled with, of the image given by the "ref"
+	// query parameter or of all images
+	endpointCredentialAudit string = "/api/v1/auth/audit"
+	// List the health of mirrors
+	endpointMirrors string = "/api/v1/mirrors"
+	// Stop or resume using the mirror given by the "host" query parameter node-wide
+	endpointMirrorDisable string = "/api/v1/mirrors/disable"
+	endpointMirrorEnable  string = "/api/v1/mirrors/enable"
+	// Check the hosts.toml files of the mirrors directory, and with "probe=true" whether
+	// their mirrors are reachable
+	endpointMirrorsValidate string = "/api/v1/mirrors/validate"
 )
 
 const defaultErrorCode string = "Unknown"
@@ -65,6 +84,8 @@ type Controller struct {
 	uid    int
 	gid    int
 	router *mux.Router
+	// Reloads the daemon configuration template, nil if there is none
+	configReloader func() error
 }
 
 type upgradeRequest struct {
@@ -117,6 +138,8 @@ type daemonInfo struct {
 	StartupCPUUtilization float64 `json:"startup_cpu_utilization"`
 	MemoryRSS             float64 `json:"memory_rss_kb"`
 	ReadData              float32 `json:"read_data_kb"`
+	// Whether any instance only serves cached data since its backends are unreachable
+	Degraded bool `json:"degraded"`
 
 	Instances map[string]rafsInstanceInfo `json:"instances"`
 }
@@ -126,6 +149,9 @@ type rafsInstanceInfo struct {
 	SnapshotDir string `json:"snapshot_dir"`
 	Mountpoint  string `json:"mountpoint"`
 	ImageID     string `json:"image_id"`
+	Degraded    bool   `json:"degraded"`
+	// Mirror the instance fetches from, empty if the registry itself
+	Mirror string `json:"mirror,omitempty"`
 }
 
 func NewSystemController(fs *filesystem.Filesystem, managers []*manager.Manager, sock string, uid, gid int) (*Controller, error) {
@@ -158,6 +184,11 @@ func NewSystemController(fs *filesystem.Filesystem, managers []*manager.Manager,
 	return &sc, nil
 }
 
+// SetConfigReloader sets the function the config reload endpoint triggers.
+func (sc *Controller) SetConfigReloader(reload func() error) {
+	sc.configReloader = reload
+}
+
 func (sc *Controller) Run() error {
 	log.L.Infof("Start system controller API server on %s", sc.addr)
 	stopChan := signals.SetupSignalHandler()
@@ -191,6 +222,108 @@ func (sc *Controller) registerRouter() {
 	sc.router.HandleFunc(endpointDaemonRecords, sc.getDaemonRecords()).Methods(http.MethodGet)
 	sc.router.HandleFunc(endpointPrefetch, sc.setPrefetchConfiguration()).Methods(http.MethodPut)
 	sc.router.HandleFunc(endpointGetBackend, sc.getBackend()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointDaemonsConfigReload, sc.reloadDaemonConfig()).Methods(http.MethodPut)
+	sc.router.HandleFunc(endpointKeyChains, sc.invalidateKeyChains()).Methods(http.MethodDelete)
+	sc.router.HandleFunc(endpointCredentialAudit, sc.describeCredentialAudit()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointMirrors, sc.describeMirrors()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointMirrorDisable, sc.setMirrorDisabled(true)).Methods(http.MethodPut)
+	sc.router.HandleFunc(endpointMirrorEnable, sc.setMirrorDisabled(false)).Methods(http.MethodPut)
+	sc.router.HandleFunc(endpointMirrorsValidate, sc.validateMirrors()).Methods(http.MethodGet)
+}
+
+func (sc *Controller) invalidateKeyChains() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := auth.InvalidateKeyChains(r.URL.Query().Get("host"))
+		jsonResponse(w, struct {
+			Invalidated int `json:"invalidated"`
+		}{n})
+	}
+}
+
+func (sc *Controller) describeCredentialAudit() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, auth.CredentialAudit(r.URL.Query().Get("ref")))
+	}
+}
+
+func (sc *Controller) describeMirrors() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		jsonResponse(w, daemonconfig.MirrorHealthStates())
+	}
+}
+
+func (sc *Controller) validateMirrors() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var probe bool
+		if v := r.URL.Query().Get("probe"); v != "" {
+			var err error
+			if probe, err = strconv.ParseBool(v); err != nil {
+				m := newErrorMessage(fmt.Sprintf("invalid query parameter probe %q", v))
+				http.Error(w, m.encode(), http.StatusBadRequest)
+				return
+			}
+		}
+		mirrorsConfig := config.GetMirrorsConfig()
+		if mirrorsConfig.Dir == "" {
+			jsonResponse(w, []daemonconfig.MirrorConfigProblem{})
+			return
+		}
+		problems, err := daemonconfig.ValidateMirrorsConfig(mirrorsConfig.Dir, probe, mirrorsConfig.ProbeTimeout)
+		if err != nil {
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, problems)
+	}
+}
+
+// setMirrorDisabled disables or enables a mirror for new mounts, mounted instances keep
+// their mirror until their configuration is reloaded.
+func (sc *Controller) setMirrorDisabled(disabled bool) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.URL.Query().Get("host")
+		if host == "" {
+			m := newErrorMessage("query parameter host is required")
+			http.Error(w, m.encode(), http.StatusBadRequest)
+			return
+		}
+		var err error
+		if disabled {
+			err = daemonconfig.DisableMirror(host)
+		} else {
+			err = daemonconfig.EnableMirror(host)
+		}
+		if err != nil {
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), http.StatusNotFound)
+		}
+	}
+}
+
+func (sc *Controller) reloadDaemonConfig() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		var err error
+		var statusCode int
+
+		defer func() {
+			if err != nil {
+				m := newErrorMessage(err.Error())
+				http.Error(w, m.encode(), statusCode)
+			}
+		}()
+
+		if sc.configReloader == nil {
+			err = errors.New("no daemon configuration to reload")
+			statusCode = http.StatusNotImplemented
+			return
+		}
+
+		if err = sc.configReloader(); err != nil {
+			log.L.Errorf("Failed to reload daemon configuration, %s", err)
+			statusCode = http.StatusInternalServerError
+		}
+	}
 }
 
 func (sc *Controller) getBackend() func(w http.ResponseWriter, r *http.Request) {
@@ -218,8 +351,8 @@ func (sc *Controller) getBackend() func(w http.ResponseWriter, r *http.Request)
 					BackendType string      `json:"type"`
 					Config      interface{} `json:"config"`
 				}{
-					backendType,
-					backendConfig,
+					backendType.String(),
+					daemonconfig.Redact(backendConfig),
 				}
 				jsonResponse(w, backend)
 				ma.Unlock()
@@ -255,14 +388,21 @@ func (sc *Controller) describeDaemons() func(w http.ResponseWriter, r *http.Requ
 			daemons := manager.ListDaemons()
 
 			for _, d := range daemons {
+				var degraded bool
 				instances := make(map[string]rafsInstanceInfo)
 				for _, i := range d.RafsCache.List() {
-					instances[i.SnapshotID] = rafsInstanceInfo{
+					instance := rafsInstanceInfo{
 						SnapshotID:  i.SnapshotID,
 						SnapshotDir: i.SnapshotDir,
 						Mountpoint:  i.GetMountpoint(),
 						ImageID:     i.ImageID,
 					}
+					if d.State() == types.DaemonStateRunning {
+						instance.Degraded = backendDegraded(d, i.SnapshotID)
+						degraded = degraded || instance.Degraded
+					}
+					instance.Mirror = i.Mirror
+					instances[i.SnapshotID] = instance
 				}
 
 				memRSS, err := metrics.GetProcessMemoryRSSKiloBytes(d.Pid())
@@ -289,6 +429,7 @@ func (sc *Controller) describeDaemons() func(w http.ResponseWriter, r *http.Requ
 					StartupCPUUtilization: d.StartupCPUUtilization,
 					MemoryRSS:             memRSS,
 					ReadData:              readData,
+					Degraded:              degraded,
 				}
 
 				info = append(info, i)
@@ -299,6 +440,21 @@ func (sc *Controller) describeDaemons() func(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// backendDegraded tells whether the instance only serves cached data since its backends
+// are unreachable.
+func backendDegraded(d *daemon.Daemon, snapshotID string) bool {
+	var sid string
+	if d.IsSharedDaemon() {
+		sid = snapshotID
+	}
+	m, err := d.GetBackendMetrics(sid)
+	if err != nil {
+		log.L.Warnf("Failed to get backend metrics of daemon %s: %v", d.ID(), err)
+		return false
+	}
+	return m.Degraded
+}
+
 // TODO: Implement me!
 func (sc *Controller) getDaemonRecords() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, _ *http.Request) {
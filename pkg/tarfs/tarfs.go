@@ -330,6 +330,9 @@ func (t *Manager) blobProcess(ctx context.Context, wg *sync.WaitGroup, snapshotI
 		log.L.Info(msg)
 	}
 
+	if rewritten, ok := config.RewriteImageRef(ref); ok {
+		ref = rewritten
+	}
 	keyChain, err := auth.GetKeyChainByRef(ref, nil)
 	if err != nil {
 		epilog(err, "create key chain for connection")
@@ -340,6 +343,9 @@ func (t *Manager) blobProcess(ctx context.Context, wg *sync.WaitGroup, snapshotI
 	if err != nil && remote.RetryWithPlainHTTP(ref, err) {
 		rc, _, err = t.getBlobStream(ctx, remote, ref, layerDigest)
 	}
+	if err != nil && remote.RetryAnonymously(ref, err) {
+		rc, _, err = t.getBlobStream(ctx, remote, ref, layerDigest)
+	}
 	if err != nil {
 		epilog(err, "get blob stream for layer")
 		return errors.Wrapf(err, "get blob stream by digest")
@@ -764,6 +770,9 @@ func (t *Manager) CheckTarfsHintAnnotation(ctx context.Context, ref string, mani
 		return true, nil
 	}
 
+	if rewritten, ok := config.RewriteImageRef(ref); ok {
+		ref = rewritten
+	}
 	keyChain, err := auth.GetKeyChainByRef(ref, nil)
 	if err != nil {
 		return false, err
@@ -793,6 +802,9 @@ func (t *Manager) CheckTarfsHintAnnotation(ctx context.Context, ref string, mani
 	if err != nil && remote.RetryWithPlainHTTP(ref, err) {
 		tarfsHint, err = handle()
 	}
+	if err != nil && remote.RetryAnonymously(ref, err) {
+		tarfsHint, err = handle()
+	}
 	return tarfsHint, err
 }
 
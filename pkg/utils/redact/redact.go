@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package redact masks credentials before they are logged or returned by APIs.
+package redact
+
+import (
+	"strings"
+
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+// Mask replaces the values of secrets.
+const Mask = "******"
+
+// Labels of snapshots and images carrying credentials.
+var secretLabels = []string{label.NydusImagePullSecret}
+
+// IsSecretHeader tells whether the HTTP header name usually carries credentials,
+// e.g. "Authorization" or "X-Auth-Token".
+func IsSecretHeader(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie":
+		return true
+	}
+	for _, s := range []string{"token", "secret", "password", "signature", "api-key", "apikey"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers returns a copy of headers with the values of secret headers masked.
+func Headers(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	result := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if IsSecretHeader(name) && value != "" {
+			value = Mask
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// Labels returns a copy of labels with the values of labels carrying credentials masked.
+func Labels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	result := make(map[string]string, len(labels))
+	for k, v := range labels {
+		result[k] = v
+	}
+	for _, k := range secretLabels {
+		if v, ok := result[k]; ok && v != "" {
+			result[k] = Mask
+		}
+	}
+	return result
+}
+
+// Options returns a copy of "key=value" mount options with the values of the given keys
+// masked, e.g. of options embedding the daemon configuration.
+func Options(options []string, keys ...string) []string {
+	result := make([]string, len(options))
+	for i, opt := range options {
+		result[i] = opt
+		for _, k := range keys {
+			if strings.HasPrefix(opt, k+"=") {
+				result[i] = k + "=" + Mask
+				break
+			}
+		}
+	}
+	return result
+}
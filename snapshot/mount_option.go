@@ -24,6 +24,7 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/layout"
 	"github.com/containerd/nydus-snapshotter/pkg/rafs"
 	"github.com/containerd/nydus-snapshotter/pkg/snapshot"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/redact"
 	"github.com/pkg/errors"
 )
 
@@ -146,7 +147,9 @@ func (o *snapshotter) mountWithKataVolume(ctx context.Context, id string, overla
 	}
 
 	if hasVolume {
-		log.G(ctx).Debugf("fuse.nydus-overlayfs mount options %v", overlayOptions)
+		// Volumes of proxy mode carry the labels of the image.
+		log.G(ctx).Debugf("fuse.nydus-overlayfs mount options %v",
+			redact.Options(overlayOptions, KataVirtualVolumeOptionName, "extraoption"))
 
 		mountType := "fuse.nydus-overlayfs"
 		if o.nydusOverlayFSPath != "" {
@@ -58,6 +58,14 @@ func chooseProcessor(ctx context.Context, logger *logrus.Entry,
 		}
 	}
 
+	// Handler to download the blob of a nydus data layer for the localfs backend.
+	populateHandler := func() (bool, []mount.Mount, error) {
+		if err := sn.fs.PopulateLocalfsBlob(ctx, labels); err != nil {
+			return false, nil, errors.Wrapf(err, "populate localfs blob for snapshot %s", s.ID)
+		}
+		return true, nil, nil
+	}
+
 	proxyHandler := func() (bool, []mount.Mount, error) {
 		mounts, err := sn.mountProxy(ctx, s)
 		return false, mounts, err
@@ -82,7 +90,11 @@ func chooseProcessor(ctx context.Context, logger *logrus.Entry,
 			handler = defaultHandler
 		case label.IsNydusDataLayer(labels):
 			logger.Debugf("found nydus data layer")
-			handler = skipHandler
+			if sn.fs.LocalfsPopulateEnabled() {
+				handler = populateHandler
+			} else {
+				handler = skipHandler
+			}
 		case sn.fs.CheckIndexAlternative(ctx, labels):
 			logger.Debugf("found nydus alternative image in index")
 			commitLabels[label.NydusIndexAlternative] = "true"
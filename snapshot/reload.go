@@ -0,0 +1,283 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package snapshot
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	mgr "github.com/containerd/nydus-snapshotter/pkg/manager"
+	"github.com/containerd/nydus-snapshotter/pkg/spiffe"
+)
+
+// How often temporary backend credentials are checked for their expiry, unless one is due
+// for refresh earlier.
+var credentialRefreshCheckInterval = time.Minute
+
+// Editors and config management tools usually write a file in several steps,
+// so changes are only picked up once the file stays quiet for a while.
+var configReloadDelay = 500 * time.Millisecond
+
+func loadDaemonConfigTemplate(cfg *config.SnapshotterConfig) (daemonconfig.DaemonConfig, error) {
+	c, err := daemonconfig.NewDaemonConfig(config.GetFsDriver(), cfg.DaemonConfig.NydusdConfigPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "load daemon configuration")
+	}
+	if cfg.DaemonConfig.DefaultWorkDirFromRoot {
+		daemonconfig.DefaultWorkDir(c, cfg.Root)
+	}
+	return c, nil
+}
+
+// reloadDaemonConfig loads the daemon configuration template again and hands it
+// to all managers, which push it to their running daemons.
+func reloadDaemonConfig(cfg *config.SnapshotterConfig, managers []*mgr.Manager) error {
+	template, err := loadDaemonConfigTemplate(cfg)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range managers {
+		if err := m.ReloadDaemonConfig(template); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// refreshCredentials has all managers fill the current credentials into the configurations
+// of their running daemons, leaving the rest of the configurations alone.
+func refreshCredentials(managers []*mgr.Manager) error {
+	var errs []error
+	for _, m := range managers {
+		if err := m.RefreshCredentials(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// failBackMirrors has all managers select the recovered mirrors for the running daemons
+// preferring them.
+func failBackMirrors(managers []*mgr.Manager, recovered []string) error {
+	var errs []error
+	for _, m := range managers {
+		if err := m.FailBackMirrors(recovered); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// startConfigReloadWatcher reloads the daemon configuration whenever its template file changes.
+func startConfigReloadWatcher(ctx context.Context, cfg *config.SnapshotterConfig, managers []*mgr.Manager) error {
+	return watchFile(ctx, cfg.DaemonConfig.NydusdConfigPath, func() error {
+		return reloadDaemonConfig(cfg, managers)
+	})
+}
+
+// startAuthFileWatcher reloads the auth file whenever it changes, and pushes the new
+// credentials to the daemons.
+func startAuthFileWatcher(ctx context.Context, cfg *config.SnapshotterConfig, managers []*mgr.Manager) error {
+	return watchFile(ctx, cfg.RemoteConfig.AuthConfig.AuthFile, func() error {
+		if err := auth.ReloadAuthFile(); err != nil {
+			return err
+		}
+		return refreshCredentials(managers)
+	})
+}
+
+// startMirrorsWatcher selects the mirrors of the running daemons from the mirrors
+// configuration directory again whenever a file in the directory changes.
+func startMirrorsWatcher(ctx context.Context, cfg *config.SnapshotterConfig, managers []*mgr.Manager) error {
+	return watchDir(ctx, cfg.RemoteConfig.MirrorsConfig.Dir, func() error {
+		var errs []error
+		for _, m := range managers {
+			if err := m.ReselectMirrors(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return stderrors.Join(errs...)
+	})
+}
+
+// watchFile calls reload whenever the file at path changes. The parent directory is
+// watched since the file is commonly replaced rather than written in place.
+func watchFile(ctx context.Context, path string, reload func() error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "create config watcher")
+	}
+	configPath := filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(configPath)); err != nil {
+		watcher.Close()
+		return errors.Wrapf(err, "watch %s", configPath)
+	}
+
+	log.G(ctx).WithField("path", configPath).Info("watching configuration for changes")
+	go configReloadLoop(ctx, watcher, configPath, reload)
+	return nil
+}
+
+// watchDir calls reload whenever a file in the directory at path or in one of its
+// subdirectories, like the per-host directories of hosts.toml files, changes.
+func watchDir(ctx context.Context, path string, reload func() error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "create config watcher")
+	}
+	dir := filepath.Clean(path)
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return errors.Wrapf(err, "watch %s", dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		watcher.Close()
+		return errors.Wrapf(err, "read %s", dir)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			if err := watcher.Add(filepath.Join(dir, e.Name())); err != nil {
+				watcher.Close()
+				return errors.Wrapf(err, "watch %s", filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+
+	log.G(ctx).WithField("path", dir).Info("watching configuration for changes")
+	go dirReloadLoop(ctx, watcher, dir, reload)
+	return nil
+}
+
+func configReloadLoop(ctx context.Context, watcher *fsnotify.Watcher, configPath string, reload func() error) {
+	reloadLoop(ctx, watcher, configPath, func(ev fsnotify.Event) bool {
+		return filepath.Clean(ev.Name) == configPath && !ev.Has(fsnotify.Chmod)
+	}, reload)
+}
+
+func dirReloadLoop(ctx context.Context, watcher *fsnotify.Watcher, dir string, reload func() error) {
+	reloadLoop(ctx, watcher, dir, func(ev fsnotify.Event) bool {
+		if ev.Has(fsnotify.Create) && filepath.Dir(filepath.Clean(ev.Name)) == dir {
+			if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+				if err := watcher.Add(ev.Name); err != nil {
+					log.G(ctx).WithError(err).WithField("path", ev.Name).Warn("failed to watch directory")
+				}
+			}
+		}
+		return !ev.Has(fsnotify.Chmod)
+	}, reload)
+}
+
+// reloadLoop calls reload once the events accepted by changed stop for configReloadDelay.
+func reloadLoop(ctx context.Context, watcher *fsnotify.Watcher, configPath string, changed func(fsnotify.Event) bool, reload func() error) {
+	defer watcher.Close()
+
+	timer := time.NewTimer(configReloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if changed(ev) {
+				timer.Reset(configReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.G(ctx).WithError(err).WithField("path", configPath).Warn("configuration watcher error")
+		case <-timer.C:
+			if err := reload(); err != nil {
+				log.G(ctx).WithError(err).WithField("path", configPath).Error("failed to reload configuration")
+			} else {
+				log.G(ctx).WithField("path", configPath).Info("reloaded configuration")
+			}
+		}
+	}
+}
+
+// startCredentialRefresh hands new credentials to the daemons before the temporary
+// credentials or signing material handed out to them expire.
+func startCredentialRefresh(ctx context.Context, managers []*mgr.Manager) {
+	go credentialRefreshLoop(ctx, func() error {
+		return refreshCredentials(managers)
+	})
+}
+
+// nextCredentialRefresh returns when the earliest temporary credentials, signing material,
+// token file, access token or SVID should be replaced, false if there are none.
+func nextCredentialRefresh() (time.Time, bool) {
+	next, ok := daemonconfig.NextSTSRefresh()
+	if t, signed := daemonconfig.NextSigningRefresh(); signed && (!ok || t.Before(next)) {
+		next, ok = t, true
+	}
+	if t, changed := daemonconfig.NextTokenFileRefresh(); changed && (!ok || t.Before(next)) {
+		next, ok = t, true
+	}
+	if t, exchanged := auth.NextIdentityTokenRefresh(); exchanged && (!ok || t.Before(next)) {
+		next, ok = t, true
+	}
+	if t, rotated := spiffe.NextRotation(); rotated && (!ok || t.Before(next)) {
+		next, ok = t, true
+	}
+	return next, ok
+}
+
+func credentialRefreshLoop(ctx context.Context, reload func() error) {
+	timer := time.NewTimer(credentialRefreshCheckInterval)
+	defer timer.Stop()
+
+	// Credentials no running instance uses anymore are not replaced by a refresh.
+	var refreshed time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			next, ok := nextCredentialRefresh()
+			if ok && !time.Now().Before(next) && !next.Equal(refreshed) {
+				if err := reload(); err != nil {
+					log.G(ctx).WithError(err).Error("failed to refresh temporary backend credentials")
+					timer.Reset(credentialRefreshCheckInterval)
+					continue
+				}
+				refreshed = next
+				log.G(ctx).Info("refreshed temporary backend credentials")
+				next, ok = nextCredentialRefresh()
+			}
+			timer.Reset(nextCredentialCheck(next, ok && !next.Equal(refreshed)))
+		}
+	}
+}
+
+// nextCredentialCheck returns how long to wait for the next check, at the latest when the
+// next credentials are due if there are any.
+func nextCredentialCheck(next time.Time, due bool) time.Duration {
+	wait := credentialRefreshCheckInterval
+	if due {
+		wait = min(wait, max(time.Until(next), time.Second))
+	}
+	return wait
+}
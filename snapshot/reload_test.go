@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2026. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigReloadLoop(t *testing.T) {
+	defer func(d time.Duration) { configReloadDelay = d }(configReloadDelay)
+	configReloadDelay = 50 * time.Millisecond
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "nydusd-config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte("{}"), 0600))
+
+	watcher, err := fsnotify.NewWatcher()
+	require.NoError(t, err)
+	require.NoError(t, watcher.Add(dir))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var reloads atomic.Int32
+	go configReloadLoop(ctx, watcher, configPath, func() error {
+		reloads.Add(1)
+		return nil
+	})
+
+	// Other files in the directory are ignored.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.json"), []byte("{}"), 0600))
+	time.Sleep(3 * configReloadDelay)
+	require.Zero(t, reloads.Load())
+
+	// A burst of writes results in a single reload.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, os.WriteFile(configPath, []byte("{ }"), 0600))
+	}
+	require.Eventually(t, func() bool { return reloads.Load() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(3 * configReloadDelay)
+	require.Equal(t, int32(1), reloads.Load())
+
+	// Replacing the file is picked up as well.
+	tmp := filepath.Join(dir, "nydusd-config.json.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("{}"), 0600))
+	require.NoError(t, os.Rename(tmp, configPath))
+	require.Eventually(t, func() bool { return reloads.Load() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWatchDir(t *testing.T) {
+	defer func(d time.Duration) { configReloadDelay = d }(configReloadDelay)
+	configReloadDelay = 50 * time.Millisecond
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "docker.io"), 0755))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var reloads atomic.Int32
+	require.NoError(t, watchDir(ctx, dir, func() error {
+		reloads.Add(1)
+		return nil
+	}))
+
+	// Files of existing host directories are watched.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker.io", "hosts.toml"), []byte(""), 0600))
+	require.Eventually(t, func() bool { return reloads.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// So are the ones of new host directories.
+	hostDir := filepath.Join(dir, "ghcr.io")
+	require.NoError(t, os.Mkdir(hostDir, 0755))
+	require.Eventually(t, func() bool { return reloads.Load() == 2 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(""), 0600))
+	require.Eventually(t, func() bool { return reloads.Load() == 3 }, time.Second, 10*time.Millisecond)
+
+	require.Error(t, watchDir(ctx, filepath.Join(dir, "missing"), func() error { return nil }))
+}
+
+func TestNextCredentialCheck(t *testing.T) {
+	require.Equal(t, credentialRefreshCheckInterval, nextCredentialCheck(time.Time{}, false))
+	require.Equal(t, credentialRefreshCheckInterval, nextCredentialCheck(time.Now().Add(time.Hour), true))
+	require.InDelta(t, float64(20*time.Second), float64(nextCredentialCheck(time.Now().Add(20*time.Second), true)), float64(time.Second))
+	require.Equal(t, time.Second, nextCredentialCheck(time.Now().Add(-time.Minute), true))
+}
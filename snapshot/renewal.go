@@ -17,29 +17,52 @@ import (
 	mgr "github.com/containerd/nydus-snapshotter/pkg/manager"
 )
 
+// How often credentials are checked for their expiry when refresh_expiring_credentials is set.
+// It is a variable so tests can substitute it.
+var expiringCredentialCheckInterval = 10 * time.Minute
+
 // startCredentialRenewal initializes the credential store, runs an initial
 // reconciliation, and starts a background goroutine that periodically
-// renews credentials and hot-reloads running nydusd daemons.
-func startCredentialRenewal(ctx context.Context, interval time.Duration, managers []*mgr.Manager) {
-	auth.InitCredentialStore(interval)
-	reconcileCredentials(ctx, managers)
+// renews credentials and hot-reloads running nydusd daemons. With
+// refreshExpiring, credentials about to expire, like ECR tokens, are
+// also renewed in between, or only them if interval is zero.
+func startCredentialRenewal(ctx context.Context, interval time.Duration, refreshExpiring bool, managers []*mgr.Manager) {
+	tick := interval
+	if refreshExpiring && (tick <= 0 || tick > expiringCredentialCheckInterval) {
+		tick = expiringCredentialCheckInterval
+	}
+	// Credentials are requested to be valid until they are all renewed again, the clamped
+	// tick only decides how often expiring ones are looked for.
+	storeInterval := interval
+	if storeInterval <= 0 {
+		storeInterval = tick
+	}
+	auth.InitCredentialStore(storeInterval)
+	reconcileCredentials(ctx, managers, false)
 
-	log.G(ctx).WithField("interval", interval).Info("credential renewal initialized")
-	go credentialRenewalLoop(ctx, interval, managers)
+	log.G(ctx).WithField("interval", interval).WithField("refresh_expiring", refreshExpiring).
+		Info("credential renewal initialized")
+	go credentialRenewalLoop(ctx, tick, interval, managers)
 }
 
 // credentialRenewalLoop is the background goroutine that periodically
-// reconciles and renews credentials.
-func credentialRenewalLoop(ctx context.Context, interval time.Duration, managers []*mgr.Manager) {
-	ticker := time.NewTicker(interval)
+// reconciles and renews credentials. Ticks between the renewals of all
+// credentials every interval only renew the expiring ones.
+func credentialRenewalLoop(ctx context.Context, tick, interval time.Duration, managers []*mgr.Manager) {
+	lastRenewal := time.Now()
+	ticker := time.NewTicker(tick)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			reconcileCredentials(ctx, managers)
+		case t := <-ticker.C:
+			all := interval > 0 && !t.Before(lastRenewal.Add(interval))
+			if all {
+				lastRenewal = t
+			}
+			reconcileCredentials(ctx, managers, !all)
 		}
 	}
 }
@@ -53,7 +76,9 @@ func credentialRenewalLoop(ctx context.Context, interval time.Duration, managers
 // - entry not in store, live in RAFS: add + hot-reload (fusedev only)
 // - entry not in store, not live in RAFS: nothing
 // - entry in store, not live in RAFS: evict
-func reconcileCredentials(ctx context.Context, managers []*mgr.Manager) {
+//
+// With onlyExpiring, entries in store are only renewed when they are about to expire.
+func reconcileCredentials(ctx context.Context, managers []*mgr.Manager, onlyExpiring bool) {
 	live := make(map[string]struct{})
 
 	for _, m := range managers {
@@ -70,11 +95,19 @@ func reconcileCredentials(ctx context.Context, managers []*mgr.Manager) {
 				live[r.ImageID] = struct{}{}
 
 				old := auth.GetStoredCredential(r.ImageID)
+				if onlyExpiring && old != nil && !auth.CredentialExpiring(r.ImageID) {
+					continue
+				}
 				log.L.WithField("ref", r.ImageID).Debug("renewing credential entry")
 				kc := auth.RenewCredential(r.ImageID)
 				if kc == nil || (old != nil && old.ToBase64() == kc.ToBase64()) {
 					continue
 				}
+				// Access tokens exchanged for identity tokens are replaced by reloading
+				// the daemon configurations, see nextCredentialRefresh.
+				if kc.IdentityToken != "" {
+					continue
+				}
 
 				if err := d.UpdateAuthConfig(r.SnapshotID, kc); err != nil {
 					log.G(ctx).WithError(err).WithField("daemon", d.ID()).
@@ -31,13 +31,17 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/cgroup"
 	v2 "github.com/containerd/nydus-snapshotter/pkg/cgroup/v2"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/fanout"
 	"github.com/containerd/nydus-snapshotter/pkg/index"
 	mgr "github.com/containerd/nydus-snapshotter/pkg/manager"
+	"github.com/containerd/nydus-snapshotter/pkg/metacache"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+	"github.com/containerd/nydus-snapshotter/pkg/mirrorcrd"
 	"github.com/containerd/nydus-snapshotter/pkg/pprof"
 	"github.com/containerd/nydus-snapshotter/pkg/referrer"
+	"github.com/containerd/nydus-snapshotter/pkg/remote"
 	"github.com/containerd/nydus-snapshotter/pkg/system"
 	"github.com/containerd/nydus-snapshotter/pkg/tarfs"
 
@@ -47,6 +51,8 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/label"
 	"github.com/containerd/nydus-snapshotter/pkg/signature"
 	"github.com/containerd/nydus-snapshotter/pkg/snapshot"
+	"github.com/containerd/nydus-snapshotter/pkg/spiffe"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/redact"
 )
 
 var _ snapshots.Snapshotter = &snapshotter{}
@@ -98,13 +104,50 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		}
 	}
 
+	for name, s := range cfg.RemoteConfig.Signers {
+		daemonconfig.RegisterRequestSigner(name, &daemonconfig.ExecSigner{Path: s.Path, Args: s.Args, Timeout: s.Timeout})
+	}
+	if cfg.RemoteConfig.VaultConfig.Address != "" {
+		s, err := daemonconfig.NewVaultSigner(cfg.RemoteConfig.VaultConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "create vault signer")
+		}
+		daemonconfig.RegisterRequestSigner(daemonconfig.VaultSignerName, s)
+	}
+	if sc := cfg.RemoteConfig.SpiffeConfig; sc.WorkloadAPISocket != "" {
+		if err := spiffe.InitX509Source(ctx, sc.WorkloadAPISocket, sc.SpiffeID, filepath.Join(cfg.Root, "spiffe")); err != nil {
+			return nil, errors.Wrap(err, "initialize SPIFFE X.509 SVID source")
+		}
+	}
+	if dc := cfg.RemoteConfig.MirrorsConfig.Discovery; len(dc.SRV) > 0 {
+		daemonconfig.InitMirrorDiscovery(ctx, dc)
+	}
+	if mc := cfg.RemoteConfig.MirrorsConfig; mc.LatencyProbeInterval > 0 {
+		daemonconfig.InitMirrorProber(ctx, mc)
+	}
+	if mc := cfg.RemoteConfig.MirrorsConfig; mc.Kubernetes.Enable {
+		if err := mirrorcrd.InitController(ctx, mc.Kubernetes, mc.Dir); err != nil {
+			return nil, errors.Wrap(err, "initialize NydusMirrorConfig controller")
+		}
+	}
+	if mc := cfg.RemoteConfig.MirrorsConfig; mc.FanOut.Enable {
+		if err := fanout.InitFanOut(ctx, mc.FanOut, daemonconfig.DragonflyProxyAddress(mc.Dragonfly),
+			filepath.Join(cfg.Root, "fanout")); err != nil {
+			return nil, errors.Wrap(err, "initialize fan-out of prefetched blobs")
+		}
+	}
+	if mc := cfg.RemoteConfig.MirrorsConfig; mc.Dir != "" {
+		// Probing the mirrors must not delay the startup.
+		go daemonconfig.CheckMirrorsConfig(mc)
+	}
+
 	var skipSSLVerify bool
 	var daemonConfig *daemonconfig.DaemonConfig
 	fsDriver := config.GetFsDriver()
 	if fsDriver == config.FsDriverFscache || fsDriver == config.FsDriverFusedev {
-		config, err := daemonconfig.NewDaemonConfig(config.GetFsDriver(), cfg.DaemonConfig.NydusdConfigPath)
+		config, err := loadDaemonConfigTemplate(cfg)
 		if err != nil {
-			return nil, errors.Wrap(err, "load daemon configuration")
+			return nil, err
 		}
 		daemonConfig = &config
 		_, backendConfig := config.StorageBackend()
@@ -206,6 +249,19 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		log.L.Infof("Started metrics HTTP server on %q", cfg.MetricsConfig.Address)
 	}
 
+	// Start before daemons are recovered, which may send their requests to it.
+	if m := cfg.RemoteConfig.MetadataCacheConfig; m.Address != "" {
+		if err := metacache.InitCache(ctx, m.Address,
+			metacache.WithTTL(m.TTL),
+			metacache.WithMaxEntries(m.MaxEntries),
+			metacache.WithInsecure(cfg.RemoteConfig.SkipSSLVerify),
+		); err != nil {
+			return nil, errors.Wrap(err, "start metadata cache")
+		}
+
+		log.L.Infof("Started metadata cache on %q", m.Address)
+	}
+
 	opts := []filesystem.NewFSOpt{
 		filesystem.WithManagers(fsManagers),
 		filesystem.WithNydusdBinaryPath(cfg.DaemonConfig.NydusdPath),
@@ -248,11 +304,45 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		return nil, errors.Wrap(err, "initialize filesystem thin layer")
 	}
 
+	if cfg.RemoteConfig.MetadataCacheConfig.Address != "" {
+		for _, m := range fsManagers {
+			m.AllowMetadataCacheHosts()
+		}
+	}
+
 	// Start credential renewal after NewFileSystem, which calls Manager.Recover()
 	// and populates the daemon caches from the DB. Starting earlier would cause
 	// the initial reconciliation to see empty managers on restart.
-	if interval := cfg.RemoteConfig.AuthConfig.CredentialRenewalInterval; interval > 0 {
-		startCredentialRenewal(ctx, interval, fsManagers)
+	authConfig := cfg.RemoteConfig.AuthConfig
+	// Tokens of the GCP metadata server and ACR live a few hours at most.
+	refreshExpiring := authConfig.RefreshExpiringCredentials || authConfig.EnableGCPWorkloadIdentity ||
+		authConfig.EnableAzureManagedIdentity
+	if authConfig.CredentialRenewalInterval > 0 || refreshExpiring {
+		startCredentialRenewal(ctx, authConfig.CredentialRenewalInterval, refreshExpiring, fsManagers)
+	}
+
+	if daemonConfig != nil {
+		if cfg.DaemonConfig.ReloadConfigOnChange {
+			if err := startConfigReloadWatcher(ctx, cfg, fsManagers); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.RemoteConfig.AuthConfig.AuthFile != "" {
+			if err := startAuthFileWatcher(ctx, cfg, fsManagers); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.RemoteConfig.MirrorsConfig.Dir != "" {
+			if err := startMirrorsWatcher(ctx, cfg, fsManagers); err != nil {
+				log.L.WithError(err).Warn("mirrors configuration is not reloaded on change")
+			}
+		}
+		startCredentialRefresh(ctx, fsManagers)
+		if mc := cfg.RemoteConfig.MirrorsConfig; mc.Failback.Enable {
+			daemonconfig.InitMirrorFailback(ctx, mc, func(recovered []string) error {
+				return failBackMirrors(fsManagers, recovered)
+			})
+		}
 	}
 
 	if config.IsSystemControllerEnabled() {
@@ -260,6 +350,11 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		if err != nil {
 			return nil, errors.Wrap(err, "create system controller")
 		}
+		if daemonConfig != nil {
+			systemController.SetConfigReloader(func() error {
+				return reloadDaemonConfig(cfg, fsManagers)
+			})
+		}
 
 		go func() {
 			if err := systemController.Run(); err != nil {
@@ -506,14 +601,17 @@ func (o *snapshotter) Prepare(ctx context.Context, key, parent string, opts ...s
 		return nil, err
 	}
 
-	logger.Debugf("[Prepare] snapshot with labels %v", info.Labels)
+	logger.Debugf("[Prepare] snapshot with labels %v", redact.Labels(info.Labels))
 
 	processor, target, commitLabels, err := chooseProcessor(ctx, logger, o, s, key, parent, info.Labels, func() string { return o.upperPath(s.ID) })
 	if err != nil {
-		return nil, err
+		return nil, o.labelRemoteError(ctx, key, err)
 	}
 
 	needCommit, mounts, err := processor()
+	if err != nil {
+		err = o.labelRemoteError(ctx, key, err)
+	}
 
 	if needCommit {
 		err := o.Commit(ctx, target, key, append(opts, snapshots.WithLabels(commitLabels))...)
@@ -525,6 +623,28 @@ func (o *snapshotter) Prepare(ctx context.Context, key, parent string, opts ...s
 	return mounts, err
 }
 
+// labelRemoteError states the class of a registry error failing the preparation of the
+// snapshot in the returned error, which CRI reports, so that e.g. wrong credentials are
+// told apart from an unreachable registry. The class is also recorded in the labels of the
+// snapshot, if it still exists.
+func (o *snapshotter) labelRemoteError(ctx context.Context, key string, err error) error {
+	class := remote.ClassifyError(err)
+	if class == remote.ErrorClassUnknown {
+		return err
+	}
+	err = errors.Wrapf(err, "%s (%s)", class.Describe(), class)
+
+	if _, serr := o.Stat(ctx, key); serr != nil {
+		log.G(ctx).WithError(serr).Debugf("not labeling snapshot %s with registry error", key)
+		return err
+	}
+	info := snapshots.Info{Name: key, Labels: map[string]string{label.NydusRemoteError: string(class)}}
+	if _, uerr := o.Update(ctx, info, "labels."+label.NydusRemoteError); uerr != nil {
+		return errors.Wrapf(err, "label snapshot %s with registry error: %v", key, uerr)
+	}
+	return err
+}
+
 // The work on supporting View operation for nydus-snapshotter is divided into 2 parts:
 // 1. View on the topmost layer of nydus images or zran images
 // 2. View on the any layer of nydus images or zran images
@@ -15,7 +15,9 @@ import (
 	"github.com/containerd/containerd/v2/core/mount"
 	"github.com/containerd/containerd/v2/core/snapshots"
 	"github.com/containerd/containerd/v2/core/snapshots/storage"
+	"github.com/containerd/errdefs"
 	"github.com/containerd/nydus-snapshotter/pkg/label"
+	remoteerrors "github.com/containerd/nydus-snapshotter/pkg/remote/remotes/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -270,3 +272,37 @@ func TestMountNativeConfigVolatile(t *testing.T) {
 		assert.NotContains(t, mounts[0].Options, "volatile")
 	})
 }
+
+func TestLabelRemoteError(t *testing.T) {
+	ms, err := storage.NewMetaStore(filepath.Join(t.TempDir(), "metadata.db"))
+	require.NoError(t, err)
+	defer ms.Close()
+	s := &snapshotter{ms: ms}
+
+	ctx := context.Background()
+	tctx, tx, err := ms.TransactionContext(ctx, true)
+	require.NoError(t, err)
+	_, err = storage.CreateSnapshot(tctx, snapshots.KindActive, "active", "")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	// Preparing the snapshot failed before it was committed, the snapshot is labeled.
+	unauthorized := remoteerrors.ErrUnexpectedStatus{StatusCode: 401}
+	err = s.labelRemoteError(ctx, "active", unauthorized)
+	var status remoteerrors.ErrUnexpectedStatus
+	require.ErrorAs(t, err, &status)
+	require.Contains(t, err.Error(), "(unauthorized)")
+	info, err := s.Stat(ctx, "active")
+	require.NoError(t, err)
+	require.Equal(t, "unauthorized", info.Labels[label.NydusRemoteError])
+
+	// The class is still stated for a snapshot which is gone.
+	err = s.labelRemoteError(ctx, "removed", unauthorized)
+	require.Contains(t, err.Error(), "(unauthorized)")
+	_, err = s.Stat(ctx, "removed")
+	require.True(t, errdefs.IsNotFound(err))
+
+	// Errors of other classes are returned as is.
+	other := fmt.Errorf("invalid manifest")
+	require.Equal(t, other, s.labelRemoteError(ctx, "active", other))
+}